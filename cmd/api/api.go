@@ -6,6 +6,7 @@ import (
 
 	"github.com/LincolnG4/Haku/internal/auth"
 	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/LincolnG4/Haku/internal/task"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"go.uber.org/zap"
@@ -16,13 +17,21 @@ type application struct {
 	store         store.Storage
 	authenticator auth.Authenticator
 	logger        *zap.SugaredLogger
+	tasks         *task.Registry
+	executor      *task.Executor
 }
 
 type config struct {
-	addr string `validate:"required"`
-	db   dbConfig
-	env  string
-	auth authConfig
+	addr   string `validate:"required"`
+	db     dbConfig
+	env    string
+	auth   authConfig
+	worker workerConfig
+}
+
+type workerConfig struct {
+	concurrency int
+	queueSize   int
 }
 
 type authConfig struct {
@@ -75,15 +84,53 @@ func (app *application) mount() http.Handler {
 				router.Get("/", app.getPipelineHandler)
 				router.Patch("/", app.updatePipelineHandler)
 				router.Delete("/", app.deletePipelineHandler)
+
+				// Task
+				router.Route("/tasks", func(router chi.Router) {
+					router.Post("/", app.createTaskHandler)
+					router.Get("/", app.getTasksHandler)
+
+					router.Route("/{taskID}", func(router chi.Router) {
+						router.Use(app.taskContextMiddleware)
+						router.Get("/", app.getTaskHandler)
+						router.Patch("/", app.updateTaskHandler)
+						router.Delete("/", app.deleteTaskHandler)
+						router.Post("/preview", app.previewTaskHandler)
+						router.Get("/profile", app.getProfileHistoryHandler)
+
+						router.Route("/runs", func(router chi.Router) {
+							router.Post("/", app.createTaskRunHandler)
+							router.Get("/", app.getTaskRunsHandler)
+							router.Get("/{runID}", app.getTaskRunHandler)
+							router.Get("/{runID}/quality", app.getQualityResultsHandler)
+							router.Get("/{runID}/profile", app.getRunProfileHandler)
+						})
+
+						router.Route("/watermark", func(router chi.Router) {
+							router.Get("/", app.getWatermarkHandler)
+							router.Put("/", app.setWatermarkHandler)
+							router.Delete("/", app.resetWatermarkHandler)
+						})
+
+						router.Route("/checkpoint", func(router chi.Router) {
+							router.Get("/", app.getCheckpointHandler)
+							router.Delete("/", app.discardCheckpointHandler)
+						})
+
+						router.Route("/manifest", func(router chi.Router) {
+							router.Get("/", app.getFileManifestHandler)
+							router.Post("/reingest", app.reingestFilesHandler)
+						})
+					})
+				})
 			})
 		})
 
-		// Task
-		// router.Route("/Tasks", func(router chi.Router) {
-		// 	router.Route("/{taskID}", func(router chi.Router) {
-		// 		router.Post("/", app.createPipelineHandler)
-		// 	})
-		// })
+		// Lineage
+		router.Route("/lineage", func(router chi.Router) {
+			router.Use(app.AuthTokenMiddleware)
+			router.Get("/", app.getLineageHandler)
+		})
 
 		// User
 		router.Route("/users", func(router chi.Router) {
@@ -108,6 +155,18 @@ func (app *application) mount() http.Handler {
 					router.Post("/", app.addMemberHandler)
 					router.Get("/", app.getMembersHandler)
 				})
+
+				router.Route("/connections", func(router chi.Router) {
+					router.Post("/", app.createConnectionHandler)
+					router.Get("/", app.getConnectionsHandler)
+					router.Delete("/{connectionID}", app.deleteConnectionHandler)
+				})
+
+				router.Route("/secrets", func(router chi.Router) {
+					router.Post("/", app.createSecretHandler)
+					router.Get("/", app.getSecretsHandler)
+					router.Delete("/{secretID}", app.deleteSecretHandler)
+				})
 			})
 
 		})
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/LincolnG4/Haku/internal/task"
+	"github.com/LincolnG4/Haku/internal/utils"
+)
+
+// getCheckpointHandler returns the checkpoint the next run of the task
+// resumes from.
+func (app *application) getCheckpointHandler(w http.ResponseWriter, r *http.Request) {
+	t := getTaskFromContext(r)
+
+	checkpoint, err := task.GetCheckpoint(r.Context(), app.store, t.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusOK, checkpoint); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// discardCheckpointHandler removes the checkpoint and the output it kept,
+// the next run starts over.
+func (app *application) discardCheckpointHandler(w http.ResponseWriter, r *http.Request) {
+	t := getTaskFromContext(r)
+
+	if err := task.DiscardCheckpoint(r.Context(), app.store, t.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/LincolnG4/Haku/internal/utils"
+)
+
+type CreateConnectionPayload struct {
+	Name string `json:"name" validate:"required,max=255"`
+	Type string `json:"type" validate:"required,oneof=postgres"`
+	DSN  string `json:"dsn" validate:"required"`
+}
+
+func (app *application) createConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	organization := app.getOrganizationFromContext(r)
+
+	user := getUserFromContext(r)
+	if !app.isUserAdmin(r.Context(), organization.ID, user.ID) {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	var payload CreateConnectionPayload
+	if err := utils.ReadJson(r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	conn := &store.Connection{
+		OrganizationID: organization.ID,
+		Name:           payload.Name,
+		Type:           payload.Type,
+		DSN:            payload.DSN,
+	}
+
+	if err := app.store.Connections.Create(ctx, conn); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusCreated, conn); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	organization := app.getOrganizationFromContext(r)
+
+	user := getUserFromContext(r)
+	if !app.isUserMemberOfOrganization(r.Context(), organization.ID, user.ID) {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	conns, err := app.store.Connections.GetByOrganization(ctx, organization.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusOK, conns); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) deleteConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	organization := app.getOrganizationFromContext(r)
+
+	user := getUserFromContext(r)
+	if !app.isUserAdmin(r.Context(), organization.ID, user.ID) {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	connID, err := utils.GetURLParamInt64(r, "connectionID")
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	conn, err := app.store.Connections.GetByID(ctx, connID)
+	if err == nil && conn.OrganizationID != organization.ID {
+		err = store.ErrNotFound
+	}
+	if err == nil {
+		err = app.store.Connections.Delete(ctx, connID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
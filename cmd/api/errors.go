@@ -42,3 +42,13 @@ func (app *application) unauthorizedErrorResponse(w http.ResponseWriter, r *http
 	app.logger.Warnf("unauthorized error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
 	utils.WriteJsonError(w, http.StatusUnauthorized, "unauthorized")
 }
+
+func (app *application) serviceUnavailableResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("service unavailable", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	utils.WriteJsonError(w, http.StatusServiceUnavailable, err.Error())
+}
+
+func (app *application) conflictResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("conflict", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	utils.WriteJsonError(w, http.StatusConflict, err.Error())
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/LincolnG4/Haku/internal/task"
+	"github.com/LincolnG4/Haku/internal/utils"
+)
+
+const defaultLineageDepth = 10
+
+type LineageQuery struct {
+	OrganizationID int64  `validate:"required,min=1"`
+	Dataset        string `validate:"required"`
+	Connection     string
+	Direction      string `validate:"oneof=upstream downstream both"`
+	Depth          int    `validate:"min=1,max=50"`
+}
+
+// getLineageHandler returns the tasks a dataset comes from and the ones it
+// feeds, across the pipelines of an organization. The dataset is a file
+// path or a table, with the connection to tell tables of the same name
+// apart.
+func (app *application) getLineageHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := LineageQuery{
+		Dataset:    params.Get("dataset"),
+		Connection: params.Get("connection"),
+		Direction:  params.Get("direction"),
+		Depth:      defaultLineageDepth,
+	}
+	if query.Direction == "" {
+		query.Direction = task.LineageBoth
+	}
+
+	var err error
+	if v := params.Get("organization_id"); v != "" {
+		if query.OrganizationID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			app.badRequestError(w, r, fmt.Errorf("invalid organization_id: %w", err))
+			return
+		}
+	}
+	if v := params.Get("depth"); v != "" {
+		if query.Depth, err = strconv.Atoi(v); err != nil {
+			app.badRequestError(w, r, fmt.Errorf("invalid depth: %w", err))
+			return
+		}
+	}
+
+	if err := utils.Validate.Struct(query); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+	if !app.isUserMemberOfOrganization(ctx, query.OrganizationID, user.ID) {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	dataset := store.Dataset{Connection: query.Connection, Name: query.Dataset}
+	lineage, err := task.TraceLineage(ctx, app.store, query.OrganizationID, dataset, query.Direction, query.Depth)
+	if err != nil {
+		switch {
+		case errors.Is(err, task.ErrUnknownDataset):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusOK, lineage); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/LincolnG4/Haku/internal/auth"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/LincolnG4/Haku/internal/task"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestLineageHandler(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+
+	member := &store.User{ID: 1, Username: "haku", Email: "haku@ghibli.com"}
+	outsider := &store.User{ID: 2, Username: "kaonashi", Email: "kaonashi@ghibli.com"}
+	app.store.Users.Create(nil, member)
+	app.store.Users.Create(nil, outsider)
+	app.store.Organizations.Create(nil, &store.Organization{ID: 1, Name: "bathhouse"})
+	app.store.Organizations.AddMember(nil, &store.OrganizationMember{UserID: member.ID, OrganizationID: 1, RoleID: store.AdminRole})
+	app.store.Pipelines.Create(nil, &store.Pipelines{ID: 1, OrganizationID: 1, Name: "bathhouse"})
+	app.store.Tasks.Create(nil, &store.Task{ID: 1, PipelineID: 1, Name: "extract"})
+	app.store.Tasks.Create(nil, &store.Task{ID: 2, PipelineID: 1, Name: "clean"})
+	app.store.Lineage.Create(nil, []store.RunDataset{
+		{RunID: 1, TaskID: 1, Access: store.DatasetRead, Dataset: store.Dataset{Connection: "db", Name: "public.orders"}},
+		{RunID: 1, TaskID: 1, Access: store.DatasetWrite, Dataset: store.Dataset{Name: "/data/orders.jsonl"}},
+		{RunID: 2, TaskID: 2, Access: store.DatasetRead, Dataset: store.Dataset{Name: "/data/orders.jsonl"}},
+		{RunID: 2, TaskID: 2, Access: store.DatasetWrite, Dataset: store.Dataset{Name: "/data/clean.jsonl"}},
+	})
+
+	newRequest := func(user *store.User, query string) *http.Request {
+		claims := &auth.MyClaims{
+			UserID:   user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:  fmt.Sprintf("%d", user.ID),
+				Issuer:   "test-aud",
+				Audience: []string{"test-aud"},
+			},
+		}
+		token, _ := app.authenticator.GenerateToken(claims)
+		req, _ := http.NewRequest(http.MethodGet, "/v1/lineage?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+
+	t.Run("reject missing dataset", func(t *testing.T) {
+		rr := executeRequest(mux, newRequest(member, "organization_id=1"))
+		checkCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("reject invalid direction", func(t *testing.T) {
+		rr := executeRequest(mux, newRequest(member, "organization_id=1&dataset=/data/orders.jsonl&direction=sideways"))
+		checkCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("forbid non-member", func(t *testing.T) {
+		rr := executeRequest(mux, newRequest(outsider, "organization_id=1&dataset=/data/orders.jsonl"))
+		checkCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("unknown dataset", func(t *testing.T) {
+		rr := executeRequest(mux, newRequest(member, "organization_id=1&dataset=/data/nope.jsonl"))
+		checkCode(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("trace both directions", func(t *testing.T) {
+		rr := executeRequest(mux, newRequest(member, "organization_id=1&dataset=/data/orders.jsonl"))
+		checkCode(t, http.StatusOK, rr.Code)
+
+		var body struct {
+			Data task.Lineage `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if len(body.Data.Upstream) != 1 || body.Data.Upstream[0].TaskName != "extract" {
+			t.Errorf("upstream = %+v, want extract", body.Data.Upstream)
+		}
+		if len(body.Data.Downstream) != 1 || body.Data.Downstream[0].TaskName != "clean" {
+			t.Errorf("downstream = %+v, want clean", body.Data.Downstream)
+		}
+	})
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"os"
 	"time"
 
 	"github.com/LincolnG4/Haku/internal/auth"
 	"github.com/LincolnG4/Haku/internal/db"
 	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/LincolnG4/Haku/internal/task"
 	"github.com/LincolnG4/Haku/internal/utils"
 	"go.uber.org/zap"
 )
@@ -34,6 +36,10 @@ func main() {
 				iss:        "Haku",
 			},
 		},
+		worker: workerConfig{
+			concurrency: utils.GetEnvInt("WORKER_CONCURRENCY", 4),
+			queueSize:   utils.GetEnvInt("WORKER_QUEUE_SIZE", 100),
+		},
 	}
 
 	// Logger
@@ -50,12 +56,19 @@ func main() {
 	store := store.NewPostgresStorage(db)
 	jwtAuthenticator := auth.NewJWTAuthenticator(cfg.auth.token.secret, cfg.auth.token.iss, cfg.auth.token.iss)
 
+	// Setup task execution
+	registry := newTaskRegistry(store)
+	executor := task.NewExecutor(store, registry, logger, cfg.worker.concurrency, cfg.worker.queueSize)
+	executor.Start(context.Background())
+
 	// Setup API server
 	app := application{
 		config:        cfg,
 		store:         store,
 		authenticator: jwtAuthenticator,
 		logger:        logger,
+		tasks:         registry,
+		executor:      executor,
 	}
 
 	// Start server
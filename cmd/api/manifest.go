@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/LincolnG4/Haku/internal/utils"
+)
+
+func (app *application) getFileManifestHandler(w http.ResponseWriter, r *http.Request) {
+	t := getTaskFromContext(r)
+
+	ctx := r.Context()
+	entries, err := app.store.FileManifest.GetByTask(ctx, t.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusOK, entries); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type ReingestFilesPayload struct {
+	EntryIDs []int64 `json:"entry_ids" validate:"required,min=1"`
+}
+
+// reingestFilesHandler removes manifest entries so that the next run of
+// the task ingests their files again.
+func (app *application) reingestFilesHandler(w http.ResponseWriter, r *http.Request) {
+	t := getTaskFromContext(r)
+
+	var payload ReingestFilesPayload
+	if err := utils.ReadJson(r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	removed, err := app.store.FileManifest.Delete(ctx, t.ID, payload.EntryIDs)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	data := map[string]int64{
+		"reingest": removed,
+	}
+	if err := utils.JsonResponse(w, http.StatusOK, data); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
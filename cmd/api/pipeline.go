@@ -14,7 +14,8 @@ type pipelineKey string
 const pipelineCtx pipelineKey = "pipeline"
 
 type CreatePipelinePayload struct {
-	Name string `json:"name" validate:"required,max=255"`
+	Name           string `json:"name" validate:"required,max=255"`
+	OrganizationID int64  `json:"organization_id" validate:"required"`
 }
 
 func (app *application) createPipelineHandler(w http.ResponseWriter, r *http.Request) {
@@ -32,8 +33,13 @@ func (app *application) createPipelineHandler(w http.ResponseWriter, r *http.Req
 	user := getUserFromContext(r)
 
 	ctx := r.Context()
+	if !app.isUserMemberOfOrganization(ctx, payload.OrganizationID, user.ID) {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
 	pipeline := &store.Pipelines{
-		OrganizationID: user.ID,
+		OrganizationID: payload.OrganizationID,
 		Name:           payload.Name,
 	}
 
@@ -113,6 +119,8 @@ func (app *application) updatePipelineHandler(w http.ResponseWriter, r *http.Req
 
 }
 
+// pipelineContextMiddleware loads the pipeline of the route for the members
+// of its organization, which every route under it relies on.
 func (app *application) pipelineContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		pipelineID, err := utils.GetURLParamInt64(r, "pipelineID")
@@ -133,7 +141,13 @@ func (app *application) pipelineContextMiddleware(next http.Handler) http.Handle
 			return
 		}
 
-		ctx = context.WithValue(ctx, pipelineCtx, pipeline)
+		user := getUserFromContext(r)
+		if !app.isUserMemberOfOrganization(ctx, pipeline.OrganizationID, user.ID) {
+			app.forbiddenResponse(w, r)
+			return
+		}
+
+		ctx = context.WithValue(ctx, pipelineCtx, &pipeline)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
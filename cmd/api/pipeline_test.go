@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/LincolnG4/Haku/internal/auth"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestPipelineAuthorization(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+
+	admin := &store.User{ID: 1, Username: "yubaba", Email: "yubaba@ghibli.com"}
+	member := &store.User{ID: 2, Username: "lin", Email: "lin@ghibli.com"}
+	outsider := &store.User{ID: 3, Username: "kaonashi", Email: "kaonashi@ghibli.com"}
+	for _, user := range []*store.User{admin, member, outsider} {
+		app.store.Users.Create(nil, user)
+	}
+	app.store.Organizations.Create(nil, &store.Organization{ID: 1, Name: "bathhouse"})
+	app.store.Organizations.AddMember(nil, &store.OrganizationMember{UserID: admin.ID, OrganizationID: 1, RoleID: store.AdminRole})
+	app.store.Organizations.AddMember(nil, &store.OrganizationMember{UserID: member.ID, OrganizationID: 1, RoleID: 2}) // 2 = not admin
+	app.store.Pipelines.Create(nil, &store.Pipelines{ID: 1, OrganizationID: 1, Name: "bathhouse"})
+	app.store.Tasks.Create(nil, &store.Task{ID: 1, PipelineID: 1, Type: "shell.exec", Config: []byte(`{"command": "echo"}`)})
+
+	newRequest := func(user *store.User, method, path, body string) *http.Request {
+		claims := &auth.MyClaims{
+			UserID:   user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:  fmt.Sprintf("%d", user.ID),
+				Issuer:   "test-aud",
+				Audience: []string{"test-aud"},
+			},
+		}
+		token, _ := app.authenticator.GenerateToken(claims)
+		req, _ := http.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+
+	t.Run("forbid non-member from the routes of a pipeline", func(t *testing.T) {
+		for _, req := range []*http.Request{
+			newRequest(outsider, http.MethodGet, "/v1/pipelines/1", ""),
+			newRequest(outsider, http.MethodGet, "/v1/pipelines/1/tasks", ""),
+			newRequest(outsider, http.MethodPost, "/v1/pipelines/1/tasks/1/runs", ""),
+			newRequest(outsider, http.MethodPatch, "/v1/pipelines/1/tasks/1", `{"config": {"command": "rm"}}`),
+		} {
+			rr := executeRequest(mux, req)
+			checkCode(t, http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("forbid non-member from creating a pipeline in the organization", func(t *testing.T) {
+		rr := executeRequest(mux, newRequest(outsider, http.MethodPost, "/v1/pipelines", `{"name": "p", "organization_id": 1}`))
+		checkCode(t, http.StatusForbidden, rr.Code)
+
+		rr = executeRequest(mux, newRequest(member, http.MethodPost, "/v1/pipelines", `{"name": "p", "organization_id": 1}`))
+		checkCode(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("allow member to read the pipeline", func(t *testing.T) {
+		rr := executeRequest(mux, newRequest(member, http.MethodGet, "/v1/pipelines/1/tasks", ""))
+		checkCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("only admins configure shell commands", func(t *testing.T) {
+		rr := executeRequest(mux, newRequest(member, http.MethodPost, "/v1/pipelines/1/tasks", `{"name": "t", "type": "shell.exec", "config": {"command": "id"}}`))
+		checkCode(t, http.StatusForbidden, rr.Code)
+
+		rr = executeRequest(mux, newRequest(member, http.MethodPatch, "/v1/pipelines/1/tasks/1", `{"config": {"command": "id"}}`))
+		checkCode(t, http.StatusForbidden, rr.Code)
+
+		rr = executeRequest(mux, newRequest(admin, http.MethodPost, "/v1/pipelines/1/tasks", `{"name": "t", "type": "shell.exec", "config": {"command": "id"}}`))
+		checkCode(t, http.StatusCreated, rr.Code)
+	})
+}
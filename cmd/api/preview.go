@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/task"
+	"github.com/LincolnG4/Haku/internal/utils"
+)
+
+// maxPreviewTimeout keeps previews under the timeout of API requests.
+const maxPreviewTimeout = 50 * time.Second
+
+type PreviewTaskPayload struct {
+	Limit   int    `json:"limit" validate:"omitempty,min=1,max=1000"`
+	Timeout string `json:"timeout"`
+}
+
+// previewTaskHandler runs a task, and the upstream tasks it reads from, on
+// the first records of its source and returns what it would write.
+func (app *application) previewTaskHandler(w http.ResponseWriter, r *http.Request) {
+	t := getTaskFromContext(r)
+
+	var payload PreviewTaskPayload
+	if err := utils.ReadJson(r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	limit := payload.Limit
+	if limit == 0 {
+		limit = task.DefaultPreviewLimit
+	}
+
+	timeout := task.DefaultPreviewTimeout
+	if payload.Timeout != "" {
+		d, err := time.ParseDuration(payload.Timeout)
+		if err != nil || d <= 0 || d > maxPreviewTimeout {
+			app.badRequestError(w, r, fmt.Errorf("timeout must be a duration up to %s", maxPreviewTimeout))
+			return
+		}
+		timeout = d
+	}
+
+	ctx := r.Context()
+	preview, err := task.PreviewTask(ctx, app.store, app.tasks, *t, limit, timeout)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("preview timed out after %s", timeout)
+		}
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusOK, preview); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/LincolnG4/Haku/internal/utils"
+)
+
+// getRunProfileHandler lists the column profiles of a profile run.
+func (app *application) getRunProfileHandler(w http.ResponseWriter, r *http.Request) {
+	t := getTaskFromContext(r)
+
+	runID, err := utils.GetURLParamInt64(r, "runID")
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	run, err := app.store.TaskRuns.GetByID(ctx, runID)
+	if err == nil && run.TaskID != t.ID {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	profiles, err := app.store.ColumnProfiles.GetByRun(ctx, run.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusOK, profiles); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getProfileHistoryHandler lists the profiles of the column given by the
+// column query parameter across the runs of a task, most recent first.
+func (app *application) getProfileHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	t := getTaskFromContext(r)
+
+	column := r.URL.Query().Get("column")
+	if column == "" {
+		app.badRequestError(w, r, fmt.Errorf("column is required"))
+		return
+	}
+
+	profiles, err := app.store.ColumnProfiles.GetByTask(r.Context(), t.ID, column)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusOK, profiles); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
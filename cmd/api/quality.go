@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/LincolnG4/Haku/internal/utils"
+)
+
+// getQualityResultsHandler lists the check results of a quality.check run.
+func (app *application) getQualityResultsHandler(w http.ResponseWriter, r *http.Request) {
+	t := getTaskFromContext(r)
+
+	runID, err := utils.GetURLParamInt64(r, "runID")
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	run, err := app.store.TaskRuns.GetByID(ctx, runID)
+	if err == nil && run.TaskID != t.ID {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	results, err := app.store.QualityResults.GetByRun(ctx, run.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusOK, results); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/LincolnG4/Haku/internal/utils"
+)
+
+type CreateSecretPayload struct {
+	Name  string `json:"name" validate:"required,max=255"`
+	Value string `json:"value" validate:"required"`
+}
+
+func (app *application) createSecretHandler(w http.ResponseWriter, r *http.Request) {
+	organization := app.getOrganizationFromContext(r)
+
+	user := getUserFromContext(r)
+	if !app.isUserAdmin(r.Context(), organization.ID, user.ID) {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	var payload CreateSecretPayload
+	if err := utils.ReadJson(r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	secret := &store.Secret{
+		OrganizationID: organization.ID,
+		Name:           payload.Name,
+		Value:          payload.Value,
+	}
+
+	if err := app.store.Secrets.Create(ctx, secret); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusCreated, secret); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	organization := app.getOrganizationFromContext(r)
+
+	user := getUserFromContext(r)
+	if !app.isUserMemberOfOrganization(r.Context(), organization.ID, user.ID) {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	secrets, err := app.store.Secrets.GetByOrganization(ctx, organization.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusOK, secrets); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) deleteSecretHandler(w http.ResponseWriter, r *http.Request) {
+	organization := app.getOrganizationFromContext(r)
+
+	user := getUserFromContext(r)
+	if !app.isUserAdmin(r.Context(), organization.ID, user.ID) {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	secretID, err := utils.GetURLParamInt64(r, "secretID")
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	secret, err := app.store.Secrets.GetByID(ctx, secretID)
+	if err == nil && secret.OrganizationID != organization.ID {
+		err = store.ErrNotFound
+	}
+	if err == nil {
+		err = app.store.Secrets.Delete(ctx, secretID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
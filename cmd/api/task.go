@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/LincolnG4/Haku/internal/task"
+	"github.com/LincolnG4/Haku/internal/utils"
+)
+
+type taskKey string
+
+const taskCtx taskKey = "task"
+
+type CreateTaskPayload struct {
+	Name        string          `json:"name" validate:"required,max=255"`
+	Description string          `json:"description" validate:"max=500"`
+	UiDisplay   int             `json:"ui_display"`
+	Type        string          `json:"type" validate:"required,max=255"`
+	Config      json.RawMessage `json:"config" validate:"required"`
+	// DriftPolicy is one of store.DriftIgnore, DriftWarn, DriftFail or
+	// DriftEvolve, warn by default.
+	DriftPolicy string `json:"drift_policy" validate:"omitempty,oneof=ignore warn fail evolve"`
+}
+
+func (app *application) createTaskHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateTaskPayload
+	if err := utils.ReadJson(r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	pipeline := getPipelineFromContext(r)
+
+	ctx := r.Context()
+	if !app.canConfigure(r, pipeline, payload.Type) {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	t := &store.Task{
+		PipelineID:  pipeline.ID,
+		Name:        payload.Name,
+		Description: payload.Description,
+		UiDisplay:   payload.UiDisplay,
+		Type:        payload.Type,
+		Config:      payload.Config,
+		DriftPolicy: payload.DriftPolicy,
+	}
+
+	if err := app.tasks.Validate(ctx, *t); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := app.store.Tasks.Create(ctx, t); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusCreated, t); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getTasksHandler(w http.ResponseWriter, r *http.Request) {
+	pipeline := getPipelineFromContext(r)
+
+	ctx := r.Context()
+	tasks, err := app.store.Tasks.GetByPipeline(ctx, pipeline.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusOK, tasks); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getTaskHandler(w http.ResponseWriter, r *http.Request) {
+	t := getTaskFromContext(r)
+
+	if err := utils.JsonResponse(w, http.StatusOK, t); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type UpdateTaskPayload struct {
+	Name        *string         `json:"name" validate:"omitempty,max=255"`
+	Description *string         `json:"description" validate:"omitempty,max=500"`
+	UiDisplay   *int            `json:"ui_display"`
+	Config      json.RawMessage `json:"config"`
+	DriftPolicy *string         `json:"drift_policy" validate:"omitempty,oneof=ignore warn fail evolve"`
+}
+
+func (app *application) updateTaskHandler(w http.ResponseWriter, r *http.Request) {
+	t := getTaskFromContext(r)
+
+	if !app.canConfigure(r, getPipelineFromContext(r), t.Type) {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	var payload UpdateTaskPayload
+	if err := utils.ReadJson(r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if payload.Name != nil {
+		t.Name = *payload.Name
+	}
+	if payload.Description != nil {
+		t.Description = *payload.Description
+	}
+	if payload.UiDisplay != nil {
+		t.UiDisplay = *payload.UiDisplay
+	}
+	if payload.Config != nil {
+		t.Config = payload.Config
+	}
+	if payload.DriftPolicy != nil {
+		t.DriftPolicy = *payload.DriftPolicy
+	}
+
+	ctx := r.Context()
+	if err := app.tasks.Validate(ctx, *t); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := app.store.Tasks.Update(ctx, t); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusOK, t); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// canConfigure reports whether the user may create or update a task of
+// the given type. Shell commands run on the API host, so only the admins of
+// the organization configure them.
+func (app *application) canConfigure(r *http.Request, pipeline *store.Pipelines, taskType string) bool {
+	if taskType != task.ShellExecType {
+		return true
+	}
+	user := getUserFromContext(r)
+	return app.isUserAdmin(r.Context(), pipeline.OrganizationID, user.ID)
+}
+
+func (app *application) deleteTaskHandler(w http.ResponseWriter, r *http.Request) {
+	t := getTaskFromContext(r)
+
+	ctx := r.Context()
+	if err := app.store.Tasks.Delete(ctx, t.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) createTaskRunHandler(w http.ResponseWriter, r *http.Request) {
+	t := getTaskFromContext(r)
+
+	ctx := r.Context()
+	run := &store.TaskRun{
+		TaskID: t.ID,
+	}
+
+	if err := app.store.TaskRuns.Create(ctx, run); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.executor.Submit(*t, *run); err != nil {
+		run.Status = store.StateError
+		run.Error = err.Error()
+		if err := app.store.TaskRuns.Finish(ctx, run); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		switch {
+		case errors.Is(err, task.ErrTaskBusy):
+			app.conflictResponse(w, r, err)
+		default:
+			app.serviceUnavailableResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusAccepted, run); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getTaskRunsHandler(w http.ResponseWriter, r *http.Request) {
+	t := getTaskFromContext(r)
+
+	ctx := r.Context()
+	runs, err := app.store.TaskRuns.GetByTask(ctx, t.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusOK, runs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getTaskRunHandler(w http.ResponseWriter, r *http.Request) {
+	t := getTaskFromContext(r)
+
+	runID, err := utils.GetURLParamInt64(r, "runID")
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	run, err := app.store.TaskRuns.GetByID(ctx, runID)
+	if err == nil && run.TaskID != t.ID {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusOK, run); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) taskContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		taskID, err := utils.GetURLParamInt64(r, "taskID")
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+
+		pipeline := getPipelineFromContext(r)
+
+		ctx := r.Context()
+		t, err := app.store.Tasks.GetByID(ctx, taskID)
+		// Tasks are only reachable through the pipeline they belong to.
+		if err == nil && t.PipelineID != pipeline.ID {
+			err = store.ErrNotFound
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, taskCtx, &t)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getTaskFromContext(r *http.Request) *store.Task {
+	t, ok := r.Context().Value(taskCtx).(*store.Task)
+	if !ok {
+		panic("task not found in context")
+	}
+
+	return t
+}
+
+func newTaskRegistry(storage store.Storage) *task.Registry {
+	registry := task.NewRegistry()
+	registry.Register(task.ShellExecType, task.NewShellExec())
+	registry.Register(task.SQLTransformType, task.NewSQLTransform(storage))
+	registry.Register(task.PostgresExtractType, task.NewPostgresExtract(storage))
+	registry.Register(task.HTTPExtractType, task.NewHTTPExtract(storage))
+	registry.Register(task.FileIngestType, task.NewFileIngest(storage))
+	registry.Register(task.PostgresCDCType, task.NewPostgresCDC(storage))
+	registry.Register(task.PostgresSCD2Type, task.NewPostgresSCD2(storage))
+	registry.Register(task.AvroReadType, task.NewAvroRead())
+	registry.Register(task.AvroWriteType, task.NewAvroWrite())
+	registry.Register(task.FixedWidthReadType, task.NewFixedWidthRead())
+	registry.Register(task.XLSXReadType, task.NewXLSXRead())
+	registry.Register(task.XMLReadType, task.NewXMLRead())
+	registry.Register(task.TransformMapType, task.NewTransformMap(storage, registry))
+	registry.Register(task.QualityCheckType, task.NewQualityCheck(storage, registry))
+	registry.Register(task.ProfileType, task.NewProfile(storage, registry))
+	registry.Register(task.TransformJoinType, task.NewTransformJoin(storage, registry))
+	registry.Register(task.TransformAggregateType, task.NewTransformAggregate(storage, registry))
+	registry.Register(task.TransformDedupeType, task.NewTransformDedupe(storage, registry))
+	registry.Register(task.TransformMaskType, task.NewTransformMask(storage, registry))
+
+	return registry
+}
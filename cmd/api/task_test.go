@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LincolnG4/Haku/internal/auth"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/LincolnG4/Haku/internal/task"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTaskHandlers(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+
+	user := &store.User{ID: 1, Username: "haku", Email: "haku@ghibli.com"}
+	app.store.Users.Create(nil, user)
+	app.store.Organizations.Create(nil, &store.Organization{ID: 1, Name: "bathhouse"})
+	app.store.Organizations.AddMember(nil, &store.OrganizationMember{UserID: user.ID, OrganizationID: 1, RoleID: store.AdminRole})
+	app.store.Pipelines.Create(nil, &store.Pipelines{ID: 1, OrganizationID: 1, Name: "bathhouse"})
+	app.store.Pipelines.Create(nil, &store.Pipelines{ID: 2, OrganizationID: 1, Name: "other"})
+
+	claims := &auth.MyClaims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:  fmt.Sprintf("%d", user.ID),
+			Issuer:   "test-aud",
+			Audience: []string{"test-aud"},
+		},
+	}
+	token, _ := app.authenticator.GenerateToken(claims)
+
+	newRequest := func(method, path, body string) *http.Request {
+		req, _ := http.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+
+	t.Run("reject unknown task type", func(t *testing.T) {
+		req := newRequest(http.MethodPost, "/v1/pipelines/1/tasks", `{"name": "t", "type": "nope", "config": {}}`)
+		rr := executeRequest(mux, req)
+		checkCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("reject invalid config", func(t *testing.T) {
+		req := newRequest(http.MethodPost, "/v1/pipelines/1/tasks", `{"name": "t", "type": "shell.exec", "config": {"args": ["x"]}}`)
+		rr := executeRequest(mux, req)
+		checkCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("create task", func(t *testing.T) {
+		req := newRequest(http.MethodPost, "/v1/pipelines/1/tasks", `{"name": "t", "type": "shell.exec", "config": {"command": "echo"}}`)
+		rr := executeRequest(mux, req)
+		checkCode(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("preview", func(t *testing.T) {
+		req := newRequest(http.MethodPost, "/v1/pipelines/1/tasks/1/preview", "")
+		rr := executeRequest(mux, req)
+		checkCode(t, http.StatusBadRequest, rr.Code)
+
+		dir := t.TempDir()
+		source := filepath.Join(dir, "in.jsonl")
+		os.WriteFile(source, []byte("{\"id\": 1}\n{\"id\": 2}\n"), 0o644)
+		app.store.Tasks.Create(nil, &store.Task{
+			ID:         10,
+			PipelineID: 1,
+			Type:       "transform.map",
+			Config:     []byte(fmt.Sprintf(`{"source_path": %q, "target_path": %q, "steps": [{"op": "rename", "mapping": {"id": "key"}}]}`, source, filepath.Join(dir, "out.jsonl"))),
+		})
+
+		req = newRequest(http.MethodPost, "/v1/pipelines/1/tasks/10/preview", `{"limit": 1}`)
+		rr = executeRequest(mux, req)
+		checkCode(t, http.StatusOK, rr.Code)
+
+		var body struct {
+			Data task.Preview `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&body)
+		if len(body.Data.Records) != 1 || body.Data.Records[0]["key"] != 1.0 {
+			t.Errorf("unexpected preview records %v", body.Data.Records)
+		}
+
+		req = newRequest(http.MethodPost, "/v1/pipelines/1/tasks/10/preview", `{"timeout": "1h"}`)
+		rr = executeRequest(mux, req)
+		checkCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("task not found through another pipeline", func(t *testing.T) {
+		req := newRequest(http.MethodGet, "/v1/pipelines/2/tasks/1", "")
+		rr := executeRequest(mux, req)
+		checkCode(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("queue a run", func(t *testing.T) {
+		req := newRequest(http.MethodPost, "/v1/pipelines/1/tasks/1/runs", "")
+		rr := executeRequest(mux, req)
+		checkCode(t, http.StatusAccepted, rr.Code)
+
+		req = newRequest(http.MethodGet, "/v1/pipelines/1/tasks/1/runs/1", "")
+		rr = executeRequest(mux, req)
+		checkCode(t, http.StatusOK, rr.Code)
+
+		req = newRequest(http.MethodGet, "/v1/pipelines/1/tasks/1/runs/1/quality", "")
+		rr = executeRequest(mux, req)
+		checkCode(t, http.StatusOK, rr.Code)
+
+		req = newRequest(http.MethodGet, "/v1/pipelines/1/tasks/1/runs/2/quality", "")
+		rr = executeRequest(mux, req)
+		checkCode(t, http.StatusNotFound, rr.Code)
+
+		req = newRequest(http.MethodGet, "/v1/pipelines/1/tasks/1/runs/1/profile", "")
+		rr = executeRequest(mux, req)
+		checkCode(t, http.StatusOK, rr.Code)
+		// The first run is still queued.
+		req = newRequest(http.MethodPost, "/v1/pipelines/1/tasks/1/runs", "")
+		rr = executeRequest(mux, req)
+		checkCode(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("profile history", func(t *testing.T) {
+		req := newRequest(http.MethodGet, "/v1/pipelines/1/tasks/1/profile", "")
+		rr := executeRequest(mux, req)
+		checkCode(t, http.StatusBadRequest, rr.Code)
+
+		req = newRequest(http.MethodGet, "/v1/pipelines/1/tasks/1/profile?column=id", "")
+		rr = executeRequest(mux, req)
+		checkCode(t, http.StatusOK, rr.Code)
+	})
+}
+
+func TestWatermarkHandlers(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+
+	user := &store.User{ID: 1, Username: "haku", Email: "haku@ghibli.com"}
+	app.store.Users.Create(nil, user)
+	app.store.Organizations.Create(nil, &store.Organization{ID: 1, Name: "bathhouse"})
+	app.store.Organizations.AddMember(nil, &store.OrganizationMember{UserID: user.ID, OrganizationID: 1, RoleID: store.AdminRole})
+	app.store.Pipelines.Create(nil, &store.Pipelines{ID: 1, OrganizationID: 1, Name: "bathhouse"})
+	app.store.Tasks.Create(nil, &store.Task{
+		PipelineID: 1,
+		Type:       "http.extract",
+		Config:     []byte(`{"url": "http://api", "target_path": "/tmp/out.jsonl", "incremental": {"cursor": "id", "cursor_type": "integer", "param": "since"}}`),
+	})
+
+	claims := &auth.MyClaims{
+		UserID: user.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:  fmt.Sprintf("%d", user.ID),
+			Issuer:   "test-aud",
+			Audience: []string{"test-aud"},
+		},
+	}
+	token, _ := app.authenticator.GenerateToken(claims)
+
+	newRequest := func(method, body string) *http.Request {
+		req, _ := http.NewRequest(method, "/v1/pipelines/1/tasks/1/watermark", bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+
+	t.Run("no watermark yet", func(t *testing.T) {
+		rr := executeRequest(mux, newRequest(http.MethodGet, ""))
+		checkCode(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("reject value of the wrong cursor type", func(t *testing.T) {
+		rr := executeRequest(mux, newRequest(http.MethodPut, `{"value": "yesterday"}`))
+		checkCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("set, inspect and reset", func(t *testing.T) {
+		rr := executeRequest(mux, newRequest(http.MethodPut, `{"value": "100"}`))
+		checkCode(t, http.StatusOK, rr.Code)
+
+		rr = executeRequest(mux, newRequest(http.MethodGet, ""))
+		checkCode(t, http.StatusOK, rr.Code)
+
+		rr = executeRequest(mux, newRequest(http.MethodDelete, ""))
+		checkCode(t, http.StatusNoContent, rr.Code)
+
+		rr = executeRequest(mux, newRequest(http.MethodGet, ""))
+		checkCode(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestCheckpointHandlers(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+
+	user := &store.User{ID: 1, Username: "haku", Email: "haku@ghibli.com"}
+	app.store.Users.Create(nil, user)
+	app.store.Organizations.Create(nil, &store.Organization{ID: 1, Name: "bathhouse"})
+	app.store.Organizations.AddMember(nil, &store.OrganizationMember{UserID: user.ID, OrganizationID: 1, RoleID: store.AdminRole})
+	app.store.Pipelines.Create(nil, &store.Pipelines{ID: 1, OrganizationID: 1, Name: "bathhouse"})
+	app.store.Tasks.Create(nil, &store.Task{
+		PipelineID: 1,
+		Type:       "transform.map",
+		Config:     []byte(`{"source_path": "/tmp/in.jsonl", "target_path": "/tmp/out.jsonl", "steps": [{"op": "drop", "columns": ["x"]}], "checkpoint": {}}`),
+	})
+
+	claims := &auth.MyClaims{
+		UserID: user.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:  fmt.Sprintf("%d", user.ID),
+			Issuer:   "test-aud",
+			Audience: []string{"test-aud"},
+		},
+	}
+	token, _ := app.authenticator.GenerateToken(claims)
+
+	newRequest := func(method string) *http.Request {
+		req, _ := http.NewRequest(method, "/v1/pipelines/1/tasks/1/checkpoint", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+
+	t.Run("no checkpoint yet", func(t *testing.T) {
+		rr := executeRequest(mux, newRequest(http.MethodGet))
+		checkCode(t, http.StatusNotFound, rr.Code)
+
+		rr = executeRequest(mux, newRequest(http.MethodDelete))
+		checkCode(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("inspect and discard", func(t *testing.T) {
+		kept := filepath.Join(t.TempDir(), ".out.jsonl.run-1.kept.tmp")
+		if err := os.WriteFile(kept, []byte(`{"id": 1}`+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		app.store.TaskState.Set(nil, &store.TaskState{
+			TaskID: 1,
+			Key:    task.CheckpointKey,
+			Value:  `{"run_id": 1, "source": {"rows": 1, "offset": 10}, "sink": {"file": "` + kept + `", "size": 10}}`,
+		})
+
+		rr := executeRequest(mux, newRequest(http.MethodGet))
+		checkCode(t, http.StatusOK, rr.Code)
+		var body struct {
+			Data task.Checkpoint `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Data.RunID != 1 || body.Data.Source.Rows != 1 {
+			t.Errorf("checkpoint = %+v, want run 1 after 1 row", body.Data)
+		}
+
+		rr = executeRequest(mux, newRequest(http.MethodDelete))
+		checkCode(t, http.StatusNoContent, rr.Code)
+		if _, err := os.Stat(kept); !os.IsNotExist(err) {
+			t.Errorf("kept output still exists: %v", err)
+		}
+
+		rr = executeRequest(mux, newRequest(http.MethodGet))
+		checkCode(t, http.StatusNotFound, rr.Code)
+	})
+}
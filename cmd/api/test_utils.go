@@ -7,6 +7,7 @@ import (
 
 	"github.com/LincolnG4/Haku/internal/auth"
 	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/LincolnG4/Haku/internal/task"
 	"go.uber.org/zap"
 )
 
@@ -16,10 +17,14 @@ func newTestApplication(t *testing.T) *application {
 	logger := zap.NewNop().Sugar()
 	mockStore := store.NewMockStore()
 	testAuth := &auth.TestAuthenticator{}
+	registry := newTaskRegistry(mockStore)
 	return &application{
 		logger:        logger,
 		store:         mockStore,
 		authenticator: testAuth,
+		tasks:         registry,
+		// Workers are not started, submitted runs stay queued.
+		executor: task.NewExecutor(mockStore, registry, logger, 1, 10),
 	}
 }
 
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/LincolnG4/Haku/internal/task"
+	"github.com/LincolnG4/Haku/internal/utils"
+)
+
+func (app *application) getWatermarkHandler(w http.ResponseWriter, r *http.Request) {
+	t := getTaskFromContext(r)
+
+	ctx := r.Context()
+	state, err := app.store.TaskState.Get(ctx, t.ID, task.WatermarkKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusOK, state); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type SetWatermarkPayload struct {
+	Value string `json:"value" validate:"required"`
+}
+
+func (app *application) setWatermarkHandler(w http.ResponseWriter, r *http.Request) {
+	t := getTaskFromContext(r)
+
+	var payload SetWatermarkPayload
+	if err := utils.ReadJson(r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	incremental, err := task.IncrementalOf(*t)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if incremental == nil {
+		app.badRequestError(w, r, errors.New("task does not extract incrementally"))
+		return
+	}
+	if err := task.ValidateCursor(incremental.CursorType, payload.Value); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	state := &store.TaskState{
+		TaskID: t.ID,
+		Key:    task.WatermarkKey,
+		Value:  payload.Value,
+	}
+	if err := app.store.TaskState.Set(ctx, state); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := utils.JsonResponse(w, http.StatusOK, state); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// resetWatermarkHandler removes the high-water mark, the next run starts
+// again from the initial value of the task.
+func (app *application) resetWatermarkHandler(w http.ResponseWriter, r *http.Request) {
+	t := getTaskFromContext(r)
+
+	ctx := r.Context()
+	if err := app.store.TaskState.Delete(ctx, t.ID, task.WatermarkKey); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,240 @@
+package expr
+
+import (
+	"github.com/LincolnG4/Haku/internal/record"
+)
+
+var numericRank = map[record.Type]int{
+	record.TypeInteger: 1,
+	record.TypeDecimal: 2,
+	record.TypeFloat:   3,
+}
+
+func check(n node, schema record.Schema) (record.Type, error) {
+	switch n := n.(type) {
+	case *literal:
+		return literalType(n.value), nil
+	case *ident:
+		field, ok := schema.Field(n.name)
+		if !ok {
+			return "", errorf(n.at, "unknown column %q", n.name)
+		}
+		return field.Type, nil
+	case *unary:
+		x, err := check(n.x, schema)
+		if err != nil {
+			return "", err
+		}
+		if n.op == "not" {
+			return record.TypeBoolean, checkBoolean(n.x, x)
+		}
+		if x != record.TypeAny && numericRank[x] == 0 {
+			return "", errorf(n.at, "cannot negate %s", x)
+		}
+		return x, nil
+	case *binary:
+		x, err := check(n.x, schema)
+		if err != nil {
+			return "", err
+		}
+		y, err := check(n.y, schema)
+		if err != nil {
+			return "", err
+		}
+		switch n.op {
+		case "??":
+			return common(x, y), nil
+		case "and", "or":
+			if err := checkBoolean(n.x, x); err != nil {
+				return "", err
+			}
+			return record.TypeBoolean, checkBoolean(n.y, y)
+		case "==", "!=", "<", "<=", ">", ">=":
+			if !comparable(x, y) {
+				return "", errorf(n.at, "cannot compare %s and %s", x, y)
+			}
+			return record.TypeBoolean, nil
+		case "in":
+			return record.TypeBoolean, checkIn(n, x, y, schema)
+		case "matches":
+			if !accepts(record.TypeString, x) || !accepts(record.TypeString, y) {
+				return "", errorf(n.at, "matches expects strings, found %s and %s", x, y)
+			}
+			return record.TypeBoolean, nil
+		}
+		return checkArithmetic(n, x, y)
+	case *ternary:
+		cond, err := check(n.cond, schema)
+		if err != nil {
+			return "", err
+		}
+		if err := checkBoolean(n.cond, cond); err != nil {
+			return "", err
+		}
+		then, err := check(n.then, schema)
+		if err != nil {
+			return "", err
+		}
+		otherwise, err := check(n.otherwise, schema)
+		if err != nil {
+			return "", err
+		}
+		return common(then, otherwise), nil
+	case *list:
+		for _, item := range n.items {
+			if _, err := check(item, schema); err != nil {
+				return "", err
+			}
+		}
+		return record.TypeArray, nil
+	case *call:
+		return checkCall(n, schema)
+	}
+	return record.TypeAny, nil
+}
+
+func checkBoolean(n node, t record.Type) error {
+	if t != record.TypeBoolean && t != record.TypeAny {
+		return errorf(n.pos(), "expected a boolean, found %s", t)
+	}
+	return nil
+}
+
+func checkIn(n *binary, x, y record.Type, schema record.Schema) error {
+	l, ok := n.y.(*list)
+	if !ok {
+		if y != record.TypeArray && y != record.TypeAny {
+			return errorf(n.y.pos(), "in expects a list, found %s", y)
+		}
+		return nil
+	}
+	for _, item := range l.items {
+		t, _ := check(item, schema)
+		if !comparable(x, t) {
+			return errorf(item.pos(), "cannot compare %s and %s", x, t)
+		}
+	}
+	return nil
+}
+
+func checkCall(n *call, schema record.Schema) (record.Type, error) {
+	args := make([]record.Type, len(n.args))
+	for i, arg := range n.args {
+		t, err := check(arg, schema)
+		if err != nil {
+			return "", err
+		}
+		if param := n.fn.param(i); !accepts(param, t) {
+			return "", errorf(arg.pos(), "%s: argument %d must be %s, found %s", n.name, i+1, paramName(param), t)
+		}
+		args[i] = t
+	}
+
+	if n.fn.unit > 0 {
+		if l, ok := n.args[n.fn.unit-1].(*literal); ok {
+			if unit, ok := l.value.(string); ok {
+				if err := checkUnit(unit); err != nil {
+					return "", errorf(l.at, "%s: %v", n.name, err)
+				}
+			}
+		}
+	}
+
+	if n.fn.resultOf != nil {
+		return n.fn.resultOf(args), nil
+	}
+	return n.fn.result, nil
+}
+
+// accepts reports whether a value of type t can be passed where param is
+// expected.
+func accepts(param, t record.Type) bool {
+	switch {
+	case param == record.TypeAny || t == record.TypeAny || param == t:
+		return true
+	case param == typeNumber:
+		return numericRank[t] > 0
+	case param == typeTime:
+		return t == record.TypeDate || t == record.TypeTimestamp || t == record.TypeString
+	}
+	return false
+}
+
+func paramName(param record.Type) string {
+	switch param {
+	case typeNumber:
+		return "a number"
+	case typeTime:
+		return "a date or timestamp"
+	case record.TypeInteger:
+		return "an integer"
+	}
+	return "a " + string(param)
+}
+
+// comparable reports whether values of the two types can be compared.
+// Dates and timestamps compare with each other and with strings.
+func comparable(x, y record.Type) bool {
+	isTime := func(t record.Type) bool {
+		return t == record.TypeDate || t == record.TypeTimestamp
+	}
+	switch {
+	case x == record.TypeAny || y == record.TypeAny || x == y:
+		return true
+	case numericRank[x] > 0 && numericRank[y] > 0:
+		return true
+	case isTime(x) && (isTime(y) || y == record.TypeString):
+		return true
+	case isTime(y) && x == record.TypeString:
+		return true
+	}
+	return false
+}
+
+// common returns the type of a value that is either of the two types.
+// Nulls type as record.TypeAny and do not widen the other type.
+func common(x, y record.Type) record.Type {
+	switch {
+	case x == y || y == record.TypeAny:
+		return x
+	case x == record.TypeAny:
+		return y
+	case numericRank[x] > 0 && numericRank[y] > 0:
+		if numericRank[y] > numericRank[x] {
+			return y
+		}
+		return x
+	}
+	return record.TypeAny
+}
+
+func checkArithmetic(n *binary, x, y record.Type) (record.Type, error) {
+	if n.op == "+" && (x == record.TypeString || y == record.TypeString) {
+		if (x == record.TypeString || x == record.TypeAny) && (y == record.TypeString || y == record.TypeAny) {
+			return record.TypeString, nil
+		}
+	}
+	if x == record.TypeAny || y == record.TypeAny {
+		return record.TypeAny, nil
+	}
+	if numericRank[x] == 0 || numericRank[y] == 0 {
+		return "", errorf(n.at, "cannot apply %s to %s and %s", n.op, x, y)
+	}
+
+	if numericRank[y] > numericRank[x] {
+		x = y
+	}
+	if n.op == "/" && x == record.TypeInteger {
+		return record.TypeFloat, nil
+	}
+	return x, nil
+}
+
+// literalType returns the type of a normalized literal. Null literals fit
+// any type.
+func literalType(v any) record.Type {
+	if _, ok := v.(decimal); ok {
+		return record.TypeDecimal
+	}
+	return record.TypeOf(v)
+}
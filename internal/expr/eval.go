@@ -0,0 +1,188 @@
+package expr
+
+import (
+	"fmt"
+
+	"github.com/LincolnG4/Haku/internal/record"
+)
+
+func eval(n node, r record.Record) (any, error) {
+	switch n := n.(type) {
+	case *literal:
+		return n.value, nil
+	case *ident:
+		return normalize(r[n.name]), nil
+	case *unary:
+		x, err := eval(n.x, r)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "not" {
+			b, err := truth(x)
+			if err != nil || b == nil {
+				return nil, err
+			}
+			return !*b, nil
+		}
+		return negate(x)
+	case *binary:
+		return evalBinary(n, r)
+	case *ternary:
+		cond, err := eval(n.cond, r)
+		if err != nil {
+			return nil, err
+		}
+		b, err := truth(cond)
+		if err != nil {
+			return nil, err
+		}
+		if b != nil && *b {
+			return eval(n.then, r)
+		}
+		return eval(n.otherwise, r)
+	case *list:
+		items := make([]any, len(n.items))
+		for i, item := range n.items {
+			v, err := eval(item, r)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = v
+		}
+		return items, nil
+	case *call:
+		args := make([]any, len(n.args))
+		for i, arg := range n.args {
+			v, err := eval(arg, r)
+			if err != nil {
+				return nil, err
+			}
+			if v == nil && !n.fn.nulls {
+				return nil, nil
+			}
+			args[i] = v
+		}
+		v, err := n.fn.call(args, n.re)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", n.name, err)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("unexpected node %T", n)
+}
+
+func evalBinary(n *binary, r record.Record) (any, error) {
+	x, err := eval(n.x, r)
+	if err != nil {
+		return nil, err
+	}
+
+	// These operators only evaluate their right operand when the left one
+	// does not decide the result.
+	switch n.op {
+	case "??":
+		if x != nil {
+			return x, nil
+		}
+		return eval(n.y, r)
+	case "and", "or":
+		return logic(n, x, r)
+	}
+
+	y, err := eval(n.y, r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(x, y), nil
+	case "!=":
+		return !equal(x, y), nil
+	case "<", "<=", ">", ">=":
+		if x == nil || y == nil {
+			return nil, nil
+		}
+		c, err := order(x, y)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "in":
+		if x == nil || y == nil {
+			return nil, nil
+		}
+		items, ok := y.([]any)
+		if !ok {
+			return nil, fmt.Errorf("in expects a list, found %s", typeName(y))
+		}
+		for _, item := range items {
+			if equal(x, normalize(item)) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "matches":
+		if x == nil || y == nil {
+			return nil, nil
+		}
+		s, ok := x.(string)
+		if !ok {
+			return nil, fmt.Errorf("matches expects a string, found %s", typeName(x))
+		}
+		re, err := pattern(n.re, y)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(s), nil
+	}
+	return arithmetic(n.op, x, y)
+}
+
+// logic evaluates and and or with three-valued logic: null and false is
+// false, null or true is true, and null otherwise.
+func logic(n *binary, x any, r record.Record) (any, error) {
+	a, err := truth(x)
+	if err != nil {
+		return nil, err
+	}
+	decides := n.op == "or"
+	if a != nil && *a == decides {
+		return decides, nil
+	}
+
+	y, err := eval(n.y, r)
+	if err != nil {
+		return nil, err
+	}
+	b, err := truth(y)
+	if err != nil {
+		return nil, err
+	}
+	if b != nil && *b == decides {
+		return decides, nil
+	}
+	if a == nil || b == nil {
+		return nil, nil
+	}
+	return !decides, nil
+}
+
+// truth reads a condition. It returns nil for null.
+func truth(v any) (*bool, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return &v, nil
+	}
+	return nil, fmt.Errorf("expected a boolean, found %s", typeName(v))
+}
@@ -0,0 +1,104 @@
+// Package expr compiles and evaluates the expressions tasks use to filter
+// records and derive columns from them. Expressions read columns by name
+// and cannot reach anything outside the record they are evaluated against:
+// there are no loops, no I/O and regular expressions run in linear time.
+//
+//	price * quantity
+//	first_name + ' ' + last_name
+//	`unit price` * 1.21
+//	status in ['paid', 'shipped'] and date_diff(today(), ordered, 'day') < 30
+//	email matches '@example\\.com$' ? 'internal' : lower(country) ?? 'unknown'
+//
+// Numbers without a fraction are integers and numbers with one are exact
+// decimals. A null operand makes arithmetic, ordering and most functions
+// null. == and != treat null as a value of its own, and and, or and not
+// follow three-valued logic, so that null and false is false.
+package expr
+
+import (
+	"github.com/LincolnG4/Haku/internal/record"
+)
+
+// Program is a compiled expression. It is safe for concurrent use.
+type Program struct {
+	src  string
+	root node
+	vars []string
+}
+
+// Compile parses an expression.
+func Compile(src string) (*Program, error) {
+	root, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Program{src: src, root: normalizeLiterals(root)}
+	seen := make(map[string]bool)
+	walk(root, func(n node) {
+		if id, ok := n.(*ident); ok && !seen[id.name] {
+			seen[id.name] = true
+			p.vars = append(p.vars, id.name)
+		}
+	})
+	return p, nil
+}
+
+func (p *Program) String() string {
+	return p.src
+}
+
+// Vars returns the columns the expression reads, in order of first use.
+func (p *Program) Vars() []string {
+	return p.vars
+}
+
+// Eval evaluates the expression against a record. Columns missing from the
+// record are null.
+func (p *Program) Eval(r record.Record) (any, error) {
+	v, err := eval(p.root, r)
+	if err != nil {
+		return nil, err
+	}
+	return export(v), nil
+}
+
+// Check type checks the expression against a schema and returns the type
+// of its result. Operands typed record.TypeAny are only checked when the
+// expression is evaluated.
+func (p *Program) Check(schema record.Schema) (record.Type, error) {
+	return check(p.root, schema)
+}
+
+// normalizeLiterals converts number literals once at compile time.
+func normalizeLiterals(n node) node {
+	walk(n, func(n node) {
+		if l, ok := n.(*literal); ok {
+			l.value = normalize(l.value)
+		}
+	})
+	return n
+}
+
+func walk(n node, fn func(node)) {
+	fn(n)
+	switch n := n.(type) {
+	case *unary:
+		walk(n.x, fn)
+	case *binary:
+		walk(n.x, fn)
+		walk(n.y, fn)
+	case *ternary:
+		walk(n.cond, fn)
+		walk(n.then, fn)
+		walk(n.otherwise, fn)
+	case *list:
+		for _, item := range n.items {
+			walk(item, fn)
+		}
+	case *call:
+		for _, arg := range n.args {
+			walk(arg, fn)
+		}
+	}
+}
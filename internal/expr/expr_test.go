@@ -0,0 +1,317 @@
+package expr
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEval(t *testing.T) {
+	r := record.Record{
+		"price":      json.Number("12.50"),
+		"quantity":   json.Number("3"),
+		"rate":       0.5,
+		"first_name": "Chihiro",
+		"last_name":  "Ogino",
+		"unit price": int64(7),
+		"missing":    nil,
+	}
+
+	tests := []struct {
+		src  string
+		want any
+	}{
+		{"price * quantity", json.Number("37.50")},
+		{"price + 0.005", json.Number("12.505")},
+		{"price * 1.21", json.Number("15.1250")},
+		{"price / 3", json.Number("4.166667")},
+		{"price % 5", json.Number("2.50")},
+		{"quantity * 2 + 1", int64(7)},
+		{"quantity * (2 + 1)", int64(9)},
+		{"quantity / 2", 1.5},
+		{"quantity % 2", int64(1)},
+		{"-quantity - -1", int64(-2)},
+		{"quantity * rate", 1.5},
+		{"first_name + ' ' + last_name", "Chihiro Ogino"},
+		{`"it's" + ' \'quoted\''`, "it's 'quoted'"},
+		{"`unit price` * 2", int64(14)},
+		{"missing + 1", nil},
+		{"unknown * 2", nil},
+		{"null", nil},
+		{"1e3 * 2", 2000.0},
+	}
+	for _, tt := range tests {
+		p, err := Compile(tt.src)
+		if !assert.NoError(t, err, tt.src) {
+			continue
+		}
+		got, err := p.Eval(r)
+		assert.NoError(t, err, tt.src)
+		assert.Equal(t, tt.want, got, tt.src)
+	}
+}
+
+func TestEval_Logic(t *testing.T) {
+	r := record.Record{
+		"status":  "paid",
+		"amount":  json.Number("20.00"),
+		"qty":     json.Number("3"),
+		"rate":    0.5,
+		"active":  true,
+		"email":   "chihiro@example.com",
+		"ordered": "2024-01-31",
+		"created": time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC),
+		"tags":    []any{"a", "b"},
+		"missing": nil,
+	}
+
+	tests := []struct {
+		src  string
+		want any
+	}{
+		{"amount == 20", true},
+		{"amount > qty and qty >= 3", true},
+		{"rate < qty", true},
+		{"status != 'paid'", false},
+		{"status > 'open'", true},
+		{"!active || false", false},
+		{"active && not false", true},
+		{"missing == null", true},
+		{"missing != 1", true},
+		{"missing > 1", nil},
+		{"missing < 1 or true", true},
+		{"missing < 1 and false", false},
+		{"missing < 1 and true", nil},
+		{"not (missing < 1)", nil},
+		{"status in ['open', 'paid']", true},
+		{"qty in [1, 2.0]", false},
+		{"'b' in tags", true},
+		{"missing in [null]", nil},
+		{"email matches '@example\\\\.com$'", true},
+		{"email matches '^' + status", false},
+		{"ordered < created", true},
+		{"created >= '2024-02-01T09:00:00Z'", true},
+		{"amount > 10 ? 'large' : 'small'", "large"},
+		{"missing > 1 ? 'yes' : 'no'", "no"},
+		{"missing ?? status", "paid"},
+		{"status ?? missing", "paid"},
+		{"active or 1 / 0 > 0", true},
+		{"missing ?? missing ?? 'x'", "x"},
+		{"1 + 2 == 3 and 'a' + 'b' == 'ab'", true},
+	}
+	for _, tt := range tests {
+		p, err := Compile(tt.src)
+		if !assert.NoError(t, err, tt.src) {
+			continue
+		}
+		got, err := p.Eval(r)
+		assert.NoError(t, err, tt.src)
+		assert.Equal(t, tt.want, got, tt.src)
+	}
+}
+
+func TestEval_Functions(t *testing.T) {
+	r := record.Record{
+		"name":    "  Chihiro Ogino ",
+		"code":    "ab-123-cd",
+		"price":   json.Number("12.345"),
+		"neg":     json.Number("-2.5"),
+		"rate":    2.5,
+		"ordered": "2024-01-31",
+		"created": time.Date(2024, 2, 29, 10, 30, 15, 0, time.UTC),
+		"missing": nil,
+	}
+
+	tests := []struct {
+		src  string
+		want any
+	}{
+		{"upper(trim(name))", "CHIHIRO OGINO"},
+		{"lower(ltrim(name))", "chihiro ogino "},
+		{"rtrim(name) + '|'", "  Chihiro Ogino|"},
+		{"length(trim(name))", int64(13)},
+		{"substr(code, 4, 3)", "123"},
+		{"substr(code, 8)", "cd"},
+		{"substr(code, 20)", ""},
+		{"concat(code, '/', missing, 1)", "ab-123-cd/1"},
+		{"contains(code, '123')", true},
+		{"starts_with(code, 'ab')", true},
+		{"ends_with(code, 'x')", false},
+		{"replace(code, '-', '')", "ab123cd"},
+		{"lpad('7', 3, '0')", "007"},
+		{"rpad('ab', 5, 'xy')", "abxyx"},
+		{"split(code, '-')", []any{"ab", "123", "cd"}},
+		{"regex_replace(code, '[0-9]+', '#')", "ab-#-cd"},
+		{"regex_extract(code, '([a-z]+)-([0-9]+)', 2)", "123"},
+		{"regex_extract(code, 'x+')", nil},
+		{"abs(neg)", json.Number("2.5")},
+		{"round(price, 2)", json.Number("12.35")},
+		{"round(rate)", 3.0},
+		{"floor(neg)", int64(-3)},
+		{"ceil(price)", int64(13)},
+		{"min(3, price, rate)", 2.5},
+		{"max('a', 'c', missing)", "c"},
+		{"coalesce(missing, price)", json.Number("12.345")},
+		{"is_null(missing)", true},
+		{"upper(missing)", nil},
+		{"string(price) + '€'", "12.345€"},
+		{"int('42') + 1", int64(43)},
+		{"float('1.5')", 1.5},
+		{"decimal('0.10') + decimal(0.2)", json.Number("0.30")},
+		{"date(created)", "2024-02-29"},
+		{"date('31/01/2024', '02/01/2006')", "2024-01-31"},
+		{"year(ordered) * 100 + month(ordered)", int64(202401)},
+		{"day(created) + hour(created) + minute(created) + second(created)", int64(29 + 10 + 30 + 15)},
+		{"weekday(ordered)", int64(3)},
+		{"date_add(ordered, 1, 'month')", "2024-03-02"},
+		{"date_add(ordered, -1, 'year')", "2023-01-31"},
+		{"format_time(date_add(created, 90, 'minute'), '15:04')", "12:00"},
+		{"date_diff(created, ordered, 'day')", int64(29)},
+		{"date_diff(created, ordered, 'month')", int64(0)},
+		{"date_diff(ordered, '2023-01-31', 'year')", int64(1)},
+		{"date_diff(ordered, created, 'hour')", int64(-706)},
+		{"date_trunc(ordered, 'month')", "2024-01-01"},
+		{"date_trunc(created, 'week') == timestamp('2024-02-26')", true},
+		{"format_time(timestamp(1700000000), '2006-01-02T15:04:05Z07:00')", "2023-11-14T22:13:20Z"},
+		{"date_diff(today(), now(), 'day') <= 0", true},
+	}
+	for _, tt := range tests {
+		p, err := Compile(tt.src)
+		if !assert.NoError(t, err, tt.src) {
+			continue
+		}
+		got, err := p.Eval(r)
+		assert.NoError(t, err, tt.src)
+		assert.Equal(t, tt.want, got, tt.src)
+	}
+}
+
+func TestEval_Errors(t *testing.T) {
+	r := record.Record{"name": "Haku", "n": int64(9223372036854775807), "zero": json.Number("0.0")}
+
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"name * 2", "cannot apply * to string and integer"},
+		{"name + 1", "cannot apply + to string and integer"},
+		{"n + 1", "integer overflow"},
+		{"1 / 0", "division by zero"},
+		{"2.5 / zero", "division by zero"},
+		{"-name", "cannot negate string"},
+		{"name > 1", "cannot compare string and integer"},
+		{"name and true", "expected a boolean, found string"},
+		{"name in 'Haku'", "in expects a list, found string"},
+		{"name matches n", "pattern must be a string, found integer"},
+		{"int(name)", `int: invalid integer "Haku"`},
+		{"date_add(name, 1, 'day')", `date_add: invalid time "Haku"`},
+		{"date_add('2024-01-01', 1, name)", `date_add: unknown unit "Haku", expected one of second, minute, hour, day, week, month, year`},
+	}
+	for _, tt := range tests {
+		p, err := Compile(tt.src)
+		if !assert.NoError(t, err, tt.src) {
+			continue
+		}
+		_, err = p.Eval(r)
+		assert.EqualError(t, err, tt.err, tt.src)
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"", "position 1: unexpected end of expression"},
+		{"price *", "position 8: unexpected end of expression"},
+		{"(price", `position 7: expected ")", found end of expression`},
+		{"price quantity", `position 7: unexpected "quantity"`},
+		{"'open", "position 1: unterminated string"},
+		{"price # 2", "position 7: unexpected character '#'"},
+		{"`open", "position 1: unterminated quoted column"},
+		{"shout(name)", "position 1: unknown function shout"},
+		{"lower(a, b)", "position 1: lower takes 1 argument, found 2"},
+		{"substr(a)", "position 1: substr takes 2 to 3 arguments, found 1"},
+		{"coalesce()", "position 1: coalesce takes at least 1 argument, found 0"},
+		{"name matches '(open'", "position 14: invalid pattern: error parsing regexp: missing closing ): `(open`"},
+		{"regex_extract(name, '[a-')", "position 21: invalid pattern: error parsing regexp: missing closing ]: `[a-`"},
+		{"a ? b", `position 6: expected ":", found end of expression`},
+		{"in + 1", `position 1: unexpected "in"`},
+		{strings.Repeat("(", 100) + "1" + strings.Repeat(")", 100), "position 65: expression is nested deeper than 64 levels"},
+		{strings.Repeat("1+", 2500) + "1", "position 4097: expression is longer than 4096 characters"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.src)
+		assert.EqualError(t, err, tt.err, tt.src)
+	}
+}
+
+func TestProgram_Vars(t *testing.T) {
+	p, err := Compile("price * quantity + price - `unit price`")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"price", "quantity", "unit price"}, p.Vars())
+	assert.Equal(t, "price * quantity + price - `unit price`", p.String())
+}
+
+func TestProgram_Check(t *testing.T) {
+	schema := record.Schema{Fields: []record.Field{
+		{Name: "id", Type: record.TypeInteger},
+		{Name: "price", Type: record.TypeDecimal},
+		{Name: "rate", Type: record.TypeFloat},
+		{Name: "name", Type: record.TypeString},
+		{Name: "created", Type: record.TypeDate},
+		{Name: "extra", Type: record.TypeAny},
+	}}
+
+	tests := []struct {
+		src  string
+		want record.Type
+		err  string
+	}{
+		{src: "id * 2", want: record.TypeInteger},
+		{src: "id / 2", want: record.TypeFloat},
+		{src: "price * id", want: record.TypeDecimal},
+		{src: "price * rate", want: record.TypeFloat},
+		{src: "name + '!'", want: record.TypeString},
+		{src: "extra + 1", want: record.TypeAny},
+		{src: "extra + name", want: record.TypeString},
+		{src: "null", want: record.TypeAny},
+		{src: "name - 1", err: "position 6: cannot apply - to string and integer"},
+		{src: "-name", err: "position 1: cannot negate string"},
+		{src: "id + total", err: `position 6: unknown column "total"`},
+		{src: "id > 2 and name != 'x'", want: record.TypeBoolean},
+		{src: "not extra", want: record.TypeBoolean},
+		{src: "created < '2024-01-01'", want: record.TypeBoolean},
+		{src: "id in [1, 2.5]", want: record.TypeBoolean},
+		{src: "id > 2 ? price : null", want: record.TypeDecimal},
+		{src: "id ?? 1.5", want: record.TypeDecimal},
+		{src: "upper(name)", want: record.TypeString},
+		{src: "round(price, 1)", want: record.TypeDecimal},
+		{src: "date_add(created, 1, 'month')", want: record.TypeDate},
+		{src: "name > 1", err: "position 6: cannot compare string and integer"},
+		{src: "id and true", err: "position 1: expected a boolean, found integer"},
+		{src: "id in ['a']", err: "position 8: cannot compare integer and string"},
+		{src: "name ? 1 : 2", err: "position 1: expected a boolean, found string"},
+		{src: "upper(id)", err: "position 7: upper: argument 1 must be a string, found integer"},
+		{src: "abs(name)", err: "position 5: abs: argument 1 must be a number, found string"},
+		{src: "year(id)", err: "position 6: year: argument 1 must be a date or timestamp, found integer"},
+		{src: "date_trunc(created, 'fortnight')", err: `position 21: date_trunc: unknown unit "fortnight", expected one of second, minute, hour, day, week, month, year`},
+	}
+	for _, tt := range tests {
+		p, err := Compile(tt.src)
+		if !assert.NoError(t, err, tt.src) {
+			continue
+		}
+		got, err := p.Check(schema)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err, tt.src)
+			continue
+		}
+		assert.NoError(t, err, tt.src)
+		assert.Equal(t, tt.want, got, tt.src)
+	}
+}
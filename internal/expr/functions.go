@@ -0,0 +1,648 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/LincolnG4/Haku/internal/record"
+)
+
+// Pseudo types accepted by function parameters.
+const (
+	// typeNumber accepts integers, decimals and floats.
+	typeNumber record.Type = "number"
+	// typeTime accepts dates, timestamps and strings holding either.
+	typeTime record.Type = "time"
+)
+
+// maxPad caps the length lpad and rpad can grow a string to.
+const maxPad = 10000
+
+type function struct {
+	params []record.Type
+	// optional is the number of trailing parameters that may be left out.
+	optional int
+	// variadic repeats the last parameter.
+	variadic bool
+	// nulls functions are called with null arguments. Other functions
+	// return null when any argument is null.
+	nulls bool
+	// pattern and unit are the 1-based positions of a regular expression
+	// and a time unit argument, checked up front when they are literals.
+	pattern int
+	unit    int
+	// result is the type of the result, or resultOf computes it from the
+	// types of the arguments.
+	result   record.Type
+	resultOf func(args []record.Type) record.Type
+	call     func(args []any, re *regexp.Regexp) (any, error)
+}
+
+func (f *function) minArgs() int {
+	return len(f.params) - f.optional
+}
+
+func (f *function) arity() string {
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return fmt.Sprintf("%d arguments", n)
+	}
+	switch {
+	case f.variadic:
+		return "at least " + plural(f.minArgs())
+	case f.optional > 0:
+		return fmt.Sprintf("%d to %s", f.minArgs(), plural(len(f.params)))
+	}
+	return plural(len(f.params))
+}
+
+func (f *function) param(i int) record.Type {
+	if i >= len(f.params) {
+		return f.params[len(f.params)-1]
+	}
+	return f.params[i]
+}
+
+var functions map[string]*function
+
+func init() {
+	str, num, tm, any_ := record.TypeString, typeNumber, typeTime, record.TypeAny
+	integer := record.TypeInteger
+
+	strFn := func(fn func(string) string) *function {
+		return &function{params: []record.Type{str}, result: str, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			return fn(args[0].(string)), nil
+		}}
+	}
+	strPred := func(fn func(string, string) bool) *function {
+		return &function{params: []record.Type{str, str}, result: record.TypeBoolean, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			return fn(args[0].(string), args[1].(string)), nil
+		}}
+	}
+	timePart := func(fn func(time.Time) int) *function {
+		return &function{params: []record.Type{tm}, result: integer, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			t, _, err := toTime(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return int64(fn(t)), nil
+		}}
+	}
+
+	functions = map[string]*function{
+		// Strings
+		"lower": strFn(strings.ToLower),
+		"upper": strFn(strings.ToUpper),
+		"trim":  strFn(strings.TrimSpace),
+		"ltrim": strFn(func(s string) string { return strings.TrimLeftFunc(s, isSpace) }),
+		"rtrim": strFn(func(s string) string { return strings.TrimRightFunc(s, isSpace) }),
+		"length": {params: []record.Type{str}, result: integer, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			return int64(utf8.RuneCountInString(args[0].(string))), nil
+		}},
+		"substr": {params: []record.Type{str, integer, integer}, optional: 1, result: str, call: substr},
+		"concat": {params: []record.Type{any_}, variadic: true, nulls: true, result: str, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			var b strings.Builder
+			for _, arg := range args {
+				if arg != nil {
+					b.WriteString(toString(arg))
+				}
+			}
+			return b.String(), nil
+		}},
+		"contains":    strPred(strings.Contains),
+		"starts_with": strPred(strings.HasPrefix),
+		"ends_with":   strPred(strings.HasSuffix),
+		"replace": {params: []record.Type{str, str, str}, result: str, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			return strings.ReplaceAll(args[0].(string), args[1].(string), args[2].(string)), nil
+		}},
+		"lpad": {params: []record.Type{str, integer, str}, optional: 1, result: str, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			return pad(args, true)
+		}},
+		"rpad": {params: []record.Type{str, integer, str}, optional: 1, result: str, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			return pad(args, false)
+		}},
+		"split": {params: []record.Type{str, str}, result: record.TypeArray, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			parts := strings.Split(args[0].(string), args[1].(string))
+			out := make([]any, len(parts))
+			for i, p := range parts {
+				out[i] = p
+			}
+			return out, nil
+		}},
+		"regex_replace": {params: []record.Type{str, str, str}, pattern: 2, result: str, call: func(args []any, re *regexp.Regexp) (any, error) {
+			re, err := pattern(re, args[1])
+			if err != nil {
+				return nil, err
+			}
+			return re.ReplaceAllString(args[0].(string), args[2].(string)), nil
+		}},
+		"regex_extract": {params: []record.Type{str, str, integer}, optional: 1, pattern: 2, result: str, call: regexExtract},
+
+		// Numbers
+		"abs": {params: []record.Type{num}, resultOf: firstArg, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			if c, _ := order(args[0], int64(0)); c < 0 {
+				return negate(args[0])
+			}
+			return args[0], nil
+		}},
+		"round": {params: []record.Type{num, integer}, optional: 1, resultOf: firstArg, call: round},
+		"floor": {params: []record.Type{num}, result: integer, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			return toInteger(math.Floor, args[0])
+		}},
+		"ceil": {params: []record.Type{num}, result: integer, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			return toInteger(math.Ceil, args[0])
+		}},
+		"min": {params: []record.Type{any_}, variadic: true, nulls: true, resultOf: commonArgs, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			return extreme(args, -1)
+		}},
+		"max": {params: []record.Type{any_}, variadic: true, nulls: true, resultOf: commonArgs, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			return extreme(args, 1)
+		}},
+
+		// Nulls
+		"coalesce": {params: []record.Type{any_}, variadic: true, nulls: true, resultOf: commonArgs, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			for _, arg := range args {
+				if arg != nil {
+					return arg, nil
+				}
+			}
+			return nil, nil
+		}},
+		"is_null": {params: []record.Type{any_}, nulls: true, result: record.TypeBoolean, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			return args[0] == nil, nil
+		}},
+
+		// Conversions
+		"string": {params: []record.Type{any_}, result: str, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			return toString(args[0]), nil
+		}},
+		"int": {params: []record.Type{any_}, result: integer, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			return convertInt(args[0])
+		}},
+		"float": {params: []record.Type{any_}, result: record.TypeFloat, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			return convertFloat(args[0])
+		}},
+		"decimal": {params: []record.Type{any_}, result: record.TypeDecimal, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			return convertDecimal(args[0])
+		}},
+
+		// Dates and times
+		"now": {result: record.TypeTimestamp, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			return time.Now().UTC(), nil
+		}},
+		"today": {result: record.TypeDate, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			return time.Now().UTC().Format(time.DateOnly), nil
+		}},
+		"date": {params: []record.Type{tm, str}, optional: 1, result: record.TypeDate, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			t, err := parseTimeArg(args)
+			if err != nil {
+				return nil, err
+			}
+			return t.Format(time.DateOnly), nil
+		}},
+		"timestamp": {params: []record.Type{any_, str}, optional: 1, result: record.TypeTimestamp, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			if numeric(args[0]) > 0 {
+				// Epoch seconds.
+				sec, frac := math.Modf(toFloat(args[0]))
+				return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+			}
+			return parseTimeArg(args)
+		}},
+		"year":    timePart(func(t time.Time) int { return t.Year() }),
+		"month":   timePart(func(t time.Time) int { return int(t.Month()) }),
+		"day":     timePart(func(t time.Time) int { return t.Day() }),
+		"hour":    timePart(func(t time.Time) int { return t.Hour() }),
+		"minute":  timePart(func(t time.Time) int { return t.Minute() }),
+		"second":  timePart(func(t time.Time) int { return t.Second() }),
+		"weekday": timePart(isoWeekday),
+		"date_add": {params: []record.Type{tm, integer, str}, unit: 3, resultOf: timeArg, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			t, dateOnly, err := toTime(args[0])
+			if err != nil {
+				return nil, err
+			}
+			t, err = addTime(t, int(args[1].(int64)), args[2].(string))
+			if err != nil {
+				return nil, err
+			}
+			return timeResult(t, dateOnly), nil
+		}},
+		"date_diff": {params: []record.Type{tm, tm, str}, unit: 3, result: integer, call: dateDiff},
+		"date_trunc": {params: []record.Type{tm, str}, unit: 2, resultOf: timeArg, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			t, dateOnly, err := toTime(args[0])
+			if err != nil {
+				return nil, err
+			}
+			t, err = truncTime(t, args[1].(string))
+			if err != nil {
+				return nil, err
+			}
+			return timeResult(t, dateOnly), nil
+		}},
+		"format_time": {params: []record.Type{tm, str}, result: str, call: func(args []any, _ *regexp.Regexp) (any, error) {
+			t, _, err := toTime(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return t.Format(args[1].(string)), nil
+		}},
+	}
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\v' || r == '\f'
+}
+
+func firstArg(args []record.Type) record.Type {
+	return args[0]
+}
+
+func commonArgs(args []record.Type) record.Type {
+	t := args[0]
+	for _, arg := range args[1:] {
+		t = common(t, arg)
+	}
+	return t
+}
+
+// timeArg keeps dates as dates and timestamps as timestamps.
+func timeArg(args []record.Type) record.Type {
+	if args[0] == record.TypeDate || args[0] == record.TypeTimestamp {
+		return args[0]
+	}
+	return record.TypeAny
+}
+
+// substr returns length characters from the 1-based position start, or
+// the rest of the string.
+func substr(args []any, _ *regexp.Regexp) (any, error) {
+	runes := []rune(args[0].(string))
+	start := int(max(args[1].(int64), 1)) - 1
+	if start >= len(runes) {
+		return "", nil
+	}
+	end := len(runes)
+	if len(args) > 2 {
+		n := args[2].(int64)
+		if n < 0 {
+			return nil, fmt.Errorf("substr length must not be negative")
+		}
+		end = int(min(int64(start)+n, int64(end)))
+	}
+	return string(runes[start:end]), nil
+}
+
+func pad(args []any, left bool) (any, error) {
+	s := args[0].(string)
+	n := args[1].(int64)
+	fill := " "
+	if len(args) > 2 {
+		fill = args[2].(string)
+	}
+	if n > maxPad {
+		return nil, fmt.Errorf("cannot pad to more than %d characters", maxPad)
+	}
+	count := utf8.RuneCountInString(s)
+	if int(n) <= count || fill == "" {
+		return s, nil
+	}
+
+	padding := []rune(strings.Repeat(fill, int(n)-count))[:int(n)-count]
+	if left {
+		return string(padding) + s, nil
+	}
+	return s + string(padding), nil
+}
+
+// pattern returns the literal pattern compiled with the expression, or
+// compiles a pattern computed per record.
+func pattern(re *regexp.Regexp, arg any) (*regexp.Regexp, error) {
+	if re != nil {
+		return re, nil
+	}
+	s, ok := arg.(string)
+	if !ok {
+		return nil, fmt.Errorf("pattern must be a string, found %s", typeName(arg))
+	}
+	return regexp.Compile(s)
+}
+
+// regexExtract returns the first match of the pattern, or of one of its
+// groups, and null when there is none.
+func regexExtract(args []any, re *regexp.Regexp) (any, error) {
+	re, err := pattern(re, args[1])
+	if err != nil {
+		return nil, err
+	}
+	group := 0
+	if len(args) > 2 {
+		group = int(args[2].(int64))
+	}
+	if group < 0 || group > re.NumSubexp() {
+		return nil, fmt.Errorf("pattern has no group %d", group)
+	}
+
+	match := re.FindStringSubmatch(args[0].(string))
+	if match == nil {
+		return nil, nil
+	}
+	return match[group], nil
+}
+
+// round rounds half away from zero to the given number of fractional
+// digits.
+func round(args []any, _ *regexp.Regexp) (any, error) {
+	digits := int64(0)
+	if len(args) > 1 {
+		digits = args[1].(int64)
+	}
+	if digits < 0 || digits > 18 {
+		return nil, fmt.Errorf("round digits must be between 0 and 18")
+	}
+
+	switch x := args[0].(type) {
+	case int64:
+		return x, nil
+	case float64:
+		scale := math.Pow10(int(digits))
+		return math.Round(x*scale) / scale, nil
+	case decimal:
+		// FloatString rounds half away from zero.
+		r, _ := new(big.Rat).SetString(x.rat.FloatString(int(digits)))
+		return decimal{rat: r, scale: int(digits)}, nil
+	}
+	return nil, fmt.Errorf("cannot round %s", typeName(args[0]))
+}
+
+func toInteger(fn func(float64) float64, x any) (any, error) {
+	switch x := x.(type) {
+	case int64:
+		return x, nil
+	case decimal:
+		q := new(big.Int)
+		m := new(big.Int)
+		q.DivMod(x.rat.Num(), x.rat.Denom(), m) // floors
+		if m.Sign() != 0 && fn(0.5) == 1 {
+			q.Add(q, big.NewInt(1))
+		}
+		if !q.IsInt64() {
+			return nil, fmt.Errorf("integer overflow")
+		}
+		return q.Int64(), nil
+	case float64:
+		f := fn(x)
+		if math.IsNaN(f) || math.Abs(f) >= 1<<63 {
+			return nil, fmt.Errorf("integer overflow")
+		}
+		return int64(f), nil
+	}
+	return nil, fmt.Errorf("cannot convert %s to an integer", typeName(x))
+}
+
+// extreme returns the smallest (sign -1) or largest (sign 1) non-null
+// argument.
+func extreme(args []any, sign int) (any, error) {
+	var best any
+	for _, arg := range args {
+		if arg == nil {
+			continue
+		}
+		if best == nil {
+			best = arg
+			continue
+		}
+		c, err := order(arg, best)
+		if err != nil {
+			return nil, err
+		}
+		if c*sign > 0 {
+			best = arg
+		}
+	}
+	return best, nil
+}
+
+func convertInt(x any) (any, error) {
+	switch x := x.(type) {
+	case int64:
+		return x, nil
+	case decimal, float64:
+		return toInteger(math.Trunc, x)
+	case bool:
+		if x {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case string:
+		s := strings.TrimSpace(x)
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+		return nil, fmt.Errorf("invalid integer %q", x)
+	}
+	return nil, fmt.Errorf("cannot convert %s to an integer", typeName(x))
+}
+
+func convertFloat(x any) (any, error) {
+	switch x := x.(type) {
+	case int64, decimal, float64:
+		return toFloat(x), nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float %q", x)
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("cannot convert %s to a float", typeName(x))
+}
+
+func convertDecimal(x any) (any, error) {
+	switch x := x.(type) {
+	case int64, decimal:
+		return toDecimal(x), nil
+	case float64:
+		return parseNumber(strconv.FormatFloat(x, 'f', -1, 64)), nil
+	case string:
+		s := strings.TrimSpace(x)
+		if _, ok := new(big.Rat).SetString(s); !ok || strings.ContainsAny(s, "/eE") {
+			return nil, fmt.Errorf("invalid decimal %q", x)
+		}
+		return toDecimal(parseNumber(s)), nil
+	}
+	return nil, fmt.Errorf("cannot convert %s to a decimal", typeName(x))
+}
+
+// toString formats a value the way it is written to JSON lines files.
+func toString(x any) string {
+	switch x := x.(type) {
+	case string:
+		return x
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case decimal:
+		return x.String()
+	case bool:
+		return strconv.FormatBool(x)
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(export(x))
+}
+
+// timeLayouts are tried in turn to read times from strings.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	time.DateOnly,
+}
+
+// toTime reads a time. dateOnly reports whether the value is a date
+// without a time of day.
+func toTime(x any) (t time.Time, dateOnly bool, err error) {
+	switch x := x.(type) {
+	case time.Time:
+		return x, false, nil
+	case string:
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, x); err == nil {
+				return t, layout == time.DateOnly, nil
+			}
+		}
+		return time.Time{}, false, fmt.Errorf("invalid time %q", x)
+	}
+	return time.Time{}, false, fmt.Errorf("expected a time, found %s", typeName(x))
+}
+
+func parseTimeArg(args []any) (time.Time, error) {
+	if len(args) > 1 {
+		s, ok := args[0].(string)
+		if !ok {
+			return time.Time{}, fmt.Errorf("only strings are parsed with a layout")
+		}
+		t, err := time.Parse(args[1].(string), s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q, expected the layout %s", s, args[1])
+		}
+		return t, nil
+	}
+	t, _, err := toTime(args[0])
+	return t, err
+}
+
+func timeResult(t time.Time, dateOnly bool) any {
+	if dateOnly {
+		return t.Format(time.DateOnly)
+	}
+	return t
+}
+
+func isoWeekday(t time.Time) int {
+	if t.Weekday() == time.Sunday {
+		return 7
+	}
+	return int(t.Weekday())
+}
+
+var timeUnits = []string{"second", "minute", "hour", "day", "week", "month", "year"}
+
+func checkUnit(unit string) error {
+	if !slices.Contains(timeUnits, unit) {
+		return fmt.Errorf("unknown unit %q, expected one of %s", unit, strings.Join(timeUnits, ", "))
+	}
+	return nil
+}
+
+func addTime(t time.Time, n int, unit string) (time.Time, error) {
+	switch unit {
+	case "second":
+		return t.Add(time.Duration(n) * time.Second), nil
+	case "minute":
+		return t.Add(time.Duration(n) * time.Minute), nil
+	case "hour":
+		return t.Add(time.Duration(n) * time.Hour), nil
+	case "day":
+		return t.AddDate(0, 0, n), nil
+	case "week":
+		return t.AddDate(0, 0, 7*n), nil
+	case "month":
+		return t.AddDate(0, n, 0), nil
+	case "year":
+		return t.AddDate(n, 0, 0), nil
+	}
+	return t, checkUnit(unit)
+}
+
+func truncTime(t time.Time, unit string) (time.Time, error) {
+	y, m, d := t.Date()
+	switch unit {
+	case "second":
+		return t.Truncate(time.Second), nil
+	case "minute":
+		return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, t.Location()), nil
+	case "hour":
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, t.Location()), nil
+	case "day":
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location()), nil
+	case "week":
+		return time.Date(y, m, d-isoWeekday(t)+1, 0, 0, 0, 0, t.Location()), nil
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location()), nil
+	case "year":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, t.Location()), nil
+	}
+	return t, checkUnit(unit)
+}
+
+// dateDiff counts the whole units from the second time to the first, so
+// date_diff(end, start, 'day') is positive when end is later.
+func dateDiff(args []any, _ *regexp.Regexp) (any, error) {
+	a, _, err := toTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	b, _, err := toTime(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	unit := args[2].(string)
+	switch unit {
+	case "month", "year":
+		months := (a.Year()-b.Year())*12 + int(a.Month()) - int(b.Month())
+		// Do not count a month that is not complete yet.
+		if months > 0 && a.Before(b.AddDate(0, months, 0)) {
+			months--
+		} else if months < 0 && a.After(b.AddDate(0, months, 0)) {
+			months++
+		}
+		if unit == "year" {
+			return int64(months / 12), nil
+		}
+		return int64(months), nil
+	}
+
+	units := map[string]time.Duration{
+		"second": time.Second,
+		"minute": time.Minute,
+		"hour":   time.Hour,
+		"day":    24 * time.Hour,
+		"week":   7 * 24 * time.Hour,
+	}
+	d, ok := units[unit]
+	if !ok {
+		return nil, checkUnit(unit)
+	}
+	return int64(a.Sub(b) / d), nil
+}
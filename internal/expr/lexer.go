@@ -0,0 +1,163 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	// quoted is set on identifiers written in backquotes, which are
+	// always column names.
+	quoted bool
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return fmt.Sprintf("string %q", t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// operators lists the operator tokens. The lexer takes the longest one
+// that matches.
+var operators = []string{
+	"(", ")", "[", "]", ",", "+", "-", "*", "/", "%",
+	"==", "!=", "<", "<=", ">", ">=", "!", "&&", "||", "??", "?", ":",
+}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(src) {
+				r, size := utf8.DecodeRuneInString(src[i:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{tokenIdent, src[start:i], start, false})
+		case r == '`':
+			// Quoted identifiers name columns with spaces or symbols.
+			end := strings.IndexByte(src[i+1:], '`')
+			if end < 0 {
+				return nil, errorf(i, "unterminated quoted column")
+			}
+			if end == 0 {
+				return nil, errorf(i, "empty quoted column")
+			}
+			tokens = append(tokens, token{tokenIdent, src[i+1 : i+1+end], i, true})
+			i += end + 2
+		case r >= '0' && r <= '9' || (r == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			end := lexNumber(src, i)
+			tokens = append(tokens, token{tokenNumber, src[i:end], i, false})
+			i = end
+		case r == '\'' || r == '"':
+			text, end, err := lexString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenString, text, i, false})
+			i = end
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(src[i:], candidate) && len(candidate) > len(op) {
+					op = candidate
+				}
+			}
+			if op == "" {
+				return nil, errorf(i, "unexpected character %q", r)
+			}
+			tokens = append(tokens, token{tokenOperator, op, i, false})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(src), false}), nil
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func lexNumber(src string, i int) int {
+	for i < len(src) && isDigit(src[i]) {
+		i++
+	}
+	if i < len(src) && src[i] == '.' {
+		i++
+		for i < len(src) && isDigit(src[i]) {
+			i++
+		}
+	}
+	if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+		j := i + 1
+		if j < len(src) && (src[j] == '+' || src[j] == '-') {
+			j++
+		}
+		if j < len(src) && isDigit(src[j]) {
+			i = j
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+		}
+	}
+	return i
+}
+
+// lexString reads a string quoted with ' or ". A backslash escapes the
+// quote, a backslash, or one of \n, \t and \r.
+func lexString(src string, start int) (string, int, error) {
+	quote := src[start]
+	var b strings.Builder
+	for i := start + 1; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\':
+			i++
+			if i == len(src) {
+				return "", 0, errorf(start, "unterminated string")
+			}
+			switch src[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '\\', '\'', '"':
+				b.WriteByte(src[i])
+			default:
+				return "", 0, errorf(i-1, "unknown escape \\%c", src[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, errorf(start, "unterminated string")
+}
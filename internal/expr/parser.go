@@ -0,0 +1,387 @@
+package expr
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+const (
+	// maxLength and maxDepth bound the work a single expression can ask
+	// for when it is compiled.
+	maxLength = 4096
+	maxDepth  = 64
+)
+
+// node is an element of the syntax tree.
+type node interface {
+	pos() int
+}
+
+type literal struct {
+	at    int
+	value any
+}
+
+type ident struct {
+	at   int
+	name string
+}
+
+type unary struct {
+	at int
+	op string
+	x  node
+}
+
+type binary struct {
+	at   int
+	op   string
+	x, y node
+	// re is the compiled pattern of matches when it is a literal.
+	re *regexp.Regexp
+}
+
+type ternary struct {
+	at                    int
+	cond, then, otherwise node
+}
+
+type list struct {
+	at    int
+	items []node
+}
+
+type call struct {
+	at   int
+	name string
+	fn   *function
+	args []node
+	// re is the compiled pattern argument of regex functions when it is a
+	// literal.
+	re *regexp.Regexp
+}
+
+func (n *literal) pos() int { return n.at }
+func (n *ident) pos() int   { return n.at }
+func (n *unary) pos() int   { return n.at }
+func (n *binary) pos() int  { return n.at }
+func (n *ternary) pos() int { return n.at }
+func (n *list) pos() int    { return n.at }
+func (n *call) pos() int    { return n.at }
+
+// precedence of the binary operators; higher binds tighter.
+var precedence = map[string]int{
+	"??":  1,
+	"or":  2,
+	"and": 3,
+	"==":  4, "!=": 4, "<": 4, "<=": 4, ">": 4, ">=": 4, "in": 4, "matches": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+// keywords are the operators written as words. They cannot name columns
+// unless quoted.
+var keywords = map[string]bool{
+	"and": true, "or": true, "not": true, "in": true, "matches": true,
+	"true": true, "false": true, "null": true,
+}
+
+// canonical maps the symbolic spelling of operators to their word.
+var canonical = map[string]string{
+	"||": "or",
+	"&&": "and",
+	"!":  "not",
+}
+
+type parser struct {
+	tokens []token
+	i      int
+	depth  int
+}
+
+func parse(src string) (node, error) {
+	if len(src) > maxLength {
+		return nil, errorf(maxLength, "expression is longer than %d characters", maxLength)
+	}
+
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	n, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, errorf(t.pos, "unexpected %s", t)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+// is reports whether the next token is the given operator.
+func (p *parser) is(op string) bool {
+	t := p.peek()
+	return t.kind == tokenOperator && t.text == op
+}
+
+func (p *parser) expect(op string) error {
+	t := p.next()
+	if t.kind != tokenOperator || t.text != op {
+		return errorf(t.pos, "expected %q, found %s", op, t)
+	}
+	return nil
+}
+
+// operator returns the binary operator the next token spells, if any.
+func (p *parser) operator() (string, bool) {
+	t := p.peek()
+	if t.kind == tokenIdent && !t.quoted && keywords[t.text] {
+		_, ok := precedence[t.text]
+		return t.text, ok
+	}
+	if t.kind != tokenOperator {
+		return "", false
+	}
+	op := t.text
+	if c, ok := canonical[op]; ok {
+		op = c
+	}
+	_, ok := precedence[op]
+	return op, ok
+}
+
+// expression parses a full expression: a binary expression optionally
+// followed by "? then : else".
+func (p *parser) expression() (node, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxDepth {
+		return nil, errorf(p.peek().pos, "expression is nested deeper than %d levels", maxDepth)
+	}
+
+	cond, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.is("?") {
+		return cond, nil
+	}
+	at := p.next().pos
+
+	then, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	return &ternary{at: at, cond: cond, then: then, otherwise: otherwise}, nil
+}
+
+// binary parses binary operators binding tighter than min by precedence
+// climbing. All binary operators are left associative.
+func (p *parser) binary(min int) (node, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.operator()
+		if !ok || precedence[op] <= min {
+			return x, nil
+		}
+		t := p.next()
+
+		y, err := p.binary(precedence[op])
+		if err != nil {
+			return nil, err
+		}
+		b := &binary{at: t.pos, op: op, x: x, y: y}
+		if op == "matches" {
+			if b.re, err = literalPattern(y); err != nil {
+				return nil, err
+			}
+		}
+		x = b
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	t := p.peek()
+	op := ""
+	switch {
+	case t.kind == tokenOperator && (t.text == "-" || t.text == "!"):
+		op = t.text
+	case t.kind == tokenIdent && !t.quoted && t.text == "not":
+		op = t.text
+	}
+	if op == "" {
+		return p.operand()
+	}
+	if c, ok := canonical[op]; ok {
+		op = c
+	}
+
+	p.next()
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxDepth {
+		return nil, errorf(t.pos, "expression is nested deeper than %d levels", maxDepth)
+	}
+
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return &unary{at: t.pos, op: op, x: x}, nil
+}
+
+func (p *parser) operand() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		return &literal{at: t.pos, value: json.Number(t.text)}, nil
+	case tokenString:
+		return &literal{at: t.pos, value: t.text}, nil
+	case tokenIdent:
+		if t.quoted {
+			return &ident{at: t.pos, name: t.text}, nil
+		}
+		switch t.text {
+		case "true":
+			return &literal{at: t.pos, value: true}, nil
+		case "false":
+			return &literal{at: t.pos, value: false}, nil
+		case "null":
+			return &literal{at: t.pos, value: nil}, nil
+		}
+		if keywords[t.text] {
+			return nil, errorf(t.pos, "unexpected %s", t)
+		}
+		if p.is("(") {
+			return p.call(t)
+		}
+		return &ident{at: t.pos, name: t.text}, nil
+	case tokenOperator:
+		switch t.text {
+		case "(":
+			x, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		case "[":
+			items, err := p.arguments("]")
+			if err != nil {
+				return nil, err
+			}
+			return &list{at: t.pos, items: items}, nil
+		}
+	}
+	return nil, errorf(t.pos, "unexpected %s", t)
+}
+
+func (p *parser) call(name token) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, errorf(name.pos, "unknown function %s", name.text)
+	}
+	p.next() // (
+
+	args, err := p.arguments(")")
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < fn.minArgs() || (!fn.variadic && len(args) > len(fn.params)) {
+		return nil, errorf(name.pos, "%s takes %s, found %d", name.text, fn.arity(), len(args))
+	}
+
+	c := &call{at: name.pos, name: name.text, fn: fn, args: args}
+	if fn.pattern > 0 && fn.pattern <= len(args) {
+		if c.re, err = literalPattern(args[fn.pattern-1]); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// arguments parses a comma separated list of expressions up to the
+// closing token.
+func (p *parser) arguments(end string) ([]node, error) {
+	var args []node
+	if p.is(end) {
+		p.next()
+		return args, nil
+	}
+	for {
+		arg, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		if p.is(end) {
+			p.next()
+			return args, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// literalPattern compiles a regular expression given as a string literal
+// up front, so that invalid patterns are compile errors.
+func literalPattern(n node) (*regexp.Regexp, error) {
+	l, ok := n.(*literal)
+	if !ok {
+		return nil, nil
+	}
+	s, ok := l.value.(string)
+	if !ok {
+		return nil, errorf(l.at, "pattern must be a string")
+	}
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return nil, errorf(l.at, "invalid pattern: %v", err)
+	}
+	return re, nil
+}
+
+// Error is a compile error. Pos is the 1-based offset of the character
+// the error refers to.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos, e.Msg)
+}
+
+func errorf(pos int, format string, args ...any) error {
+	return &Error{Pos: pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,359 @@
+package expr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/record"
+)
+
+// decimal is an exact number with a fixed number of fractional digits,
+// used for numbers such as prices that must not pick up float rounding.
+type decimal struct {
+	rat   *big.Rat
+	scale int
+}
+
+func (d decimal) String() string {
+	return d.rat.FloatString(d.scale)
+}
+
+var errDivisionByZero = errors.New("division by zero")
+
+// normalize converts a record value to the kinds the evaluator works on:
+// nil, bool, string, int64, float64, decimal and time.Time. Other values,
+// such as nested objects, are passed through unchanged.
+func normalize(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		return parseNumber(string(v))
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint:
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+		return float64(v)
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+		return float64(v)
+	case float32:
+		return float64(v)
+	case []byte:
+		return string(v)
+	}
+	return v
+}
+
+// parseNumber reads a JSON number as an integer, a decimal when it has a
+// fraction, or a float when it has an exponent.
+func parseNumber(s string) any {
+	if strings.ContainsAny(s, "eE") {
+		f, _ := new(big.Float).SetString(s)
+		if f == nil {
+			return s
+		}
+		v, _ := f.Float64()
+		return v
+	}
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return s
+		}
+		return decimal{rat: r, scale: len(s) - i - 1}
+	}
+
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v
+	}
+	// Too large for an int64.
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return s
+	}
+	return decimal{rat: r}
+}
+
+// export converts an evaluated value back into a record value.
+func export(v any) any {
+	switch v := v.(type) {
+	case decimal:
+		return json.Number(v.String())
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = export(item)
+		}
+		return out
+	}
+	return v
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case decimal:
+		return string(record.TypeDecimal)
+	}
+	return string(record.TypeOf(v))
+}
+
+// numeric ranks the number kinds. Operations between two numbers are done
+// in the kind ranked higher.
+func numeric(v any) int {
+	switch v.(type) {
+	case int64:
+		return 1
+	case decimal:
+		return 2
+	case float64:
+		return 3
+	}
+	return 0
+}
+
+func toDecimal(v any) decimal {
+	switch v := v.(type) {
+	case int64:
+		return decimal{rat: new(big.Rat).SetInt64(v)}
+	case decimal:
+		return v
+	}
+	return decimal{}
+}
+
+func toFloat(v any) float64 {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case decimal:
+		f, _ := v.rat.Float64()
+		return f
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// arithmetic applies +, -, *, / or %. Any null operand makes the result
+// null.
+func arithmetic(op string, x, y any) (any, error) {
+	if x == nil || y == nil {
+		return nil, nil
+	}
+
+	if xs, ok := x.(string); ok && op == "+" {
+		if ys, ok := y.(string); ok {
+			return xs + ys, nil
+		}
+	}
+
+	kind := max(numeric(x), numeric(y))
+	if numeric(x) == 0 || numeric(y) == 0 {
+		return nil, fmt.Errorf("cannot apply %s to %s and %s", op, typeName(x), typeName(y))
+	}
+	if op == "/" && kind == 1 {
+		// Integer division would silently drop the remainder.
+		kind = 3
+	}
+
+	switch kind {
+	case 1:
+		return intArithmetic(op, x.(int64), y.(int64))
+	case 2:
+		return decimalArithmetic(op, toDecimal(x), toDecimal(y))
+	}
+	return floatArithmetic(op, toFloat(x), toFloat(y))
+}
+
+func intArithmetic(op string, a, b int64) (any, error) {
+	var r int64
+	switch op {
+	case "+":
+		r = a + b
+		if (r > a) != (b > 0) {
+			return nil, errors.New("integer overflow")
+		}
+	case "-":
+		r = a - b
+		if (r < a) != (b > 0) {
+			return nil, errors.New("integer overflow")
+		}
+	case "*":
+		if a != 0 && b != 0 {
+			r = a * b
+			if r/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+				return nil, errors.New("integer overflow")
+			}
+		}
+	case "%":
+		if b == 0 {
+			return nil, errDivisionByZero
+		}
+		r = a % b
+	}
+	return r, nil
+}
+
+// decimalArithmetic keeps the scale of the operands: the larger one for
+// sums, their total for products, and at least six digits for quotients.
+func decimalArithmetic(op string, a, b decimal) (any, error) {
+	r := new(big.Rat)
+	scale := max(a.scale, b.scale)
+	switch op {
+	case "+":
+		r.Add(a.rat, b.rat)
+	case "-":
+		r.Sub(a.rat, b.rat)
+	case "*":
+		r.Mul(a.rat, b.rat)
+		scale = a.scale + b.scale
+	case "/":
+		if b.rat.Sign() == 0 {
+			return nil, errDivisionByZero
+		}
+		r.Quo(a.rat, b.rat)
+		scale = max(scale, 6)
+	case "%":
+		if b.rat.Sign() == 0 {
+			return nil, errDivisionByZero
+		}
+		// a - b * trunc(a / b), the sign follows the dividend like for
+		// integers.
+		q := new(big.Rat).Quo(a.rat, b.rat)
+		trunc := new(big.Int).Quo(q.Num(), q.Denom())
+		r.Sub(a.rat, new(big.Rat).Mul(b.rat, new(big.Rat).SetInt(trunc)))
+	}
+	return decimal{rat: r, scale: scale}, nil
+}
+
+func floatArithmetic(op string, a, b float64) (any, error) {
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, errDivisionByZero
+		}
+		return a / b, nil
+	case "%":
+		if b == 0 {
+			return nil, errDivisionByZero
+		}
+		return math.Mod(a, b), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", op)
+}
+
+func negate(x any) (any, error) {
+	switch x := x.(type) {
+	case nil:
+		return nil, nil
+	case int64:
+		if x == math.MinInt64 {
+			return nil, errors.New("integer overflow")
+		}
+		return -x, nil
+	case decimal:
+		return decimal{rat: new(big.Rat).Neg(x.rat), scale: x.scale}, nil
+	case float64:
+		return -x, nil
+	}
+	return nil, fmt.Errorf("cannot negate %s", typeName(x))
+}
+
+// equal compares two values for == and !=. Null equals only null, numbers
+// compare by value whatever their kind, and values that cannot be ordered
+// against each other are not equal.
+func equal(x, y any) bool {
+	if x == nil || y == nil {
+		return x == nil && y == nil
+	}
+	if xb, ok := x.(bool); ok {
+		yb, ok := y.(bool)
+		return ok && xb == yb
+	}
+	c, err := order(x, y)
+	return err == nil && c == 0
+}
+
+// order compares two numbers, strings or times. Strings compared with
+// times are read as times.
+func order(x, y any) (int, error) {
+	if numeric(x) > 0 && numeric(y) > 0 {
+		return compareNumbers(x, y), nil
+	}
+
+	switch xv := x.(type) {
+	case string:
+		switch yv := y.(type) {
+		case string:
+			return strings.Compare(xv, yv), nil
+		case time.Time:
+			xt, _, err := toTime(xv)
+			if err != nil {
+				return 0, err
+			}
+			return xt.Compare(yv), nil
+		}
+	case time.Time:
+		if _, ok := y.(string); ok {
+			c, err := order(y, x)
+			return -c, err
+		}
+		if yv, ok := y.(time.Time); ok {
+			return xv.Compare(yv), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %s and %s", typeName(x), typeName(y))
+}
+
+func compareNumbers(x, y any) int {
+	switch max(numeric(x), numeric(y)) {
+	case 1:
+		a, b := x.(int64), y.(int64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case 2:
+		return toDecimal(x).rat.Cmp(toDecimal(y).rat)
+	}
+	a, b := toFloat(x), toFloat(y)
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,377 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBatchSize = 500
+	DefaultBuffer    = 4
+)
+
+// Writer receives the records of a Source. Write blocks while the next
+// stage is behind, which is how backpressure reaches the source.
+type Writer interface {
+	Write(r Record) error
+}
+
+// Source produces records. Read returns once the input is exhausted.
+type Source interface {
+	Read(ctx context.Context, w Writer) error
+}
+
+// Transform maps each batch to a new one. The returned batch may be
+// shorter or longer than its input, or empty.
+type Transform interface {
+	Apply(ctx context.Context, batch Batch) (Batch, error)
+}
+
+// Flusher is implemented by transforms that hold records back, such as
+// aggregations. Flush is called once after the last batch and writes the
+// records held back to w, which batches them like the writer of a source.
+type Flusher interface {
+	Flush(ctx context.Context, w Writer) error
+}
+
+// Positioner is implemented by sources that can tell how far they have
+// read. Position is called from within Write when a batch is complete, and
+// returns the position after the last record written.
+type Positioner interface {
+	Position() any
+}
+
+// Sink writes records out. Commit is called after every record was
+// written without error; otherwise Abort discards the output.
+type Sink interface {
+	Write(ctx context.Context, batch Batch) error
+	Commit(ctx context.Context) error
+	Abort()
+}
+
+// Named lets a stage choose the name it is reported under in the stats.
+type Named interface {
+	Name() string
+}
+
+// StageStats counts what went through a stage. Wait is the time the stage
+// spent blocked on a full channel to the next stage.
+type StageStats struct {
+	Stage      string        `json:"stage"`
+	RecordsIn  int64         `json:"records_in"`
+	RecordsOut int64         `json:"records_out"`
+	Rejected   int64         `json:"rejected"`
+	BytesIn    int64         `json:"bytes_in"`
+	BytesOut   int64         `json:"bytes_out"`
+	Batches    int64         `json:"batches"`
+	Wait       time.Duration `json:"wait_ns"`
+}
+
+type Stats struct {
+	Stages []StageStats `json:"stages"`
+	// Counters are totals of the task beyond the records of each stage,
+	// such as the number of duplicates a dedupe dropped.
+	Counters map[string]int64 `json:"counters,omitempty"`
+}
+
+// Written returns the number of records the sink received and did not
+// reject.
+func (s Stats) Written() int64 {
+	if len(s.Stages) == 0 {
+		return 0
+	}
+	sink := s.Stages[len(s.Stages)-1]
+	return sink.RecordsIn - sink.Rejected
+}
+
+// Rejected returns the number of records rejected by all stages.
+func (s Stats) Rejected() int64 {
+	var n int64
+	for _, stage := range s.Stages {
+		n += stage.Rejected
+	}
+	return n
+}
+
+// Read returns the number of records the source read, including the ones
+// it rejected.
+func (s Stats) Read() int64 {
+	if len(s.Stages) == 0 {
+		return 0
+	}
+	return s.Stages[0].RecordsOut + s.Stages[0].Rejected
+}
+
+// Pipeline connects a source to a sink through zero or more transforms.
+// Every stage runs in its own goroutine, and consecutive stages share a
+// channel holding at most Buffer batches of BatchSize records.
+//
+// Records a stage cannot process are passed to Rejects with Reject. Without
+// Rejects a rejected record fails the run.
+//
+// When the source is a Positioner and Checkpoint is set, each batch carries
+// the position of the source after its last record, and Checkpoint is
+// called with it once the sink wrote the batch. Every record the source
+// read up to the position has then reached the sink, or was rejected. A
+// Flusher holds records back, so no position gets past one.
+type Pipeline struct {
+	Source     Source
+	Transforms []Transform
+	Sink       Sink
+	Rejects    Rejects
+	Checkpoint func(ctx context.Context, position any) error
+	BatchSize  int
+	Buffer     int
+}
+
+// envelope is what flows between stages: a batch, and the position of the
+// source after its last record when it is known.
+type envelope struct {
+	batch    Batch
+	position any
+}
+
+// Run streams all records from the source into the sink. The stats are
+// returned even when the run fails, to show how far it got.
+func (p *Pipeline) Run(ctx context.Context) (Stats, error) {
+	batchSize, buffer := p.BatchSize, p.Buffer
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	stats := make([]StageStats, len(p.Transforms)+2)
+	stats[0].Stage = stageName(p.Source, "source")
+	for i, t := range p.Transforms {
+		stats[i+1].Stage = stageName(t, fmt.Sprintf("transform %d", i+1))
+	}
+	stats[len(stats)-1].Stage = stageName(p.Sink, "sink")
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel(err)
+		})
+	}
+	// Stages run outside the caller's goroutine, so a panic has to be
+	// turned into an error here or it would take the process down.
+	recoverStage := func(stage string) {
+		if r := recover(); r != nil {
+			fail(fmt.Errorf("%s panicked: %v", stage, r))
+		}
+	}
+
+	in := make(chan envelope, buffer)
+	wg.Add(1)
+	go func(out chan<- envelope) {
+		defer wg.Done()
+		defer close(out)
+		defer recoverStage(stats[0].Stage)
+
+		ctx := p.stageContext(ctx, &stats[0])
+		w := &emitter{ctx: ctx, out: out, size: batchSize, stats: &stats[0], source: true}
+		if positioner, ok := p.Source.(Positioner); ok && p.Checkpoint != nil {
+			w.position = positioner.Position
+		}
+		err := p.Source.Read(ctx, w)
+		if err == nil {
+			err = w.flush()
+		}
+		if err != nil {
+			fail(err)
+		}
+	}(in)
+
+	for i, t := range p.Transforms {
+		out := make(chan envelope, buffer)
+		wg.Add(1)
+		go func(t Transform, in <-chan envelope, out chan<- envelope, s *StageStats) {
+			defer wg.Done()
+			defer close(out)
+			defer recoverStage(s.Stage)
+
+			if err := transform(p.stageContext(ctx, s), t, in, out, s, batchSize); err != nil {
+				fail(err)
+			}
+		}(t, in, out, &stats[i+1])
+		in = out
+	}
+
+	sinkStats := &stats[len(stats)-1]
+	sinkCtx := p.stageContext(ctx, sinkStats)
+	for e := range in {
+		if ctx.Err() != nil {
+			continue // drain so upstream stages can exit
+		}
+		if len(e.batch) > 0 {
+			sinkStats.count(e.batch, nil)
+			if err := p.Sink.Write(sinkCtx, e.batch); err != nil {
+				fail(err)
+				continue
+			}
+		}
+		if e.position != nil {
+			if err := p.Checkpoint(sinkCtx, e.position); err != nil {
+				fail(err)
+			}
+		}
+	}
+	wg.Wait()
+
+	if firstErr == nil {
+		if ctx.Err() != nil {
+			firstErr = context.Cause(ctx)
+		}
+	}
+	if firstErr == nil && p.Rejects != nil {
+		firstErr = p.Rejects.Finish(Stats{Stages: stats})
+	}
+	if firstErr == nil {
+		firstErr = p.Sink.Commit(ctx)
+	}
+	if firstErr != nil {
+		p.Sink.Abort()
+		return Stats{Stages: stats}, firstErr
+	}
+
+	return Stats{Stages: stats}, nil
+}
+
+func transform(ctx context.Context, t Transform, in <-chan envelope, out chan<- envelope, s *StageStats, batchSize int) error {
+	f, flusher := t.(Flusher)
+
+	var err error
+	for e := range in {
+		if err != nil {
+			continue // drain so upstream stages can exit
+		}
+		var result Batch
+		if result, err = t.Apply(ctx, e.batch); err == nil {
+			s.count(e.batch, result)
+			// The position still has to reach the sink when every record
+			// of the batch was dropped.
+			position := e.position
+			if flusher {
+				position = nil
+			}
+			err = send(ctx, out, envelope{batch: result, position: position}, s)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if flusher {
+		w := &emitter{ctx: ctx, out: out, size: batchSize, stats: s}
+		if err := f.Flush(ctx, w); err != nil {
+			return err
+		}
+		return w.flush()
+	}
+	return nil
+}
+
+// send passes a batch on, blocking while the channel is full.
+func send(ctx context.Context, out chan<- envelope, e envelope, s *StageStats) error {
+	if len(e.batch) == 0 && e.position == nil {
+		return nil
+	}
+
+	select {
+	case out <- e:
+		return nil
+	default:
+	}
+
+	start := time.Now()
+	defer func() { s.Wait += time.Since(start) }()
+
+	select {
+	case out <- e:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+func (s *StageStats) count(in, out Batch) {
+	if in != nil {
+		s.Batches++
+		s.RecordsIn += int64(len(in))
+		for _, r := range in {
+			s.BytesIn += Size(r)
+		}
+	}
+	s.RecordsOut += int64(len(out))
+	for _, r := range out {
+		s.BytesOut += Size(r)
+	}
+}
+
+// emitter is the Writer handed to a source or a Flusher. It groups records
+// into batches.
+type emitter struct {
+	ctx   context.Context
+	out   chan<- envelope
+	size  int
+	batch Batch
+	stats *StageStats
+	// source counts the batches written, which for transforms are the
+	// batches read instead.
+	source bool
+	// position, when set, returns the position of the source to send with
+	// each batch.
+	position func() any
+}
+
+func (e *emitter) Write(r Record) error {
+	if r == nil {
+		return errors.New("record: nil record")
+	}
+	if e.batch == nil {
+		e.batch = make(Batch, 0, e.size)
+	}
+	e.batch = append(e.batch, r)
+	if len(e.batch) < e.size {
+		return nil
+	}
+	return e.flush()
+}
+
+func (e *emitter) flush() error {
+	batch := e.batch
+	e.batch = nil
+	if len(batch) == 0 {
+		return nil
+	}
+	if e.source {
+		e.stats.Batches++
+	}
+	e.stats.count(nil, batch)
+
+	var position any
+	if e.position != nil {
+		position = e.position()
+	}
+	return send(e.ctx, e.out, envelope{batch: batch, position: position}, e.stats)
+}
+
+func stageName(stage any, def string) string {
+	if n, ok := stage.(Named); ok {
+		return n.Name()
+	}
+	return def
+}
@@ -0,0 +1,399 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countSource struct {
+	n       int
+	written atomic.Int64
+	err     error
+}
+
+func (s *countSource) Read(ctx context.Context, w Writer) error {
+	for i := 0; i < s.n; i++ {
+		if err := w.Write(Record{"id": int64(i)}); err != nil {
+			return err
+		}
+		s.written.Add(1)
+	}
+	return s.err
+}
+
+type memorySink struct {
+	records   []Record
+	block     chan struct{}
+	err       error
+	committed bool
+	aborted   bool
+}
+
+func (s *memorySink) Write(ctx context.Context, batch Batch) error {
+	if s.block != nil {
+		<-s.block
+	}
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, batch...)
+	return nil
+}
+
+func (s *memorySink) Commit(ctx context.Context) error {
+	s.committed = true
+	return nil
+}
+
+func (s *memorySink) Abort() {
+	s.aborted = true
+}
+
+type transformFunc func(Batch) (Batch, error)
+
+func (f transformFunc) Apply(ctx context.Context, batch Batch) (Batch, error) {
+	return f(batch)
+}
+
+// evenOnly drops odd ids and counts the records it kept in Flush.
+type evenOnly struct {
+	kept int64
+}
+
+func (e *evenOnly) Name() string { return "even" }
+
+func (e *evenOnly) Apply(ctx context.Context, batch Batch) (Batch, error) {
+	out := Batch{}
+	for _, r := range batch {
+		if r["id"].(int64)%2 == 0 {
+			out = append(out, r)
+			e.kept++
+		}
+	}
+	return out, nil
+}
+
+func (e *evenOnly) Flush(ctx context.Context, w Writer) error {
+	return w.Write(Record{"kept": e.kept})
+}
+
+func TestPipeline_Run(t *testing.T) {
+	sink := &memorySink{}
+	p := &Pipeline{
+		Source:     &countSource{n: 25},
+		Transforms: []Transform{&evenOnly{}},
+		Sink:       sink,
+		BatchSize:  10,
+	}
+
+	stats, err := p.Run(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, sink.committed)
+	assert.False(t, sink.aborted)
+	assert.Len(t, sink.records, 14)
+	assert.Equal(t, Record{"kept": int64(13)}, sink.records[13])
+
+	assert.Len(t, stats.Stages, 3)
+	source, even, out := stats.Stages[0], stats.Stages[1], stats.Stages[2]
+
+	assert.Equal(t, "source", source.Stage)
+	assert.Equal(t, int64(25), source.RecordsOut)
+	assert.Equal(t, int64(3), source.Batches)
+	assert.Equal(t, int64(25*(2+8)), source.BytesOut)
+
+	assert.Equal(t, "even", even.Stage)
+	assert.Equal(t, int64(25), even.RecordsIn)
+	assert.Equal(t, int64(14), even.RecordsOut)
+	assert.Equal(t, source.BytesOut, even.BytesIn)
+
+	assert.Equal(t, "sink", out.Stage)
+	assert.Equal(t, int64(14), out.RecordsIn)
+	assert.Equal(t, int64(14), stats.Written())
+}
+
+func TestPipeline_Backpressure(t *testing.T) {
+	source := &countSource{n: 100}
+	sink := &memorySink{block: make(chan struct{})}
+	p := &Pipeline{
+		Source: source,
+		Transforms: []Transform{transformFunc(func(b Batch) (Batch, error) {
+			return b, nil
+		})},
+		Sink:      sink,
+		BatchSize: 1,
+		Buffer:    2,
+	}
+
+	done := make(chan Stats)
+	go func() {
+		stats, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		done <- stats
+	}()
+
+	// With the sink stuck, the source fills both channels, one batch held
+	// by each of the transform and the sink, and one pending in its own
+	// Write.
+	time.Sleep(100 * time.Millisecond)
+	assert.LessOrEqual(t, source.written.Load(), int64(2+2+2+1))
+
+	close(sink.block)
+	stats := <-done
+	assert.Len(t, sink.records, 100)
+	assert.Greater(t, stats.Stages[0].Wait, time.Duration(0))
+}
+
+func TestPipeline_SourceError(t *testing.T) {
+	sink := &memorySink{}
+	p := &Pipeline{
+		Source: &countSource{n: 5, err: errors.New("bad input")},
+		Sink:   sink,
+	}
+
+	stats, err := p.Run(context.Background())
+	assert.EqualError(t, err, "bad input")
+	assert.False(t, sink.committed)
+	assert.True(t, sink.aborted)
+	// The records still waiting in the unfinished batch are not sent on.
+	assert.Equal(t, int64(0), stats.Stages[0].RecordsOut)
+	assert.Empty(t, sink.records)
+}
+
+func TestPipeline_TransformError(t *testing.T) {
+	sink := &memorySink{}
+	p := &Pipeline{
+		Source: &countSource{n: 10000},
+		Transforms: []Transform{transformFunc(func(b Batch) (Batch, error) {
+			return nil, errors.New("cannot transform")
+		})},
+		Sink:      sink,
+		BatchSize: 10,
+	}
+
+	_, err := p.Run(context.Background())
+	assert.EqualError(t, err, "cannot transform")
+	assert.Empty(t, sink.records)
+	assert.True(t, sink.aborted)
+}
+
+func TestPipeline_SinkError(t *testing.T) {
+	source := &countSource{n: 10000}
+	sink := &memorySink{err: errors.New("disk full")}
+	p := &Pipeline{Source: source, Sink: sink, BatchSize: 10, Buffer: 1}
+
+	_, err := p.Run(context.Background())
+	assert.EqualError(t, err, "disk full")
+	assert.True(t, sink.aborted)
+	assert.Less(t, source.written.Load(), int64(10000))
+}
+
+func TestPipeline_Panic(t *testing.T) {
+	sink := &memorySink{}
+	p := &Pipeline{
+		Source: &countSource{n: 3},
+		Transforms: []Transform{transformFunc(func(b Batch) (Batch, error) {
+			panic("boom")
+		})},
+		Sink: sink,
+	}
+
+	_, err := p.Run(context.Background())
+	assert.EqualError(t, err, "transform 1 panicked: boom")
+	assert.True(t, sink.aborted)
+}
+
+func TestPipeline_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	sink := &memorySink{}
+	p := &Pipeline{Source: &countSource{n: 10000}, Sink: sink, BatchSize: 1, Buffer: 1}
+
+	_, err := p.Run(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.True(t, sink.aborted)
+}
+
+type memoryRejects struct {
+	mu       sync.Mutex
+	rejected []Rejection
+	limit    int
+	finished Stats
+}
+
+func (m *memoryRejects) Reject(ctx context.Context, r Rejection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rejected = append(m.rejected, r)
+	if m.limit > 0 && len(m.rejected) > m.limit {
+		return errors.New("too many rejects")
+	}
+	return nil
+}
+
+func (m *memoryRejects) Finish(stats Stats) error {
+	m.finished = stats
+	return nil
+}
+
+// rejectOdd rejects records with odd ids.
+type rejectOdd struct{}
+
+func (rejectOdd) Name() string { return "odd" }
+
+func (rejectOdd) Apply(ctx context.Context, batch Batch) (Batch, error) {
+	out := Batch{}
+	for _, r := range batch {
+		if id := r["id"].(int64); id%2 == 1 {
+			err := Reject(ctx, Rejection{Position: fmt.Sprintf("record %d", id+1), Reason: "odd id", Record: r})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func TestPipeline_Reject(t *testing.T) {
+	t.Run("rejects are kept and counted", func(t *testing.T) {
+		rejects := &memoryRejects{}
+		sink := &memorySink{}
+		p := &Pipeline{
+			Source:     &countSource{n: 10},
+			Transforms: []Transform{rejectOdd{}},
+			Sink:       sink,
+			Rejects:    rejects,
+		}
+
+		stats, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, sink.records, 5)
+		assert.Len(t, rejects.rejected, 5)
+		assert.Equal(t, Rejection{Stage: "odd", Position: "record 2", Reason: "odd id", Record: Record{"id": int64(1)}}, rejects.rejected[0])
+		assert.Equal(t, int64(5), stats.Stages[1].Rejected)
+		assert.Equal(t, int64(5), stats.Rejected())
+		assert.Equal(t, int64(10), stats.Read())
+		assert.Equal(t, stats, rejects.finished)
+	})
+
+	t.Run("without rejects the first one fails the run", func(t *testing.T) {
+		sink := &memorySink{}
+		p := &Pipeline{
+			Source:     &countSource{n: 10},
+			Transforms: []Transform{rejectOdd{}},
+			Sink:       sink,
+		}
+
+		_, err := p.Run(context.Background())
+		assert.EqualError(t, err, "record 2: odd id")
+		assert.True(t, sink.aborted)
+	})
+
+	t.Run("rejects can stop the run", func(t *testing.T) {
+		sink := &memorySink{}
+		p := &Pipeline{
+			Source:     &countSource{n: 10},
+			Transforms: []Transform{rejectOdd{}},
+			Sink:       sink,
+			Rejects:    &memoryRejects{limit: 2},
+		}
+
+		_, err := p.Run(context.Background())
+		assert.EqualError(t, err, "too many rejects")
+		assert.True(t, sink.aborted)
+	})
+}
+
+// positionSource counts the records it read as its position.
+type positionSource struct {
+	n    int
+	read int64
+}
+
+func (s *positionSource) Read(ctx context.Context, w Writer) error {
+	for i := 0; i < s.n; i++ {
+		s.read++
+		if err := w.Write(Record{"id": int64(i)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *positionSource) Position() any {
+	return s.read
+}
+
+func TestPipeline_Checkpoint(t *testing.T) {
+	t.Run("positions follow the batches to the sink", func(t *testing.T) {
+		sink := &memorySink{}
+		var positions []any
+		var written []int
+		p := &Pipeline{
+			Source: &positionSource{n: 25},
+			// Drops the whole second batch.
+			Transforms: []Transform{transformFunc(func(b Batch) (Batch, error) {
+				if b[0]["id"].(int64) == 10 {
+					return Batch{}, nil
+				}
+				return b, nil
+			})},
+			Sink: sink,
+			Checkpoint: func(ctx context.Context, position any) error {
+				positions = append(positions, position)
+				written = append(written, len(sink.records))
+				return nil
+			},
+			BatchSize: 10,
+		}
+
+		_, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []any{int64(10), int64(20), int64(25)}, positions)
+		assert.Equal(t, []int{10, 10, 15}, written)
+	})
+
+	t.Run("no position gets past a flusher", func(t *testing.T) {
+		called := false
+		p := &Pipeline{
+			Source:     &positionSource{n: 25},
+			Transforms: []Transform{&evenOnly{}},
+			Sink:       &memorySink{},
+			Checkpoint: func(ctx context.Context, position any) error {
+				called = true
+				return nil
+			},
+			BatchSize: 10,
+		}
+
+		_, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, called)
+	})
+
+	t.Run("checkpoint error fails the run", func(t *testing.T) {
+		sink := &memorySink{}
+		p := &Pipeline{
+			Source: &positionSource{n: 25},
+			Sink:   sink,
+			Checkpoint: func(ctx context.Context, position any) error {
+				return errors.New("disk full")
+			},
+			BatchSize: 10,
+		}
+
+		_, err := p.Run(context.Background())
+		assert.EqualError(t, err, "disk full")
+		assert.True(t, sink.aborted)
+	})
+}
@@ -0,0 +1,214 @@
+// Package record moves rows between the stages of a task. A Source reads
+// records, Transforms reshape them and a Sink writes them out; the stages
+// run concurrently and exchange batches over bounded channels.
+package record
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// Record is a single row keyed by field name. Values are the types produced
+// by encoding/json with UseNumber, plus the native Go types sources emit:
+// integers, floats, bool, string, []byte, time.Time, nested maps and slices.
+type Record map[string]any
+
+// Batch is a group of records handed from one stage to the next.
+type Batch []Record
+
+type Type string
+
+const (
+	TypeString    Type = "string"
+	TypeInteger   Type = "integer"
+	TypeFloat     Type = "float"
+	TypeDecimal   Type = "decimal"
+	TypeBoolean   Type = "boolean"
+	TypeDate      Type = "date"
+	TypeTimestamp Type = "timestamp"
+	TypeBytes     Type = "bytes"
+	TypeObject    Type = "object"
+	TypeArray     Type = "array"
+	// TypeAny is used when a field holds values of different types.
+	TypeAny Type = "any"
+)
+
+type Field struct {
+	Name     string `json:"name"`
+	Type     Type   `json:"type"`
+	Nullable bool   `json:"nullable"`
+}
+
+// Schema describes the fields of the records a stage produces, in order.
+type Schema struct {
+	Fields []Field `json:"fields"`
+}
+
+// Field returns the field with the given name.
+func (s Schema) Field(name string) (Field, bool) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+func (s Schema) Names() []string {
+	names := make([]string, len(s.Fields))
+	for i, f := range s.Fields {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// Observe widens the schema to cover r. New fields are appended in the
+// order they are first seen; fields missing from r become nullable.
+func (s *Schema) Observe(r Record) {
+	seen := make(map[string]bool, len(r))
+	for i := range s.Fields {
+		f := &s.Fields[i]
+		v, ok := r[f.Name]
+		seen[f.Name] = ok
+		if !ok || v == nil {
+			f.Nullable = true
+			continue
+		}
+		f.Type = widen(f.Type, TypeOf(v))
+	}
+
+	// Map order is random, so new fields of the same record are sorted to
+	// keep the inferred schema stable.
+	var added []string
+	for name := range r {
+		if _, ok := seen[name]; !ok {
+			added = append(added, name)
+		}
+	}
+	slices.Sort(added)
+
+	// Fields first seen after the first record were missing before it.
+	missing := len(s.Fields) > 0
+	for _, name := range added {
+		v := r[name]
+		s.Fields = append(s.Fields, Field{Name: name, Type: TypeOf(v), Nullable: missing || v == nil})
+	}
+}
+
+// Infer builds a schema from a sample of records.
+func Infer(records []Record) Schema {
+	var s Schema
+	for _, r := range records {
+		s.Observe(r)
+	}
+	return s
+}
+
+// TypeOf returns the type of a record value. Nil has no type of its own
+// and reports TypeAny.
+func TypeOf(v any) Type {
+	switch v := v.(type) {
+	case nil:
+		return TypeAny
+	case string:
+		return TypeString
+	case bool:
+		return TypeBoolean
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return TypeInteger
+	case float32:
+		return TypeFloat
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return TypeInteger
+		}
+		return TypeFloat
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return TypeInteger
+		}
+		return TypeDecimal
+	case []byte:
+		return TypeBytes
+	case time.Time:
+		return TypeTimestamp
+	case map[string]any, Record:
+		return TypeObject
+	case []any:
+		return TypeArray
+	}
+	return TypeAny
+}
+
+// widen returns a type that holds values of both a and b.
+func widen(a, b Type) Type {
+	switch {
+	case a == b:
+		return a
+	case b == TypeAny && a != "":
+		return a
+	case a == TypeAny || a == "":
+		return b
+	}
+
+	numeric := map[Type]int{TypeInteger: 1, TypeDecimal: 2, TypeFloat: 3}
+	if numeric[a] > 0 && numeric[b] > 0 {
+		if numeric[a] > numeric[b] {
+			return a
+		}
+		return b
+	}
+	if (a == TypeDate && b == TypeTimestamp) || (a == TypeTimestamp && b == TypeDate) {
+		return TypeTimestamp
+	}
+	return TypeAny
+}
+
+// Size estimates the number of bytes a record takes when serialized. It is
+// used for the byte counters and does not need to be exact.
+func Size(r Record) int64 {
+	var n int64
+	for k, v := range r {
+		n += int64(len(k)) + valueSize(v)
+	}
+	return n
+}
+
+func valueSize(v any) int64 {
+	switch v := v.(type) {
+	case nil:
+		return 4
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	case json.Number:
+		return int64(len(v))
+	case bool:
+		return 1
+	case int8, uint8:
+		return 1
+	case int16, uint16:
+		return 2
+	case int32, uint32, float32:
+		return 4
+	case int, int64, uint, uint64, float64:
+		return 8
+	case time.Time:
+		return int64(len(time.RFC3339Nano))
+	case map[string]any:
+		return Size(v)
+	case Record:
+		return Size(v)
+	case []any:
+		var n int64
+		for _, e := range v {
+			n += valueSize(e)
+		}
+		return n
+	}
+	return int64(len(fmt.Sprint(v)))
+}
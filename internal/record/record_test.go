@@ -0,0 +1,64 @@
+package record
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfer(t *testing.T) {
+	schema := Infer([]Record{
+		{"id": json.Number("1"), "name": "a", "price": json.Number("1"), "at": time.Now()},
+		{"id": json.Number("2"), "name": nil, "price": json.Number("2.50"), "at": "yesterday"},
+		{"id": json.Number("3"), "price": 3.5, "tags": []any{"x"}},
+	})
+
+	assert.Equal(t, []Field{
+		{Name: "at", Type: TypeAny, Nullable: true},
+		{Name: "id", Type: TypeInteger},
+		{Name: "name", Type: TypeString, Nullable: true},
+		{Name: "price", Type: TypeFloat},
+		{Name: "tags", Type: TypeArray, Nullable: true},
+	}, schema.Fields)
+	assert.Equal(t, []string{"at", "id", "name", "price", "tags"}, schema.Names())
+
+	field, ok := schema.Field("price")
+	assert.True(t, ok)
+	assert.Equal(t, TypeFloat, field.Type)
+	_, ok = schema.Field("missing")
+	assert.False(t, ok)
+}
+
+func TestTypeOf(t *testing.T) {
+	tests := []struct {
+		value any
+		want  Type
+	}{
+		{"x", TypeString},
+		{true, TypeBoolean},
+		{int32(1), TypeInteger},
+		{float64(2), TypeInteger},
+		{2.5, TypeFloat},
+		{json.Number("10"), TypeInteger},
+		{json.Number("10.25"), TypeDecimal},
+		{[]byte("x"), TypeBytes},
+		{time.Now(), TypeTimestamp},
+		{map[string]any{}, TypeObject},
+		{[]any{}, TypeArray},
+		{nil, TypeAny},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, TypeOf(tt.value), "%#v", tt.value)
+	}
+}
+
+func TestSize(t *testing.T) {
+	r := Record{
+		"name":   "haku",
+		"n":      int64(1),
+		"nested": map[string]any{"ok": true},
+	}
+	assert.Equal(t, int64(4+4+1+8+6+2+1), Size(r))
+}
@@ -0,0 +1,61 @@
+package record
+
+import (
+	"context"
+)
+
+// Rejection is a record a stage could not process, such as a line that
+// does not parse or a value that does not cast.
+type Rejection struct {
+	// Stage is filled in by Reject.
+	Stage string `json:"stage"`
+	// Position locates the record in the input of the stage, for instance
+	// "line 12" or "record 3".
+	Position string `json:"position"`
+	Reason   string `json:"reason"`
+	// Record is the rejected record, or its raw text when it did not parse.
+	Record any `json:"record"`
+}
+
+func (r Rejection) Error() string {
+	if r.Position == "" {
+		return r.Reason
+	}
+	return r.Position + ": " + r.Reason
+}
+
+// Rejects receives the records rejected by the stages of a pipeline. It
+// must be safe for concurrent use, as stages run in their own goroutines.
+type Rejects interface {
+	// Reject keeps a rejected record. An error fails the run, for instance
+	// once too many records were rejected.
+	Reject(ctx context.Context, r Rejection) error
+	// Finish is called with the final stats before the sink commits. An
+	// error fails the run and discards the output.
+	Finish(stats Stats) error
+}
+
+type stageKey struct{}
+
+type stage struct {
+	rejects Rejects
+	stats   *StageStats
+}
+
+func (p *Pipeline) stageContext(ctx context.Context, stats *StageStats) context.Context {
+	return context.WithValue(ctx, stageKey{}, &stage{rejects: p.Rejects, stats: stats})
+}
+
+// Reject passes a record the calling stage cannot process to the rejects
+// of its pipeline and counts it. The stage carries on unless Reject returns
+// an error, which it always does when the pipeline has no rejects.
+func Reject(ctx context.Context, r Rejection) error {
+	s, ok := ctx.Value(stageKey{}).(*stage)
+	if !ok || s.rejects == nil {
+		return r
+	}
+
+	r.Stage = s.stats.Stage
+	s.stats.Rejected++
+	return s.rejects.Reject(ctx, r)
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+// ColumnProfile holds the statistics a profile run computed for one
+// column.
+type ColumnProfile struct {
+	ID        int64           `json:"id"`
+	RunID     int64           `json:"run_id"`
+	TaskID    int64           `json:"task_id"`
+	Column    string          `json:"column"`
+	Stats     json.RawMessage `json:"stats"`
+	CreatedAt string          `json:"created_at"`
+}
+
+type ColumnProfilesStore struct {
+	db *sql.DB
+}
+
+// Create stores the profiles of a run in a single transaction.
+func (s *ColumnProfilesStore) Create(ctx context.Context, profiles []ColumnProfile) error {
+	query := `
+		INSERT INTO column_profiles (run_id, task_id, column_name, stats)
+		VALUES ($1, $2, $3, $4) RETURNING id, created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := range profiles {
+		p := &profiles[i]
+		if err := tx.QueryRowContext(
+			ctx,
+			query,
+			p.RunID,
+			p.TaskID,
+			p.Column,
+			[]byte(p.Stats),
+		).Scan(
+			&p.ID,
+			&p.CreatedAt,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *ColumnProfilesStore) GetByRun(ctx context.Context, runID int64) ([]ColumnProfile, error) {
+	query := `
+		SELECT id, run_id, task_id, column_name, stats, created_at
+		FROM column_profiles WHERE run_id=$1
+		ORDER BY id
+	`
+	return s.query(ctx, query, runID)
+}
+
+// GetByTask returns the profiles of a column across the runs of a task,
+// most recent first.
+func (s *ColumnProfilesStore) GetByTask(ctx context.Context, taskID int64, column string) ([]ColumnProfile, error) {
+	query := `
+		SELECT id, run_id, task_id, column_name, stats, created_at
+		FROM column_profiles WHERE task_id=$1 AND column_name=$2
+		ORDER BY run_id DESC
+	`
+	return s.query(ctx, query, taskID, column)
+}
+
+func (s *ColumnProfilesStore) query(ctx context.Context, query string, args ...any) ([]ColumnProfile, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := []ColumnProfile{}
+	for rows.Next() {
+		var p ColumnProfile
+		var stats []byte
+		if err := rows.Scan(
+			&p.ID,
+			&p.RunID,
+			&p.TaskID,
+			&p.Column,
+			&stats,
+			&p.CreatedAt); err != nil {
+			return nil, err
+		}
+		p.Stats = stats
+		profiles = append(profiles, p)
+	}
+
+	return profiles, rows.Err()
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColumnProfilesStore_Create(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	store := &ColumnProfilesStore{db: db}
+
+	t.Run("Success", func(t *testing.T) {
+		profiles := []ColumnProfile{
+			{RunID: 7, TaskID: 3, Column: "id", Stats: json.RawMessage(`{"rows":2,"nulls":0}`)},
+			{RunID: 7, TaskID: 3, Column: "name", Stats: json.RawMessage(`{"rows":2,"nulls":1}`)},
+		}
+		mock.ExpectBegin()
+		for i, p := range profiles {
+			mock.ExpectQuery("INSERT INTO column_profiles").
+				WithArgs(p.RunID, p.TaskID, p.Column, []byte(p.Stats)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(i+1, "2024-01-01T00:00:00Z"))
+		}
+		mock.ExpectCommit()
+
+		err := store.Create(context.Background(), profiles)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), profiles[1].ID)
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO column_profiles").
+			WillReturnError(errors.New("disk full"))
+		mock.ExpectRollback()
+
+		err := store.Create(context.Background(), []ColumnProfile{{RunID: 7}})
+		assert.Error(t, err)
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestColumnProfilesStore_GetByTask(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	store := &ColumnProfilesStore{db: db}
+
+	columns := []string{"id", "run_id", "task_id", "column_name", "stats", "created_at"}
+	mock.ExpectQuery("SELECT (.+) FROM column_profiles WHERE task_id=(.+) AND column_name=(.+) ORDER BY run_id DESC").
+		WithArgs(int64(3), "name").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(4, 8, 3, "name", []byte(`{"null_percent":50}`), "2024-01-02T00:00:00Z").
+			AddRow(2, 7, 3, "name", []byte(`{"null_percent":0}`), "2024-01-01T00:00:00Z"))
+
+	profiles, err := store.GetByTask(context.Background(), 3, "name")
+	assert.NoError(t, err)
+	assert.Len(t, profiles, 2)
+	assert.Equal(t, int64(8), profiles[0].RunID)
+	assert.Equal(t, json.RawMessage(`{"null_percent":50}`), profiles[0].Stats)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
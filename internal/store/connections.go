@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+const (
+	ConnectionPostgres string = "postgres"
+)
+
+type Connection struct {
+	ID             int64  `json:"id"`
+	OrganizationID int64  `json:"organization_id"`
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	// DSN holds credentials, it is never sent back to clients.
+	DSN       string `json:"-"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type ConnectionsStore struct {
+	db *sql.DB
+}
+
+func (s *ConnectionsStore) Create(ctx context.Context, conn *Connection) error {
+	query := `
+	INSERT INTO connections (organization_id, name, type, dsn)
+	VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		conn.OrganizationID,
+		conn.Name,
+		conn.Type,
+		conn.DSN,
+	).Scan(
+		&conn.ID,
+		&conn.CreatedAt,
+		&conn.UpdatedAt,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *ConnectionsStore) GetByID(ctx context.Context, connID int64) (Connection, error) {
+	query := `
+		SELECT id, organization_id, name, type, dsn, created_at, updated_at
+		FROM connections WHERE id=$1
+	`
+	return s.getOne(ctx, query, connID)
+}
+
+func (s *ConnectionsStore) GetByName(ctx context.Context, orgID int64, name string) (Connection, error) {
+	query := `
+		SELECT id, organization_id, name, type, dsn, created_at, updated_at
+		FROM connections WHERE organization_id=$1 AND name=$2
+	`
+	return s.getOne(ctx, query, orgID, name)
+}
+
+func (s *ConnectionsStore) getOne(ctx context.Context, query string, args ...any) (Connection, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	conn := Connection{}
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		args...,
+	).Scan(
+		&conn.ID,
+		&conn.OrganizationID,
+		&conn.Name,
+		&conn.Type,
+		&conn.DSN,
+		&conn.CreatedAt,
+		&conn.UpdatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return Connection{}, ErrNotFound
+		default:
+			return Connection{}, err
+		}
+	}
+
+	return conn, nil
+}
+
+func (s *ConnectionsStore) GetByOrganization(ctx context.Context, orgID int64) ([]Connection, error) {
+	query := `
+		SELECT id, organization_id, name, type, dsn, created_at, updated_at
+		FROM connections WHERE organization_id=$1
+		ORDER BY name
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conns := []Connection{}
+	for rows.Next() {
+		var c Connection
+		if err := rows.Scan(
+			&c.ID,
+			&c.OrganizationID,
+			&c.Name,
+			&c.Type,
+			&c.DSN,
+			&c.CreatedAt,
+			&c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		conns = append(conns, c)
+	}
+
+	return conns, rows.Err()
+}
+
+func (s *ConnectionsStore) Delete(ctx context.Context, connID int64) error {
+	query := `
+		DELETE FROM connections WHERE id=$1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, connID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionStore_Create(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	store := &ConnectionsStore{db: db}
+
+	conn := &Connection{
+		OrganizationID: 1,
+		Name:           "warehouse",
+		Type:           ConnectionPostgres,
+		DSN:            "postgres://haku@localhost/dw",
+	}
+
+	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
+		AddRow(1, time.Now(), time.Now())
+
+	mock.ExpectQuery("INSERT INTO connections").
+		WithArgs(conn.OrganizationID, conn.Name, conn.Type, conn.DSN).
+		WillReturnRows(rows)
+
+	err = store.Create(context.Background(), conn)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), conn.ID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestConnectionStore_GetByName(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	store := &ConnectionsStore{db: db}
+
+	t.Run("Success", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"id", "organization_id", "name", "type", "dsn", "created_at", "updated_at"}).
+			AddRow(1, 1, "warehouse", ConnectionPostgres, "postgres://haku@localhost/dw", time.Now(), time.Now())
+		mock.ExpectQuery("SELECT id, organization_id, name, type, dsn").
+			WithArgs(1, "warehouse").
+			WillReturnRows(rows)
+
+		conn, err := store.GetByName(context.Background(), 1, "warehouse")
+		assert.NoError(t, err)
+		assert.Equal(t, "postgres://haku@localhost/dw", conn.DSN)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, organization_id, name, type, dsn").
+			WithArgs(1, "lake").
+			WillReturnError(sql.ErrNoRows)
+
+		_, err := store.GetByName(context.Background(), 1, "lake")
+		assert.Equal(t, ErrNotFound, err)
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
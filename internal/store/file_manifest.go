@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// FileManifestEntry is a file ingested by a task.
+type FileManifestEntry struct {
+	ID         int64     `json:"id"`
+	TaskID     int64     `json:"task_id"`
+	RunID      *int64    `json:"run_id"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	MTime      time.Time `json:"mtime"`
+	Checksum   string    `json:"checksum"`
+	IngestedAt string    `json:"ingested_at"`
+}
+
+type FileManifestStore struct {
+	db *sql.DB
+}
+
+func (s *FileManifestStore) GetByTask(ctx context.Context, taskID int64) ([]FileManifestEntry, error) {
+	query := `
+		SELECT id, task_id, run_id, path, size, mtime, checksum, ingested_at
+		FROM file_manifest WHERE task_id=$1
+		ORDER BY path
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []FileManifestEntry{}
+	for rows.Next() {
+		var e FileManifestEntry
+		if err := rows.Scan(
+			&e.ID,
+			&e.TaskID,
+			&e.RunID,
+			&e.Path,
+			&e.Size,
+			&e.MTime,
+			&e.Checksum,
+			&e.IngestedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// Upsert records ingested files in a single transaction, replacing the
+// entries of files ingested again.
+func (s *FileManifestStore) Upsert(ctx context.Context, entries []FileManifestEntry) error {
+	query := `
+		INSERT INTO file_manifest (task_id, run_id, path, size, mtime, checksum)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (task_id, path) DO UPDATE
+		SET run_id = EXCLUDED.run_id, size = EXCLUDED.size, mtime = EXCLUDED.mtime,
+			checksum = EXCLUDED.checksum, ingested_at = now()
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, e := range entries {
+		if _, err := tx.ExecContext(
+			ctx,
+			query,
+			e.TaskID,
+			e.RunID,
+			e.Path,
+			e.Size,
+			e.MTime,
+			e.Checksum,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes entries of a task so that their files are ingested again
+// by the next run. It returns the number of removed entries.
+func (s *FileManifestStore) Delete(ctx context.Context, taskID int64, entryIDs []int64) (int64, error) {
+	query := `
+		DELETE FROM file_manifest WHERE task_id=$1 AND id = ANY($2)
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, taskID, entryIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
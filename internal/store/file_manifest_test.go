@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileManifestStore_Upsert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	store := &FileManifestStore{db: db}
+
+	runID := int64(7)
+	mtime := time.Now().UTC()
+	entries := []FileManifestEntry{
+		{TaskID: 1, RunID: &runID, Path: "/landing/a.csv", Size: 10, MTime: mtime, Checksum: "aa"},
+		{TaskID: 1, RunID: &runID, Path: "/landing/b.csv", Size: 20, MTime: mtime, Checksum: "bb"},
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectBegin()
+		for _, e := range entries {
+			mock.ExpectExec("INSERT INTO file_manifest").
+				WithArgs(e.TaskID, e.RunID, e.Path, e.Size, e.MTime, e.Checksum).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+		}
+		mock.ExpectCommit()
+
+		err := store.Upsert(context.Background(), entries)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO file_manifest").
+			WillReturnError(errors.New("disk full"))
+		mock.ExpectRollback()
+
+		err := store.Upsert(context.Background(), entries)
+		assert.Error(t, err)
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+const (
+	DatasetRead  string = "read"
+	DatasetWrite string = "write"
+)
+
+// Dataset is a file, identified by its path, or a table or endpoint of a
+// connection.
+type Dataset struct {
+	Connection string `json:"connection,omitempty"`
+	Name       string `json:"name"`
+}
+
+// RunDataset is a dataset a run of a task read or wrote.
+type RunDataset struct {
+	ID     int64  `json:"id"`
+	RunID  int64  `json:"run_id"`
+	TaskID int64  `json:"task_id"`
+	Access string `json:"access"`
+	Dataset
+	// TaskName and PipelineID are filled in by GetByOrganization.
+	TaskName   string `json:"task_name,omitempty"`
+	PipelineID int64  `json:"pipeline_id,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
+
+type LineageStore struct {
+	db *sql.DB
+}
+
+// Create stores the datasets of a run in a single transaction.
+func (s *LineageStore) Create(ctx context.Context, datasets []RunDataset) error {
+	query := `
+		INSERT INTO run_datasets (run_id, task_id, access, connection, dataset)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := range datasets {
+		d := &datasets[i]
+		if err := tx.QueryRowContext(
+			ctx,
+			query,
+			d.RunID,
+			d.TaskID,
+			d.Access,
+			d.Connection,
+			d.Name,
+		).Scan(
+			&d.ID,
+			&d.CreatedAt,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetByOrganization returns the datasets of the tasks of an organization,
+// as recorded by the last run of each task that recorded any.
+func (s *LineageStore) GetByOrganization(ctx context.Context, organizationID int64) ([]RunDataset, error) {
+	query := `
+		SELECT d.id, d.run_id, d.task_id, d.access, d.connection, d.dataset, d.created_at,
+			t.name, t.pipeline_id
+		FROM run_datasets d
+		JOIN tasks t ON t.id = d.task_id
+		JOIN pipelines p ON p.id = t.pipeline_id
+		WHERE p.organization_id=$1
+			AND d.run_id = (SELECT MAX(run_id) FROM run_datasets WHERE task_id = d.task_id)
+		ORDER BY d.task_id, d.id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	datasets := []RunDataset{}
+	for rows.Next() {
+		var d RunDataset
+		if err := rows.Scan(
+			&d.ID,
+			&d.RunID,
+			&d.TaskID,
+			&d.Access,
+			&d.Connection,
+			&d.Name,
+			&d.CreatedAt,
+			&d.TaskName,
+			&d.PipelineID); err != nil {
+			return nil, err
+		}
+		datasets = append(datasets, d)
+	}
+
+	return datasets, rows.Err()
+}
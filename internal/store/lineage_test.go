@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineageStore_Create(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	store := &LineageStore{db: db}
+
+	t.Run("Success", func(t *testing.T) {
+		datasets := []RunDataset{
+			{RunID: 7, TaskID: 3, Access: DatasetRead, Dataset: Dataset{Connection: "warehouse", Name: "public.orders"}},
+			{RunID: 7, TaskID: 3, Access: DatasetWrite, Dataset: Dataset{Name: "/data/orders.jsonl"}},
+		}
+		mock.ExpectBegin()
+		for i, d := range datasets {
+			mock.ExpectQuery("INSERT INTO run_datasets").
+				WithArgs(d.RunID, d.TaskID, d.Access, d.Connection, d.Name).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(i+1, "2024-01-01T00:00:00Z"))
+		}
+		mock.ExpectCommit()
+
+		err := store.Create(context.Background(), datasets)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), datasets[1].ID)
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO run_datasets").
+			WillReturnError(errors.New("disk full"))
+		mock.ExpectRollback()
+
+		err := store.Create(context.Background(), []RunDataset{{RunID: 7}})
+		assert.Error(t, err)
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestLineageStore_GetByOrganization(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	store := &LineageStore{db: db}
+
+	columns := []string{"id", "run_id", "task_id", "access", "connection", "dataset", "created_at", "name", "pipeline_id"}
+	mock.ExpectQuery("SELECT (.+) FROM run_datasets d JOIN tasks t (.+) WHERE p.organization_id=").
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, 7, 3, "read", "warehouse", "public.orders", "2024-01-01T00:00:00Z", "extract", 2).
+			AddRow(2, 7, 3, "write", "", "/data/orders.jsonl", "2024-01-01T00:00:00Z", "extract", 2))
+
+	datasets, err := store.GetByOrganization(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Len(t, datasets, 2)
+	assert.Equal(t, Dataset{Connection: "warehouse", Name: "public.orders"}, datasets[0].Dataset)
+	assert.Equal(t, "extract", datasets[1].TaskName)
+	assert.Equal(t, int64(2), datasets[1].PipelineID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
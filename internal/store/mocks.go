@@ -1,11 +1,27 @@
 package store
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"slices"
+)
 
 func NewMockStore() Storage {
+	pipelines := NewMockPipelineStore()
+	tasks := NewMockTaskStore()
 	return Storage{
-		Users:         &MockUserStore{},
-		Organizations: NewMockOrganizationStore(),
+		Pipelines:      pipelines,
+		Tasks:          tasks,
+		TaskRuns:       NewMockTaskRunStore(),
+		TaskState:      NewMockTaskStateStore(),
+		FileManifest:   NewMockFileManifestStore(),
+		QualityResults: NewMockQualityResultsStore(),
+		ColumnProfiles: NewMockColumnProfilesStore(),
+		Lineage:        NewMockLineageStore(pipelines, tasks),
+		Connections:    NewMockConnectionStore(),
+		Secrets:        NewMockSecretStore(),
+		Users:          &MockUserStore{},
+		Organizations:  NewMockOrganizationStore(),
 	}
 }
 
@@ -119,3 +135,514 @@ func (m *MockOrganizationStore) GetMember(ctx context.Context, orgID, userID int
 	}
 	return *member, nil
 }
+
+// --- Mock Pipeline Store ---
+type MockPipelineStore struct {
+	pipelines map[int64]*Pipelines
+	nextID    int64
+}
+
+func NewMockPipelineStore() *MockPipelineStore {
+	return &MockPipelineStore{
+		pipelines: make(map[int64]*Pipelines),
+		nextID:    1,
+	}
+}
+
+func (m *MockPipelineStore) Create(ctx context.Context, pipeline *Pipelines) error {
+	if pipeline.ID == 0 {
+		pipeline.ID = m.nextID
+		m.nextID++
+	}
+	pipeline.Status = StateCreated
+	pipeline.Version = 1
+	m.pipelines[pipeline.ID] = pipeline
+	return nil
+}
+
+func (m *MockPipelineStore) GetByID(ctx context.Context, pipelineID int64) (Pipelines, error) {
+	pipeline, ok := m.pipelines[pipelineID]
+	if !ok {
+		return Pipelines{}, ErrNotFound
+	}
+	return *pipeline, nil
+}
+
+func (m *MockPipelineStore) Delete(ctx context.Context, pipelineID int64) error {
+	if _, ok := m.pipelines[pipelineID]; !ok {
+		return ErrNotFound
+	}
+	delete(m.pipelines, pipelineID)
+	return nil
+}
+
+func (m *MockPipelineStore) Update(ctx context.Context, pipeline *Pipelines) error {
+	if _, ok := m.pipelines[pipeline.ID]; !ok {
+		return ErrNotFound
+	}
+	pipeline.Version++
+	m.pipelines[pipeline.ID] = pipeline
+	return nil
+}
+
+// --- Mock Task Store ---
+type MockTaskStore struct {
+	tasks  map[int64]*Task
+	nextID int64
+}
+
+func NewMockTaskStore() *MockTaskStore {
+	return &MockTaskStore{
+		tasks:  make(map[int64]*Task),
+		nextID: 1,
+	}
+}
+
+func (m *MockTaskStore) Create(ctx context.Context, task *Task) error {
+	if task.ID == 0 {
+		task.ID = m.nextID
+		m.nextID++
+	}
+	task.Status = StateCreated
+	if task.DriftPolicy == "" {
+		task.DriftPolicy = DriftWarn
+	}
+	m.tasks[task.ID] = task
+	return nil
+}
+
+func (m *MockTaskStore) GetByID(ctx context.Context, taskID int64) (Task, error) {
+	task, ok := m.tasks[taskID]
+	if !ok {
+		return Task{}, ErrNotFound
+	}
+	return *task, nil
+}
+
+func (m *MockTaskStore) GetByPipeline(ctx context.Context, pipelineID int64) ([]Task, error) {
+	tasks := []Task{}
+	for _, t := range m.tasks {
+		if t.PipelineID == pipelineID {
+			tasks = append(tasks, *t)
+		}
+	}
+	return tasks, nil
+}
+
+func (m *MockTaskStore) Update(ctx context.Context, task *Task) error {
+	if _, ok := m.tasks[task.ID]; !ok {
+		return ErrNotFound
+	}
+	m.tasks[task.ID] = task
+	return nil
+}
+
+func (m *MockTaskStore) UpdateStatus(ctx context.Context, taskID int64, status, taskErr string) error {
+	task, ok := m.tasks[taskID]
+	if !ok {
+		return ErrNotFound
+	}
+	task.Status = status
+	task.Error = taskErr
+	return nil
+}
+
+func (m *MockTaskStore) Delete(ctx context.Context, taskID int64) error {
+	if _, ok := m.tasks[taskID]; !ok {
+		return ErrNotFound
+	}
+	delete(m.tasks, taskID)
+	return nil
+}
+
+// --- Mock Task Run Store ---
+type MockTaskRunStore struct {
+	runs   map[int64]*TaskRun
+	nextID int64
+}
+
+func NewMockTaskRunStore() *MockTaskRunStore {
+	return &MockTaskRunStore{
+		runs:   make(map[int64]*TaskRun),
+		nextID: 1,
+	}
+}
+
+func (m *MockTaskRunStore) Create(ctx context.Context, run *TaskRun) error {
+	if run.ID == 0 {
+		run.ID = m.nextID
+		m.nextID++
+	}
+	run.Status = StateQueued
+	m.runs[run.ID] = run
+	return nil
+}
+
+func (m *MockTaskRunStore) GetByID(ctx context.Context, runID int64) (TaskRun, error) {
+	run, ok := m.runs[runID]
+	if !ok {
+		return TaskRun{}, ErrNotFound
+	}
+	return *run, nil
+}
+
+func (m *MockTaskRunStore) GetByTask(ctx context.Context, taskID int64) ([]TaskRun, error) {
+	runs := []TaskRun{}
+	for _, r := range m.runs {
+		if r.TaskID == taskID {
+			runs = append(runs, *r)
+		}
+	}
+	return runs, nil
+}
+
+func (m *MockTaskRunStore) GetLastSchema(ctx context.Context, taskID int64) (json.RawMessage, error) {
+	var last *TaskRun
+	for _, r := range m.runs {
+		if r.TaskID != taskID || r.Status != StateSuccess || r.Schema == nil {
+			continue
+		}
+		if last == nil || r.ID > last.ID {
+			last = r
+		}
+	}
+	if last == nil {
+		return nil, ErrNotFound
+	}
+	return last.Schema, nil
+}
+
+func (m *MockTaskRunStore) Start(ctx context.Context, run *TaskRun) error {
+	if _, ok := m.runs[run.ID]; !ok {
+		return ErrNotFound
+	}
+	run.Status = StateRunning
+	m.runs[run.ID] = run
+	return nil
+}
+
+func (m *MockTaskRunStore) Finish(ctx context.Context, run *TaskRun) error {
+	if _, ok := m.runs[run.ID]; !ok {
+		return ErrNotFound
+	}
+	m.runs[run.ID] = run
+	return nil
+}
+
+// --- Mock Task State Store ---
+type taskStateKey struct {
+	taskID int64
+	key    string
+}
+
+type MockTaskStateStore struct {
+	states map[taskStateKey]TaskState
+}
+
+func NewMockTaskStateStore() *MockTaskStateStore {
+	return &MockTaskStateStore{
+		states: make(map[taskStateKey]TaskState),
+	}
+}
+
+func (m *MockTaskStateStore) Get(ctx context.Context, taskID int64, key string) (TaskState, error) {
+	state, ok := m.states[taskStateKey{taskID, key}]
+	if !ok {
+		return TaskState{}, ErrNotFound
+	}
+	return state, nil
+}
+
+func (m *MockTaskStateStore) Set(ctx context.Context, state *TaskState) error {
+	m.states[taskStateKey{state.TaskID, state.Key}] = *state
+	return nil
+}
+
+func (m *MockTaskStateStore) Delete(ctx context.Context, taskID int64, key string) error {
+	if _, ok := m.states[taskStateKey{taskID, key}]; !ok {
+		return ErrNotFound
+	}
+	delete(m.states, taskStateKey{taskID, key})
+	return nil
+}
+
+// --- Mock File Manifest Store ---
+type MockFileManifestStore struct {
+	entries []FileManifestEntry
+	nextID  int64
+}
+
+func NewMockFileManifestStore() *MockFileManifestStore {
+	return &MockFileManifestStore{nextID: 1}
+}
+
+func (m *MockFileManifestStore) GetByTask(ctx context.Context, taskID int64) ([]FileManifestEntry, error) {
+	entries := []FileManifestEntry{}
+	for _, e := range m.entries {
+		if e.TaskID == taskID {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (m *MockFileManifestStore) Upsert(ctx context.Context, entries []FileManifestEntry) error {
+	for _, e := range entries {
+		replaced := false
+		for i := range m.entries {
+			if m.entries[i].TaskID == e.TaskID && m.entries[i].Path == e.Path {
+				e.ID = m.entries[i].ID
+				m.entries[i] = e
+				replaced = true
+			}
+		}
+		if !replaced {
+			e.ID = m.nextID
+			m.nextID++
+			m.entries = append(m.entries, e)
+		}
+	}
+	return nil
+}
+
+func (m *MockFileManifestStore) Delete(ctx context.Context, taskID int64, entryIDs []int64) (int64, error) {
+	var deleted int64
+	kept := m.entries[:0]
+	for _, e := range m.entries {
+		if e.TaskID == taskID && slices.Contains(entryIDs, e.ID) {
+			deleted++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	m.entries = kept
+	return deleted, nil
+}
+
+// --- Mock Quality Results Store ---
+type MockQualityResultsStore struct {
+	results []QualityResult
+	nextID  int64
+}
+
+func NewMockQualityResultsStore() *MockQualityResultsStore {
+	return &MockQualityResultsStore{nextID: 1}
+}
+
+func (m *MockQualityResultsStore) Create(ctx context.Context, results []QualityResult) error {
+	for i := range results {
+		results[i].ID = m.nextID
+		m.nextID++
+		m.results = append(m.results, results[i])
+	}
+	return nil
+}
+
+func (m *MockQualityResultsStore) GetByRun(ctx context.Context, runID int64) ([]QualityResult, error) {
+	results := []QualityResult{}
+	for _, r := range m.results {
+		if r.RunID == runID {
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+// --- Mock Column Profiles Store ---
+type MockColumnProfilesStore struct {
+	profiles []ColumnProfile
+	nextID   int64
+}
+
+func NewMockColumnProfilesStore() *MockColumnProfilesStore {
+	return &MockColumnProfilesStore{nextID: 1}
+}
+
+func (m *MockColumnProfilesStore) Create(ctx context.Context, profiles []ColumnProfile) error {
+	for i := range profiles {
+		profiles[i].ID = m.nextID
+		m.nextID++
+		m.profiles = append(m.profiles, profiles[i])
+	}
+	return nil
+}
+
+func (m *MockColumnProfilesStore) GetByRun(ctx context.Context, runID int64) ([]ColumnProfile, error) {
+	profiles := []ColumnProfile{}
+	for _, p := range m.profiles {
+		if p.RunID == runID {
+			profiles = append(profiles, p)
+		}
+	}
+	return profiles, nil
+}
+
+func (m *MockColumnProfilesStore) GetByTask(ctx context.Context, taskID int64, column string) ([]ColumnProfile, error) {
+	profiles := []ColumnProfile{}
+	for _, p := range slices.Backward(m.profiles) {
+		if p.TaskID == taskID && p.Column == column {
+			profiles = append(profiles, p)
+		}
+	}
+	return profiles, nil
+}
+
+// --- Mock Lineage Store ---
+type MockLineageStore struct {
+	pipelines *MockPipelineStore
+	tasks     *MockTaskStore
+	datasets  []RunDataset
+	nextID    int64
+}
+
+func NewMockLineageStore(pipelines *MockPipelineStore, tasks *MockTaskStore) *MockLineageStore {
+	return &MockLineageStore{pipelines: pipelines, tasks: tasks, nextID: 1}
+}
+
+func (m *MockLineageStore) Create(ctx context.Context, datasets []RunDataset) error {
+	for i := range datasets {
+		datasets[i].ID = m.nextID
+		m.nextID++
+		m.datasets = append(m.datasets, datasets[i])
+	}
+	return nil
+}
+
+func (m *MockLineageStore) GetByOrganization(ctx context.Context, organizationID int64) ([]RunDataset, error) {
+	last := make(map[int64]int64)
+	for _, d := range m.datasets {
+		last[d.TaskID] = max(last[d.TaskID], d.RunID)
+	}
+
+	datasets := []RunDataset{}
+	for _, d := range m.datasets {
+		task, ok := m.tasks.tasks[d.TaskID]
+		if !ok || d.RunID != last[d.TaskID] {
+			continue
+		}
+		pipeline, ok := m.pipelines.pipelines[task.PipelineID]
+		if !ok || pipeline.OrganizationID != organizationID {
+			continue
+		}
+		d.TaskName = task.Name
+		d.PipelineID = task.PipelineID
+		datasets = append(datasets, d)
+	}
+	return datasets, nil
+}
+
+// --- Mock Connection Store ---
+type MockConnectionStore struct {
+	conns  map[int64]*Connection
+	nextID int64
+}
+
+func NewMockConnectionStore() *MockConnectionStore {
+	return &MockConnectionStore{
+		conns:  make(map[int64]*Connection),
+		nextID: 1,
+	}
+}
+
+func (m *MockConnectionStore) Create(ctx context.Context, conn *Connection) error {
+	if conn.ID == 0 {
+		conn.ID = m.nextID
+		m.nextID++
+	}
+	m.conns[conn.ID] = conn
+	return nil
+}
+
+func (m *MockConnectionStore) GetByID(ctx context.Context, connID int64) (Connection, error) {
+	conn, ok := m.conns[connID]
+	if !ok {
+		return Connection{}, ErrNotFound
+	}
+	return *conn, nil
+}
+
+func (m *MockConnectionStore) GetByName(ctx context.Context, orgID int64, name string) (Connection, error) {
+	for _, c := range m.conns {
+		if c.OrganizationID == orgID && c.Name == name {
+			return *c, nil
+		}
+	}
+	return Connection{}, ErrNotFound
+}
+
+func (m *MockConnectionStore) GetByOrganization(ctx context.Context, orgID int64) ([]Connection, error) {
+	conns := []Connection{}
+	for _, c := range m.conns {
+		if c.OrganizationID == orgID {
+			conns = append(conns, *c)
+		}
+	}
+	return conns, nil
+}
+
+func (m *MockConnectionStore) Delete(ctx context.Context, connID int64) error {
+	if _, ok := m.conns[connID]; !ok {
+		return ErrNotFound
+	}
+	delete(m.conns, connID)
+	return nil
+}
+
+// --- Mock Secret Store ---
+type MockSecretStore struct {
+	secrets map[int64]*Secret
+	nextID  int64
+}
+
+func NewMockSecretStore() *MockSecretStore {
+	return &MockSecretStore{
+		secrets: make(map[int64]*Secret),
+		nextID:  1,
+	}
+}
+
+func (m *MockSecretStore) Create(ctx context.Context, secret *Secret) error {
+	if secret.ID == 0 {
+		secret.ID = m.nextID
+		m.nextID++
+	}
+	m.secrets[secret.ID] = secret
+	return nil
+}
+
+func (m *MockSecretStore) GetByID(ctx context.Context, secretID int64) (Secret, error) {
+	secret, ok := m.secrets[secretID]
+	if !ok {
+		return Secret{}, ErrNotFound
+	}
+	return *secret, nil
+}
+
+func (m *MockSecretStore) GetByName(ctx context.Context, orgID int64, name string) (Secret, error) {
+	for _, s := range m.secrets {
+		if s.OrganizationID == orgID && s.Name == name {
+			return *s, nil
+		}
+	}
+	return Secret{}, ErrNotFound
+}
+
+func (m *MockSecretStore) GetByOrganization(ctx context.Context, orgID int64) ([]Secret, error) {
+	secrets := []Secret{}
+	for _, s := range m.secrets {
+		if s.OrganizationID == orgID {
+			secret := *s
+			secret.Value = ""
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets, nil
+}
+
+func (m *MockSecretStore) Delete(ctx context.Context, secretID int64) error {
+	if _, ok := m.secrets[secretID]; !ok {
+		return ErrNotFound
+	}
+	delete(m.secrets, secretID)
+	return nil
+}
@@ -14,6 +14,9 @@ const (
 	StateRunning  string = "running"
 	StateError    string = "error"
 	StateRetrying string = "retrying"
+	StateSuccess  string = "success"
+	StateSkipped  string = "skipped"
+	StateTimeout  string = "timeout"
 )
 
 type Pipelines struct {
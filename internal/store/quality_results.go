@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+// QualityResult is the outcome of one data quality check of a run.
+type QualityResult struct {
+	ID       int64  `json:"id"`
+	RunID    int64  `json:"run_id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Severity string `json:"severity"`
+	Passed   bool   `json:"passed"`
+	// Failures counts the records, or for dataset checks such as row
+	// counts the datasets, the check failed for.
+	Failures int64  `json:"failures"`
+	Message  string `json:"message"`
+	// Samples holds some of the failing records.
+	Samples   json.RawMessage `json:"samples"`
+	CreatedAt string          `json:"created_at"`
+}
+
+type QualityResultsStore struct {
+	db *sql.DB
+}
+
+// Create stores the results of a run in a single transaction.
+func (s *QualityResultsStore) Create(ctx context.Context, results []QualityResult) error {
+	query := `
+		INSERT INTO quality_results (run_id, name, check_type, severity, passed, failures, message, samples)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := range results {
+		r := &results[i]
+		if err := tx.QueryRowContext(
+			ctx,
+			query,
+			r.RunID,
+			r.Name,
+			r.Type,
+			r.Severity,
+			r.Passed,
+			r.Failures,
+			r.Message,
+			[]byte(r.Samples),
+		).Scan(
+			&r.ID,
+			&r.CreatedAt,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *QualityResultsStore) GetByRun(ctx context.Context, runID int64) ([]QualityResult, error) {
+	query := `
+		SELECT id, run_id, name, check_type, severity, passed, failures, message, samples, created_at
+		FROM quality_results WHERE run_id=$1
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []QualityResult{}
+	for rows.Next() {
+		var r QualityResult
+		var samples []byte
+		if err := rows.Scan(
+			&r.ID,
+			&r.RunID,
+			&r.Name,
+			&r.Type,
+			&r.Severity,
+			&r.Passed,
+			&r.Failures,
+			&r.Message,
+			&samples,
+			&r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.Samples = samples
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
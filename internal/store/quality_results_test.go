@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQualityResultsStore_Create(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	store := &QualityResultsStore{db: db}
+
+	t.Run("Success", func(t *testing.T) {
+		results := []QualityResult{
+			{RunID: 7, Name: "id not null", Type: "not_null", Severity: "fail", Passed: true},
+			{RunID: 7, Name: "status accepted", Type: "accepted_values", Severity: "warn", Failures: 2,
+				Message: "2 records have values outside the accepted ones", Samples: json.RawMessage(`[{"record":3}]`)},
+		}
+		mock.ExpectBegin()
+		for i, r := range results {
+			mock.ExpectQuery("INSERT INTO quality_results").
+				WithArgs(r.RunID, r.Name, r.Type, r.Severity, r.Passed, r.Failures, r.Message, []byte(r.Samples)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(i+1, "2024-01-01T00:00:00Z"))
+		}
+		mock.ExpectCommit()
+
+		err := store.Create(context.Background(), results)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), results[1].ID)
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO quality_results").
+			WillReturnError(errors.New("disk full"))
+		mock.ExpectRollback()
+
+		err := store.Create(context.Background(), []QualityResult{{RunID: 7}})
+		assert.Error(t, err)
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestQualityResultsStore_GetByRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	store := &QualityResultsStore{db: db}
+
+	columns := []string{"id", "run_id", "name", "check_type", "severity", "passed", "failures", "message", "samples", "created_at"}
+	mock.ExpectQuery("SELECT (.+) FROM quality_results WHERE run_id=").
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, 7, "id not null", "not_null", "fail", true, 0, "", nil, "2024-01-01T00:00:00Z").
+			AddRow(2, 7, "rows", "row_count", "warn", false, 1, "3 records, expected at least 10", []byte(`[]`), "2024-01-01T00:00:00Z"))
+
+	results, err := store.GetByRun(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Nil(t, results[0].Samples)
+	assert.Equal(t, json.RawMessage(`[]`), results[1].Samples)
+	assert.False(t, results[1].Passed)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// Secret is a value an organization keeps out of task configurations, such
+// as the salt or key of a masking task, which refers to it by name.
+type Secret struct {
+	ID             int64  `json:"id"`
+	OrganizationID int64  `json:"organization_id"`
+	Name           string `json:"name"`
+	// Value is never sent back to clients.
+	Value     string `json:"-"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type SecretsStore struct {
+	db *sql.DB
+}
+
+func (s *SecretsStore) Create(ctx context.Context, secret *Secret) error {
+	query := `
+	INSERT INTO secrets (organization_id, name, value)
+	VALUES ($1, $2, $3) RETURNING id, created_at, updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		secret.OrganizationID,
+		secret.Name,
+		secret.Value,
+	).Scan(
+		&secret.ID,
+		&secret.CreatedAt,
+		&secret.UpdatedAt,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SecretsStore) GetByID(ctx context.Context, secretID int64) (Secret, error) {
+	query := `
+		SELECT id, organization_id, name, value, created_at, updated_at
+		FROM secrets WHERE id=$1
+	`
+	return s.getOne(ctx, query, secretID)
+}
+
+func (s *SecretsStore) GetByName(ctx context.Context, orgID int64, name string) (Secret, error) {
+	query := `
+		SELECT id, organization_id, name, value, created_at, updated_at
+		FROM secrets WHERE organization_id=$1 AND name=$2
+	`
+	return s.getOne(ctx, query, orgID, name)
+}
+
+func (s *SecretsStore) getOne(ctx context.Context, query string, args ...any) (Secret, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	secret := Secret{}
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		args...,
+	).Scan(
+		&secret.ID,
+		&secret.OrganizationID,
+		&secret.Name,
+		&secret.Value,
+		&secret.CreatedAt,
+		&secret.UpdatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return Secret{}, ErrNotFound
+		default:
+			return Secret{}, err
+		}
+	}
+
+	return secret, nil
+}
+
+// GetByOrganization lists the secrets of an organization without their
+// values.
+func (s *SecretsStore) GetByOrganization(ctx context.Context, orgID int64) ([]Secret, error) {
+	query := `
+		SELECT id, organization_id, name, created_at, updated_at
+		FROM secrets WHERE organization_id=$1
+		ORDER BY name
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	secrets := []Secret{}
+	for rows.Next() {
+		var secret Secret
+		if err := rows.Scan(
+			&secret.ID,
+			&secret.OrganizationID,
+			&secret.Name,
+			&secret.CreatedAt,
+			&secret.UpdatedAt); err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+
+	return secrets, rows.Err()
+}
+
+func (s *SecretsStore) Delete(ctx context.Context, secretID int64) error {
+	query := `
+		DELETE FROM secrets WHERE id=$1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, secretID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretStore_Create(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	store := &SecretsStore{db: db}
+
+	secret := &Secret{
+		OrganizationID: 1,
+		Name:           "pii_salt",
+		Value:          "s3cr3t",
+	}
+
+	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
+		AddRow(1, time.Now(), time.Now())
+
+	mock.ExpectQuery("INSERT INTO secrets").
+		WithArgs(secret.OrganizationID, secret.Name, secret.Value).
+		WillReturnRows(rows)
+
+	err = store.Create(context.Background(), secret)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), secret.ID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestSecretStore_GetByName(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	store := &SecretsStore{db: db}
+
+	t.Run("Success", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"id", "organization_id", "name", "value", "created_at", "updated_at"}).
+			AddRow(1, 1, "pii_salt", "s3cr3t", time.Now(), time.Now())
+		mock.ExpectQuery("SELECT id, organization_id, name, value").
+			WithArgs(1, "pii_salt").
+			WillReturnRows(rows)
+
+		secret, err := store.GetByName(context.Background(), 1, "pii_salt")
+		assert.NoError(t, err)
+		assert.Equal(t, "s3cr3t", secret.Value)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, organization_id, name, value").
+			WithArgs(1, "token_key").
+			WillReturnError(sql.ErrNoRows)
+
+		_, err := store.GetByName(context.Background(), 1, "token_key")
+		assert.Equal(t, ErrNotFound, err)
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestSecretStore_GetByOrganization(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	store := &SecretsStore{db: db}
+
+	rows := sqlmock.NewRows([]string{"id", "organization_id", "name", "created_at", "updated_at"}).
+		AddRow(1, 1, "pii_salt", time.Now(), time.Now()).
+		AddRow(2, 1, "token_key", time.Now(), time.Now())
+	mock.ExpectQuery("SELECT id, organization_id, name, created_at, updated_at FROM secrets").
+		WithArgs(1).
+		WillReturnRows(rows)
+
+	secrets, err := store.GetByOrganization(context.Background(), 1)
+	assert.NoError(t, err)
+	if assert.Len(t, secrets, 2) {
+		assert.Equal(t, "token_key", secrets[1].Name)
+		assert.Empty(t, secrets[1].Value)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"time"
 )
@@ -22,6 +23,59 @@ type Storage struct {
 		Delete(context.Context, int64) error
 		Update(context.Context, *Pipelines) error
 	}
+	Tasks interface {
+		Create(context.Context, *Task) error
+		GetByID(context.Context, int64) (Task, error)
+		GetByPipeline(context.Context, int64) ([]Task, error)
+		Update(context.Context, *Task) error
+		UpdateStatus(context.Context, int64, string, string) error
+		Delete(context.Context, int64) error
+	}
+	TaskRuns interface {
+		Create(context.Context, *TaskRun) error
+		GetByID(context.Context, int64) (TaskRun, error)
+		GetByTask(context.Context, int64) ([]TaskRun, error)
+		GetLastSchema(context.Context, int64) (json.RawMessage, error)
+		Start(context.Context, *TaskRun) error
+		Finish(context.Context, *TaskRun) error
+	}
+	TaskState interface {
+		Get(context.Context, int64, string) (TaskState, error)
+		Set(context.Context, *TaskState) error
+		Delete(context.Context, int64, string) error
+	}
+	FileManifest interface {
+		GetByTask(context.Context, int64) ([]FileManifestEntry, error)
+		Upsert(context.Context, []FileManifestEntry) error
+		Delete(context.Context, int64, []int64) (int64, error)
+	}
+	QualityResults interface {
+		Create(context.Context, []QualityResult) error
+		GetByRun(context.Context, int64) ([]QualityResult, error)
+	}
+	ColumnProfiles interface {
+		Create(context.Context, []ColumnProfile) error
+		GetByRun(context.Context, int64) ([]ColumnProfile, error)
+		GetByTask(context.Context, int64, string) ([]ColumnProfile, error)
+	}
+	Lineage interface {
+		Create(context.Context, []RunDataset) error
+		GetByOrganization(context.Context, int64) ([]RunDataset, error)
+	}
+	Connections interface {
+		Create(context.Context, *Connection) error
+		GetByID(context.Context, int64) (Connection, error)
+		GetByName(context.Context, int64, string) (Connection, error)
+		GetByOrganization(context.Context, int64) ([]Connection, error)
+		Delete(context.Context, int64) error
+	}
+	Secrets interface {
+		Create(context.Context, *Secret) error
+		GetByID(context.Context, int64) (Secret, error)
+		GetByName(context.Context, int64, string) (Secret, error)
+		GetByOrganization(context.Context, int64) ([]Secret, error)
+		Delete(context.Context, int64) error
+	}
 	Users interface {
 		Create(context.Context, *User) error
 		GetByID(context.Context, int64) (*User, error)
@@ -38,8 +92,17 @@ type Storage struct {
 
 func NewPostgresStorage(db *sql.DB) Storage {
 	return Storage{
-		Pipelines:     &PipelinesStore{db},
-		Users:         &UsersStore{db},
-		Organizations: &OrganizationStore{db},
+		Pipelines:      &PipelinesStore{db},
+		Tasks:          &TasksStore{db},
+		TaskRuns:       &TaskRunsStore{db},
+		TaskState:      &TaskStateStore{db},
+		FileManifest:   &FileManifestStore{db},
+		QualityResults: &QualityResultsStore{db},
+		ColumnProfiles: &ColumnProfilesStore{db},
+		Lineage:        &LineageStore{db},
+		Connections:    &ConnectionsStore{db},
+		Secrets:        &SecretsStore{db},
+		Users:          &UsersStore{db},
+		Organizations:  &OrganizationStore{db},
 	}
 }
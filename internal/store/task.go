@@ -1,20 +1,237 @@
 package store
 
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+// Drift policies decide what a run does when the schema of its source
+// differs from the one of the last successful run.
+const (
+	DriftIgnore string = "ignore"
+	DriftWarn   string = "warn"
+	DriftFail   string = "fail"
+	// DriftEvolve keeps the fields the source dropped in the output, as
+	// nulls, so the output schema only ever grows.
+	DriftEvolve string = "evolve"
+)
+
 type Task struct {
-	ID          int64  `json:"id"`
-	PipelineID  int64  `json:"pipeline_id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	UiDisplay   int    `json:"ui_display"`
-	Type        string `json:"type"`
-	Config      Config `json:"config"`
-	Status      string `json:"status"`
-	Error       string `json:"error"`
-	CreatedAt   string `json:"create_at"`
-	UpdatedAt   string `json:"update_at"`
-}
-
-type Config struct {
-	SourcePath string `json:"source_path"`
-	TargetPath string `json:"target_path"`
+	ID          int64           `json:"id"`
+	PipelineID  int64           `json:"pipeline_id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	UiDisplay   int             `json:"ui_display"`
+	Type        string          `json:"type"`
+	Config      json.RawMessage `json:"config"`
+	DriftPolicy string          `json:"drift_policy"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error"`
+	CreatedAt   string          `json:"create_at"`
+	UpdatedAt   string          `json:"update_at"`
+}
+
+type TasksStore struct {
+	db *sql.DB
+}
+
+func (s *TasksStore) Create(ctx context.Context, task *Task) error {
+	query := `
+	INSERT INTO tasks (pipeline_id, name, description, ui_display, type, config, drift_policy, status)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at, updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	task.Status = StateCreated
+	if task.DriftPolicy == "" {
+		task.DriftPolicy = DriftWarn
+	}
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		task.PipelineID,
+		task.Name,
+		task.Description,
+		task.UiDisplay,
+		task.Type,
+		[]byte(task.Config),
+		task.DriftPolicy,
+		task.Status,
+	).Scan(
+		&task.ID,
+		&task.CreatedAt,
+		&task.UpdatedAt,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *TasksStore) GetByID(ctx context.Context, taskID int64) (Task, error) {
+	query := `
+		SELECT id, pipeline_id, name, COALESCE(description, ''), COALESCE(ui_display, 0),
+			type, config, drift_policy, status, COALESCE(error, ''), created_at, updated_at
+		FROM tasks WHERE id=$1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	task := Task{}
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		taskID,
+	).Scan(
+		&task.ID,
+		&task.PipelineID,
+		&task.Name,
+		&task.Description,
+		&task.UiDisplay,
+		&task.Type,
+		&task.Config,
+		&task.DriftPolicy,
+		&task.Status,
+		&task.Error,
+		&task.CreatedAt,
+		&task.UpdatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return Task{}, ErrNotFound
+		default:
+			return Task{}, err
+		}
+	}
+
+	return task, nil
+}
+
+func (s *TasksStore) GetByPipeline(ctx context.Context, pipelineID int64) ([]Task, error) {
+	query := `
+		SELECT id, pipeline_id, name, COALESCE(description, ''), COALESCE(ui_display, 0),
+			type, config, drift_policy, status, COALESCE(error, ''), created_at, updated_at
+		FROM tasks WHERE pipeline_id=$1
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pipelineID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []Task{}
+	for rows.Next() {
+		var t Task
+		if err := rows.Scan(
+			&t.ID,
+			&t.PipelineID,
+			&t.Name,
+			&t.Description,
+			&t.UiDisplay,
+			&t.Type,
+			&t.Config,
+			&t.DriftPolicy,
+			&t.Status,
+			&t.Error,
+			&t.CreatedAt,
+			&t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+
+	return tasks, rows.Err()
+}
+
+func (s *TasksStore) Update(ctx context.Context, task *Task) error {
+	query := `
+		UPDATE tasks
+		SET name = $1, description = $2, ui_display = $3, config = $4, drift_policy = $5, updated_at = now()
+		WHERE id = $6
+		RETURNING updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		task.Name,
+		task.Description,
+		task.UiDisplay,
+		[]byte(task.Config),
+		task.DriftPolicy,
+		task.ID,
+	).Scan(&task.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *TasksStore) UpdateStatus(ctx context.Context, taskID int64, status, taskErr string) error {
+	query := `
+		UPDATE tasks SET status = $1, error = NULLIF($2, ''), updated_at = now()
+		WHERE id = $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, status, taskErr, taskID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *TasksStore) Delete(ctx context.Context, taskID int64) error {
+	query := `
+		DELETE FROM tasks WHERE id=$1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, taskID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
 }
@@ -0,0 +1,245 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+type TaskRun struct {
+	ID           int64           `json:"id"`
+	TaskID       int64           `json:"task_id"`
+	Status       string          `json:"status"`
+	ExitCode     *int            `json:"exit_code"`
+	RowsAffected *int64          `json:"rows_affected"`
+	Stats        json.RawMessage `json:"stats"`
+	// Schema is the schema of the records the source read, and
+	// SchemaDrift its differences with the last successful run.
+	Schema      json.RawMessage `json:"schema"`
+	SchemaDrift json.RawMessage `json:"schema_drift"`
+	Logs        string          `json:"logs"`
+	Error       string          `json:"error"`
+	StartedAt   *string         `json:"started_at"`
+	FinishedAt  *string         `json:"finished_at"`
+	CreatedAt   string          `json:"created_at"`
+	UpdatedAt   string          `json:"updated_at"`
+}
+
+type TaskRunsStore struct {
+	db *sql.DB
+}
+
+func (s *TaskRunsStore) Create(ctx context.Context, run *TaskRun) error {
+	query := `
+	INSERT INTO task_runs (task_id, status)
+	VALUES ($1, $2) RETURNING id, created_at, updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	run.Status = StateQueued
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		run.TaskID,
+		run.Status,
+	).Scan(
+		&run.ID,
+		&run.CreatedAt,
+		&run.UpdatedAt,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *TaskRunsStore) GetByID(ctx context.Context, runID int64) (TaskRun, error) {
+	query := `
+		SELECT id, task_id, status, exit_code, rows_affected, stats, schema, schema_drift,
+			COALESCE(logs, ''), COALESCE(error, ''), started_at, finished_at, created_at, updated_at
+		FROM task_runs WHERE id=$1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	run := TaskRun{}
+	var stats, schema, drift []byte
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		runID,
+	).Scan(
+		&run.ID,
+		&run.TaskID,
+		&run.Status,
+		&run.ExitCode,
+		&run.RowsAffected,
+		&stats,
+		&schema,
+		&drift,
+		&run.Logs,
+		&run.Error,
+		&run.StartedAt,
+		&run.FinishedAt,
+		&run.CreatedAt,
+		&run.UpdatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return TaskRun{}, ErrNotFound
+		default:
+			return TaskRun{}, err
+		}
+	}
+	run.Stats = stats
+	run.Schema = schema
+	run.SchemaDrift = drift
+
+	return run, nil
+}
+
+// GetByTask returns the runs of a task, most recent first. Logs and
+// schemas are left out of the listing; fetch a single run to read them.
+func (s *TaskRunsStore) GetByTask(ctx context.Context, taskID int64) ([]TaskRun, error) {
+	query := `
+		SELECT id, task_id, status, exit_code, rows_affected, stats, schema_drift, COALESCE(error, ''),
+			started_at, finished_at, created_at, updated_at
+		FROM task_runs WHERE task_id=$1
+		ORDER BY id DESC
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []TaskRun{}
+	for rows.Next() {
+		var r TaskRun
+		var stats, drift []byte
+		if err := rows.Scan(
+			&r.ID,
+			&r.TaskID,
+			&r.Status,
+			&r.ExitCode,
+			&r.RowsAffected,
+			&stats,
+			&drift,
+			&r.Error,
+			&r.StartedAt,
+			&r.FinishedAt,
+			&r.CreatedAt,
+			&r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		r.Stats = stats
+		r.SchemaDrift = drift
+		runs = append(runs, r)
+	}
+
+	return runs, rows.Err()
+}
+
+// GetLastSchema returns the source schema of the last successful run of a
+// task that recorded one.
+func (s *TaskRunsStore) GetLastSchema(ctx context.Context, taskID int64) (json.RawMessage, error) {
+	query := `
+		SELECT schema FROM task_runs
+		WHERE task_id=$1 AND status=$2 AND schema IS NOT NULL
+		ORDER BY id DESC LIMIT 1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var schema []byte
+	err := s.db.QueryRowContext(ctx, query, taskID, StateSuccess).Scan(&schema)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return schema, nil
+}
+
+// Start marks a queued run as running.
+func (s *TaskRunsStore) Start(ctx context.Context, run *TaskRun) error {
+	query := `
+		UPDATE task_runs
+		SET status = $1, started_at = now(), updated_at = now()
+		WHERE id = $2
+		RETURNING started_at, updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	run.Status = StateRunning
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		run.Status,
+		run.ID,
+	).Scan(&run.StartedAt, &run.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Finish records the final state of a run together with its exit code,
+// row count, stats, schema, logs and error.
+func (s *TaskRunsStore) Finish(ctx context.Context, run *TaskRun) error {
+	query := `
+		UPDATE task_runs
+		SET status = $1, exit_code = $2, rows_affected = $3, stats = $4, schema = $5, schema_drift = $6,
+			logs = $7, error = NULLIF($8, ''), finished_at = now(), updated_at = now()
+		WHERE id = $9
+		RETURNING finished_at, updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		run.Status,
+		run.ExitCode,
+		run.RowsAffected,
+		[]byte(run.Stats),
+		[]byte(run.Schema),
+		[]byte(run.SchemaDrift),
+		run.Logs,
+		run.Error,
+		run.ID,
+	).Scan(&run.FinishedAt, &run.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// TaskState is a value a task keeps between runs, such as the high-water
+// mark of an incremental extraction.
+type TaskState struct {
+	TaskID    int64  `json:"task_id"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type TaskStateStore struct {
+	db *sql.DB
+}
+
+func (s *TaskStateStore) Get(ctx context.Context, taskID int64, key string) (TaskState, error) {
+	query := `
+		SELECT task_id, key, value, updated_at
+		FROM task_state WHERE task_id=$1 AND key=$2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	state := TaskState{}
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		taskID,
+		key,
+	).Scan(
+		&state.TaskID,
+		&state.Key,
+		&state.Value,
+		&state.UpdatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return TaskState{}, ErrNotFound
+		default:
+			return TaskState{}, err
+		}
+	}
+
+	return state, nil
+}
+
+// Set creates or replaces a state value.
+func (s *TaskStateStore) Set(ctx context.Context, state *TaskState) error {
+	query := `
+		INSERT INTO task_state (task_id, key, value)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (task_id, key) DO UPDATE SET value = EXCLUDED.value, updated_at = now()
+		RETURNING updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		state.TaskID,
+		state.Key,
+		state.Value,
+	).Scan(&state.UpdatedAt)
+}
+
+func (s *TaskStateStore) Delete(ctx context.Context, taskID int64, key string) error {
+	query := `
+		DELETE FROM task_state WHERE task_id=$1 AND key=$2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, taskID, key)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskStore_Create(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	store := &TasksStore{db: db}
+
+	task := &Task{
+		PipelineID: 1,
+		Name:       "extract",
+		Type:       "shell.exec",
+		Config:     json.RawMessage(`{"command":"echo"}`),
+	}
+
+	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
+		AddRow(1, time.Now(), time.Now())
+
+	mock.ExpectQuery("INSERT INTO tasks").
+		WithArgs(task.PipelineID, task.Name, task.Description, task.UiDisplay, task.Type, []byte(task.Config), DriftWarn, StateCreated).
+		WillReturnRows(rows)
+
+	err = store.Create(context.Background(), task)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), task.ID)
+	assert.Equal(t, StateCreated, task.Status)
+	assert.Equal(t, DriftWarn, task.DriftPolicy)
+	assert.NotEmpty(t, task.CreatedAt)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTaskStore_GetByID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	store := &TasksStore{db: db}
+
+	columns := []string{"id", "pipeline_id", "name", "description", "ui_display", "type", "config", "drift_policy", "status", "error", "created_at", "updated_at"}
+
+	t.Run("Success", func(t *testing.T) {
+		rows := sqlmock.NewRows(columns).
+			AddRow(1, 2, "extract", "", 0, "shell.exec", []byte(`{"command":"echo"}`), DriftFail, StateCreated, "", time.Now(), time.Now())
+		mock.ExpectQuery("SELECT id, pipeline_id, name").WithArgs(1).WillReturnRows(rows)
+
+		task, err := store.GetByID(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), task.PipelineID)
+		assert.JSONEq(t, `{"command":"echo"}`, string(task.Config))
+		assert.Equal(t, DriftFail, task.DriftPolicy)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, pipeline_id, name").WithArgs(999).WillReturnError(sql.ErrNoRows)
+
+		_, err := store.GetByID(context.Background(), 999)
+		assert.Equal(t, ErrNotFound, err)
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTaskRunStore_Finish(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	store := &TaskRunsStore{db: db}
+
+	code := 0
+	stats := json.RawMessage(`{"stages":[]}`)
+	schema := json.RawMessage(`{"fields":[]}`)
+	run := &TaskRun{ID: 1, TaskID: 1, Status: StateSuccess, ExitCode: &code, Stats: stats, Schema: schema, Logs: "done\n"}
+
+	rows := sqlmock.NewRows([]string{"finished_at", "updated_at"}).
+		AddRow(time.Now(), time.Now())
+	mock.ExpectQuery("UPDATE task_runs").
+		WithArgs(StateSuccess, &code, nil, []byte(stats), []byte(schema), []byte(nil), "done\n", "", int64(1)).
+		WillReturnRows(rows)
+
+	err = store.Finish(context.Background(), run)
+	assert.NoError(t, err)
+	assert.NotNil(t, run.FinishedAt)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTaskRunStore_GetLastSchema(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	store := &TaskRunsStore{db: db}
+
+	t.Run("Success", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"schema"}).AddRow([]byte(`{"fields":[]}`))
+		mock.ExpectQuery("SELECT schema FROM task_runs").WithArgs(1, StateSuccess).WillReturnRows(rows)
+
+		schema, err := store.GetLastSchema(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"fields":[]}`, string(schema))
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		mock.ExpectQuery("SELECT schema FROM task_runs").WithArgs(2, StateSuccess).WillReturnError(sql.ErrNoRows)
+
+		_, err := store.GetLastSchema(context.Background(), 2)
+		assert.Equal(t, ErrNotFound, err)
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
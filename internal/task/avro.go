@@ -0,0 +1,751 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/linkedin/goavro/v2"
+)
+
+const (
+	AvroReadType  = "avro.read"
+	AvroWriteType = "avro.write"
+)
+
+type AvroReadConfig struct {
+	SourcePath string `json:"source_path" validate:"required"`
+	TargetPath string `json:"target_path" validate:"required"`
+	OutputConfig
+}
+
+func (AvroReadConfig) resumable() {}
+
+type AvroWriteConfig struct {
+	// SourcePath is a JSON lines file, such as the output of an extract.
+	SourcePath string `json:"source_path" validate:"required"`
+	TargetPath string `json:"target_path" validate:"required"`
+	// Schema is the Avro schema of the records. Without it the schema is
+	// inferred from the source, with every field nullable.
+	Schema json.RawMessage `json:"schema"`
+	// RecordName names the inferred record schema, "Record" by default.
+	RecordName  string `json:"record_name"`
+	Compression string `json:"compression" validate:"omitempty,oneof=null deflate snappy"`
+	// DeadLetter, when set, sets aside the lines that do not parse and the
+	// records that do not fit the schema instead of failing the run.
+	DeadLetter *DeadLetterConfig `json:"dead_letter"`
+	OutputConfig
+}
+
+// AvroRead converts an Avro object container file into a JSON lines file.
+type AvroRead struct{}
+
+func NewAvroRead() *AvroRead {
+	return &AvroRead{}
+}
+
+func (a *AvroRead) Validate(ctx context.Context, task store.Task) error {
+	_, err := a.config(task)
+	return err
+}
+
+func (a *AvroRead) config(task store.Task) (AvroReadConfig, error) {
+	var cfg AvroReadConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if err := validateSourcePath(cfg.SourcePath); err != nil {
+		return cfg, err
+	}
+	if err := validateOutputPath(cfg.TargetPath); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func (a *AvroRead) Run(ctx context.Context, run *Run) error {
+	cfg, err := a.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(cfg.SourcePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := goavro.NewOCFReader(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cfg.SourcePath, err)
+	}
+
+	schema, err := parseAvroSchema(reader.Codec().Schema())
+	if err != nil {
+		return err
+	}
+	run.Log.Printf("reading %s with the embedded schema %s", cfg.SourcePath, reader.Codec().Schema())
+
+	sink, err := newJSONLOutput(run, cfg.TargetPath, cfg.Partition)
+	if err != nil {
+		return err
+	}
+
+	source := newSource(AvroReadType, func(ctx context.Context, w record.Writer) error {
+		var n int64
+		for reader.Scan() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			n++
+
+			datum, err := reader.Read()
+			if err != nil {
+				return fmt.Errorf("record %d: %w", n, err)
+			}
+
+			value, err := schema.toJSON(schema.root, datum)
+			if err != nil {
+				return fmt.Errorf("record %d: %w", n, err)
+			}
+			r, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("record %d is not a record", n)
+			}
+
+			if err := w.Write(r); err != nil {
+				return err
+			}
+		}
+		return reader.Err()
+	})
+	source.path = cfg.SourcePath
+	stats, err := runPipeline(ctx, run, nil, source, sink)
+	if err != nil {
+		return err
+	}
+
+	run.Log.Printf("read %d records into %s", stats.Written(), cfg.TargetPath)
+	return nil
+}
+
+// AvroWrite converts a JSON lines file into an Avro object container file,
+// which embeds the schema of its records. Partitioned files leave the
+// partition columns out, so the schema must not require them.
+type AvroWrite struct{}
+
+func NewAvroWrite() *AvroWrite {
+	return &AvroWrite{}
+}
+
+func (a *AvroWrite) Validate(ctx context.Context, task store.Task) error {
+	_, err := a.config(task)
+	return err
+}
+
+func (a *AvroWrite) config(task store.Task) (AvroWriteConfig, error) {
+	var cfg AvroWriteConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if err := validateSourcePath(cfg.SourcePath); err != nil {
+		return cfg, err
+	}
+	if err := validateOutputPath(cfg.TargetPath); err != nil {
+		return cfg, err
+	}
+	if err := validateDeadLetter(cfg.DeadLetter); err != nil {
+		return cfg, err
+	}
+
+	if cfg.RecordName == "" {
+		cfg.RecordName = "Record"
+	}
+	if !avroNamePattern.MatchString(cfg.RecordName) {
+		return cfg, fmt.Errorf("invalid record_name %q", cfg.RecordName)
+	}
+	if cfg.Compression == "" {
+		cfg.Compression = goavro.CompressionNullLabel
+	}
+
+	if string(cfg.Schema) == "null" {
+		cfg.Schema = nil
+	}
+	if len(cfg.Schema) > 0 {
+		if _, err := goavro.NewCodec(string(cfg.Schema)); err != nil {
+			return cfg, fmt.Errorf("invalid schema: %w", err)
+		}
+	}
+
+	return cfg, nil
+}
+
+func (a *AvroWrite) Run(ctx context.Context, run *Run) error {
+	cfg, err := a.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	text := string(cfg.Schema)
+	if text == "" {
+		// Lines that do not parse are left to the dead letter, if any.
+		bad := failLine
+		if cfg.DeadLetter != nil {
+			bad = func(int, any, error) error { return nil }
+		}
+		text, err = inferAvroSchema(cfg.SourcePath, cfg.RecordName, bad)
+		if err != nil {
+			return err
+		}
+		run.Log.Printf("inferred schema %s", text)
+	}
+
+	codec, err := goavro.NewCodec(text)
+	if err != nil {
+		return err
+	}
+	schema, err := parseAvroSchema(text)
+	if err != nil {
+		return err
+	}
+
+	var sink record.Sink
+	if cfg.Partition != nil {
+		sink = newPartitionedSink(run, cfg.TargetPath, *cfg.Partition, ".avro", func(path string) (record.Sink, error) {
+			return newAvroSink(nil, path, codec, schema, cfg.Compression)
+		})
+	} else {
+		sink, err = newAvroSink(run, cfg.TargetPath, codec, schema, cfg.Compression)
+		if err != nil {
+			return err
+		}
+	}
+
+	stats, err := runPipeline(ctx, run, cfg.DeadLetter, jsonlSource(AvroWriteType, cfg.SourcePath), sink)
+	if err != nil {
+		return err
+	}
+
+	run.Log.Printf("wrote %d records into %s", stats.Written(), cfg.TargetPath)
+	return nil
+}
+
+// avroSink writes records to an object container file, one block per
+// batch. Records that do not fit the schema are rejected.
+type avroSink struct {
+	out    *atomicFile
+	writer *goavro.OCFWriter
+	schema *avroSchema
+	rows   int64
+}
+
+func newAvroSink(run *Run, path string, codec *goavro.Codec, schema *avroSchema, compression string) (*avroSink, error) {
+	out, err := createAtomic(run, path)
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := goavro.NewOCFWriter(goavro.OCFConfig{
+		W:               out,
+		Codec:           codec,
+		CompressionName: compression,
+	})
+	if err != nil {
+		out.Abort()
+		return nil, err
+	}
+
+	return &avroSink{out: out, writer: writer, schema: schema}, nil
+}
+
+func (s *avroSink) Name() string {
+	return "avro"
+}
+
+func (s *avroSink) Write(ctx context.Context, batch record.Batch) error {
+	block := make([]any, 0, len(batch))
+	for i, r := range batch {
+		datum, err := s.schema.fromJSON(s.schema.root, map[string]any(r))
+		if err != nil {
+			err = record.Reject(ctx, record.Rejection{
+				Position: fmt.Sprintf("record %d", s.rows+int64(i)+1),
+				Reason:   err.Error(),
+				Record:   r,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		block = append(block, datum)
+	}
+
+	if len(block) > 0 {
+		if err := s.writer.Append(block); err != nil {
+			return fmt.Errorf("records %d to %d: %w", s.rows+1, s.rows+int64(len(batch)), err)
+		}
+	}
+	s.rows += int64(len(batch))
+	return nil
+}
+
+func (s *avroSink) Commit(ctx context.Context) error {
+	return s.out.Commit()
+}
+
+func (s *avroSink) Abort() {
+	s.out.Abort()
+}
+
+func (s *avroSink) size() int64 {
+	return s.out.size
+}
+
+func (s *avroSink) dataset() string {
+	return s.out.path
+}
+
+var avroNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// inferAvroSchema infers a record schema from the scalar fields of a JSON
+// lines file. Fields are nullable since they may be missing from records,
+// and fields that are always null are strings.
+func inferAvroSchema(path, name string, bad badLine) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	types := make(map[string]string)
+	err = scanJSONL(file, func(record map[string]any) error {
+		for field, value := range record {
+			if !avroNamePattern.MatchString(field) {
+				return fmt.Errorf("field %q is not a valid Avro name, provide a schema", field)
+			}
+
+			var t string
+			switch v := value.(type) {
+			case nil:
+				if _, ok := types[field]; !ok {
+					types[field] = ""
+				}
+				continue
+			case bool:
+				t = "boolean"
+			case string:
+				t = "string"
+			case json.Number:
+				t = "double"
+				if _, err := v.Int64(); err == nil {
+					t = "long"
+				}
+			default:
+				return fmt.Errorf("field %q holds nested values, provide a schema", field)
+			}
+
+			switch prev := types[field]; {
+			case prev == "" || prev == t:
+				types[field] = t
+			case prev == "long" && t == "double", prev == "double" && t == "long":
+				types[field] = "double"
+			default:
+				return fmt.Errorf("field %q holds both %s and %s values, provide a schema", field, prev, t)
+			}
+		}
+		return nil
+	}, bad)
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(types))
+	for field := range types {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	fields := make([]map[string]any, len(names))
+	for i, field := range names {
+		t := types[field]
+		if t == "" {
+			t = "string"
+		}
+		fields[i] = map[string]any{
+			"name":    field,
+			"type":    []string{"null", t},
+			"default": nil,
+		}
+	}
+
+	schema, err := json.Marshal(map[string]any{
+		"type":   "record",
+		"name":   name,
+		"fields": fields,
+	})
+	return string(schema), err
+}
+
+// avroSchema is a parsed Avro schema used to convert between JSON values
+// and the native values of goavro, which wraps union values in a map keyed
+// by the name of their branch.
+type avroSchema struct {
+	root  any
+	named map[string]any
+}
+
+func parseAvroSchema(text string) (*avroSchema, error) {
+	var root any
+	if err := json.Unmarshal([]byte(text), &root); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	s := &avroSchema{root: root, named: make(map[string]any)}
+	s.collect(root, "")
+	return s, nil
+}
+
+// collect registers the named types of a schema under their short and full
+// names. The name of a named type is normalized to its full name.
+func (s *avroSchema) collect(schema any, namespace string) {
+	switch schema := schema.(type) {
+	case []any:
+		for _, branch := range schema {
+			s.collect(branch, namespace)
+		}
+	case map[string]any:
+		switch schema["type"] {
+		case "record", "error", "enum", "fixed":
+			name, _ := schema["name"].(string)
+			if ns, ok := schema["namespace"].(string); ok {
+				namespace = ns
+			}
+			full := name
+			if !strings.Contains(name, ".") && namespace != "" {
+				full = namespace + "." + name
+			}
+			schema["name"] = full
+			s.named[name] = schema
+			s.named[full] = schema
+
+			fields, _ := schema["fields"].([]any)
+			for _, field := range fields {
+				if field, ok := field.(map[string]any); ok {
+					s.collect(field["type"], namespace)
+				}
+			}
+		case "array":
+			s.collect(schema["items"], namespace)
+		case "map":
+			s.collect(schema["values"], namespace)
+		default:
+			s.collect(schema["type"], namespace)
+		}
+	}
+}
+
+// resolve replaces references to named types by their definition.
+func (s *avroSchema) resolve(schema any) any {
+	if name, ok := schema.(string); ok {
+		if named, ok := s.named[name]; ok {
+			return named
+		}
+	}
+	return schema
+}
+
+// branchName returns the name goavro uses for a union branch.
+func branchName(schema any) string {
+	switch schema := schema.(type) {
+	case string:
+		return schema
+	case map[string]any:
+		t, _ := schema["type"].(string)
+		switch t {
+		case "record", "error", "enum", "fixed":
+			name, _ := schema["name"].(string)
+			return name
+		}
+		if logical, ok := schema["logicalType"].(string); ok {
+			return t + "." + logical
+		}
+		return t
+	}
+	return ""
+}
+
+// typeOf returns the type of a schema, and its logical type if any.
+func typeOf(schema any) (string, string) {
+	switch schema := schema.(type) {
+	case string:
+		return schema, ""
+	case map[string]any:
+		t, _ := schema["type"].(string)
+		logical, _ := schema["logicalType"].(string)
+		if t == "" {
+			// {"type": {"type": ...}} nests a schema.
+			return typeOf(schema["type"])
+		}
+		return t, logical
+	}
+	return "", ""
+}
+
+// fromJSON converts a value read from JSON lines into the native value of
+// schema.
+func (s *avroSchema) fromJSON(schema, value any) (any, error) {
+	schema = s.resolve(schema)
+
+	if branches, ok := schema.([]any); ok {
+		if value == nil {
+			for _, branch := range branches {
+				if branch == "null" {
+					return nil, nil
+				}
+			}
+			return nil, errors.New("null is not allowed")
+		}
+
+		var errs []string
+		for _, branch := range branches {
+			if branch == "null" {
+				continue
+			}
+			native, err := s.fromJSON(branch, value)
+			if err == nil {
+				return goavro.Union(branchName(s.resolve(branch)), native), nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return nil, fmt.Errorf("no union branch matches: %s", strings.Join(errs, "; "))
+	}
+
+	m, _ := schema.(map[string]any)
+	if nested, ok := m["type"].(map[string]any); ok {
+		return s.fromJSON(nested, value)
+	}
+
+	t, logical := typeOf(schema)
+	switch t {
+	case "null":
+		if value != nil {
+			return nil, fmt.Errorf("expected null, got %v", value)
+		}
+		return nil, nil
+	case "boolean":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case "int", "long":
+		switch logical {
+		case "timestamp-millis", "timestamp-micros":
+			if s, ok := value.(string); ok {
+				ts, err := time.Parse(time.RFC3339Nano, s)
+				if err != nil {
+					return nil, err
+				}
+				return ts, nil
+			}
+		case "date":
+			if s, ok := value.(string); ok {
+				d, err := time.Parse(time.DateOnly, s)
+				if err != nil {
+					return nil, err
+				}
+				return d, nil
+			}
+		}
+		if n, ok := value.(json.Number); ok {
+			i, err := n.Int64()
+			if err != nil {
+				return nil, fmt.Errorf("expected %s, got %s", t, n)
+			}
+			return i, nil
+		}
+	case "float", "double":
+		if n, ok := value.(json.Number); ok {
+			return n.Float64()
+		}
+	case "bytes", "fixed":
+		if logical == "decimal" {
+			if r, ok := decimalRat(value); ok {
+				return r, nil
+			}
+			return nil, fmt.Errorf("expected decimal, got %v", value)
+		}
+		if str, ok := value.(string); ok {
+			return []byte(str), nil
+		}
+	case "string":
+		if str, ok := value.(string); ok {
+			return str, nil
+		}
+	case "enum":
+		if str, ok := value.(string); ok {
+			return str, nil
+		}
+	case "array":
+		if items, ok := value.([]any); ok {
+			natives := make([]any, len(items))
+			for i, item := range items {
+				native, err := s.fromJSON(m["items"], item)
+				if err != nil {
+					return nil, fmt.Errorf("item %d: %w", i, err)
+				}
+				natives[i] = native
+			}
+			return natives, nil
+		}
+	case "map":
+		if values, ok := value.(map[string]any); ok {
+			natives := make(map[string]any, len(values))
+			for k, v := range values {
+				native, err := s.fromJSON(m["values"], v)
+				if err != nil {
+					return nil, fmt.Errorf("key %s: %w", k, err)
+				}
+				natives[k] = native
+			}
+			return natives, nil
+		}
+	case "record", "error":
+		if record, ok := value.(map[string]any); ok {
+			fields, _ := m["fields"].([]any)
+			natives := make(map[string]any, len(fields))
+			for _, f := range fields {
+				field, _ := f.(map[string]any)
+				name, _ := field["name"].(string)
+
+				v, present := record[name]
+				if !present {
+					if def, ok := field["default"]; ok {
+						v = def
+					}
+				}
+				native, err := s.fromJSON(field["type"], v)
+				if err != nil {
+					return nil, fmt.Errorf("field %s: %w", name, err)
+				}
+				natives[name] = native
+			}
+			return natives, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported schema type %q", t)
+	}
+
+	return nil, fmt.Errorf("expected %s, got %T", t, value)
+}
+
+func decimalRat(value any) (*big.Rat, bool) {
+	var text string
+	switch v := value.(type) {
+	case json.Number:
+		text = v.String()
+	case string:
+		text = v
+	default:
+		return nil, false
+	}
+	return new(big.Rat).SetString(text)
+}
+
+// toJSON converts a native value of schema into a value for JSON lines,
+// unwrapping union values.
+func (s *avroSchema) toJSON(schema, value any) (any, error) {
+	schema = s.resolve(schema)
+	if value == nil {
+		return nil, nil
+	}
+
+	if branches, ok := schema.([]any); ok {
+		wrapped, ok := value.(map[string]any)
+		if !ok || len(wrapped) != 1 {
+			return nil, fmt.Errorf("invalid union value %v", value)
+		}
+		for name, v := range wrapped {
+			for _, branch := range branches {
+				if branchName(s.resolve(branch)) == name {
+					return s.toJSON(branch, v)
+				}
+			}
+			return nil, fmt.Errorf("unknown union branch %q", name)
+		}
+	}
+
+	m, _ := schema.(map[string]any)
+	if nested, ok := m["type"].(map[string]any); ok {
+		return s.toJSON(nested, value)
+	}
+
+	t, logical := typeOf(schema)
+	switch t {
+	case "bytes", "fixed":
+		if r, ok := value.(*big.Rat); ok && logical == "decimal" {
+			scale, _ := m["scale"].(float64)
+			return json.Number(r.FloatString(int(scale))), nil
+		}
+		if b, ok := value.([]byte); ok {
+			return string(b), nil
+		}
+	case "int", "long":
+		if logical == "date" {
+			if d, ok := value.(time.Time); ok {
+				return d.Format(time.DateOnly), nil
+			}
+		}
+	case "array":
+		if items, ok := value.([]any); ok {
+			values := make([]any, len(items))
+			for i, item := range items {
+				v, err := s.toJSON(m["items"], item)
+				if err != nil {
+					return nil, err
+				}
+				values[i] = v
+			}
+			return values, nil
+		}
+	case "map":
+		if natives, ok := value.(map[string]any); ok {
+			values := make(map[string]any, len(natives))
+			for k, native := range natives {
+				v, err := s.toJSON(m["values"], native)
+				if err != nil {
+					return nil, err
+				}
+				values[k] = v
+			}
+			return values, nil
+		}
+	case "record", "error":
+		if natives, ok := value.(map[string]any); ok {
+			fields, _ := m["fields"].([]any)
+			record := make(map[string]any, len(fields))
+			for _, f := range fields {
+				field, _ := f.(map[string]any)
+				name, _ := field["name"].(string)
+				v, err := s.toJSON(field["type"], natives[name])
+				if err != nil {
+					return nil, fmt.Errorf("field %s: %w", name, err)
+				}
+				record[name] = v
+			}
+			return record, nil
+		}
+	}
+
+	return value, nil
+}
@@ -0,0 +1,124 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func runTask(t *testing.T, handler Handler, taskType string, config any) (*Run, error) {
+	t.Helper()
+
+	raw, _ := json.Marshal(config)
+	task := store.Task{ID: 1, Type: taskType, Config: raw}
+	if err := handler.Validate(context.Background(), task); err != nil {
+		return nil, err
+	}
+
+	run := NewRun(task, &store.TaskRun{ID: 1})
+	return run, run.complete(context.Background(), handler.Run(context.Background(), run))
+}
+
+func TestAvro_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "people.jsonl")
+	data := "{\"id\": 1, \"name\": \"Chihiro\", \"score\": 9.5, \"active\": true}\n" +
+		"{\"id\": 2, \"name\": null, \"score\": 7, \"nickname\": null}\n"
+	assert.NoError(t, os.WriteFile(source, []byte(data), 0o644))
+
+	t.Run("inferred schema", func(t *testing.T) {
+		avroPath := filepath.Join(dir, "people.avro")
+		run, err := runTask(t, NewAvroWrite(), AvroWriteType, AvroWriteConfig{
+			SourcePath:  source,
+			TargetPath:  avroPath,
+			Compression: "deflate",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), *run.Record.RowsAffected)
+
+		// The schema is embedded in the container file.
+		file, _ := os.Open(avroPath)
+		defer file.Close()
+		reader, err := goavro.NewOCFReader(file)
+		assert.NoError(t, err)
+		assert.Contains(t, reader.Codec().Schema(), `"name":"score","type":["null","double"]`)
+		assert.Contains(t, reader.Codec().Schema(), `"name":"nickname","type":["null","string"]`)
+
+		target := filepath.Join(dir, "people_copy.jsonl")
+		run, err = runTask(t, NewAvroRead(), AvroReadType, AvroReadConfig{SourcePath: avroPath, TargetPath: target})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), *run.Record.RowsAffected)
+
+		lines := readLines(t, target)
+		assert.Equal(t, map[string]any{"id": 1.0, "name": "Chihiro", "score": 9.5, "active": true, "nickname": nil}, lines[0])
+		assert.Equal(t, map[string]any{"id": 2.0, "name": nil, "score": 7.0, "active": nil, "nickname": nil}, lines[1])
+	})
+
+	t.Run("explicit schema", func(t *testing.T) {
+		source := filepath.Join(dir, "orders.jsonl")
+		data := `{"id": 1, "amount": "12.50", "placed_at": "2025-01-02T03:04:05Z", "status": "open", "customer": {"name": "Lin"}, "tags": ["a", "b"]}`
+		assert.NoError(t, os.WriteFile(source, []byte(data), 0o644))
+
+		schema := `{
+			"type": "record", "name": "Order", "namespace": "shop",
+			"fields": [
+				{"name": "id", "type": "int"},
+				{"name": "amount", "type": {"type": "bytes", "logicalType": "decimal", "precision": 10, "scale": 2}},
+				{"name": "placed_at", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+				{"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["open", "closed"]}},
+				{"name": "customer", "type": ["null", {"type": "record", "name": "Customer", "fields": [{"name": "name", "type": "string"}]}]},
+				{"name": "tags", "type": {"type": "array", "items": "string"}},
+				{"name": "note", "type": ["null", "string"], "default": null}
+			]
+		}`
+
+		avroPath := filepath.Join(dir, "orders.avro")
+		_, err := runTask(t, NewAvroWrite(), AvroWriteType, AvroWriteConfig{
+			SourcePath: source,
+			TargetPath: avroPath,
+			Schema:     json.RawMessage(schema),
+		})
+		assert.NoError(t, err)
+
+		target := filepath.Join(dir, "orders_copy.jsonl")
+		_, err = runTask(t, NewAvroRead(), AvroReadType, AvroReadConfig{SourcePath: avroPath, TargetPath: target})
+		assert.NoError(t, err)
+
+		lines := readLines(t, target)
+		assert.Equal(t, 12.5, lines[0]["amount"])
+		assert.Equal(t, "2025-01-02T03:04:05Z", lines[0]["placed_at"])
+		assert.Equal(t, "open", lines[0]["status"])
+		assert.Equal(t, map[string]any{"name": "Lin"}, lines[0]["customer"])
+		assert.Equal(t, []any{"a", "b"}, lines[0]["tags"])
+		assert.Nil(t, lines[0]["note"])
+	})
+
+	t.Run("record not matching the schema", func(t *testing.T) {
+		schema := `{"type": "record", "name": "Person", "fields": [{"name": "id", "type": "int"}, {"name": "name", "type": "string"}]}`
+		target := filepath.Join(dir, "bad.avro")
+		_, err := runTask(t, NewAvroWrite(), AvroWriteType, AvroWriteConfig{
+			SourcePath: source,
+			TargetPath: target,
+			Schema:     json.RawMessage(schema),
+		})
+		assert.ErrorContains(t, err, "record 2: field name: expected string")
+
+		_, err = os.Stat(target)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("invalid schema", func(t *testing.T) {
+		_, err := runTask(t, NewAvroWrite(), AvroWriteType, AvroWriteConfig{
+			SourcePath: source,
+			TargetPath: filepath.Join(dir, "bad.avro"),
+			Schema:     json.RawMessage(`{"type": "record"}`),
+		})
+		assert.ErrorContains(t, err, "invalid schema")
+	})
+}
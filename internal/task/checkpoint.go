@@ -0,0 +1,355 @@
+package task
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+// CheckpointKey is the task state key of the checkpoint of a run that did
+// not finish.
+const CheckpointKey = "checkpoint"
+
+const defaultCheckpointInterval = time.Minute
+
+// CheckpointConfig makes a run save how far it got at regular intervals:
+// the position of its source and the output written up to there. When the
+// run fails, the next run of the task resumes from the last checkpoint
+// instead of starting over. A successful run removes the checkpoint.
+type CheckpointConfig struct {
+	// Interval is the time between checkpoints, "1m" by default.
+	Interval string `json:"interval"`
+}
+
+func (c *CheckpointConfig) interval() (time.Duration, error) {
+	if c.Interval == "" {
+		return defaultCheckpointInterval, nil
+	}
+
+	d, err := time.ParseDuration(c.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid checkpoint interval: %w", err)
+	}
+	if d <= 0 {
+		return 0, errors.New("checkpoint interval must be positive")
+	}
+	return d, nil
+}
+
+// CheckpointOf returns the checkpoint configuration of a task, or nil when
+// the task does not checkpoint.
+func CheckpointOf(task store.Task) (*CheckpointConfig, error) {
+	var cfg struct {
+		Checkpoint *CheckpointConfig `json:"checkpoint"`
+	}
+	if err := json.Unmarshal(task.Config, &cfg); err != nil {
+		return nil, err
+	}
+	return cfg.Checkpoint, nil
+}
+
+// SourcePosition is how far the source of a pipeline has read. Which
+// fields a source resumes from depends on the source.
+type SourcePosition struct {
+	// Rows counts the records the source wrote. Sources that cannot seek
+	// read the rows again and skip them.
+	Rows int64 `json:"rows"`
+	// Offset is the byte offset of the next line of a file, and Line the
+	// number of lines read.
+	Offset int64 `json:"offset,omitempty"`
+	Line   int   `json:"line,omitempty"`
+	// Cursor is the cursor value of the last row of an ordered query, and
+	// Ties the number of rows of that value written.
+	Cursor string `json:"cursor,omitempty"`
+	Ties   int64  `json:"ties,omitempty"`
+}
+
+// SinkPosition is the output of a sink up to a checkpoint: the staged
+// file written so far and its length.
+type SinkPosition struct {
+	File string `json:"file"`
+	Size int64  `json:"size"`
+}
+
+// FileVersion tells a version of a file from the one replacing it.
+type FileVersion struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Checkpoint is the state a run saved.
+type Checkpoint struct {
+	RunID int64 `json:"run_id"`
+	// Config is a digest of the task configuration. A checkpoint saved
+	// under another configuration is discarded.
+	Config string         `json:"config"`
+	Source SourcePosition `json:"source"`
+	// SourceFile is the version of the file the source reads, if it reads
+	// one. A checkpoint is discarded once the file was replaced, such as
+	// by a new run of the upstream task, as its position would point into
+	// another file.
+	SourceFile *FileVersion `json:"source_file,omitempty"`
+	Sink       SinkPosition `json:"sink"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// resumableSource is a source that can tell how far it read and start
+// again from there.
+type resumableSource interface {
+	record.Positioner
+	resume(pos SourcePosition)
+}
+
+// resumableSink is a sink whose output can be kept when the run fails and
+// continued by the next one.
+type resumableSink interface {
+	// checkpoint flushes the output to disk and returns its position.
+	checkpoint() (SinkPosition, error)
+	// resume continues the output saved at pos, in place of its own.
+	resume(pos SinkPosition) error
+	// keep makes Abort leave the output for the next run.
+	keep()
+}
+
+// checkpointer saves the checkpoints of a run.
+type checkpointer struct {
+	storage  store.Storage
+	run      *Run
+	interval time.Duration
+	config   string
+	// resumed is the checkpoint the run resumes from, if any.
+	resumed *Checkpoint
+
+	sink resumableSink
+	// file is the version of the source file the run reads.
+	file *FileVersion
+	last time.Time
+}
+
+// loadCheckpoint returns the checkpointer of a run, or nil when the task
+// does not checkpoint. A checkpoint saved under another configuration, or
+// whose output is gone, is discarded and the run starts over.
+func loadCheckpoint(ctx context.Context, storage store.Storage, run *Run) (*checkpointer, error) {
+	// The handler reports invalid configurations.
+	cfg, err := CheckpointOf(run.Task)
+	if err != nil || cfg == nil {
+		return nil, nil
+	}
+	interval, err := cfg.interval()
+	if err != nil {
+		return nil, nil
+	}
+
+	digest := sha256.Sum256(run.Task.Config)
+	c := &checkpointer{
+		storage:  storage,
+		run:      run,
+		interval: interval,
+		config:   hex.EncodeToString(digest[:]),
+	}
+
+	state, err := storage.TaskState.Get(ctx, run.Task.ID, CheckpointKey)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return c, nil
+	case err != nil:
+		return nil, err
+	}
+
+	saved, err := parseCheckpoint(state)
+	if err != nil {
+		return nil, err
+	}
+
+	reason := ""
+	if saved.Config != c.config {
+		reason = "the task configuration changed"
+	} else if info, err := os.Stat(saved.Sink.File); err != nil || info.Size() < saved.Sink.Size {
+		reason = "its output is gone"
+	}
+	if reason != "" {
+		run.Log.Printf("discarding the checkpoint of run %d, %s", saved.RunID, reason)
+		if err := c.discard(ctx, saved); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+
+	c.resumed = saved
+	return c, nil
+}
+
+// GetCheckpoint returns the checkpoint the next run of a task resumes
+// from, or store.ErrNotFound when there is none.
+func GetCheckpoint(ctx context.Context, storage store.Storage, taskID int64) (*Checkpoint, error) {
+	state, err := storage.TaskState.Get(ctx, taskID, CheckpointKey)
+	if err != nil {
+		return nil, err
+	}
+	return parseCheckpoint(state)
+}
+
+// DiscardCheckpoint removes the checkpoint of a task and the output it
+// kept, so that the next run starts over. It returns store.ErrNotFound
+// when there is none.
+func DiscardCheckpoint(ctx context.Context, storage store.Storage, taskID int64) error {
+	saved, err := GetCheckpoint(ctx, storage, taskID)
+	if err != nil {
+		return err
+	}
+	if saved.Sink.File != "" {
+		os.Remove(saved.Sink.File)
+	}
+	return storage.TaskState.Delete(ctx, taskID, CheckpointKey)
+}
+
+func parseCheckpoint(state store.TaskState) (*Checkpoint, error) {
+	var saved Checkpoint
+	if err := json.Unmarshal([]byte(state.Value), &saved); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint: %w", err)
+	}
+	return &saved, nil
+}
+
+// attach resumes the source and sink of a pipeline from the checkpoint,
+// if any, and returns the function saving new ones. It returns nil when
+// the source or the sink cannot resume.
+func (c *checkpointer) attach(ctx context.Context, source record.Source, sink record.Sink) (func(context.Context, any) error, error) {
+	rs, ok := source.(resumableSource)
+	if !ok {
+		c.run.Log.Printf("checkpoints are not supported by source %s", stageName(source))
+		return nil, nil
+	}
+	c.sink, ok = sink.(resumableSink)
+	if !ok {
+		c.run.Log.Printf("checkpoints are not supported by sink %s", stageName(sink))
+		return nil, nil
+	}
+
+	c.file = sourceFile(source)
+	if saved := c.resumed; saved != nil && !sameFile(saved.SourceFile, c.file) {
+		c.run.Log.Printf("discarding the checkpoint of run %d, its source file was replaced", saved.RunID)
+		if err := c.discard(ctx, saved); err != nil {
+			return nil, err
+		}
+	}
+
+	if saved := c.resumed; saved != nil {
+		if err := c.sink.resume(saved.Sink); err != nil {
+			// The next run starts over.
+			if discardErr := c.discard(ctx, saved); discardErr != nil {
+				err = errors.Join(err, discardErr)
+			}
+			return nil, fmt.Errorf("failed to resume from the checkpoint of run %d: %w", saved.RunID, err)
+		}
+		rs.resume(saved.Source)
+		c.sink.keep()
+		c.run.Log.Printf("resuming from the checkpoint of run %d after %d records", saved.RunID, saved.Source.Rows)
+	}
+
+	c.last = time.Now()
+	c.run.OnSuccess(c.clear)
+	return c.save, nil
+}
+
+// save saves a checkpoint at position once the interval has passed since
+// the last one.
+func (c *checkpointer) save(ctx context.Context, position any) error {
+	pos, ok := position.(SourcePosition)
+	if !ok || time.Since(c.last) < c.interval {
+		return nil
+	}
+
+	out, err := c.sink.checkpoint()
+	if err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	data, err := json.Marshal(Checkpoint{
+		RunID:      c.run.Record.ID,
+		Config:     c.config,
+		Source:     pos,
+		SourceFile: c.file,
+		Sink:       out,
+		CreatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	state := &store.TaskState{
+		TaskID: c.run.Task.ID,
+		Key:    CheckpointKey,
+		Value:  string(data),
+	}
+	if err := c.storage.TaskState.Set(ctx, state); err != nil {
+		// The run can go on, only a retry would start from further back.
+		c.run.Log.Printf("failed to save checkpoint: %v", err)
+		return nil
+	}
+	c.sink.keep()
+	c.last = time.Now()
+	return nil
+}
+
+// clear removes the checkpoint once the run succeeded.
+func (c *checkpointer) clear(ctx context.Context) error {
+	err := c.storage.TaskState.Delete(ctx, c.run.Task.ID, CheckpointKey)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+	return nil
+}
+
+// discard removes a checkpoint and the output it kept.
+func (c *checkpointer) discard(ctx context.Context, saved *Checkpoint) error {
+	if saved.Sink.File != "" {
+		os.Remove(saved.Sink.File)
+	}
+	c.resumed = nil
+	return c.clear(ctx)
+}
+
+// resumeFrom returns the source position the run resumes from, or nil.
+func (r *Run) resumeFrom() *SourcePosition {
+	if r.checkpoint == nil || r.checkpoint.resumed == nil {
+		return nil
+	}
+	return &r.checkpoint.resumed.Source
+}
+
+// sourceFile returns the version of the file a source reads, or nil when
+// it reads no file.
+func sourceFile(source record.Source) *FileVersion {
+	d, ok := source.(fileStage)
+	if !ok || d.dataset() == "" {
+		return nil
+	}
+	info, err := os.Stat(d.dataset())
+	if err != nil {
+		// The source reports the error when it reads.
+		return nil
+	}
+	return &FileVersion{Size: info.Size(), ModTime: info.ModTime().UTC()}
+}
+
+func sameFile(a, b *FileVersion) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Size == b.Size && a.ModTime.Equal(b.ModTime)
+}
+
+func stageName(stage any) string {
+	if n, ok := stage.(record.Named); ok {
+		return n.Name()
+	}
+	return fmt.Sprintf("%T", stage)
+}
@@ -0,0 +1,413 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestCheckpoint_Validate(t *testing.T) {
+	ctx := context.Background()
+	storage := store.NewMockStore()
+	dir := t.TempDir()
+	source, target := filepath.Join(dir, "in.jsonl"), filepath.Join(dir, "out.jsonl")
+
+	tests := []struct {
+		name    string
+		handler Handler
+		config  string
+		wantErr string
+	}{
+		{
+			name:    "interval",
+			handler: NewTransformMask(storage, NewRegistry()),
+			config:  `{"source_path": "` + source + `", "target_path": "` + target + `", "rules": [{"columns": ["email"], "method": "redact"}], "checkpoint": {"interval": "30s"}}`,
+		},
+		{
+			name:    "invalid interval",
+			handler: NewFixedWidthRead(),
+			config:  `{"source_path": "` + source + `", "target_path": "` + target + `", "columns": [{"name": "id", "start": 1, "length": 4}], "checkpoint": {"interval": "-1s"}}`,
+			wantErr: "checkpoint interval must be positive",
+		},
+		{
+			name:    "partition",
+			handler: NewFixedWidthRead(),
+			config:  `{"source_path": "` + source + `", "target_path": "` + target + `", "columns": [{"name": "id", "start": 1, "length": 4}], "partition": {"columns": ["id"]}, "checkpoint": {}}`,
+			wantErr: "checkpoint cannot be combined with partition",
+		},
+		{
+			name:    "postgres without incremental",
+			handler: NewPostgresExtract(storage),
+			config:  `{"connection": "app", "table": "orders", "target_path": "` + target + `", "checkpoint": {}}`,
+			wantErr: "checkpoint requires incremental",
+		},
+		{
+			name:    "unsupported task type",
+			handler: NewTransformAggregate(storage, NewRegistry()),
+			config:  `{"source_path": "` + source + `", "target_path": "` + target + `", "aggregations": [{"op": "count"}], "checkpoint": {}}`,
+			wantErr: "checkpoint is not supported by this task type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.handler.Validate(ctx, store.Task{Config: json.RawMessage(tt.config)})
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+// checkpointTest copies a JSON lines file through an executor. While
+// failing, the run fails at the record with id 1100, once the checkpoint
+// after the first 1000 records was saved.
+type checkpointTest struct {
+	storage  store.Storage
+	executor *Executor
+	task     *store.Task
+	source   string
+	target   string
+	failing  bool
+	// saved receives the rows of each checkpoint saved.
+	saved chan int64
+}
+
+// signalingState passes on the rows of the checkpoints it saves.
+type signalingState struct {
+	*store.MockTaskStateStore
+	saved chan int64
+}
+
+func (s *signalingState) Set(ctx context.Context, state *store.TaskState) error {
+	if err := s.MockTaskStateStore.Set(ctx, state); err != nil {
+		return err
+	}
+	var saved Checkpoint
+	if state.Key == CheckpointKey && json.Unmarshal([]byte(state.Value), &saved) == nil {
+		select {
+		case s.saved <- saved.Source.Rows:
+		default:
+		}
+	}
+	return nil
+}
+
+func newCheckpointTest(t *testing.T) *checkpointTest {
+	dir := t.TempDir()
+	c := &checkpointTest{
+		storage: store.NewMockStore(),
+		source:  filepath.Join(dir, "in.jsonl"),
+		target:  filepath.Join(dir, "out", "out.jsonl"),
+		failing: true,
+		saved:   make(chan int64, 10),
+	}
+	c.storage.TaskState = &signalingState{c.storage.TaskState.(*store.MockTaskStateStore), c.saved}
+	registry := NewRegistry()
+	registry.Register("test.copy", runFunc(func(ctx context.Context, run *Run) error {
+		sink, err := newJSONLSink(run, c.target)
+		if err != nil {
+			return err
+		}
+		_, err = runPipeline(ctx, run, nil, jsonlSource("copy", c.source), sink, c)
+		return err
+	}))
+	c.executor = NewExecutor(c.storage, registry, zap.NewNop().Sugar(), 1, 1)
+
+	var lines strings.Builder
+	for i := 0; i < 1200; i++ {
+		fmt.Fprintf(&lines, "{\"id\": %d}\n", i)
+	}
+	assert.NoError(t, os.WriteFile(c.source, []byte(lines.String()), 0o644))
+
+	c.task = &store.Task{PipelineID: 1, Type: "test.copy"}
+	c.configure("1ns")
+	assert.NoError(t, c.storage.Tasks.Create(context.Background(), c.task))
+	return c
+}
+
+func (c *checkpointTest) configure(interval string) {
+	c.task.Config = json.RawMessage(`{"checkpoint": {"interval": "` + interval + `"}}`)
+}
+
+func (c *checkpointTest) Apply(ctx context.Context, batch record.Batch) (record.Batch, error) {
+	if !c.failing || batch[0]["id"] != json.Number("1000") {
+		return batch, nil
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case rows := <-c.saved:
+			if rows == 1000 {
+				return nil, errors.New("boom")
+			}
+		case <-timeout:
+			return nil, errors.New("no checkpoint after 1000 records")
+		}
+	}
+}
+
+func (c *checkpointTest) execute(t *testing.T) store.TaskRun {
+	t.Helper()
+
+	ctx := context.Background()
+	run := &store.TaskRun{TaskID: c.task.ID}
+	assert.NoError(t, c.storage.TaskRuns.Create(ctx, run))
+	c.executor.execute(ctx, job{task: *c.task, run: *run})
+
+	finished, err := c.storage.TaskRuns.GetByID(ctx, run.ID)
+	assert.NoError(t, err)
+	return finished
+}
+
+func (c *checkpointTest) checkpoint() (Checkpoint, bool) {
+	state, err := c.storage.TaskState.Get(context.Background(), c.task.ID, CheckpointKey)
+	if err != nil {
+		return Checkpoint{}, false
+	}
+	var saved Checkpoint
+	if err := json.Unmarshal([]byte(state.Value), &saved); err != nil {
+		return Checkpoint{}, false
+	}
+	return saved, true
+}
+
+func TestCheckpoint_Resume(t *testing.T) {
+	c := newCheckpointTest(t)
+
+	failed := c.execute(t)
+	assert.Equal(t, store.StateError, failed.Status)
+	assert.Equal(t, "boom", failed.Error)
+	assert.NoFileExists(t, c.target)
+
+	saved, ok := c.checkpoint()
+	assert.True(t, ok)
+	assert.Equal(t, failed.ID, saved.RunID)
+	assert.Equal(t, SourcePosition{Rows: 1000, Line: 1000, Offset: int64(len(`{"id": 0}`)*10 + len(`{"id": 10}`)*90 + len(`{"id": 100}`)*900 + 1000)}, saved.Source)
+	assert.FileExists(t, saved.Sink.File)
+
+	c.failing = false
+	resumed := c.execute(t)
+	assert.Equal(t, store.StateSuccess, resumed.Status, resumed.Error)
+	assert.Contains(t, resumed.Logs, fmt.Sprintf("resuming from the checkpoint of run %d after 1000 records", failed.ID))
+	assert.Equal(t, int64(200), *resumed.RowsAffected)
+
+	// Every record is written once, in order.
+	lines := readLines(t, c.target)
+	assert.Len(t, lines, 1200)
+	for i, line := range lines {
+		assert.Equal(t, map[string]any{"id": float64(i)}, line)
+	}
+
+	_, ok = c.checkpoint()
+	assert.False(t, ok)
+	entries, err := os.ReadDir(filepath.Dir(c.target))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestCheckpoint_DiscardedOnConfigChange(t *testing.T) {
+	c := newCheckpointTest(t)
+
+	assert.Equal(t, store.StateError, c.execute(t).Status)
+	saved, ok := c.checkpoint()
+	assert.True(t, ok)
+
+	c.failing = false
+	c.configure("1h")
+	run := c.execute(t)
+	assert.Equal(t, store.StateSuccess, run.Status, run.Error)
+	assert.Contains(t, run.Logs, "the task configuration changed")
+	assert.Equal(t, int64(1200), *run.RowsAffected)
+	assert.NoFileExists(t, saved.Sink.File)
+	assert.Len(t, readLines(t, c.target), 1200)
+}
+
+func TestCheckpoint_DiscardedWhenOutputIsGone(t *testing.T) {
+	c := newCheckpointTest(t)
+
+	assert.Equal(t, store.StateError, c.execute(t).Status)
+	saved, _ := c.checkpoint()
+	assert.NoError(t, os.Remove(saved.Sink.File))
+
+	c.failing = false
+	run := c.execute(t)
+	assert.Equal(t, store.StateSuccess, run.Status, run.Error)
+	assert.Contains(t, run.Logs, "its output is gone")
+	assert.Equal(t, int64(1200), *run.RowsAffected)
+}
+
+func TestCheckpoint_DiscardedWhenSourceIsReplaced(t *testing.T) {
+	c := newCheckpointTest(t)
+
+	assert.Equal(t, store.StateError, c.execute(t).Status)
+	saved, ok := c.checkpoint()
+	assert.True(t, ok)
+	assert.NotNil(t, saved.SourceFile)
+
+	// An upstream run replaces the source with another file.
+	replacement := c.source + ".tmp"
+	assert.NoError(t, os.WriteFile(replacement, []byte("{\"id\": 5000}\n{\"id\": 5001}\n"), 0o644))
+	assert.NoError(t, os.Rename(replacement, c.source))
+
+	c.failing = false
+	run := c.execute(t)
+	assert.Equal(t, store.StateSuccess, run.Status, run.Error)
+	assert.Contains(t, run.Logs, "its source file was replaced")
+	assert.Equal(t, int64(2), *run.RowsAffected)
+	assert.NoFileExists(t, saved.Sink.File)
+	assert.Equal(t, []map[string]any{{"id": float64(5000)}, {"id": float64(5001)}}, readLines(t, c.target))
+}
+
+func TestReadFixedWidth_Resume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "in.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("HEADER\r\n0001A\r\n\r\n0002B\r\n0003C\r\n0004D"), 0o644))
+	cfg := FixedWidthReadConfig{
+		SourcePath: path,
+		SkipLines:  1,
+		Columns: []FixedWidthColumn{
+			{Name: "id", Start: 1, Length: 4, Type: FieldInteger},
+			{Name: "code", Start: 5, Length: 1, Type: FieldString},
+		},
+	}
+
+	var all []record.Record
+	var positions []SourcePosition
+	pos := &SourcePosition{}
+	err := readFixedWidth(context.Background(), cfg, pos, writerFunc(func(r record.Record) error {
+		all = append(all, r)
+		positions = append(positions, *pos)
+		return nil
+	}))
+	assert.NoError(t, err)
+	assert.Len(t, all, 4)
+
+	// Resuming after the second record reads the last two.
+	resume := positions[1]
+	assert.Equal(t, 4, resume.Line)
+	assert.Equal(t, int64(len("HEADER\r\n0001A\r\n\r\n0002B\r\n")), resume.Offset)
+
+	var rest []record.Record
+	err = readFixedWidth(context.Background(), cfg, &resume, writerFunc(func(r record.Record) error {
+		rest = append(rest, r)
+		return nil
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, all[2:], rest)
+	assert.Equal(t, 6, resume.Line)
+}
+
+func TestReaderSource_ResumeSkipsRows(t *testing.T) {
+	source := newSource("rows", func(ctx context.Context, w record.Writer) error {
+		for i := 0; i < 5; i++ {
+			if err := w.Write(record.Record{"id": i}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	source.resume(SourcePosition{Rows: 3})
+
+	var ids []any
+	err := source.Read(context.Background(), writerFunc(func(r record.Record) error {
+		ids = append(ids, r["id"])
+		return nil
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, []any{3, 4}, ids)
+	assert.Equal(t, int64(5), source.Position().(SourcePosition).Rows)
+}
+
+func TestPostgresExtract_ResumeFromCursor(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+
+	ctx := context.Background()
+	storage := store.NewMockStore()
+	storage.Pipelines.Create(ctx, &store.Pipelines{ID: 1, OrganizationID: 1})
+	storage.Connections.Create(ctx, &store.Connection{OrganizationID: 1, Name: "app", Type: store.ConnectionPostgres})
+
+	extract := NewPostgresExtract(storage)
+	extract.open = func(store.Connection) (*sql.DB, error) {
+		return db, nil
+	}
+	registry := NewRegistry()
+	registry.Register(PostgresExtractType, extract)
+	executor := NewExecutor(storage, registry, zap.NewNop().Sugar(), 1, 1)
+
+	target := filepath.Join(t.TempDir(), "orders.jsonl")
+	config := `{"connection": "app", "table": "public.orders", "target_path": "` + target + `",
+		"incremental": {"cursor": "id", "cursor_type": "integer"}, "checkpoint": {}}`
+	task := &store.Task{PipelineID: 1, Type: PostgresExtractType, Config: json.RawMessage(config)}
+	assert.NoError(t, storage.Tasks.Create(ctx, task))
+
+	// A failed run wrote the rows up to the first of the two with id 2.
+	kept := filepath.Join(filepath.Dir(target), ".orders.jsonl.run-1.kept.tmp")
+	written := `{"id":1}` + "\n" + `{"id":2}` + "\n"
+	assert.NoError(t, os.WriteFile(kept, []byte(written+`{"id":`), 0o644))
+	loaded, err := loadCheckpoint(ctx, storage, NewRun(*task, &store.TaskRun{}))
+	assert.NoError(t, err)
+	data, _ := json.Marshal(Checkpoint{
+		RunID:  1,
+		Config: loaded.config,
+		Source: SourcePosition{Rows: 2, Cursor: "2", Ties: 1},
+		Sink:   SinkPosition{File: kept, Size: int64(len(written))},
+	})
+	storage.TaskState.Set(ctx, &store.TaskState{TaskID: task.ID, Key: CheckpointKey, Value: string(data)})
+
+	rows := sqlmock.NewRows([]string{"id"}).
+		AddRow(int64(2)).
+		AddRow(int64(2)).
+		AddRow(int64(3))
+	mock.ExpectQuery(`SELECT * FROM (SELECT * FROM "public"."orders") AS src WHERE "id" >= $1 ORDER BY "id"`).
+		WithArgs("2").
+		WillReturnRows(rows)
+	mock.ExpectClose()
+
+	run := &store.TaskRun{TaskID: task.ID}
+	assert.NoError(t, storage.TaskRuns.Create(ctx, run))
+	executor.execute(ctx, job{task: *task, run: *run})
+
+	finished, _ := storage.TaskRuns.GetByID(ctx, run.ID)
+	assert.Equal(t, store.StateSuccess, finished.Status, finished.Error)
+	assert.Equal(t, int64(2), *finished.RowsAffected)
+	var ids []any
+	for _, line := range readLines(t, target) {
+		ids = append(ids, line["id"])
+	}
+	assert.Equal(t, []any{1.0, 2.0, 2.0, 3.0}, ids)
+	assert.NoFileExists(t, kept)
+
+	state, _ := storage.TaskState.Get(ctx, task.ID, WatermarkKey)
+	assert.Equal(t, "3", state.Value)
+	_, err = storage.TaskState.Get(ctx, task.ID, CheckpointKey)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+type writerFunc func(record.Record) error
+
+func (f writerFunc) Write(r record.Record) error {
+	return f(r)
+}
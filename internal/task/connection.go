@@ -0,0 +1,39 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+// taskConnection looks up a connection by name in the organization that
+// owns the pipeline of the task.
+func taskConnection(ctx context.Context, storage store.Storage, task store.Task, name string) (store.Connection, error) {
+	pipeline, err := storage.Pipelines.GetByID(ctx, task.PipelineID)
+	if err != nil {
+		return store.Connection{}, fmt.Errorf("failed to get pipeline %d: %w", task.PipelineID, err)
+	}
+
+	conn, err := storage.Connections.GetByName(ctx, pipeline.OrganizationID, name)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return store.Connection{}, fmt.Errorf("connection %q not found", name)
+		}
+		return store.Connection{}, err
+	}
+
+	return conn, nil
+}
+
+// openPostgres opens a connection pool to a postgres connection. The caller
+// closes it.
+func openPostgres(conn store.Connection) (*sql.DB, error) {
+	if conn.Type != store.ConnectionPostgres {
+		return nil, fmt.Errorf("connection %q is of type %q, expected %q", conn.Name, conn.Type, store.ConnectionPostgres)
+	}
+
+	return sql.Open("pgx", conn.DSN)
+}
@@ -0,0 +1,119 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/LincolnG4/Haku/internal/record"
+)
+
+// DeadLetterConfig sets aside the records a task cannot process, such as
+// lines that do not parse or values that do not cast, instead of failing
+// the run on the first one. Without thresholds every record may be
+// rejected.
+type DeadLetterConfig struct {
+	// Path is the directory the rejected records of each run are written
+	// to, as run-<run id>.jsonl, with the reason and position of each.
+	Path string `json:"path" validate:"required"`
+	// MaxRejects fails the run once more records were rejected.
+	MaxRejects *int64 `json:"max_rejects" validate:"omitempty,min=0"`
+	// MaxRejectPercent fails the run when a larger share of the records
+	// read was rejected.
+	MaxRejectPercent *float64 `json:"max_reject_percent" validate:"omitempty,min=0,max=100"`
+}
+
+func validateDeadLetter(cfg *DeadLetterConfig) error {
+	if cfg != nil && !filepath.IsAbs(cfg.Path) {
+		return fmt.Errorf("dead_letter: path must be an absolute path")
+	}
+	return nil
+}
+
+// deadLetter writes the rejected records of a run to its file, which is
+// only created once a record is rejected and is kept whether the run
+// succeeds or not.
+type deadLetter struct {
+	cfg  DeadLetterConfig
+	path string
+
+	mu       sync.Mutex
+	out      *jsonlOutput
+	rejected int64
+}
+
+func newDeadLetter(cfg DeadLetterConfig, runID int64) *deadLetter {
+	return &deadLetter{
+		cfg:  cfg,
+		path: filepath.Join(cfg.Path, fmt.Sprintf("run-%d.jsonl", runID)),
+	}
+}
+
+func (d *deadLetter) Reject(ctx context.Context, r record.Rejection) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.out == nil {
+		// Rejects are kept even when the run fails, and the file is named
+		// after the run, so it is not staged.
+		out, err := createJSONL(nil, d.path)
+		if err != nil {
+			return fmt.Errorf("dead letter: %w", err)
+		}
+		d.out = out
+	}
+
+	err := d.out.Write(map[string]any{
+		"stage":    r.Stage,
+		"position": r.Position,
+		"reason":   r.Reason,
+		"record":   r.Record,
+	})
+	if err != nil {
+		return fmt.Errorf("dead letter: %w", err)
+	}
+
+	d.rejected++
+	if max := d.cfg.MaxRejects; max != nil && d.rejected > *max {
+		return fmt.Errorf("rejected more than %d records, the last one %s", *max, r.Error())
+	}
+	return nil
+}
+
+func (d *deadLetter) Finish(stats record.Stats) error {
+	max := d.cfg.MaxRejectPercent
+	read := stats.Read()
+	if max == nil || read == 0 {
+		return nil
+	}
+
+	rejected := stats.Rejected()
+	if percent := float64(rejected) * 100 / float64(read); percent > *max {
+		return fmt.Errorf("rejected %d of %d records (%.2f%%), more than %g%%", rejected, read, percent, *max)
+	}
+	return nil
+}
+
+// close keeps the records rejected so far.
+func (d *deadLetter) close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.out == nil {
+		return nil
+	}
+	return d.out.Commit()
+}
+
+// rejectLine returns a badLine that rejects the records that do not parse,
+// positioned by their line in the input named by prefix.
+func rejectLine(ctx context.Context, prefix string) badLine {
+	return func(line int, raw any, err error) error {
+		return record.Reject(ctx, record.Rejection{
+			Position: fmt.Sprintf("%sline %d", prefix, line),
+			Reason:   err.Error(),
+			Record:   raw,
+		})
+	}
+}
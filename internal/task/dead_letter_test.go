@@ -0,0 +1,96 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetter(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "orders.jsonl")
+	target := filepath.Join(dir, "mapped.jsonl")
+	rejects := filepath.Join(dir, "rejects")
+	data := `{"id": 1, "price": "12.50"}` + "\n" +
+		`{"id": 2, "price": ` + "\n" +
+		`{"id": 3, "price": "n/a"}` + "\n" +
+		`{"id": 4, "price": "3"}` + "\n"
+	assert.NoError(t, os.WriteFile(source, []byte(data), 0o644))
+	assert.NoError(t, os.Mkdir(rejects, 0o755))
+
+	config := TransformMapConfig{
+		SourcePath: source,
+		TargetPath: target,
+		Steps:      []MapStep{{Op: MapCast, Columns: []string{"price"}, Type: "decimal"}},
+		DeadLetter: &DeadLetterConfig{Path: rejects},
+	}
+
+	run, err := runTask(t, newTransformMap(store.NewMockStore()), TransformMapType, config)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), *run.Record.RowsAffected)
+	assert.Equal(t, []map[string]any{{"id": 1.0, "price": 12.5}, {"id": 4.0, "price": 3.0}}, readLines(t, target))
+
+	assert.Equal(t, []map[string]any{
+		{
+			"stage":    TransformMapType,
+			"position": "line 2",
+			"reason":   "unexpected EOF",
+			"record":   `{"id": 2, "price":`,
+		},
+		{
+			"stage":    "map",
+			"position": "record 2",
+			"reason":   "step 1 (cast): column price: invalid decimal \"n/a\"",
+			"record":   map[string]any{"id": 3.0, "price": "n/a"},
+		},
+	}, readLines(t, filepath.Join(rejects, "run-1.jsonl")))
+
+	t.Run("max rejects", func(t *testing.T) {
+		limited := config
+		limited.DeadLetter = &DeadLetterConfig{Path: rejects, MaxRejects: new(int64)}
+
+		_, err := runTask(t, newTransformMap(store.NewMockStore()), TransformMapType, limited)
+		assert.EqualError(t, err, "rejected more than 0 records, the last one line 2: unexpected EOF")
+	})
+
+	t.Run("max reject percent", func(t *testing.T) {
+		limited := config
+		limited.DeadLetter = &DeadLetterConfig{Path: rejects, MaxRejectPercent: float(25)}
+
+		_, err := runTask(t, newTransformMap(store.NewMockStore()), TransformMapType, limited)
+		assert.EqualError(t, err, "rejected 2 of 4 records (50.00%), more than 25%")
+		assert.NoFileExists(t, target+".tmp")
+	})
+
+	t.Run("csv rows with missing fields", func(t *testing.T) {
+		csvPath := filepath.Join(dir, "orders.csv")
+		assert.NoError(t, os.WriteFile(csvPath, []byte("id,price\n1,2\n2\n3,4\n"), 0o644))
+
+		target := filepath.Join(dir, "ingested.jsonl")
+		_, err := runTask(t, NewFileIngest(store.NewMockStore()), FileIngestType, FileIngestConfig{
+			SourceGlobs: []string{csvPath},
+			Format:      FormatCSV,
+			TargetPath:  target,
+			DeadLetter:  &DeadLetterConfig{Path: rejects},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, readLines(t, target), 2)
+
+		lines := readLines(t, filepath.Join(rejects, "run-1.jsonl"))
+		if assert.Len(t, lines, 1) {
+			assert.Equal(t, csvPath+": line 3", lines[0]["position"])
+			assert.Equal(t, "wrong number of fields", lines[0]["reason"])
+			assert.Equal(t, []any{"2"}, lines[0]["record"])
+		}
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		invalid := config
+		invalid.DeadLetter = &DeadLetterConfig{Path: "rejects"}
+		_, err := runTask(t, newTransformMap(store.NewMockStore()), TransformMapType, invalid)
+		assert.EqualError(t, err, "dead_letter: path must be an absolute path")
+	})
+}
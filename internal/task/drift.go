@@ -0,0 +1,189 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+const (
+	FieldAdded       string = "added"
+	FieldRemoved     string = "removed"
+	FieldTypeChanged string = "type_changed"
+)
+
+// SchemaChange is a difference between the schema a source read and the
+// one of the last successful run of the task.
+type SchemaChange struct {
+	Field  string      `json:"field"`
+	Change string      `json:"change"`
+	From   record.Type `json:"from,omitempty"`
+	To     record.Type `json:"to,omitempty"`
+}
+
+func (c SchemaChange) String() string {
+	switch c.Change {
+	case FieldAdded:
+		return fmt.Sprintf("field %s added (%s)", c.Field, c.To)
+	case FieldRemoved:
+		return fmt.Sprintf("field %s removed", c.Field)
+	default:
+		return fmt.Sprintf("field %s changed from %s to %s", c.Field, c.From, c.To)
+	}
+}
+
+// diffSchema lists the fields removed from prev, the ones whose type
+// changed, and the ones added to next. Nullability is not compared, nor
+// are fields that only held nulls, since both depend on the records read.
+func diffSchema(prev, next record.Schema) []SchemaChange {
+	var changes []SchemaChange
+	for _, f := range prev.Fields {
+		g, ok := next.Field(f.Name)
+		switch {
+		case !ok:
+			changes = append(changes, SchemaChange{Field: f.Name, Change: FieldRemoved, From: f.Type})
+		case f.Type != g.Type && f.Type != record.TypeAny && g.Type != record.TypeAny:
+			changes = append(changes, SchemaChange{Field: f.Name, Change: FieldTypeChanged, From: f.Type, To: g.Type})
+		}
+	}
+	for _, g := range next.Fields {
+		if _, ok := prev.Field(g.Name); !ok {
+			changes = append(changes, SchemaChange{Field: g.Name, Change: FieldAdded, To: g.Type})
+		}
+	}
+	return changes
+}
+
+// evolveSchema appends the fields of prev missing from next, as nullable.
+func evolveSchema(prev, next record.Schema) record.Schema {
+	evolved := record.Schema{Fields: append([]record.Field{}, next.Fields...)}
+	for _, f := range prev.Fields {
+		if _, ok := next.Field(f.Name); !ok {
+			f.Nullable = true
+			evolved.Fields = append(evolved.Fields, f)
+		}
+	}
+	return evolved
+}
+
+// lastSchema returns the source schema of the last successful run of a
+// task, or nil when there is none.
+func lastSchema(ctx context.Context, storage store.Storage, taskID int64) (*record.Schema, error) {
+	raw, err := storage.TaskRuns.GetLastSchema(ctx, taskID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the last schema: %w", err)
+	}
+
+	var schema record.Schema
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil, fmt.Errorf("failed to decode the last schema: %w", err)
+	}
+	return &schema, nil
+}
+
+// checkSchema records the schema the source of the run read and its
+// differences with the last successful run, then applies the drift policy
+// of the task.
+func (r *Run) checkSchema(observed record.Schema) error {
+	schema := observed
+	var changes []SchemaChange
+	if r.baseline != nil {
+		changes = diffSchema(*r.baseline, observed)
+		if r.Task.DriftPolicy == store.DriftEvolve {
+			schema = evolveSchema(*r.baseline, observed)
+		}
+	}
+
+	r.Record.Schema, _ = json.Marshal(schema)
+	if len(changes) == 0 {
+		return nil
+	}
+	r.Record.SchemaDrift, _ = json.Marshal(changes)
+
+	switch r.Task.DriftPolicy {
+	case store.DriftIgnore:
+	case store.DriftFail:
+		descriptions := make([]string, len(changes))
+		for i, c := range changes {
+			descriptions[i] = c.String()
+		}
+		return fmt.Errorf("schema drift: %s", strings.Join(descriptions, ", "))
+	case store.DriftEvolve:
+		for _, c := range changes {
+			if c.Change == FieldRemoved {
+				r.Log.Printf("schema drift: %s, written as null", c)
+			} else {
+				r.Log.Printf("schema drift: %s", c)
+			}
+		}
+	default:
+		for _, c := range changes {
+			r.Log.Printf("schema drift: %s", c)
+		}
+	}
+	return nil
+}
+
+// errSourceLimit stops a source that read as many records as it may.
+var errSourceLimit = errors.New("source limit reached")
+
+// observedSource records the schema of the records a source reads. The
+// fields of fill the records miss are written as nulls. With a limit, the
+// source ends after that many records.
+type observedSource struct {
+	source record.Source
+	fill   []string
+	limit  int64
+	schema record.Schema
+	count  int64
+}
+
+func (s *observedSource) Name() string {
+	if n, ok := s.source.(record.Named); ok {
+		return n.Name()
+	}
+	return "source"
+}
+
+// Position passes the position of the source on, for checkpoints.
+func (s *observedSource) Position() any {
+	if p, ok := s.source.(record.Positioner); ok {
+		return p.Position()
+	}
+	return nil
+}
+
+func (s *observedSource) Read(ctx context.Context, w record.Writer) error {
+	err := s.source.Read(ctx, observedWriter{s, w})
+	if errors.Is(err, errSourceLimit) {
+		return nil
+	}
+	return err
+}
+
+type observedWriter struct {
+	source *observedSource
+	w      record.Writer
+}
+
+func (o observedWriter) Write(r record.Record) error {
+	if o.source.limit > 0 && o.source.count >= o.source.limit {
+		return errSourceLimit
+	}
+	o.source.schema.Observe(r)
+	o.source.count++
+	for _, name := range o.source.fill {
+		if _, ok := r[name]; !ok {
+			r[name] = nil
+		}
+	}
+	return o.w.Write(r)
+}
@@ -0,0 +1,156 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestDiffSchema(t *testing.T) {
+	prev := record.Schema{Fields: []record.Field{
+		{Name: "id", Type: record.TypeInteger},
+		{Name: "name", Type: record.TypeString},
+		{Name: "score", Type: record.TypeInteger},
+		{Name: "note", Type: record.TypeAny, Nullable: true},
+	}}
+	next := record.Schema{Fields: []record.Field{
+		{Name: "id", Type: record.TypeInteger, Nullable: true},
+		{Name: "score", Type: record.TypeFloat},
+		{Name: "note", Type: record.TypeString},
+		{Name: "email", Type: record.TypeString},
+	}}
+
+	changes := diffSchema(prev, next)
+	assert.Equal(t, []SchemaChange{
+		{Field: "name", Change: FieldRemoved, From: record.TypeString},
+		{Field: "score", Change: FieldTypeChanged, From: record.TypeInteger, To: record.TypeFloat},
+		{Field: "email", Change: FieldAdded, To: record.TypeString},
+	}, changes)
+	assert.Equal(t, "field score changed from integer to float", changes[1].String())
+
+	assert.Empty(t, diffSchema(next, next))
+}
+
+func TestRunPipeline_SchemaDrift(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "in.jsonl")
+	assert.NoError(t, os.WriteFile(source, []byte(`{"id": 1, "email": "chihiro@example.com"}`+"\n"), 0o644))
+
+	baseline := &record.Schema{Fields: []record.Field{
+		{Name: "id", Type: record.TypeInteger},
+		{Name: "name", Type: record.TypeString},
+	}}
+
+	pipeline := func(t *testing.T, policy string, baseline *record.Schema) (*Run, string, error) {
+		t.Helper()
+
+		target := filepath.Join(t.TempDir(), "out.jsonl")
+		run := NewRun(store.Task{ID: 1, DriftPolicy: policy}, &store.TaskRun{ID: 1})
+		run.baseline = baseline
+		sink, err := newJSONLSink(run, target)
+		assert.NoError(t, err)
+
+		_, err = runPipeline(context.Background(), run, nil, jsonlSource("copy", source), sink)
+		return run, target, run.complete(context.Background(), err)
+	}
+
+	t.Run("first run records the schema", func(t *testing.T) {
+		run, _, err := pipeline(t, store.DriftFail, nil)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"fields": [
+			{"name": "email", "type": "string", "nullable": false},
+			{"name": "id", "type": "integer", "nullable": false}
+		]}`, string(run.Record.Schema))
+		assert.Nil(t, run.Record.SchemaDrift)
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		run, target, err := pipeline(t, store.DriftWarn, baseline)
+		assert.NoError(t, err)
+		assert.Contains(t, run.Log.String(), "schema drift: field name removed")
+		assert.Contains(t, run.Log.String(), "schema drift: field email added (string)")
+		assert.JSONEq(t, `[
+			{"field": "name", "change": "removed", "from": "string"},
+			{"field": "email", "change": "added", "to": "string"}
+		]`, string(run.Record.SchemaDrift))
+		assert.Len(t, readLines(t, target), 1)
+	})
+
+	t.Run("ignore", func(t *testing.T) {
+		run, _, err := pipeline(t, store.DriftIgnore, baseline)
+		assert.NoError(t, err)
+		assert.NotContains(t, run.Log.String(), "schema drift")
+		assert.NotNil(t, run.Record.SchemaDrift)
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		run, target, err := pipeline(t, store.DriftFail, baseline)
+		assert.EqualError(t, err, "schema drift: field name removed, field email added (string)")
+		assert.NotNil(t, run.Record.SchemaDrift)
+		assert.NoFileExists(t, target)
+	})
+
+	t.Run("evolve", func(t *testing.T) {
+		run, target, err := pipeline(t, store.DriftEvolve, baseline)
+		assert.NoError(t, err)
+		assert.Contains(t, run.Log.String(), "schema drift: field name removed, written as null")
+		assert.Equal(t, []map[string]any{{"id": 1.0, "email": "chihiro@example.com", "name": nil}}, readLines(t, target))
+
+		var schema record.Schema
+		assert.NoError(t, json.Unmarshal(run.Record.Schema, &schema))
+		assert.Equal(t, []string{"email", "id", "name"}, schema.Names())
+	})
+}
+
+func TestExecutor_SchemaDrift(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "in.jsonl")
+	target := filepath.Join(dir, "out.jsonl")
+
+	storage := store.NewMockStore()
+	registry := NewRegistry()
+	registry.Register("test.copy", runFunc(func(ctx context.Context, run *Run) error {
+		sink, err := newJSONLSink(run, target)
+		if err != nil {
+			return err
+		}
+		_, err = runPipeline(ctx, run, nil, jsonlSource("copy", source), sink)
+		return err
+	}))
+	executor := NewExecutor(storage, registry, zap.NewNop().Sugar(), 1, 1)
+
+	ctx := context.Background()
+	task := &store.Task{PipelineID: 1, Type: "test.copy", DriftPolicy: store.DriftFail, Config: json.RawMessage(`{}`)}
+	assert.NoError(t, storage.Tasks.Create(ctx, task))
+
+	execute := func(t *testing.T, data string) store.TaskRun {
+		t.Helper()
+
+		assert.NoError(t, os.WriteFile(source, []byte(data), 0o644))
+		run := &store.TaskRun{TaskID: task.ID}
+		assert.NoError(t, storage.TaskRuns.Create(ctx, run))
+		executor.execute(ctx, job{task: *task, run: *run})
+
+		finished, err := storage.TaskRuns.GetByID(ctx, run.ID)
+		assert.NoError(t, err)
+		return finished
+	}
+
+	assert.Equal(t, store.StateSuccess, execute(t, `{"id": 1}`+"\n").Status)
+	assert.Equal(t, store.StateSuccess, execute(t, `{"id": 2}`+"\n").Status)
+
+	run := execute(t, `{"id": "3"}`+"\n")
+	assert.Equal(t, store.StateError, run.Status)
+	assert.Equal(t, "schema drift: field id changed from integer to string", run.Error)
+	assert.Equal(t, []map[string]any{{"id": 2.0}}, readLines(t, target))
+
+	// The failed run does not become the baseline.
+	assert.Equal(t, store.StateError, execute(t, `{"id": "4"}`+"\n").Status)
+}
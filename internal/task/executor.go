@@ -0,0 +1,169 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrQueueFull = errors.New("task queue is full")
+	ErrTaskBusy  = errors.New("task already has a run queued or running")
+)
+
+type job struct {
+	task store.Task
+	run  store.TaskRun
+}
+
+// Executor runs queued task runs on a fixed pool of workers.
+type Executor struct {
+	store    store.Storage
+	registry *Registry
+	logger   *zap.SugaredLogger
+	queue    chan job
+	workers  int
+	wg       sync.WaitGroup
+
+	mu sync.Mutex
+	// busy holds the tasks with a run queued or running. Runs of a task
+	// share its output and state, so they never overlap.
+	busy map[int64]bool
+}
+
+func NewExecutor(storage store.Storage, registry *Registry, logger *zap.SugaredLogger, workers, queueSize int) *Executor {
+	return &Executor{
+		store:    storage,
+		registry: registry,
+		logger:   logger,
+		queue:    make(chan job, queueSize),
+		workers:  workers,
+		busy:     make(map[int64]bool),
+	}
+}
+
+// Start launches the workers. They stop once ctx is done.
+func (e *Executor) Start(ctx context.Context) {
+	for i := 0; i < e.workers; i++ {
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-e.queue:
+					e.execute(ctx, j)
+				}
+			}
+		}()
+	}
+}
+
+// Wait blocks until all workers have stopped.
+func (e *Executor) Wait() {
+	e.wg.Wait()
+}
+
+// Submit queues a run without blocking. It fails with ErrTaskBusy while
+// another run of the task is queued or running.
+func (e *Executor) Submit(task store.Task, run store.TaskRun) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.busy[task.ID] {
+		return ErrTaskBusy
+	}
+	select {
+	case e.queue <- job{task: task, run: run}:
+		e.busy[task.ID] = true
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (e *Executor) release(taskID int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.busy, taskID)
+}
+
+func (e *Executor) execute(ctx context.Context, j job) {
+	defer e.release(j.task.ID)
+
+	run := NewRun(j.task, &j.run)
+
+	if err := e.store.TaskRuns.Start(ctx, run.Record); err != nil {
+		e.logger.Errorw("failed to start task run", "task_id", j.task.ID, "run_id", j.run.ID, "error", err)
+		return
+	}
+	e.setTaskStatus(ctx, j.task.ID, store.StateRunning, "")
+
+	err := e.runHandler(ctx, run)
+
+	switch {
+	case err == nil && run.state != "":
+		run.Record.Status = run.state
+	case err == nil:
+		run.Record.Status = store.StateSuccess
+	case errors.Is(err, context.DeadlineExceeded):
+		run.Record.Status = store.StateTimeout
+	default:
+		run.Record.Status = store.StateError
+	}
+
+	if err != nil {
+		run.Record.Error = err.Error()
+		run.Log.Printf("run failed: %v", err)
+	}
+	run.Record.Logs = run.Log.String()
+
+	// The run outcome must be recorded even when the executor is shutting down.
+	finishCtx := context.WithoutCancel(ctx)
+	if err := e.store.TaskRuns.Finish(finishCtx, run.Record); err != nil {
+		e.logger.Errorw("failed to finish task run", "task_id", j.task.ID, "run_id", j.run.ID, "error", err)
+	}
+	if len(run.datasets) > 0 {
+		if err := e.store.Lineage.Create(finishCtx, run.datasets); err != nil {
+			e.logger.Errorw("failed to record run datasets", "task_id", j.task.ID, "run_id", j.run.ID, "error", err)
+		}
+	}
+	e.setTaskStatus(finishCtx, j.task.ID, run.Record.Status, run.Record.Error)
+}
+
+func (e *Executor) runHandler(ctx context.Context, run *Run) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			run.discard()
+			err = fmt.Errorf("task panicked: %v", r)
+		}
+	}()
+
+	handler, err := e.registry.Get(run.Task.Type)
+	if err != nil {
+		return err
+	}
+
+	run.baseline, err = lastSchema(ctx, e.store, run.Task.ID)
+	if err != nil {
+		return err
+	}
+
+	run.checkpoint, err = loadCheckpoint(ctx, e.store, run)
+	if err != nil {
+		return err
+	}
+
+	return run.complete(ctx, handler.Run(ctx, run))
+}
+
+func (e *Executor) setTaskStatus(ctx context.Context, taskID int64, status, taskErr string) {
+	if err := e.store.Tasks.UpdateStatus(ctx, taskID, status, taskErr); err != nil {
+		e.logger.Errorw("failed to update task status", "task_id", taskID, "error", err)
+	}
+}
@@ -0,0 +1,126 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestExecutor_Execute(t *testing.T) {
+	storage := store.NewMockStore()
+	registry := NewRegistry()
+	registry.Register(ShellExecType, NewShellExec())
+	executor := NewExecutor(storage, registry, zap.NewNop().Sugar(), 1, 1)
+
+	ctx := context.Background()
+	execute := func(t *testing.T, taskType, config string) store.TaskRun {
+		t.Helper()
+
+		task := &store.Task{PipelineID: 1, Type: taskType, Config: json.RawMessage(config)}
+		assert.NoError(t, storage.Tasks.Create(ctx, task))
+
+		run := &store.TaskRun{TaskID: task.ID}
+		assert.NoError(t, storage.TaskRuns.Create(ctx, run))
+
+		executor.execute(ctx, job{task: *task, run: *run})
+
+		finished, err := storage.TaskRuns.GetByID(ctx, run.ID)
+		assert.NoError(t, err)
+
+		updated, err := storage.Tasks.GetByID(ctx, task.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, finished.Status, updated.Status)
+
+		return finished
+	}
+
+	t.Run("success", func(t *testing.T) {
+		run := execute(t, ShellExecType, `{"command": "sh", "args": ["-c", "echo hello"]}`)
+		assert.Equal(t, store.StateSuccess, run.Status)
+		assert.Contains(t, run.Logs, "[stdout] hello")
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		run := execute(t, ShellExecType, `{"command": "sh", "args": ["-c", "exit 1"]}`)
+		assert.Equal(t, store.StateError, run.Status)
+		assert.Equal(t, "command exited with code 1", run.Error)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		run := execute(t, ShellExecType, `{"command": "sleep", "args": ["5"], "timeout": "50ms"}`)
+		assert.Equal(t, store.StateTimeout, run.Status)
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		run := execute(t, "unknown", `{}`)
+		assert.Equal(t, store.StateError, run.Status)
+		assert.Contains(t, run.Error, "unknown task type")
+	})
+
+	t.Run("staged outputs", func(t *testing.T) {
+		var events []string
+		registry.Register("test.stage", runFunc(func(ctx context.Context, run *Run) error {
+			run.Stage(func() error {
+				events = append(events, "publish")
+				return nil
+			}, func() {
+				events = append(events, "discard")
+			})
+			run.OnSuccess(func(ctx context.Context) error {
+				events = append(events, "success")
+				return nil
+			})
+
+			switch string(run.Task.Config) {
+			case `"error"`:
+				return assert.AnError
+			case `"panic"`:
+				panic("boom")
+			}
+			return nil
+		}))
+
+		for config, want := range map[string][]string{
+			`{}`:      {"publish", "success"},
+			`"error"`: {"discard"},
+			`"panic"`: {"discard"},
+		} {
+			events = nil
+			execute(t, "test.stage", config)
+			assert.Equal(t, want, events, config)
+		}
+	})
+
+	t.Run("queue full", func(t *testing.T) {
+		assert.NoError(t, executor.Submit(store.Task{ID: 100}, store.TaskRun{}))
+		assert.ErrorIs(t, executor.Submit(store.Task{ID: 101}, store.TaskRun{}), ErrQueueFull)
+	})
+}
+
+func TestExecutor_OneRunPerTask(t *testing.T) {
+	executor := NewExecutor(store.NewMockStore(), NewRegistry(), zap.NewNop().Sugar(), 1, 10)
+	task := store.Task{ID: 1, Type: "unknown"}
+
+	assert.NoError(t, executor.Submit(task, store.TaskRun{ID: 1}))
+	assert.ErrorIs(t, executor.Submit(task, store.TaskRun{ID: 2}), ErrTaskBusy)
+	assert.NoError(t, executor.Submit(store.Task{ID: 2}, store.TaskRun{ID: 3}))
+
+	// The task takes runs again once its run finished.
+	executor.execute(context.Background(), <-executor.queue)
+	assert.NoError(t, executor.Submit(task, store.TaskRun{ID: 4}))
+}
+
+// runFunc is a handler that accepts any configuration and runs itself.
+type runFunc func(ctx context.Context, run *Run) error
+
+func (f runFunc) Validate(ctx context.Context, task store.Task) error {
+	return nil
+}
+
+func (f runFunc) Run(ctx context.Context, run *Run) error {
+	return f(ctx, run)
+}
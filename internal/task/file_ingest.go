@@ -0,0 +1,274 @@
+package task
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+const FileIngestType = "file.ingest"
+
+const (
+	FormatCSV   string = "csv"
+	FormatJSONL string = "jsonl"
+)
+
+type FileIngestConfig struct {
+	// SourceGlobs select the files to ingest, e.g. "/landing/orders/*.csv".
+	SourceGlobs []string `json:"source_globs" validate:"required,min=1,dive,required"`
+	Format      string   `json:"format" validate:"required,oneof=csv jsonl"`
+	// Delimiter of CSV files, a comma by default.
+	Delimiter  string `json:"delimiter" validate:"omitempty,len=1"`
+	TargetPath string `json:"target_path" validate:"required"`
+	// SourceFileField, when set, adds the path of the source file to each
+	// record under that name.
+	SourceFileField string `json:"source_file_field"`
+	// DeadLetter, when set, sets aside the lines that do not parse instead
+	// of failing the run.
+	DeadLetter *DeadLetterConfig `json:"dead_letter"`
+	OutputConfig
+}
+
+// FileIngest ingests new or changed CSV and JSON lines files into a JSON
+// lines file. Ingested files are tracked in the file manifest of the task.
+type FileIngest struct {
+	store store.Storage
+}
+
+func NewFileIngest(storage store.Storage) *FileIngest {
+	return &FileIngest{
+		store: storage,
+	}
+}
+
+func (f *FileIngest) Validate(ctx context.Context, task store.Task) error {
+	_, err := f.config(task)
+	return err
+}
+
+func (f *FileIngest) config(task store.Task) (FileIngestConfig, error) {
+	var cfg FileIngestConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, err
+	}
+
+	for _, pattern := range cfg.SourceGlobs {
+		if !filepath.IsAbs(pattern) {
+			return cfg, fmt.Errorf("source glob %q must be an absolute path", pattern)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return cfg, fmt.Errorf("invalid source glob %q: %w", pattern, err)
+		}
+	}
+
+	if err := validateOutputPath(cfg.TargetPath); err != nil {
+		return cfg, err
+	}
+
+	if err := validateDeadLetter(cfg.DeadLetter); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func (f *FileIngest) Run(ctx context.Context, run *Run) error {
+	cfg, err := f.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	files, err := matchFiles(cfg.SourceGlobs)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := loadFileManifest(ctx, f.store, run.Task.ID)
+	if err != nil {
+		return err
+	}
+
+	selected, err := manifest.Select(run, files)
+	if err != nil {
+		return err
+	}
+	run.Log.Printf("matched %d files, %d new or changed", len(files), len(selected))
+	for _, path := range selected {
+		run.Reads("", path)
+	}
+	if len(selected) == 0 {
+		// The output of the last run stays as it is.
+		run.SetRowsAffected(0)
+		manifest.CommitOnSuccess(run)
+		return nil
+	}
+
+	sink, err := newJSONLOutput(run, cfg.TargetPath, cfg.Partition)
+	if err != nil {
+		return err
+	}
+
+	source := newSource(FileIngestType, func(ctx context.Context, w record.Writer) error {
+		for _, path := range selected {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			rows, err := ingestFile(ctx, path, cfg, w)
+			var rejection record.Rejection
+			if errors.As(err, &rejection) {
+				return err // already positioned in the file
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			run.Log.Printf("ingested %d records from %s", rows, path)
+		}
+		return nil
+	})
+	if _, err := runPipeline(ctx, run, cfg.DeadLetter, source, sink); err != nil {
+		return err
+	}
+
+	manifest.CommitOnSuccess(run)
+	return nil
+}
+
+// ingestFile writes the records of a file and returns how many it read.
+// Lines that do not parse are rejected with the path of the file.
+func ingestFile(ctx context.Context, path string, cfg FileIngestConfig, w record.Writer) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var rows int64
+	write := func(r map[string]any) error {
+		if cfg.SourceFileField != "" {
+			r[cfg.SourceFileField] = path
+		}
+		rows++
+		return w.Write(r)
+	}
+
+	bad := rejectLine(ctx, path+": ")
+	switch cfg.Format {
+	case FormatCSV:
+		err = readCSV(file, cfg.Delimiter, write, bad)
+	case FormatJSONL:
+		err = scanJSONL(file, write, bad)
+	default:
+		err = fmt.Errorf("unsupported format %q", cfg.Format)
+	}
+	return rows, err
+}
+
+// badLine is called with a line of input that does not parse, along with
+// what could be read of it. Reading goes on past the line unless it
+// returns an error.
+type badLine func(line int, raw any, err error) error
+
+// failLine is the badLine that stops reading at the first bad line.
+func failLine(line int, raw any, err error) error {
+	return fmt.Errorf("line %d: %w", line, err)
+}
+
+// readCSV reads a CSV file whose first row names the columns. Rows that do
+// not parse or have the wrong number of fields are passed to bad.
+func readCSV(r io.Reader, delimiter string, fn func(map[string]any) error, bad badLine) error {
+	reader := csv.NewReader(r)
+	if delimiter != "" {
+		reader.Comma, _ = utf8.DecodeRuneInString(delimiter)
+	}
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			if err := bad(parseErr.StartLine, row, parseErr.Err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		record := make(map[string]any, len(header))
+		for i, column := range header {
+			record[column] = row[i]
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// readJSONL reads one JSON object per line. Blank lines are ignored.
+func readJSONL(r io.Reader, fn func(map[string]any) error) error {
+	return scanJSONL(r, fn, failLine)
+}
+
+// scanJSONL is readJSONL passing the lines that are not JSON objects to
+// bad.
+func scanJSONL(r io.Reader, fn func(map[string]any) error, bad badLine) error {
+	return scanJSONLAt(r, &SourcePosition{}, fn, bad)
+}
+
+// scanJSONLAt scans a JSON lines file from pos, which it moves past each
+// line before handing its record on.
+func scanJSONLAt(r io.Reader, pos *SourcePosition, fn func(map[string]any) error, bad badLine) error {
+	reader := bufio.NewReader(r)
+
+	for {
+		data, err := reader.ReadBytes('\n')
+		if len(data) > 0 {
+			pos.Line++
+			pos.Offset += int64(len(data))
+			line := pos.Line
+			if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 {
+				var record map[string]any
+				decoder := json.NewDecoder(bytes.NewReader(trimmed))
+				decoder.UseNumber()
+				var fnErr error
+				if err := decoder.Decode(&record); err != nil {
+					fnErr = bad(line, string(trimmed), err)
+				} else {
+					fnErr = fn(record)
+				}
+				if fnErr != nil {
+					return fnErr
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileIngest_Run(t *testing.T) {
+	ctx := context.Background()
+	storage := store.NewMockStore()
+	ingest := NewFileIngest(storage)
+
+	dir := t.TempDir()
+	landing := filepath.Join(dir, "landing")
+	assert.NoError(t, os.MkdirAll(landing, 0o755))
+	write := func(name, content string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(landing, name), []byte(content), 0o644))
+	}
+	write("a.csv", "id,name\n1,Chihiro\n2,Haku\n")
+	write("b.csv", "id,name\n3,Lin\n")
+
+	target := filepath.Join(dir, "out", "people.jsonl")
+	// The globs overlap on both files.
+	config, _ := json.Marshal(FileIngestConfig{
+		SourceGlobs:     []string{filepath.Join(landing, "*.csv"), filepath.Join(landing, "a.*")},
+		Format:          FormatCSV,
+		TargetPath:      target,
+		SourceFileField: "_file",
+	})
+	task := store.Task{ID: 1, Type: FileIngestType, Config: config}
+
+	var runID int64
+	execute := func(t *testing.T) *Run {
+		t.Helper()
+		runID++
+		run := NewRun(task, &store.TaskRun{ID: runID})
+		assert.NoError(t, run.complete(ctx, ingest.Run(ctx, run)))
+		return run
+	}
+
+	t.Run("first run ingests every file once", func(t *testing.T) {
+		run := execute(t)
+		assert.Equal(t, int64(3), *run.Record.RowsAffected)
+
+		data, _ := os.ReadFile(target)
+		assert.Contains(t, string(data), `"name":"Chihiro"`)
+		assert.Contains(t, string(data), `"_file":"`+filepath.Join(landing, "b.csv")+`"`)
+
+		entries, _ := storage.FileManifest.GetByTask(ctx, 1)
+		assert.Len(t, entries, 2)
+	})
+
+	t.Run("unchanged files are skipped", func(t *testing.T) {
+		before, err := os.ReadFile(target)
+		assert.NoError(t, err)
+
+		run := execute(t)
+		assert.Equal(t, int64(0), *run.Record.RowsAffected)
+
+		after, err := os.ReadFile(target)
+		assert.NoError(t, err)
+		assert.Equal(t, string(before), string(after))
+	})
+
+	t.Run("touched files are skipped", func(t *testing.T) {
+		later := time.Now().Add(time.Hour)
+		assert.NoError(t, os.Chtimes(filepath.Join(landing, "a.csv"), later, later))
+
+		run := execute(t)
+		assert.Equal(t, int64(0), *run.Record.RowsAffected)
+	})
+
+	t.Run("new and changed files are ingested", func(t *testing.T) {
+		write("b.csv", "id,name\n3,Lin\n4,Kamaji\n")
+		write("c.csv", "id,name\n5,Boh\n")
+
+		run := execute(t)
+		assert.Equal(t, int64(3), *run.Record.RowsAffected)
+		assert.Contains(t, run.Log.String(), "matched 3 files, 2 new or changed")
+	})
+
+	t.Run("removed entries are ingested again", func(t *testing.T) {
+		entries, _ := storage.FileManifest.GetByTask(ctx, 1)
+		removed, _ := storage.FileManifest.Delete(ctx, 1, []int64{entries[0].ID})
+		assert.Equal(t, int64(1), removed)
+
+		run := execute(t)
+		assert.Equal(t, int64(2), *run.Record.RowsAffected)
+	})
+
+	t.Run("failed runs do not record files", func(t *testing.T) {
+		write("d.csv", "id,name\n6,Yubaba,extra\n")
+
+		run := NewRun(task, &store.TaskRun{ID: 99})
+		err := ingest.Run(ctx, run)
+		assert.Error(t, err)
+		assert.Empty(t, run.onSuccess)
+
+		entries, _ := storage.FileManifest.GetByTask(ctx, 1)
+		for _, e := range entries {
+			assert.False(t, strings.HasSuffix(e.Path, "d.csv"))
+		}
+	})
+}
+
+func TestReadJSONL(t *testing.T) {
+	var records []map[string]any
+	err := readJSONL(strings.NewReader("{\"a\": 1}\n\n{\"a\": 2}"), func(r map[string]any) error {
+		records = append(records, r)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	err = readJSONL(strings.NewReader("{\"a\": 1}\nnot json\n"), func(map[string]any) error { return nil })
+	assert.ErrorContains(t, err, "line 2")
+}
@@ -0,0 +1,286 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+const FixedWidthReadType = "fixedwidth.read"
+
+const (
+	FieldString  string = "string"
+	FieldInteger string = "integer"
+	FieldDecimal string = "decimal"
+	FieldDate    string = "date"
+)
+
+// FixedWidthColumn locates a column in a line. Start is the 1-based
+// position of its first character.
+type FixedWidthColumn struct {
+	Name   string `json:"name" validate:"required"`
+	Start  int    `json:"start" validate:"required,min=1"`
+	Length int    `json:"length" validate:"required,min=1"`
+	Type   string `json:"type" validate:"omitempty,oneof=string integer decimal date"`
+	// Trim removes the padding around the value. Numbers and dates are
+	// always trimmed.
+	Trim bool `json:"trim"`
+	// Format is the Go layout of date columns, "20060102" by default.
+	Format string `json:"format"`
+}
+
+type FixedWidthReadConfig struct {
+	SourcePath string             `json:"source_path" validate:"required"`
+	TargetPath string             `json:"target_path" validate:"required"`
+	Columns    []FixedWidthColumn `json:"columns" validate:"required,min=1,dive"`
+	// SkipLines skips header lines at the start of the file.
+	SkipLines int `json:"skip_lines" validate:"min=0"`
+	// DeadLetter, when set, sets aside the lines that are too short or
+	// hold values that do not parse instead of failing the run.
+	DeadLetter *DeadLetterConfig `json:"dead_letter"`
+	OutputConfig
+}
+
+func (FixedWidthReadConfig) resumable() {}
+
+// FixedWidthRead converts a fixed-width file, such as a mainframe extract,
+// into a JSON lines file. Blank lines are ignored.
+type FixedWidthRead struct{}
+
+func NewFixedWidthRead() *FixedWidthRead {
+	return &FixedWidthRead{}
+}
+
+func (f *FixedWidthRead) Validate(ctx context.Context, task store.Task) error {
+	_, err := f.config(task)
+	return err
+}
+
+func (f *FixedWidthRead) config(task store.Task) (FixedWidthReadConfig, error) {
+	var cfg FixedWidthReadConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if err := validateSourcePath(cfg.SourcePath); err != nil {
+		return cfg, err
+	}
+	if err := validateOutputPath(cfg.TargetPath); err != nil {
+		return cfg, err
+	}
+	if err := validateDeadLetter(cfg.DeadLetter); err != nil {
+		return cfg, err
+	}
+
+	names := make(map[string]bool, len(cfg.Columns))
+	for i := range cfg.Columns {
+		column := &cfg.Columns[i]
+		if names[column.Name] {
+			return cfg, fmt.Errorf("duplicate column %q", column.Name)
+		}
+		names[column.Name] = true
+
+		if column.Type == "" {
+			column.Type = FieldString
+		}
+		if column.Type == FieldDate && column.Format == "" {
+			column.Format = "20060102"
+		}
+		if column.Format != "" && column.Type != FieldDate {
+			return cfg, fmt.Errorf("column %q: format only applies to dates", column.Name)
+		}
+	}
+
+	return cfg, nil
+}
+
+// OutputSchema returns the columns of the spec. Blank numbers and dates
+// are null.
+func (f *FixedWidthRead) OutputSchema(ctx context.Context, task store.Task) (*record.Schema, error) {
+	cfg, err := f.config(task)
+	if err != nil {
+		return nil, err
+	}
+
+	types := map[string]record.Type{
+		FieldString:  record.TypeString,
+		FieldInteger: record.TypeInteger,
+		FieldDecimal: record.TypeDecimal,
+		FieldDate:    record.TypeDate,
+	}
+	schema := &record.Schema{}
+	for _, column := range cfg.Columns {
+		schema.Fields = append(schema.Fields, record.Field{
+			Name:     column.Name,
+			Type:     types[column.Type],
+			Nullable: column.Type != FieldString,
+		})
+	}
+	return schema, nil
+}
+
+func (f *FixedWidthRead) Run(ctx context.Context, run *Run) error {
+	cfg, err := f.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	sink, err := newJSONLOutput(run, cfg.TargetPath, cfg.Partition)
+	if err != nil {
+		return err
+	}
+
+	source := &readerSource{name: FixedWidthReadType, path: cfg.SourcePath, seeks: true}
+	source.read = func(ctx context.Context, w record.Writer) error {
+		return readFixedWidth(ctx, cfg, &source.pos, w)
+	}
+	stats, err := runPipeline(ctx, run, cfg.DeadLetter, source, sink)
+	if err != nil {
+		return err
+	}
+
+	run.Log.Printf("read %d records into %s", stats.Written(), cfg.TargetPath)
+	return nil
+}
+
+// readFixedWidth reads the file from pos, which it moves past each line
+// before handing its record on.
+func readFixedWidth(ctx context.Context, cfg FixedWidthReadConfig, pos *SourcePosition, w record.Writer) error {
+	file, err := os.Open(cfg.SourcePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(pos.Offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	// The offset of a line is counted from what the scanner consumed, as
+	// it drops the line ending.
+	offset := pos.Offset
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		offset += int64(advance)
+		return advance, token, err
+	})
+
+	line := pos.Line
+	for scanner.Scan() {
+		line++
+		pos.Line, pos.Offset = line, offset
+		if line <= cfg.SkipLines {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		r, err := parseFixedWidth([]rune(text), cfg.Columns)
+		if err != nil {
+			err = record.Reject(ctx, record.Rejection{
+				Position: fmt.Sprintf("line %d", line),
+				Reason:   err.Error(),
+				Record:   text,
+			})
+		} else {
+			err = w.Write(r)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return fmt.Errorf("line %d: longer than 1 MiB", line+1)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// parseFixedWidth cuts a line into columns. Positions count characters,
+// not bytes.
+func parseFixedWidth(line []rune, columns []FixedWidthColumn) (map[string]any, error) {
+	record := make(map[string]any, len(columns))
+
+	for _, column := range columns {
+		end := column.Start - 1 + column.Length
+		if end > len(line) {
+			return nil, fmt.Errorf("column %s: line is %d characters, expected at least %d", column.Name, len(line), end)
+		}
+		raw := string(line[column.Start-1 : end])
+
+		value, err := fixedWidthValue(column, raw)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", column.Name, err)
+		}
+		record[column.Name] = value
+	}
+
+	return record, nil
+}
+
+// fixedWidthValue converts the raw text of a column. Blank numbers and
+// dates are null.
+func fixedWidthValue(column FixedWidthColumn, raw string) (any, error) {
+	if column.Type == FieldString {
+		if column.Trim {
+			return strings.TrimSpace(raw), nil
+		}
+		return raw, nil
+	}
+
+	text := strings.TrimSpace(raw)
+	if text == "" {
+		return nil, nil
+	}
+
+	switch column.Type {
+	case FieldInteger:
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q", text)
+		}
+		return n, nil
+	case FieldDecimal:
+		r, ok := new(big.Rat).SetString(text)
+		if !ok || strings.ContainsAny(text, "/eE") {
+			return nil, fmt.Errorf("invalid decimal %q", text)
+		}
+		// Keep the scale, but normalize signs and leading zeros into a
+		// valid JSON number.
+		scale := 0
+		if i := strings.IndexByte(text, '.'); i >= 0 {
+			scale = len(text) - i - 1
+		}
+		return json.Number(r.FloatString(scale)), nil
+	case FieldDate:
+		d, err := time.Parse(column.Format, text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q, expected the format %s", text, column.Format)
+		}
+		return d.Format(time.DateOnly), nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %q", column.Type)
+}
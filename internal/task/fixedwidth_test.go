@@ -0,0 +1,74 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixedWidthRead(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "accounts.txt")
+	target := filepath.Join(dir, "accounts.jsonl")
+
+	columns := []FixedWidthColumn{
+		{Name: "id", Start: 1, Length: 5, Type: FieldInteger},
+		{Name: "name", Start: 6, Length: 10, Trim: true},
+		{Name: "balance", Start: 16, Length: 9, Type: FieldDecimal},
+		{Name: "opened", Start: 25, Length: 8, Type: FieldDate},
+		{Name: "code", Start: 33, Length: 3},
+	}
+	config := FixedWidthReadConfig{
+		SourcePath: source,
+		TargetPath: target,
+		Columns:    columns,
+		SkipLines:  1,
+	}
+
+	t.Run("valid file", func(t *testing.T) {
+		data := "HEADER 20250101\n" +
+			"00001Chihiro   +00012.5020240131 AB\n" +
+			"\n" +
+			"00002Haku          -3.0020240229   \n"
+		assert.NoError(t, os.WriteFile(source, []byte(data), 0o644))
+
+		run, err := runTask(t, NewFixedWidthRead(), FixedWidthReadType, config)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), *run.Record.RowsAffected)
+
+		lines := readLines(t, target)
+		assert.Equal(t, map[string]any{"id": 1.0, "name": "Chihiro", "balance": 12.5, "opened": "2024-01-31", "code": " AB"}, lines[0])
+		assert.Equal(t, -3.0, lines[1]["balance"])
+		assert.Equal(t, "   ", lines[1]["code"])
+	})
+
+	t.Run("errors report the line number", func(t *testing.T) {
+		data := "HEADER\n" +
+			"00001Chihiro   +00012.5020240131 AB\n" +
+			"0000xHaku          -3.0020240229   \n"
+		assert.NoError(t, os.WriteFile(source, []byte(data), 0o644))
+
+		_, err := runTask(t, NewFixedWidthRead(), FixedWidthReadType, config)
+		assert.EqualError(t, err, `line 3: column id: invalid integer "0000x"`)
+	})
+
+	t.Run("short lines", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(source, []byte("HEADER\n00001Chihiro\n"), 0o644))
+
+		_, err := runTask(t, NewFixedWidthRead(), FixedWidthReadType, config)
+		assert.ErrorContains(t, err, "line 2: column name: line is 12 characters, expected at least 15")
+	})
+
+	t.Run("invalid spec", func(t *testing.T) {
+		bad := config
+		bad.Columns = []FixedWidthColumn{{Name: "id", Start: 1, Length: 5}, {Name: "id", Start: 6, Length: 2}}
+		_, err := runTask(t, NewFixedWidthRead(), FixedWidthReadType, bad)
+		assert.ErrorContains(t, err, "duplicate column")
+
+		bad.Columns = []FixedWidthColumn{{Name: "id", Start: 0, Length: 5}}
+		_, err = runTask(t, NewFixedWidthRead(), FixedWidthReadType, bad)
+		assert.Error(t, err)
+	})
+}
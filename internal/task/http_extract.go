@@ -0,0 +1,222 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+const HTTPExtractType = "http.extract"
+
+const defaultHTTPTimeout = 10 * time.Minute
+
+type HTTPExtractConfig struct {
+	URL     string            `json:"url" validate:"required,url"`
+	Headers map[string]string `json:"headers"`
+	// RecordsPath is the dot separated path of the records array in the
+	// response, e.g. "data.items". The response itself is the array when
+	// it is empty.
+	RecordsPath string           `json:"records_path"`
+	TargetPath  string           `json:"target_path" validate:"required"`
+	Incremental *HTTPIncremental `json:"incremental"`
+	Timeout     string           `json:"timeout"`
+	OutputConfig
+}
+
+// HTTPIncremental sends the high-water mark to the API as a query
+// parameter. Records at or below the mark are dropped in case the API
+// filtering is inclusive.
+type HTTPIncremental struct {
+	IncrementalConfig
+	Param string `json:"param" validate:"required"`
+}
+
+// HTTPExtract extracts the records of a JSON API into a JSON lines file.
+type HTTPExtract struct {
+	store  store.Storage
+	client *http.Client
+}
+
+func NewHTTPExtract(storage store.Storage) *HTTPExtract {
+	return &HTTPExtract{
+		store:  storage,
+		client: &http.Client{},
+	}
+}
+
+func (h *HTTPExtract) Validate(ctx context.Context, task store.Task) error {
+	_, err := h.config(task)
+	return err
+}
+
+func (h *HTTPExtract) config(task store.Task) (HTTPExtractConfig, error) {
+	var cfg HTTPExtractConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if err := validateOutputPath(cfg.TargetPath); err != nil {
+		return cfg, err
+	}
+
+	if cfg.Incremental != nil {
+		if err := cfg.Incremental.validate(); err != nil {
+			return cfg, err
+		}
+	}
+
+	if _, err := parseTimeout(cfg.Timeout, defaultHTTPTimeout); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func (h *HTTPExtract) Run(ctx context.Context, run *Run) error {
+	cfg, err := h.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	timeout, _ := parseTimeout(cfg.Timeout, defaultHTTPTimeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	target, err := url.Parse(cfg.URL)
+	if err != nil {
+		return err
+	}
+
+	var mark *watermark
+	if cfg.Incremental != nil {
+		mark, err = loadWatermark(ctx, h.store, run.Task.ID, &cfg.Incremental.IncrementalConfig)
+		if err != nil {
+			return err
+		}
+		if mark.from != "" {
+			query := target.Query()
+			query.Set(cfg.Incremental.Param, mark.from)
+			target.RawQuery = query.Encode()
+			run.Log.Printf("extracting records with %s > %s", cfg.Incremental.Cursor, mark.from)
+		} else {
+			run.Log.Printf("no high-water mark, running a full load")
+		}
+	}
+
+	run.Reads("", cfg.URL)
+	records, err := h.fetch(ctx, target.String(), cfg)
+	if err != nil {
+		return err
+	}
+
+	sink, err := newJSONLOutput(run, cfg.TargetPath, cfg.Partition)
+	if err != nil {
+		return err
+	}
+
+	var skipped int
+	source := newSource(HTTPExtractType, func(ctx context.Context, w record.Writer) error {
+		for i, raw := range records {
+			r, ok := raw.(map[string]any)
+			if !ok {
+				return fmt.Errorf("record %d is not an object", i)
+			}
+
+			if mark != nil {
+				cursor := r[cfg.Incremental.Cursor]
+				after, err := mark.After(cursor)
+				if err != nil {
+					return fmt.Errorf("record %d: cursor %s: %w", i, cfg.Incremental.Cursor, err)
+				}
+				if !after {
+					skipped++
+					continue
+				}
+				if err := mark.Observe(cursor); err != nil {
+					return fmt.Errorf("record %d: %w", i, err)
+				}
+			}
+
+			if err := w.Write(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	stats, err := runPipeline(ctx, run, nil, source, sink)
+	if err != nil {
+		return err
+	}
+
+	if skipped > 0 {
+		run.Log.Printf("skipped %d records at or below the high-water mark", skipped)
+	}
+	run.Log.Printf("extracted %d records into %s", stats.Written(), cfg.TargetPath)
+
+	if mark != nil {
+		mark.CommitOnSuccess(run, h.store)
+	}
+	return nil
+}
+
+func (h *HTTPExtract) fetch(ctx context.Context, target string, cfg HTTPExtractConfig) ([]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var body any
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid JSON response: %w", err)
+	}
+
+	return recordsAt(body, cfg.RecordsPath)
+}
+
+// recordsAt walks a dot separated path down a decoded JSON document to the
+// records array.
+func recordsAt(body any, path string) ([]any, error) {
+	if path != "" {
+		for _, key := range strings.Split(path, ".") {
+			object, ok := body.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("records_path %q: %q is not inside an object", path, key)
+			}
+			body = object[key]
+		}
+	}
+
+	records, ok := body.([]any)
+	if !ok {
+		if body == nil {
+			return nil, fmt.Errorf("records_path %q not found in response", path)
+		}
+		return nil, fmt.Errorf("records_path %q is not an array", path)
+	}
+	return records, nil
+}
@@ -0,0 +1,213 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+// WatermarkKey is the task state key of the high-water mark of an
+// incremental extraction.
+const WatermarkKey = "high_water_mark"
+
+const (
+	CursorTimestamp string = "timestamp"
+	CursorInteger   string = "integer"
+)
+
+// IncrementalConfig enables incremental extraction. Only records with a
+// cursor greater than the high-water mark of the last successful run are
+// extracted.
+type IncrementalConfig struct {
+	// Cursor is the column, or record field, that increases monotonically.
+	Cursor     string `json:"cursor" validate:"required"`
+	CursorType string `json:"cursor_type" validate:"required,oneof=timestamp integer"`
+	// InitialValue bounds the first run. Without it the first run is a
+	// full load.
+	InitialValue string `json:"initial_value"`
+}
+
+func (c *IncrementalConfig) validate() error {
+	if c.InitialValue == "" {
+		return nil
+	}
+	if _, err := parseCursor(c.CursorType, c.InitialValue); err != nil {
+		return fmt.Errorf("invalid initial_value: %w", err)
+	}
+	return nil
+}
+
+// ValidateCursor checks that value is a valid cursor of the given type.
+func ValidateCursor(cursorType, value string) error {
+	_, err := parseCursor(cursorType, value)
+	return err
+}
+
+// IncrementalOf returns the incremental configuration of a task, or nil
+// when the task does not extract incrementally.
+func IncrementalOf(task store.Task) (*IncrementalConfig, error) {
+	var cfg struct {
+		Incremental *IncrementalConfig `json:"incremental"`
+	}
+	if err := json.Unmarshal(task.Config, &cfg); err != nil {
+		return nil, err
+	}
+	return cfg.Incremental, nil
+}
+
+// watermark tracks the high-water mark of a run.
+type watermark struct {
+	cfg *IncrementalConfig
+	// from is the lower bound of the run, empty for a full load.
+	from string
+	max  any
+}
+
+func loadWatermark(ctx context.Context, storage store.Storage, taskID int64, cfg *IncrementalConfig) (*watermark, error) {
+	w := &watermark{cfg: cfg, from: cfg.InitialValue}
+
+	state, err := storage.TaskState.Get(ctx, taskID, WatermarkKey)
+	switch {
+	case err == nil:
+		w.from = state.Value
+	case !errors.Is(err, store.ErrNotFound):
+		return nil, err
+	}
+
+	if w.from != "" {
+		from, err := parseCursor(cfg.CursorType, w.from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid high-water mark %q: %w", w.from, err)
+		}
+		w.max = from
+	}
+
+	return w, nil
+}
+
+// After reports whether a cursor value is past the lower bound of the run.
+func (w *watermark) After(value any) (bool, error) {
+	if w.from == "" {
+		return true, nil
+	}
+
+	v, err := cursorValue(w.cfg.CursorType, value)
+	if err != nil {
+		return false, err
+	}
+	from, _ := parseCursor(w.cfg.CursorType, w.from)
+	return compareCursor(v, from) > 0, nil
+}
+
+// Observe records a cursor value seen during the run.
+func (w *watermark) Observe(value any) error {
+	v, err := cursorValue(w.cfg.CursorType, value)
+	if err != nil {
+		return fmt.Errorf("cursor %s: %w", w.cfg.Cursor, err)
+	}
+
+	if w.max == nil || compareCursor(v, w.max) > 0 {
+		w.max = v
+	}
+	return nil
+}
+
+// Value returns the high-water mark reached by the run.
+func (w *watermark) Value() string {
+	switch v := w.max.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	default:
+		return ""
+	}
+}
+
+// CommitOnSuccess persists the high-water mark once the run succeeds.
+func (w *watermark) CommitOnSuccess(run *Run, storage store.Storage) {
+	run.OnSuccess(func(ctx context.Context) error {
+		value := w.Value()
+		if value == "" || value == w.from {
+			return nil
+		}
+
+		state := &store.TaskState{
+			TaskID: run.Task.ID,
+			Key:    WatermarkKey,
+			Value:  value,
+		}
+		if err := storage.TaskState.Set(ctx, state); err != nil {
+			return fmt.Errorf("failed to save high-water mark: %w", err)
+		}
+		run.Log.Printf("high-water mark advanced from %q to %q", w.from, value)
+		return nil
+	})
+}
+
+func parseCursor(cursorType, value string) (any, error) {
+	switch cursorType {
+	case CursorTimestamp:
+		return time.Parse(time.RFC3339Nano, value)
+	case CursorInteger:
+		return strconv.ParseInt(value, 10, 64)
+	default:
+		return nil, fmt.Errorf("unknown cursor type %q", cursorType)
+	}
+}
+
+// cursorValue converts a value read from a source into a cursor.
+func cursorValue(cursorType string, value any) (any, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, errors.New("cursor value is null")
+	case time.Time:
+		if cursorType != CursorTimestamp {
+			break
+		}
+		return v, nil
+	case int64:
+		if cursorType != CursorInteger {
+			break
+		}
+		return v, nil
+	case int:
+		return cursorValue(cursorType, int64(v))
+	case int32:
+		return cursorValue(cursorType, int64(v))
+	case float64:
+		if cursorType != CursorInteger || v != float64(int64(v)) {
+			break
+		}
+		return int64(v), nil
+	case json.Number:
+		return parseCursor(cursorType, v.String())
+	case []byte:
+		return parseCursor(cursorType, string(v))
+	case string:
+		return parseCursor(cursorType, v)
+	}
+
+	return nil, fmt.Errorf("%v (%T) is not a valid %s cursor", value, value, cursorType)
+}
+
+func compareCursor(a, b any) int {
+	switch a := a.(type) {
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case int64:
+		b := b.(int64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	}
+	return 0
+}
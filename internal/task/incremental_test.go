@@ -0,0 +1,146 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatermark(t *testing.T) {
+	ctx := context.Background()
+	storage := store.NewMockStore()
+	cfg := &IncrementalConfig{Cursor: "id", CursorType: CursorInteger, InitialValue: "10"}
+
+	mark, err := loadWatermark(ctx, storage, 1, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "10", mark.from)
+
+	after, err := mark.After(json.Number("10"))
+	assert.NoError(t, err)
+	assert.False(t, after)
+
+	assert.NoError(t, mark.Observe(int64(42)))
+	assert.NoError(t, mark.Observe(json.Number("12")))
+	assert.Error(t, mark.Observe(nil))
+	assert.Equal(t, "42", mark.Value())
+
+	// The stored high-water mark wins over the initial value.
+	storage.TaskState.Set(ctx, &store.TaskState{TaskID: 1, Key: WatermarkKey, Value: "42"})
+	mark, err = loadWatermark(ctx, storage, 1, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "42", mark.from)
+}
+
+func TestWatermark_AdvancesOnlyOnSuccess(t *testing.T) {
+	ctx := context.Background()
+	storage := store.NewMockStore()
+	cfg := &IncrementalConfig{Cursor: "updated_at", CursorType: CursorTimestamp}
+
+	mark, err := loadWatermark(ctx, storage, 1, cfg)
+	assert.NoError(t, err)
+	assert.NoError(t, mark.Observe(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)))
+
+	run := NewRun(store.Task{ID: 1}, &store.TaskRun{})
+	mark.CommitOnSuccess(run, storage)
+
+	_, err = storage.TaskState.Get(ctx, 1, WatermarkKey)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	for _, fn := range run.onSuccess {
+		assert.NoError(t, fn(ctx))
+	}
+
+	state, err := storage.TaskState.Get(ctx, 1, WatermarkKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "2025-01-02T03:04:05Z", state.Value)
+}
+
+func TestPostgresExtract_RunIncremental(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+
+	ctx := context.Background()
+	storage := store.NewMockStore()
+	storage.Pipelines.Create(ctx, &store.Pipelines{ID: 1, OrganizationID: 1})
+	storage.Connections.Create(ctx, &store.Connection{OrganizationID: 1, Name: "app", Type: store.ConnectionPostgres})
+	storage.TaskState.Set(ctx, &store.TaskState{TaskID: 1, Key: WatermarkKey, Value: "5"})
+
+	extract := NewPostgresExtract(storage)
+	extract.open = func(store.Connection) (*sql.DB, error) {
+		return db, nil
+	}
+
+	target := filepath.Join(t.TempDir(), "orders.jsonl")
+	config := `{"connection": "app", "table": "public.orders", "target_path": "` + target + `",
+		"incremental": {"cursor": "id", "cursor_type": "integer"}}`
+
+	rows := sqlmock.NewRows([]string{"id", "total"}).
+		AddRow(int64(6), "10.5").
+		AddRow(int64(9), "3.0")
+	mock.ExpectQuery(`SELECT * FROM (SELECT * FROM "public"."orders") AS src WHERE "id" > $1 ORDER BY "id"`).
+		WithArgs("5").
+		WillReturnRows(rows)
+	mock.ExpectClose()
+
+	run := NewRun(store.Task{ID: 1, PipelineID: 1, Config: json.RawMessage(config)}, &store.TaskRun{})
+	assert.NoError(t, run.complete(ctx, extract.Run(ctx, run)))
+	assert.Equal(t, int64(2), *run.Record.RowsAffected)
+
+	data, err := os.ReadFile(target)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+
+	state, _ := storage.TaskState.Get(ctx, 1, WatermarkKey)
+	assert.Equal(t, "9", state.Value)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestHTTPExtract_RunIncremental(t *testing.T) {
+	var since string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since = r.URL.Query().Get("updated_since")
+		w.Write([]byte(`{"data": {"items": [
+			{"id": 1, "updated_at": "2025-01-01T00:00:00Z"},
+			{"id": 2, "updated_at": "2025-01-03T00:00:00Z"}
+		]}}`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	storage := store.NewMockStore()
+	storage.TaskState.Set(ctx, &store.TaskState{TaskID: 1, Key: WatermarkKey, Value: "2025-01-01T00:00:00Z"})
+
+	target := filepath.Join(t.TempDir(), "items.jsonl")
+	config := `{"url": "` + server.URL + `/items", "records_path": "data.items", "target_path": "` + target + `",
+		"incremental": {"cursor": "updated_at", "cursor_type": "timestamp", "param": "updated_since"}}`
+
+	extract := NewHTTPExtract(storage)
+	run := NewRun(store.Task{ID: 1, Config: json.RawMessage(config)}, &store.TaskRun{})
+	assert.NoError(t, run.complete(ctx, extract.Run(ctx, run)))
+
+	assert.Equal(t, "2025-01-01T00:00:00Z", since)
+	assert.Equal(t, int64(1), *run.Record.RowsAffected)
+
+	data, err := os.ReadFile(target)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id": 2, "updated_at": "2025-01-03T00:00:00Z"}`, string(data))
+
+	state, _ := storage.TaskState.Get(ctx, 1, WatermarkKey)
+	assert.Equal(t, "2025-01-03T00:00:00Z", state.Value)
+}
@@ -0,0 +1,194 @@
+package task
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// atomicFile is written to a temporary file next to its target, which only
+// replaces the target on Commit so readers never see a partial output.
+//
+// A file staged for a run is named after it, and its Commit only finishes
+// the file: the target is replaced once the whole run succeeds, and the
+// file is removed when it fails, so a retried run never publishes part of
+// the output of a failed one.
+type atomicFile struct {
+	path string
+	run  *Run
+	file *os.File
+	buf  *bufio.Writer
+	size int64
+
+	committed bool
+	// kept leaves the file in place on Abort, for a later run to resume.
+	kept bool
+}
+
+// createAtomic creates an atomic file for path, staged for run unless run
+// is nil.
+func createAtomic(run *Run, path string) (*atomicFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	pattern := "." + filepath.Base(path) + ".*.tmp"
+	if run != nil {
+		pattern = fmt.Sprintf(".%s.run-%d.*.tmp", filepath.Base(path), run.Record.ID)
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return &atomicFile{
+		path: path,
+		run:  run,
+		file: file,
+		buf:  bufio.NewWriter(file),
+	}, nil
+}
+
+func (f *atomicFile) Write(p []byte) (int, error) {
+	n, err := f.buf.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *atomicFile) Commit() error {
+	if err := f.buf.Flush(); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.file.Sync(); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.file.Close(); err != nil {
+		os.Remove(f.file.Name())
+		return err
+	}
+	f.committed = true
+
+	if f.run == nil {
+		return os.Rename(f.file.Name(), f.path)
+	}
+
+	tmp := f.file.Name()
+	f.run.Stage(func() error {
+		return os.Rename(tmp, f.path)
+	}, func() {
+		os.Remove(tmp)
+	})
+	return nil
+}
+
+// Abort discards the output. It is a no-op after Commit.
+func (f *atomicFile) Abort() {
+	if f.committed {
+		return
+	}
+	f.file.Close()
+	if !f.kept {
+		os.Remove(f.file.Name())
+	}
+}
+
+// sync flushes what was written to disk and returns the temporary file
+// with its length.
+func (f *atomicFile) sync() (SinkPosition, error) {
+	if err := f.buf.Flush(); err != nil {
+		return SinkPosition{}, err
+	}
+	if err := f.file.Sync(); err != nil {
+		return SinkPosition{}, err
+	}
+	return SinkPosition{File: f.file.Name(), Size: f.size}, nil
+}
+
+// reopen continues the temporary file of pos, cut back to its length, in
+// place of the file created for the run.
+func (f *atomicFile) reopen(pos SinkPosition) error {
+	if filepath.Dir(pos.File) != filepath.Dir(f.path) {
+		return fmt.Errorf("%s is not next to %s", pos.File, f.path)
+	}
+
+	file, err := os.OpenFile(pos.File, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(pos.Size); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Seek(pos.Size, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+
+	f.Abort()
+	f.file = file
+	f.buf.Reset(file)
+	f.size = pos.Size
+	return nil
+}
+
+// jsonlOutput writes records as JSON lines to an atomic file.
+type jsonlOutput struct {
+	file *atomicFile
+	enc  *json.Encoder
+}
+
+func createJSONL(run *Run, path string) (*jsonlOutput, error) {
+	file, err := createAtomic(run, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jsonlOutput{
+		file: file,
+		enc:  json.NewEncoder(file),
+	}, nil
+}
+
+func (o *jsonlOutput) Write(record map[string]any) error {
+	for k, v := range record {
+		if b, ok := v.([]byte); ok {
+			record[k] = string(b)
+		}
+	}
+
+	return o.enc.Encode(record)
+}
+
+func (o *jsonlOutput) Commit() error {
+	return o.file.Commit()
+}
+
+// Abort discards the output. It is a no-op after Commit.
+func (o *jsonlOutput) Abort() {
+	o.file.Abort()
+}
+
+func validateSourcePath(path string) error {
+	if path == "" {
+		return fmt.Errorf("source_path is required")
+	}
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("source_path must be an absolute path")
+	}
+	return nil
+}
+
+func validateOutputPath(path string) error {
+	if path == "" {
+		return fmt.Errorf("target_path is required")
+	}
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("target_path must be an absolute path")
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package task
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+var ErrUnknownDataset = errors.New("no task reads or writes the dataset")
+
+const (
+	LineageUpstream   string = "upstream"
+	LineageDownstream string = "downstream"
+	LineageBoth       string = "both"
+)
+
+// LineageTask is a task of a lineage graph, with the datasets the last run
+// of the task read and wrote.
+type LineageTask struct {
+	TaskID     int64  `json:"task_id"`
+	TaskName   string `json:"task_name"`
+	PipelineID int64  `json:"pipeline_id"`
+	RunID      int64  `json:"run_id"`
+	// Depth is 1 for the tasks reading or writing the dataset itself, 2 for
+	// the tasks reading or writing theirs, and so on.
+	Depth  int             `json:"depth"`
+	Reads  []store.Dataset `json:"reads"`
+	Writes []store.Dataset `json:"writes"`
+}
+
+// Lineage is the graph of the tasks a dataset comes from, upstream, and
+// the ones it feeds, downstream.
+type Lineage struct {
+	Datasets   []store.Dataset `json:"datasets"`
+	Upstream   []LineageTask   `json:"upstream"`
+	Downstream []LineageTask   `json:"downstream"`
+}
+
+// TraceLineage follows the datasets the runs of the tasks of an
+// organization read and wrote, across pipelines, from dataset up to depth
+// tasks away in the given direction. A dataset without a connection
+// matches the datasets of that name of any connection.
+func TraceLineage(ctx context.Context, storage store.Storage, organizationID int64, dataset store.Dataset, direction string, depth int) (*Lineage, error) {
+	records, err := storage.Lineage.GetByOrganization(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []*LineageTask
+	byID := make(map[int64]*LineageTask)
+	lineage := &Lineage{Datasets: []store.Dataset{}, Upstream: []LineageTask{}, Downstream: []LineageTask{}}
+	for _, r := range records {
+		t, ok := byID[r.TaskID]
+		if !ok {
+			t = &LineageTask{
+				TaskID:     r.TaskID,
+				TaskName:   r.TaskName,
+				PipelineID: r.PipelineID,
+				RunID:      r.RunID,
+				Reads:      []store.Dataset{},
+				Writes:     []store.Dataset{},
+			}
+			byID[r.TaskID] = t
+			tasks = append(tasks, t)
+		}
+		if r.Access == store.DatasetRead {
+			t.Reads = append(t.Reads, r.Dataset)
+		} else {
+			t.Writes = append(t.Writes, r.Dataset)
+		}
+
+		matches := r.Name == dataset.Name && (dataset.Connection == "" || r.Connection == dataset.Connection)
+		if matches && !slices.Contains(lineage.Datasets, r.Dataset) {
+			lineage.Datasets = append(lineage.Datasets, r.Dataset)
+		}
+	}
+	if len(lineage.Datasets) == 0 {
+		return nil, ErrUnknownDataset
+	}
+	slices.SortFunc(tasks, func(a, b *LineageTask) int {
+		return cmp.Compare(a.TaskID, b.TaskID)
+	})
+
+	if direction != LineageDownstream {
+		lineage.Upstream = trace(tasks, lineage.Datasets, depth, func(t *LineageTask) ([]store.Dataset, []store.Dataset) {
+			return t.Writes, t.Reads
+		})
+	}
+	if direction != LineageUpstream {
+		lineage.Downstream = trace(tasks, lineage.Datasets, depth, func(t *LineageTask) ([]store.Dataset, []store.Dataset) {
+			return t.Reads, t.Writes
+		})
+	}
+	return lineage, nil
+}
+
+// trace walks the graph breadth first from the start datasets. edges
+// returns the datasets a task is reached from and the ones it leads to.
+func trace(tasks []*LineageTask, start []store.Dataset, depth int, edges func(*LineageTask) (from, to []store.Dataset)) []LineageTask {
+	reached := []LineageTask{}
+	visited := make(map[int64]bool)
+	seen := make(map[store.Dataset]bool)
+	frontier := make(map[store.Dataset]bool)
+	for _, d := range start {
+		seen[d] = true
+		frontier[d] = true
+	}
+
+	for level := 1; level <= depth && len(frontier) > 0; level++ {
+		next := make(map[store.Dataset]bool)
+		for _, t := range tasks {
+			from, to := edges(t)
+			if visited[t.TaskID] || !slices.ContainsFunc(from, func(d store.Dataset) bool { return frontier[d] }) {
+				continue
+			}
+			visited[t.TaskID] = true
+
+			task := *t
+			task.Depth = level
+			reached = append(reached, task)
+			for _, d := range to {
+				if !seen[d] {
+					seen[d] = true
+					next[d] = true
+				}
+			}
+		}
+		frontier = next
+	}
+	return reached
+}
@@ -0,0 +1,119 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestTraceLineage(t *testing.T) {
+	ctx := context.Background()
+	storage := store.NewMockStore()
+	assert.NoError(t, storage.Pipelines.Create(ctx, &store.Pipelines{ID: 1, OrganizationID: 1}))
+	assert.NoError(t, storage.Pipelines.Create(ctx, &store.Pipelines{ID: 2, OrganizationID: 1}))
+	assert.NoError(t, storage.Pipelines.Create(ctx, &store.Pipelines{ID: 3, OrganizationID: 2}))
+
+	orders := store.Dataset{Connection: "app", Name: "public.orders"}
+	raw := store.Dataset{Name: "/data/orders.jsonl"}
+	clean := store.Dataset{Name: "/data/clean.jsonl"}
+	daily := store.Dataset{Connection: "warehouse", Name: "analytics.daily"}
+
+	// run records the datasets of a run of a new task.
+	run := func(pipelineID, runID int64, name string, reads, writes []store.Dataset) {
+		task := &store.Task{PipelineID: pipelineID, Name: name}
+		assert.NoError(t, storage.Tasks.Create(ctx, task))
+		r := NewRun(*task, &store.TaskRun{ID: runID})
+		for _, d := range reads {
+			r.Reads(d.Connection, d.Name)
+		}
+		for _, d := range writes {
+			r.Writes(d.Connection, d.Name)
+		}
+		assert.NoError(t, storage.Lineage.Create(ctx, r.datasets))
+	}
+
+	run(1, 1, "extract", []store.Dataset{orders}, []store.Dataset{raw})
+	run(1, 2, "clean", []store.Dataset{raw, {Name: "/data/legacy.jsonl"}}, []store.Dataset{clean})
+	run(2, 3, "load", []store.Dataset{clean}, []store.Dataset{daily})
+	run(3, 4, "other organization", []store.Dataset{clean}, nil)
+
+	// A later run of clean no longer reads the legacy file.
+	r := NewRun(store.Task{ID: 2}, &store.TaskRun{ID: 5})
+	r.Reads("", "/data/tmp/../orders.jsonl")
+	r.Writes("", clean.Name)
+	assert.NoError(t, storage.Lineage.Create(ctx, r.datasets))
+
+	lineage, err := TraceLineage(ctx, storage, 1, store.Dataset{Name: "analytics.daily"}, LineageBoth, 10)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []store.Dataset{daily}, lineage.Datasets)
+	assert.Empty(t, lineage.Downstream)
+
+	type hop struct {
+		name  string
+		depth int
+	}
+	hops := func(tasks []LineageTask) []hop {
+		var got []hop
+		for _, t := range tasks {
+			got = append(got, hop{t.TaskName, t.Depth})
+		}
+		return got
+	}
+	assert.Equal(t, []hop{{"load", 1}, {"clean", 2}, {"extract", 3}}, hops(lineage.Upstream))
+	assert.Equal(t, int64(5), lineage.Upstream[1].RunID)
+	assert.Equal(t, []store.Dataset{raw}, lineage.Upstream[1].Reads)
+
+	lineage, err = TraceLineage(ctx, storage, 1, orders, LineageDownstream, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, lineage.Upstream)
+	// The depth stops the walk before load.
+	assert.Equal(t, []hop{{"extract", 1}, {"clean", 2}}, hops(lineage.Downstream))
+
+	_, err = TraceLineage(ctx, storage, 1, store.Dataset{Connection: "warehouse", Name: "public.orders"}, LineageBoth, 10)
+	assert.ErrorIs(t, err, ErrUnknownDataset)
+}
+
+func TestExecutor_RecordsDatasets(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "in.jsonl")
+	target := filepath.Join(dir, "out.jsonl")
+	assert.NoError(t, os.WriteFile(source, []byte(`{"id": 1}`+"\n"), 0o644))
+
+	ctx := context.Background()
+	storage := store.NewMockStore()
+	registry := NewRegistry()
+	registry.Register("test.copy", runFunc(func(ctx context.Context, run *Run) error {
+		run.Reads("app", "public.customers")
+		sink, err := newJSONLSink(run, target)
+		if err != nil {
+			return err
+		}
+		_, err = runPipeline(ctx, run, nil, jsonlSource("copy", source), sink)
+		return err
+	}))
+	executor := NewExecutor(storage, registry, zap.NewNop().Sugar(), 1, 1)
+
+	assert.NoError(t, storage.Pipelines.Create(ctx, &store.Pipelines{ID: 1, OrganizationID: 1}))
+	task := &store.Task{PipelineID: 1, Name: "copy", Type: "test.copy", Config: json.RawMessage(`{}`)}
+	assert.NoError(t, storage.Tasks.Create(ctx, task))
+	taskRun := &store.TaskRun{TaskID: task.ID}
+	assert.NoError(t, storage.TaskRuns.Create(ctx, taskRun))
+	executor.execute(ctx, job{task: *task, run: *taskRun})
+
+	datasets, err := storage.Lineage.GetByOrganization(ctx, 1)
+	assert.NoError(t, err)
+	var got []string
+	for _, d := range datasets {
+		assert.Equal(t, taskRun.ID, d.RunID)
+		got = append(got, d.Access+" "+d.Connection+":"+d.Name)
+	}
+	assert.Equal(t, []string{"read app:public.customers", "read :" + source, "write :" + target}, got)
+}
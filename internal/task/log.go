@@ -0,0 +1,87 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLogSize caps the logs kept for a single run.
+const maxLogSize = 1 << 20
+
+// Log collects the log lines of a run. It is safe for concurrent use.
+type Log struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func NewLog() *Log {
+	return &Log{}
+}
+
+func (l *Log) Printf(format string, args ...any) {
+	l.writeLine("haku", fmt.Sprintf(format, args...))
+}
+
+// Writer returns a writer that appends everything written to it to the
+// log, one entry per line, tagged with the given stream name.
+func (l *Log) Writer(stream string) *StreamWriter {
+	return &StreamWriter{log: l, stream: stream}
+}
+
+func (l *Log) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.buf.String()
+}
+
+func (l *Log) writeLine(stream, line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.truncated {
+		return
+	}
+
+	entry := fmt.Sprintf("%s [%s] %s\n", time.Now().UTC().Format(time.RFC3339), stream, line)
+	if l.buf.Len()+len(entry) > maxLogSize {
+		l.buf.WriteString("... log truncated\n")
+		l.truncated = true
+		return
+	}
+	l.buf.WriteString(entry)
+}
+
+// StreamWriter splits the bytes written to it into log lines.
+type StreamWriter struct {
+	log     *Log
+	stream  string
+	partial []byte
+}
+
+func (w *StreamWriter) Write(p []byte) (int, error) {
+	data := append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		w.log.writeLine(w.stream, strings.TrimRight(string(data[:i]), "\r"))
+		data = data[i+1:]
+	}
+	w.partial = append([]byte(nil), data...)
+
+	return len(p), nil
+}
+
+// Flush writes any pending partial line to the log.
+func (w *StreamWriter) Flush() {
+	if len(w.partial) > 0 {
+		w.log.writeLine(w.stream, string(w.partial))
+		w.partial = nil
+	}
+}
@@ -0,0 +1,147 @@
+package task
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+// matchFiles expands glob patterns into a sorted list of regular files.
+// Files matched by several patterns are listed once.
+func matchFiles(patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+
+		for _, path := range matches {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			if info.Mode().IsRegular() {
+				files = append(files, path)
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// fileManifest tracks the files a task has ingested so that a run only
+// picks up new or changed files.
+type fileManifest struct {
+	storage store.Storage
+	taskID  int64
+	known   map[string]store.FileManifestEntry
+	// pending are the files of the run, recorded once it succeeds.
+	pending []store.FileManifestEntry
+}
+
+func loadFileManifest(ctx context.Context, storage store.Storage, taskID int64) (*fileManifest, error) {
+	entries, err := storage.FileManifest.GetByTask(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]store.FileManifestEntry, len(entries))
+	for _, e := range entries {
+		known[e.Path] = e
+	}
+
+	return &fileManifest{
+		storage: storage,
+		taskID:  taskID,
+		known:   known,
+	}, nil
+}
+
+// Select returns the files that have to be ingested. A file is skipped when
+// its size and modification time are unchanged, or when its content is
+// unchanged even though it was touched.
+func (m *fileManifest) Select(run *Run, paths []string) ([]string, error) {
+	var selected []string
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := store.FileManifestEntry{
+			TaskID: m.taskID,
+			RunID:  &run.Record.ID,
+			Path:   path,
+			Size:   info.Size(),
+			// Postgres timestamps have a microsecond precision.
+			MTime: info.ModTime().UTC().Truncate(time.Microsecond),
+		}
+
+		known, ok := m.known[path]
+		if ok && known.Size == entry.Size && known.MTime.Equal(entry.MTime) {
+			continue
+		}
+
+		entry.Checksum, err = fileChecksum(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok && known.Checksum == entry.Checksum {
+			// Only touched, remember the new modification time.
+			entry.RunID = known.RunID
+			m.pending = append(m.pending, entry)
+			continue
+		}
+
+		m.pending = append(m.pending, entry)
+		selected = append(selected, path)
+	}
+
+	return selected, nil
+}
+
+// CommitOnSuccess records the files of the run once it succeeds.
+func (m *fileManifest) CommitOnSuccess(run *Run) {
+	run.OnSuccess(func(ctx context.Context) error {
+		if len(m.pending) == 0 {
+			return nil
+		}
+		if err := m.storage.FileManifest.Upsert(ctx, m.pending); err != nil {
+			return fmt.Errorf("failed to record file manifest: %w", err)
+		}
+		return nil
+	})
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,420 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/record"
+)
+
+const (
+	defaultMaxOpenPartitions = 64
+	// hiveDefaultPartition holds the records whose partition value is null
+	// or empty, named as Hive names it.
+	hiveDefaultPartition = "__HIVE_DEFAULT_PARTITION__"
+)
+
+// PartitionConfig writes the output of a task as a Hive style directory
+// tree under its target path, such as dt=2025-01-01/region=eu/, with the
+// files of each partition named part-00000, part-00001 and so on. A run
+// replaces the partitions it writes and leaves the others as they are, so
+// rerunning a day only rewrites that day.
+//
+// Partitioning is supported by the JSON lines and Avro outputs, the file
+// formats tasks write. There is no CSV or Parquet output to partition yet.
+type PartitionConfig struct {
+	// Columns are the directory levels, in order. Their values are taken
+	// out of the records, the path holding them.
+	Columns []string `json:"columns" validate:"required,min=1,max=8,unique,dive,required"`
+	// MaxOpen caps the partitions written to at once, 64 by default. Past
+	// it, the file of the partition written to least recently is closed,
+	// and the partition continues in a new file should more records come.
+	MaxOpen int `json:"max_open" validate:"omitempty,min=1,max=1024"`
+	// MaxFileRows and MaxFileBytes roll a partition over to a new file
+	// once its file holds that many records or bytes. Sizes are checked
+	// after each batch of records, so files may go over by one batch.
+	MaxFileRows  int64 `json:"max_file_rows" validate:"omitempty,min=1"`
+	MaxFileBytes int64 `json:"max_file_bytes" validate:"omitempty,min=1"`
+}
+
+// openPartFile creates the sink writing one file of a partition.
+type openPartFile func(path string) (record.Sink, error)
+
+// sizedSink is a sink that knows how many bytes it wrote.
+type sizedSink interface {
+	size() int64
+}
+
+// partitionedSink writes records to one directory per partition. Files
+// are written to a staging directory of the run, and the partitions are
+// moved into place once the run succeeds.
+type partitionedSink struct {
+	run     *Run
+	root    string
+	staging string
+	cfg     PartitionConfig
+	ext     string
+	open    openPartFile
+
+	// appends adds the files of a run to the partitions it writes instead
+	// of replacing them. Files are then named after the run.
+	appends bool
+
+	files map[string]*partFile
+	// parts counts the files of every partition written, by directory.
+	parts map[string]int
+	clock int64
+	rows  int64
+
+	committed bool
+}
+
+// partFile is the open file of a partition.
+type partFile struct {
+	sink record.Sink
+	rows int64
+	used int64
+}
+
+func newPartitionedSink(run *Run, root string, cfg PartitionConfig, ext string, open openPartFile) *partitionedSink {
+	if cfg.MaxOpen == 0 {
+		cfg.MaxOpen = defaultMaxOpenPartitions
+	}
+	return &partitionedSink{
+		run:     run,
+		root:    root,
+		staging: filepath.Join(root, fmt.Sprintf(".run-%d", run.Record.ID)),
+		cfg:     cfg,
+		ext:     ext,
+		open:    open,
+		files:   make(map[string]*partFile),
+		parts:   make(map[string]int),
+	}
+}
+
+func (s *partitionedSink) Name() string {
+	return "partitioned"
+}
+
+func (s *partitionedSink) dataset() string {
+	return s.root
+}
+
+func (s *partitionedSink) Write(ctx context.Context, batch record.Batch) error {
+	// Records keep their order within a partition.
+	var dirs []string
+	groups := make(map[string]record.Batch)
+	for _, r := range batch {
+		s.rows++
+		dir, out, err := s.partition(r)
+		if err != nil {
+			err = record.Reject(ctx, record.Rejection{
+				Position: fmt.Sprintf("record %d", s.rows),
+				Reason:   err.Error(),
+				Record:   r,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := groups[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		groups[dir] = append(groups[dir], out)
+	}
+
+	for _, dir := range dirs {
+		if err := s.write(ctx, dir, groups[dir]); err != nil {
+			return fmt.Errorf("partition %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// partition returns the directory of a record, relative to the root, and
+// the record without its partition columns.
+func (s *partitionedSink) partition(r record.Record) (string, record.Record, error) {
+	out := make(record.Record, len(r))
+	for k, v := range r {
+		out[k] = v
+	}
+
+	segments := make([]string, len(s.cfg.Columns))
+	for i, c := range s.cfg.Columns {
+		value, err := partitionValue(r[c])
+		if err != nil {
+			return "", nil, fmt.Errorf("partition column %s: %w", c, err)
+		}
+		delete(out, c)
+		segments[i] = escapePartition(c) + "=" + value
+	}
+	return filepath.Join(segments...), out, nil
+}
+
+func (s *partitionedSink) write(ctx context.Context, dir string, batch record.Batch) error {
+	for len(batch) > 0 {
+		f, err := s.file(dir)
+		if err != nil {
+			return err
+		}
+
+		n := int64(len(batch))
+		if s.cfg.MaxFileRows > 0 {
+			n = min(n, s.cfg.MaxFileRows-f.rows)
+		}
+		if err := f.sink.Write(ctx, batch[:n]); err != nil {
+			return err
+		}
+		f.rows += n
+		batch = batch[n:]
+
+		if s.full(f) {
+			if err := s.close(ctx, dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *partitionedSink) full(f *partFile) bool {
+	if s.cfg.MaxFileRows > 0 && f.rows >= s.cfg.MaxFileRows {
+		return true
+	}
+	if sized, ok := f.sink.(sizedSink); ok && s.cfg.MaxFileBytes > 0 {
+		return sized.size() >= s.cfg.MaxFileBytes
+	}
+	return false
+}
+
+// file returns the open file of a partition, creating a new one if there
+// is none. The partition written to least recently is closed first when
+// as many as allowed are open.
+func (s *partitionedSink) file(dir string) (*partFile, error) {
+	s.clock++
+	if f, ok := s.files[dir]; ok {
+		f.used = s.clock
+		return f, nil
+	}
+
+	if len(s.files) >= s.cfg.MaxOpen {
+		var lru string
+		for d, f := range s.files {
+			if lru == "" || f.used < s.files[lru].used {
+				lru = d
+			}
+		}
+		if err := s.close(context.Background(), lru); err != nil {
+			return nil, fmt.Errorf("partition %s: %w", lru, err)
+		}
+	}
+
+	name := fmt.Sprintf("part-%05d%s", s.parts[dir], s.ext)
+	if s.appends {
+		name = fmt.Sprintf("part-run-%d-%05d%s", s.run.Record.ID, s.parts[dir], s.ext)
+	}
+	sink, err := s.open(filepath.Join(s.staging, dir, name))
+	if err != nil {
+		return nil, err
+	}
+	s.parts[dir]++
+
+	f := &partFile{sink: sink, used: s.clock}
+	s.files[dir] = f
+	return f, nil
+}
+
+func (s *partitionedSink) close(ctx context.Context, dir string) error {
+	f := s.files[dir]
+	delete(s.files, dir)
+	return f.sink.Commit(ctx)
+}
+
+func (s *partitionedSink) Commit(ctx context.Context) error {
+	for dir := range s.files {
+		if err := s.close(ctx, dir); err != nil {
+			s.Abort()
+			return fmt.Errorf("partition %s: %w", dir, err)
+		}
+	}
+	s.committed = true
+
+	if len(s.parts) > 0 {
+		s.run.Stage(s.publish, s.discard)
+	}
+	return nil
+}
+
+// Abort discards the output. It is a no-op after Commit.
+func (s *partitionedSink) Abort() {
+	if s.committed {
+		return
+	}
+	for _, f := range s.files {
+		f.sink.Abort()
+	}
+	s.files = nil
+	s.discard()
+}
+
+func (s *partitionedSink) discard() {
+	os.RemoveAll(s.staging)
+}
+
+// publish moves the partitions written into place. The partitions of
+// earlier runs are all moved aside before any new one is moved in, so that
+// on an error every partition is put back as it was. The partitions
+// replaced are removed once all the new ones are in place.
+func (s *partitionedSink) publish() error {
+	defer s.discard()
+
+	dirs := make([]string, 0, len(s.parts))
+	for dir := range s.parts {
+		dirs = append(dirs, dir)
+	}
+	slices.Sort(dirs)
+
+	if s.appends {
+		return s.publishFiles(dirs)
+	}
+
+	replaced := s.staging + ".replaced"
+	var aside, placed []string
+	rollback := func() {
+		restored := true
+		for _, dir := range placed {
+			if err := os.Rename(filepath.Join(s.root, dir), filepath.Join(s.staging, dir)); err != nil {
+				restored = false
+			}
+		}
+		for _, dir := range aside {
+			if err := os.Rename(filepath.Join(replaced, dir), filepath.Join(s.root, dir)); err != nil {
+				restored = false
+			}
+		}
+		// Partitions that could not be put back are kept aside rather
+		// than lost.
+		if restored {
+			os.RemoveAll(replaced)
+		}
+	}
+
+	for _, dir := range dirs {
+		target := filepath.Join(s.root, dir)
+		_, err := os.Stat(target)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			rollback()
+			return err
+		}
+
+		old := filepath.Join(replaced, dir)
+		if err := os.MkdirAll(filepath.Dir(old), 0o755); err != nil {
+			rollback()
+			return err
+		}
+		if err := os.Rename(target, old); err != nil {
+			rollback()
+			return err
+		}
+		aside = append(aside, dir)
+	}
+
+	for _, dir := range dirs {
+		target := filepath.Join(s.root, dir)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			rollback()
+			return err
+		}
+		if err := os.Rename(filepath.Join(s.staging, dir), target); err != nil {
+			rollback()
+			return err
+		}
+		placed = append(placed, dir)
+	}
+
+	os.RemoveAll(replaced)
+	return nil
+}
+
+// publishFiles moves the files written into their partitions, next to the
+// files of earlier runs.
+func (s *partitionedSink) publishFiles(dirs []string) error {
+	for _, dir := range dirs {
+		target := filepath.Join(s.root, dir)
+		if err := os.MkdirAll(target, 0o755); err != nil {
+			return err
+		}
+
+		entries, err := os.ReadDir(filepath.Join(s.staging, dir))
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := os.Rename(filepath.Join(s.staging, dir, e.Name()), filepath.Join(target, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// partitionValue formats a value for a partition directory. Nulls and
+// empty strings go to the default partition, and times at midnight are
+// formatted as dates, such as dt=2025-01-01.
+func partitionValue(v any) (string, error) {
+	var value string
+	switch v := v.(type) {
+	case nil:
+	case string:
+		value = v
+	case json.Number:
+		value = string(v)
+	case bool:
+		value = strconv.FormatBool(v)
+	case float64:
+		value = strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		value = strconv.FormatInt(v, 10)
+	case int:
+		value = strconv.Itoa(v)
+	case time.Time:
+		value = v.Format(time.RFC3339Nano)
+		if h, m, sec := v.Clock(); h == 0 && m == 0 && sec == 0 && v.Nanosecond() == 0 {
+			value = v.Format(time.DateOnly)
+		}
+	default:
+		return "", fmt.Errorf("cannot partition by a value of type %s", record.TypeOf(v))
+	}
+
+	if value == "" {
+		return hiveDefaultPartition, nil
+	}
+	return escapePartition(value), nil
+}
+
+// escapePartition escapes the characters Hive escapes in partition paths
+// as %XX, which includes the path separator and the equals sign.
+func escapePartition(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c == 0x7f || strings.IndexByte("\"#%'*/:=?\\{[]^", c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
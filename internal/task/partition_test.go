@@ -0,0 +1,216 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionedSink(t *testing.T) {
+	// write runs a pipeline copying the lines into a partitioned output and
+	// returns the files under it, relative to the root.
+	write := func(t *testing.T, root string, runID int64, lines string, cfg PartitionConfig, fail error) []string {
+		t.Helper()
+
+		source := filepath.Join(t.TempDir(), "in.jsonl")
+		assert.NoError(t, os.WriteFile(source, []byte(lines), 0o644))
+
+		run := NewRun(store.Task{ID: 1}, &store.TaskRun{ID: runID})
+		sink, err := newJSONLOutput(run, root, &cfg)
+		assert.NoError(t, err)
+
+		_, err = runPipeline(context.Background(), run, nil, jsonlSource("copy", source), sink)
+		if err == nil {
+			err = fail
+		}
+		err = run.complete(context.Background(), err)
+		if fail == nil {
+			assert.NoError(t, err)
+		}
+
+		var files []string
+		filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				rel, _ := filepath.Rel(root, path)
+				files = append(files, rel)
+			}
+			return nil
+		})
+		sort.Strings(files)
+		return files
+	}
+
+	lines := func(records ...string) string {
+		return strings.Join(records, "\n") + "\n"
+	}
+
+	t.Run("layout", func(t *testing.T) {
+		root := filepath.Join(t.TempDir(), "orders")
+		files := write(t, root, 1, lines(
+			`{"id": 1, "dt": "2025-01-01", "region": "eu"}`,
+			`{"id": 2, "dt": "2025-01-01", "region": "us"}`,
+			`{"id": 3, "dt": "2025-01-02", "region": null}`,
+			`{"id": 4, "dt": "2025-01-01", "region": "eu"}`,
+			`{"id": 5, "dt": "2025-01-02", "region": "a/b=c"}`,
+		), PartitionConfig{Columns: []string{"dt", "region"}}, nil)
+
+		assert.Equal(t, []string{
+			"dt=2025-01-01/region=eu/part-00000.jsonl",
+			"dt=2025-01-01/region=us/part-00000.jsonl",
+			"dt=2025-01-02/region=__HIVE_DEFAULT_PARTITION__/part-00000.jsonl",
+			"dt=2025-01-02/region=a%2Fb%3Dc/part-00000.jsonl",
+		}, files)
+		assert.Equal(t, []map[string]any{{"id": 1.0}, {"id": 4.0}}, readLines(t, filepath.Join(root, files[0])))
+	})
+
+	t.Run("rolling", func(t *testing.T) {
+		root := filepath.Join(t.TempDir(), "orders")
+		data := lines(
+			`{"id": 1, "dt": "a"}`,
+			`{"id": 2, "dt": "a"}`,
+			`{"id": 3, "dt": "a"}`,
+			`{"id": 4, "dt": "a"}`,
+			`{"id": 5, "dt": "a"}`,
+		)
+
+		files := write(t, root, 1, data, PartitionConfig{Columns: []string{"dt"}, MaxFileRows: 2}, nil)
+		assert.Equal(t, []string{"dt=a/part-00000.jsonl", "dt=a/part-00001.jsonl", "dt=a/part-00002.jsonl"}, files)
+		assert.Equal(t, []map[string]any{{"id": 5.0}}, readLines(t, filepath.Join(root, files[2])))
+	})
+
+	// Batches are written one at a time, so the records of a partition in
+	// the same batch go to the same file.
+	batches := func(t *testing.T, root string, cfg PartitionConfig, batches ...record.Batch) []string {
+		t.Helper()
+
+		run := NewRun(store.Task{ID: 1}, &store.TaskRun{ID: 1})
+		sink := newPartitionedSink(run, root, cfg, ".jsonl", func(path string) (record.Sink, error) {
+			return newJSONLSink(nil, path)
+		})
+		for _, batch := range batches {
+			assert.NoError(t, sink.Write(context.Background(), batch))
+		}
+		assert.NoError(t, sink.Commit(context.Background()))
+		assert.NoError(t, run.complete(context.Background(), nil))
+
+		entries, _ := filepath.Glob(filepath.Join(root, "*", "*"))
+		for i := range entries {
+			entries[i], _ = filepath.Rel(root, entries[i])
+		}
+		return entries
+	}
+
+	t.Run("rolling by size", func(t *testing.T) {
+		root := filepath.Join(t.TempDir(), "orders")
+		files := batches(t, root, PartitionConfig{Columns: []string{"dt"}, MaxFileBytes: 20},
+			record.Batch{{"id": 1, "dt": "a"}, {"id": 2, "dt": "a"}},
+			record.Batch{{"id": 3, "dt": "a"}},
+			record.Batch{{"id": 4, "dt": "a"}},
+		)
+		assert.Equal(t, []string{"dt=a/part-00000.jsonl", "dt=a/part-00001.jsonl"}, files)
+	})
+
+	t.Run("max open partitions", func(t *testing.T) {
+		root := filepath.Join(t.TempDir(), "orders")
+		files := batches(t, root, PartitionConfig{Columns: []string{"dt"}, MaxOpen: 1},
+			record.Batch{{"id": 1, "dt": "a"}, {"id": 2, "dt": "b"}},
+			record.Batch{{"id": 3, "dt": "a"}},
+		)
+
+		assert.Equal(t, []string{"dt=a/part-00000.jsonl", "dt=a/part-00001.jsonl", "dt=b/part-00000.jsonl"}, files)
+	})
+
+	t.Run("times", func(t *testing.T) {
+		root := filepath.Join(t.TempDir(), "orders")
+		files := batches(t, root, PartitionConfig{Columns: []string{"dt"}},
+			record.Batch{
+				{"id": 1, "dt": time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+				{"id": 2, "dt": time.Date(2025, 1, 1, 12, 30, 0, 0, time.UTC)},
+			},
+		)
+		assert.Equal(t, []string{"dt=2025-01-01/part-00000.jsonl", "dt=2025-01-01T12%3A30%3A00Z/part-00000.jsonl"}, files)
+	})
+
+	t.Run("reruns overwrite the partitions they write", func(t *testing.T) {
+		root := filepath.Join(t.TempDir(), "orders")
+		cfg := PartitionConfig{Columns: []string{"dt"}, MaxFileRows: 1}
+		write(t, root, 1, lines(
+			`{"id": 1, "dt": "a"}`,
+			`{"id": 2, "dt": "a"}`,
+			`{"id": 3, "dt": "b"}`,
+		), cfg, nil)
+
+		files := write(t, root, 2, lines(`{"id": 4, "dt": "a"}`), cfg, nil)
+		assert.Equal(t, []string{"dt=a/part-00000.jsonl", "dt=b/part-00000.jsonl"}, files)
+		assert.Equal(t, []map[string]any{{"id": 4.0}}, readLines(t, filepath.Join(root, files[0])))
+
+		files = write(t, root, 3, lines(`{"id": 5, "dt": "b"}`), cfg, errors.New("quality check failed"))
+		assert.Equal(t, []string{"dt=a/part-00000.jsonl", "dt=b/part-00000.jsonl"}, files)
+		assert.Equal(t, []map[string]any{{"id": 3.0}}, readLines(t, filepath.Join(root, files[1])))
+	})
+
+	t.Run("failed publish restores every partition", func(t *testing.T) {
+		root := filepath.Join(t.TempDir(), "orders")
+		cfg := PartitionConfig{Columns: []string{"dt"}}
+		write(t, root, 1, lines(`{"id": 1, "dt": "a"}`, `{"id": 2, "dt": "b"}`), cfg, nil)
+
+		run := NewRun(store.Task{ID: 1}, &store.TaskRun{ID: 2})
+		sink := newPartitionedSink(run, root, cfg, ".jsonl", func(path string) (record.Sink, error) {
+			return newJSONLSink(nil, path)
+		})
+		assert.NoError(t, sink.Write(context.Background(), record.Batch{{"id": 3, "dt": "a"}, {"id": 4, "dt": "b"}}))
+		assert.NoError(t, sink.Commit(context.Background()))
+
+		// The second partition cannot be moved in once the first one is.
+		assert.NoError(t, os.RemoveAll(filepath.Join(sink.staging, "dt=b")))
+		assert.Error(t, run.complete(context.Background(), nil))
+
+		assert.Equal(t, []map[string]any{{"id": 1.0}}, readLines(t, filepath.Join(root, "dt=a", "part-00000.jsonl")))
+		assert.Equal(t, []map[string]any{{"id": 2.0}}, readLines(t, filepath.Join(root, "dt=b", "part-00000.jsonl")))
+		assert.NoDirExists(t, sink.staging)
+		assert.NoDirExists(t, sink.staging+".replaced")
+	})
+
+	t.Run("appending runs keep the files of earlier ones", func(t *testing.T) {
+		root := filepath.Join(t.TempDir(), "changes")
+		for _, id := range []int64{1, 2} {
+			run := NewRun(store.Task{ID: 1}, &store.TaskRun{ID: id})
+			sink := newPartitionedSink(run, root, PartitionConfig{Columns: []string{"dt"}}, ".jsonl", func(path string) (record.Sink, error) {
+				return newJSONLSink(nil, path)
+			})
+			sink.appends = true
+
+			assert.NoError(t, sink.Write(context.Background(), record.Batch{{"id": id, "dt": "a"}}))
+			assert.NoError(t, sink.Commit(context.Background()))
+			assert.NoError(t, run.complete(context.Background(), nil))
+		}
+
+		entries, err := os.ReadDir(filepath.Join(root, "dt=a"))
+		assert.NoError(t, err)
+		assert.Len(t, entries, 2)
+		assert.Equal(t, "part-run-1-00000.jsonl", entries[0].Name())
+		assert.Equal(t, "part-run-2-00000.jsonl", entries[1].Name())
+	})
+
+	t.Run("unsupported values", func(t *testing.T) {
+		root := filepath.Join(t.TempDir(), "orders")
+		source := filepath.Join(t.TempDir(), "in.jsonl")
+		assert.NoError(t, os.WriteFile(source, []byte(`{"id": 1, "dt": {"day": 1}}`+"\n"), 0o644))
+
+		run := NewRun(store.Task{ID: 1}, &store.TaskRun{ID: 1})
+		sink, _ := newJSONLOutput(run, root, &PartitionConfig{Columns: []string{"dt"}})
+		_, err := runPipeline(context.Background(), run, nil, jsonlSource("copy", source), sink)
+		assert.ErrorContains(t, err, "partition column dt: cannot partition by a value of type object")
+		assert.NoError(t, run.complete(context.Background(), nil))
+		assert.NoDirExists(t, root)
+	})
+}
@@ -0,0 +1,336 @@
+package task
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// LSN is a position in the postgres write-ahead log.
+type LSN uint64
+
+// ParseLSN parses the textual form of an LSN, e.g. "16/B374D848".
+func ParseLSN(s string) (LSN, error) {
+	var hi, lo uint32
+	if _, err := fmt.Sscanf(s, "%X/%X", &hi, &lo); err != nil {
+		return 0, fmt.Errorf("invalid LSN %q", s)
+	}
+	return LSN(uint64(hi)<<32 | uint64(lo)), nil
+}
+
+func (l LSN) String() string {
+	return fmt.Sprintf("%X/%X", uint32(l>>32), uint32(l))
+}
+
+const (
+	ChangeInsert   string = "insert"
+	ChangeUpdate   string = "update"
+	ChangeDelete   string = "delete"
+	ChangeTruncate string = "truncate"
+)
+
+// postgresEpoch is the origin of the timestamps of the replication
+// protocol.
+var postgresEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+type pgRelation struct {
+	namespace string
+	name      string
+	columns   []pgColumn
+}
+
+type pgColumn struct {
+	name    string
+	key     bool
+	typeOID uint32
+}
+
+// pgoutputBatch is what a single pgoutput message decodes into.
+type pgoutputBatch struct {
+	events []map[string]any
+	// begin is set by the begin message of a transaction.
+	begin bool
+	// commit is set by the commit message of a transaction, with the WAL
+	// position following it.
+	commit bool
+	endLSN LSN
+}
+
+// pgoutputDecoder decodes the messages of the pgoutput logical decoding
+// plugin, protocol version 1, into change events. Relation messages are
+// remembered since changes only reference their relation by id.
+type pgoutputDecoder struct {
+	relations map[uint32]*pgRelation
+	types     *pgtype.Map
+
+	xid        uint32
+	commitTime time.Time
+}
+
+func newPgoutputDecoder() *pgoutputDecoder {
+	return &pgoutputDecoder{
+		relations: make(map[uint32]*pgRelation),
+		types:     pgtype.NewMap(),
+	}
+}
+
+var errShortMessage = errors.New("pgoutput: message too short")
+
+// pgReader reads the fields of a pgoutput message.
+type pgReader struct {
+	buf []byte
+	err error
+}
+
+func (r *pgReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.buf) < n {
+		r.err = errShortMessage
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *pgReader) uint8() uint8 {
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *pgReader) uint16() uint16 {
+	if b := r.take(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *pgReader) uint32() uint32 {
+	if b := r.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *pgReader) uint64() uint64 {
+	if b := r.take(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *pgReader) time() time.Time {
+	micros := int64(r.uint64())
+	return postgresEpoch.Add(time.Duration(micros) * time.Microsecond)
+}
+
+func (r *pgReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	for i, c := range r.buf {
+		if c == 0 {
+			s := string(r.buf[:i])
+			r.buf = r.buf[i+1:]
+			return s
+		}
+	}
+	r.err = errShortMessage
+	return ""
+}
+
+// Decode decodes the message found at walStart in the replication stream.
+func (d *pgoutputDecoder) Decode(walStart LSN, data []byte) (pgoutputBatch, error) {
+	var batch pgoutputBatch
+	if len(data) == 0 {
+		return batch, errShortMessage
+	}
+
+	r := &pgReader{buf: data[1:]}
+	var err error
+
+	switch data[0] {
+	case 'B':
+		r.uint64() // final LSN of the transaction
+		batch.begin = true
+		d.commitTime = r.time()
+		d.xid = r.uint32()
+	case 'C':
+		r.uint8()  // flags
+		r.uint64() // LSN of the commit
+		batch.commit = true
+		batch.endLSN = LSN(r.uint64())
+	case 'R':
+		d.decodeRelation(r)
+	case 'I':
+		var event map[string]any
+		event, err = d.decodeChange(r, ChangeInsert, walStart)
+		batch.events = append(batch.events, event)
+	case 'U':
+		var event map[string]any
+		event, err = d.decodeChange(r, ChangeUpdate, walStart)
+		batch.events = append(batch.events, event)
+	case 'D':
+		var event map[string]any
+		event, err = d.decodeChange(r, ChangeDelete, walStart)
+		batch.events = append(batch.events, event)
+	case 'T':
+		batch.events, err = d.decodeTruncate(r, walStart)
+	case 'Y', 'O', 'M':
+		// Type, origin and logical messages carry no row changes.
+	default:
+		return batch, fmt.Errorf("pgoutput: unknown message type %q", data[0])
+	}
+
+	if err == nil {
+		err = r.err
+	}
+	return batch, err
+}
+
+func (d *pgoutputDecoder) decodeRelation(r *pgReader) {
+	id := r.uint32()
+	rel := &pgRelation{
+		namespace: r.string(),
+		name:      r.string(),
+	}
+	r.uint8() // replica identity
+
+	n := int(r.uint16())
+	for i := 0; i < n && r.err == nil; i++ {
+		flags := r.uint8()
+		column := pgColumn{
+			name: r.string(),
+			key:  flags&1 == 1,
+		}
+		column.typeOID = r.uint32()
+		r.uint32() // type modifier
+		rel.columns = append(rel.columns, column)
+	}
+
+	d.relations[id] = rel
+}
+
+func (d *pgoutputDecoder) relation(id uint32) (*pgRelation, error) {
+	rel, ok := d.relations[id]
+	if !ok {
+		return nil, fmt.Errorf("pgoutput: change for unknown relation %d", id)
+	}
+	return rel, nil
+}
+
+func (d *pgoutputDecoder) event(op string, rel *pgRelation, walStart LSN) map[string]any {
+	return map[string]any{
+		"op":          op,
+		"schema":      rel.namespace,
+		"table":       rel.name,
+		"lsn":         walStart.String(),
+		"xid":         d.xid,
+		"commit_time": d.commitTime,
+		"before":      nil,
+		"after":       nil,
+	}
+}
+
+// decodeChange decodes an insert, update or delete. The before image of
+// updates and deletes holds the whole row only with REPLICA IDENTITY FULL,
+// otherwise the replica identity key columns.
+func (d *pgoutputDecoder) decodeChange(r *pgReader, op string, walStart LSN) (map[string]any, error) {
+	rel, err := d.relation(r.uint32())
+	if err != nil {
+		return nil, err
+	}
+	event := d.event(op, rel, walStart)
+
+	for r.err == nil && len(r.buf) > 0 {
+		kind := r.uint8()
+		image, err := d.decodeTuple(r, rel, kind == 'K')
+		if err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case 'K', 'O':
+			event["before"] = image
+		case 'N':
+			event["after"] = image
+		default:
+			return nil, fmt.Errorf("pgoutput: unknown tuple type %q", kind)
+		}
+	}
+
+	return event, nil
+}
+
+func (d *pgoutputDecoder) decodeTruncate(r *pgReader, walStart LSN) ([]map[string]any, error) {
+	n := int(r.uint32())
+	r.uint8() // options
+
+	var events []map[string]any
+	for i := 0; i < n && r.err == nil; i++ {
+		rel, err := d.relation(r.uint32())
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, d.event(ChangeTruncate, rel, walStart))
+	}
+	return events, nil
+}
+
+// decodeTuple decodes the columns of a row. Unchanged TOASTed values are
+// not sent by postgres and are left out of the image.
+func (d *pgoutputDecoder) decodeTuple(r *pgReader, rel *pgRelation, keyOnly bool) (map[string]any, error) {
+	n := int(r.uint16())
+	if r.err == nil && n != len(rel.columns) {
+		return nil, fmt.Errorf("pgoutput: %s.%s has %d columns, tuple has %d", rel.namespace, rel.name, len(rel.columns), n)
+	}
+
+	image := make(map[string]any, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		column := rel.columns[i]
+		kind := r.uint8()
+
+		var value any
+		switch kind {
+		case 'n':
+		case 'u':
+			continue
+		case 't', 'b':
+			data := r.take(int(r.uint32()))
+			value = d.decodeValue(column.typeOID, kind, data)
+		default:
+			return nil, fmt.Errorf("pgoutput: unknown column data type %q", kind)
+		}
+
+		if keyOnly && !column.key {
+			continue
+		}
+		image[column.name] = value
+	}
+
+	return image, r.err
+}
+
+// decodeValue converts a column value the way database/sql scans it, so
+// that events hold the same values as postgres.extract records. Values of
+// unknown types are kept as text.
+func (d *pgoutputDecoder) decodeValue(oid uint32, kind uint8, data []byte) any {
+	format := int16(pgtype.TextFormatCode)
+	if kind == 'b' {
+		format = pgtype.BinaryFormatCode
+	}
+
+	if typ, ok := d.types.TypeForOID(oid); ok {
+		if value, err := typ.Codec.DecodeDatabaseSQLValue(d.types, oid, format, data); err == nil {
+			return value
+		}
+	}
+	return string(data)
+}
@@ -0,0 +1,273 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+// runPipeline streams the records of source through the transforms into
+// sink. The stage counters are kept on the run whether or not it succeeds,
+// and the records written become its row count. Records the stages reject
+// go to the dead letter when there is one, and fail the run otherwise.
+// The schema of the records the source reads is checked for drift.
+// Preview runs write to their preview sink instead. When the task
+// checkpoints, the run resumes from the last checkpoint and saves new
+// ones as it goes.
+func runPipeline(ctx context.Context, run *Run, dl *DeadLetterConfig, source record.Source, sink record.Sink, transforms ...record.Transform) (record.Stats, error) {
+	observed := &observedSource{source: source}
+	if run.baseline != nil && run.Task.DriftPolicy == store.DriftEvolve {
+		observed.fill = run.baseline.Names()
+	}
+
+	if d, ok := source.(fileStage); ok {
+		run.Reads("", d.dataset())
+	}
+	if d, ok := sink.(fileStage); ok {
+		run.Writes("", d.dataset())
+	}
+
+	// A preview reads the first records of the source and keeps what the
+	// transforms make of them, the sink of the task writes nothing.
+	if run.preview != nil {
+		sink.Abort()
+		sink = run.preview
+		observed.limit = int64(run.preview.limit)
+	}
+
+	p := &record.Pipeline{
+		Source:     observed,
+		Transforms: transforms,
+		Sink:       sink,
+	}
+
+	if run.checkpoint != nil && run.preview == nil {
+		save, err := run.checkpoint.attach(ctx, source, sink)
+		if err != nil {
+			sink.Abort()
+			return record.Stats{}, err
+		}
+		p.Checkpoint = save
+	}
+
+	var rejects *deadLetter
+	if dl != nil {
+		rejects = newDeadLetter(*dl, run.Record.ID)
+		p.Rejects = rejects
+	}
+
+	stats, err := p.Run(ctx)
+	run.SetStats(stats)
+
+	if rejects != nil {
+		if closeErr := rejects.close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("dead letter: %w", closeErr))
+		}
+		if n := stats.Rejected(); n > 0 {
+			run.Log.Printf("rejected %d records to %s", n, rejects.path)
+		}
+	}
+
+	// An empty source says nothing about its schema.
+	if err == nil && observed.count > 0 {
+		err = run.checkSchema(observed.schema)
+	}
+	return stats, err
+}
+
+// fileStage is a source or sink of a pipeline reading or writing a file,
+// which runPipeline records for lineage.
+type fileStage interface {
+	dataset() string
+}
+
+// readerSource adapts a read function to a record source reported under
+// the given name, usually the task type. Sources reading a file set path.
+//
+// The source counts the records it writes in pos. A read function that
+// can seek sets seeks, starts from pos and keeps the rest of pos up to
+// date as it reads. Otherwise a resumed source reads the rows written
+// before again and skips them.
+type readerSource struct {
+	name  string
+	path  string
+	read  func(ctx context.Context, w record.Writer) error
+	seeks bool
+	pos   SourcePosition
+	skip  int64
+}
+
+func newSource(name string, read func(ctx context.Context, w record.Writer) error) *readerSource {
+	return &readerSource{name: name, read: read}
+}
+
+func (s *readerSource) Name() string {
+	return s.name
+}
+
+func (s *readerSource) Read(ctx context.Context, w record.Writer) error {
+	return s.read(ctx, &positionWriter{source: s, w: w})
+}
+
+func (s *readerSource) Position() any {
+	return s.pos
+}
+
+func (s *readerSource) resume(pos SourcePosition) {
+	if s.seeks {
+		s.pos = pos
+		return
+	}
+	s.skip = pos.Rows
+}
+
+// positionWriter counts the records of a readerSource and skips the ones
+// written before it resumed.
+type positionWriter struct {
+	source *readerSource
+	w      record.Writer
+}
+
+func (p *positionWriter) Write(r record.Record) error {
+	p.source.pos.Rows++
+	if p.source.pos.Rows <= p.source.skip {
+		return nil
+	}
+	return p.w.Write(r)
+}
+
+func (s *readerSource) dataset() string {
+	return s.path
+}
+
+// jsonlSink writes the records of a pipeline to a JSON lines file, which
+// only appears at its path once the run succeeds.
+type jsonlSink struct {
+	out *jsonlOutput
+}
+
+func newJSONLSink(run *Run, path string) (*jsonlSink, error) {
+	out, err := createJSONL(run, path)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonlSink{out: out}, nil
+}
+
+func (s *jsonlSink) Name() string {
+	return "jsonl"
+}
+
+func (s *jsonlSink) Write(ctx context.Context, batch record.Batch) error {
+	for _, r := range batch {
+		if err := s.out.Write(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *jsonlSink) Commit(ctx context.Context) error {
+	return s.out.Commit()
+}
+
+func (s *jsonlSink) Abort() {
+	s.out.Abort()
+}
+
+func (s *jsonlSink) size() int64 {
+	return s.out.file.size
+}
+
+func (s *jsonlSink) dataset() string {
+	return s.out.file.path
+}
+
+func (s *jsonlSink) checkpoint() (SinkPosition, error) {
+	return s.out.file.sync()
+}
+
+func (s *jsonlSink) resume(pos SinkPosition) error {
+	return s.out.file.reopen(pos)
+}
+
+func (s *jsonlSink) keep() {
+	s.out.file.kept = true
+}
+
+// OutputConfig holds the output options shared by the tasks writing
+// records to a target path. decodeConfig validates them.
+type OutputConfig struct {
+	// Partition, when set, writes the records to partitions under the
+	// target path, which is then a directory.
+	Partition *PartitionConfig `json:"partition"`
+	// Checkpoint, when set, saves the progress of a run so that the next
+	// run resumes where a failed one stopped. Only the tasks whose
+	// configuration is a resumableConfig support it.
+	Checkpoint *CheckpointConfig `json:"checkpoint"`
+}
+
+// resumableConfig is implemented by the configurations of the tasks whose
+// runs can resume from a checkpoint.
+type resumableConfig interface {
+	resumable()
+}
+
+// validateOutput checks the output options of cfg, the configuration
+// embedding them.
+func (o *OutputConfig) validateOutput(cfg any) error {
+	if o.Checkpoint == nil {
+		return nil
+	}
+	if _, ok := cfg.(resumableConfig); !ok {
+		return errors.New("checkpoint is not supported by this task type")
+	}
+	if _, err := o.Checkpoint.interval(); err != nil {
+		return err
+	}
+	if o.Partition != nil {
+		return errors.New("checkpoint cannot be combined with partition")
+	}
+	return nil
+}
+
+// newJSONLOutput returns the sink writing the output of a task to path,
+// or to partitions under it when partition is set.
+func newJSONLOutput(run *Run, path string, partition *PartitionConfig) (record.Sink, error) {
+	if partition != nil {
+		return newPartitionedSink(run, path, *partition, ".jsonl", func(path string) (record.Sink, error) {
+			return newJSONLSink(nil, path)
+		}), nil
+	}
+
+	sink, err := newJSONLSink(run, path)
+	if err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+// jsonlSource reads a JSON lines file written by an upstream task.
+func jsonlSource(name, path string) *readerSource {
+	source := &readerSource{name: name, path: path, seeks: true}
+	source.read = func(ctx context.Context, w record.Writer) error {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if _, err := file.Seek(source.pos.Offset, io.SeekStart); err != nil {
+			return err
+		}
+		return scanJSONLAt(file, &source.pos, func(r map[string]any) error {
+			return w.Write(r)
+		}, rejectLine(ctx, ""))
+	}
+	return source
+}
@@ -0,0 +1,98 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunPipeline(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "in.jsonl")
+	target := filepath.Join(dir, "out.jsonl")
+	assert.NoError(t, os.WriteFile(source, []byte("{\"id\": 1}\n{\"id\": 2}\n{\"id\": 3}\n"), 0o644))
+
+	t.Run("records stats on the run", func(t *testing.T) {
+		run := NewRun(store.Task{ID: 1}, &store.TaskRun{ID: 1})
+		sink, err := newJSONLSink(run, target)
+		assert.NoError(t, err)
+
+		_, err = runPipeline(context.Background(), run, nil, jsonlSource("copy", source), sink)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), *run.Record.RowsAffected)
+		assert.NoFileExists(t, target, "published once the run succeeds")
+
+		assert.NoError(t, run.complete(context.Background(), nil))
+		assert.Len(t, readLines(t, target), 3)
+
+		var stats record.Stats
+		assert.NoError(t, json.Unmarshal(run.Record.Stats, &stats))
+		assert.Equal(t, "copy", stats.Stages[0].Stage)
+		assert.Equal(t, int64(3), stats.Stages[0].RecordsOut)
+		assert.Equal(t, "jsonl", stats.Stages[1].Stage)
+		assert.Equal(t, int64(3), stats.Stages[1].RecordsIn)
+		assert.Equal(t, int64(3*(2+1)), stats.Stages[1].BytesIn)
+	})
+
+	t.Run("failed runs keep no output", func(t *testing.T) {
+		failed := filepath.Join(dir, "failed.jsonl")
+		run := NewRun(store.Task{ID: 1}, &store.TaskRun{ID: 1})
+		sink, err := newJSONLSink(run, failed)
+		assert.NoError(t, err)
+
+		drop := filterFunc(func(r record.Record) (bool, error) {
+			if r["id"] == json.Number("3") {
+				return false, assert.AnError
+			}
+			return true, nil
+		})
+		_, err = runPipeline(context.Background(), run, nil, jsonlSource("copy", source), sink, drop)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.NotEmpty(t, run.Record.Stats)
+		assert.NoFileExists(t, failed)
+	})
+
+	t.Run("runs failing after the pipeline keep the previous output", func(t *testing.T) {
+		previous := filepath.Join(dir, "previous.jsonl")
+		assert.NoError(t, os.WriteFile(previous, []byte("{\"id\": 0}\n"), 0o644))
+
+		run := NewRun(store.Task{ID: 1}, &store.TaskRun{ID: 2})
+		sink, err := newJSONLSink(run, previous)
+		assert.NoError(t, err)
+
+		_, err = runPipeline(context.Background(), run, nil, jsonlSource("copy", source), sink)
+		assert.NoError(t, err)
+
+		staged, _ := filepath.Glob(filepath.Join(dir, ".previous.jsonl.run-2.*.tmp"))
+		if !assert.Len(t, staged, 1) {
+			return
+		}
+
+		assert.ErrorIs(t, run.complete(context.Background(), assert.AnError), assert.AnError)
+		assert.Equal(t, []map[string]any{{"id": 0.0}}, readLines(t, previous))
+		assert.NoFileExists(t, staged[0])
+	})
+}
+
+// filterFunc keeps the records for which it returns true.
+type filterFunc func(record.Record) (bool, error)
+
+func (f filterFunc) Apply(ctx context.Context, batch record.Batch) (record.Batch, error) {
+	out := batch[:0]
+	for _, r := range batch {
+		keep, err := f(r)
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
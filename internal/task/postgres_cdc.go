@@ -0,0 +1,346 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+const PostgresCDCType = "postgres.cdc"
+
+// CDCPositionKey is the task state key of the LSN a change data capture
+// task resumes from.
+const CDCPositionKey = "lsn"
+
+const (
+	defaultCDCTimeout     = time.Hour
+	defaultCDCIdleTimeout = 10 * time.Second
+)
+
+// slotNamePattern matches the names postgres accepts for replication slots,
+// which are also used for publications.
+var slotNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,63}$`)
+
+type PostgresCDCConfig struct {
+	Connection string `json:"connection" validate:"required"`
+	// Tables to capture, optionally schema qualified.
+	Tables []string `json:"tables" validate:"required,min=1,dive,required"`
+	// Slot and Publication default to haku_task_<task id>.
+	Slot        string `json:"slot"`
+	Publication string `json:"publication"`
+	// TargetPath is the directory the change events are written to, one
+	// file per run named after it, such as run-42.jsonl. A run capturing
+	// no change writes no file.
+	TargetPath string `json:"target_path" validate:"required"`
+	// MaxEvents ends the run at the first transaction boundary once that
+	// many events are captured.
+	MaxEvents int64 `json:"max_events" validate:"omitempty,min=1"`
+	// IdleTimeout ends the run when no change arrives for that long.
+	IdleTimeout string `json:"idle_timeout"`
+	Timeout     string `json:"timeout"`
+	OutputConfig
+}
+
+// PostgresCDC captures the row changes of postgres tables from a logical
+// replication slot, decoded with pgoutput, into JSON lines files of change
+// events. Each run resumes from the LSN checkpointed by the last
+// successful run and stops once the stream is idle. The changes of a run
+// go to files of their own, so the files of earlier runs stay until a
+// downstream task has read them. Partitioned, each run adds its files to
+// the partitions it writes.
+type PostgresCDC struct {
+	store     store.Storage
+	open      func(store.Connection) (*sql.DB, error)
+	replicate func(ctx context.Context, conn store.Connection, slot, publication string, start LSN) (replicationStream, error)
+}
+
+func NewPostgresCDC(storage store.Storage) *PostgresCDC {
+	return &PostgresCDC{
+		store:     storage,
+		open:      openPostgres,
+		replicate: startReplication,
+	}
+}
+
+func (p *PostgresCDC) Validate(ctx context.Context, task store.Task) error {
+	cfg, err := p.config(task)
+	if err != nil {
+		return err
+	}
+
+	_, err = taskConnection(ctx, p.store, task, cfg.Connection)
+	return err
+}
+
+func (p *PostgresCDC) config(task store.Task) (PostgresCDCConfig, error) {
+	var cfg PostgresCDCConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if cfg.Slot == "" {
+		cfg.Slot = fmt.Sprintf("haku_task_%d", task.ID)
+	}
+	if cfg.Publication == "" {
+		cfg.Publication = fmt.Sprintf("haku_task_%d", task.ID)
+	}
+	for _, name := range []string{cfg.Slot, cfg.Publication} {
+		if !slotNamePattern.MatchString(name) {
+			return cfg, fmt.Errorf("invalid slot or publication name %q: use up to 63 lowercase letters, digits and underscores", name)
+		}
+	}
+
+	if err := validateOutputPath(cfg.TargetPath); err != nil {
+		return cfg, err
+	}
+
+	if _, err := parseTimeout(cfg.IdleTimeout, defaultCDCIdleTimeout); err != nil {
+		return cfg, fmt.Errorf("idle_timeout: %w", err)
+	}
+	if _, err := parseTimeout(cfg.Timeout, defaultCDCTimeout); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func (p *PostgresCDC) Run(ctx context.Context, run *Run) error {
+	cfg, err := p.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	timeout, _ := parseTimeout(cfg.Timeout, defaultCDCTimeout)
+	idleTimeout, _ := parseTimeout(cfg.IdleTimeout, defaultCDCIdleTimeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := taskConnection(ctx, p.store, run.Task, cfg.Connection)
+	if err != nil {
+		return err
+	}
+
+	if err := p.setup(ctx, run, conn, cfg); err != nil {
+		return err
+	}
+
+	start, err := p.position(ctx, run.Task.ID)
+	if err != nil {
+		return err
+	}
+
+	stream, err := p.replicate(ctx, conn, cfg.Slot, cfg.Publication, start)
+	if err != nil {
+		return fmt.Errorf("failed to start replication: %w", err)
+	}
+	defer stream.Close(context.WithoutCancel(ctx))
+
+	if start != 0 {
+		// The checkpoint of the last successful run is durable, let the
+		// slot release the WAL before it.
+		if err := stream.Ack(ctx, start); err != nil {
+			return err
+		}
+		run.Log.Printf("resuming slot %s from %s", cfg.Slot, start)
+	} else {
+		run.Log.Printf("no checkpoint, starting slot %s from its confirmed position", cfg.Slot)
+	}
+
+	for _, table := range cfg.Tables {
+		run.Reads(cfg.Connection, table)
+	}
+
+	sink := newChangeSink(run, cfg)
+
+	decoder := newPgoutputDecoder()
+	checkpoint := start
+	source := newSource(PostgresCDCType, func(ctx context.Context, w record.Writer) error {
+		var events int64
+		var inTransaction bool
+
+		for {
+			receiveCtx, cancelReceive := context.WithTimeout(ctx, idleTimeout)
+			msg, err := stream.Receive(receiveCtx)
+			cancelReceive()
+			if err != nil {
+				if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+					if !inTransaction {
+						return nil
+					}
+					// Only stop at a transaction boundary.
+					continue
+				}
+				return err
+			}
+
+			batch, err := decoder.Decode(msg.WALStart, msg.Data)
+			if err != nil {
+				return err
+			}
+
+			if batch.begin {
+				inTransaction = true
+			}
+			for _, event := range batch.events {
+				if err := w.Write(event); err != nil {
+					return err
+				}
+				events++
+			}
+
+			if batch.commit {
+				inTransaction = false
+				checkpoint = batch.endLSN
+				if cfg.MaxEvents > 0 && events >= cfg.MaxEvents {
+					return nil
+				}
+			}
+		}
+	})
+	stats, err := runPipeline(ctx, run, nil, source, sink)
+	if err != nil {
+		return err
+	}
+
+	run.Log.Printf("captured %d change events into %s", stats.Written(), cfg.TargetPath)
+
+	if checkpoint != start {
+		run.OnSuccess(func(ctx context.Context) error {
+			state := &store.TaskState{
+				TaskID: run.Task.ID,
+				Key:    CDCPositionKey,
+				Value:  checkpoint.String(),
+			}
+			if err := p.store.TaskState.Set(ctx, state); err != nil {
+				return fmt.Errorf("failed to save LSN checkpoint: %w", err)
+			}
+			run.Log.Printf("checkpointed LSN %s", checkpoint)
+			return nil
+		})
+	}
+	return nil
+}
+
+// newChangeSink returns the sink writing the change events of a run.
+func newChangeSink(run *Run, cfg PostgresCDCConfig) record.Sink {
+	if cfg.Partition != nil {
+		sink := newPartitionedSink(run, cfg.TargetPath, *cfg.Partition, ".jsonl", func(path string) (record.Sink, error) {
+			return newJSONLSink(nil, path)
+		})
+		sink.appends = true
+		return sink
+	}
+	return &changeFileSink{
+		run:  run,
+		dir:  cfg.TargetPath,
+		path: filepath.Join(cfg.TargetPath, fmt.Sprintf("run-%d.jsonl", run.Record.ID)),
+	}
+}
+
+// changeFileSink writes the change events of a run to a file of its own,
+// created on the first event.
+type changeFileSink struct {
+	run  *Run
+	dir  string
+	path string
+	out  *jsonlSink
+}
+
+func (s *changeFileSink) Name() string {
+	return "jsonl"
+}
+
+func (s *changeFileSink) dataset() string {
+	return s.dir
+}
+
+func (s *changeFileSink) Write(ctx context.Context, batch record.Batch) error {
+	if s.out == nil {
+		out, err := newJSONLSink(s.run, s.path)
+		if err != nil {
+			return err
+		}
+		s.out = out
+	}
+	return s.out.Write(ctx, batch)
+}
+
+func (s *changeFileSink) Commit(ctx context.Context) error {
+	if s.out == nil {
+		return nil
+	}
+	return s.out.Commit(ctx)
+}
+
+func (s *changeFileSink) Abort() {
+	if s.out != nil {
+		s.out.Abort()
+	}
+}
+
+// position returns the LSN checkpointed by the last successful run, zero
+// when there is none.
+func (p *PostgresCDC) position(ctx context.Context, taskID int64) (LSN, error) {
+	state, err := p.store.TaskState.Get(ctx, taskID, CDCPositionKey)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return ParseLSN(state.Value)
+}
+
+// setup creates the publication and the replication slot when they do not
+// exist yet, and keeps the tables of the publication in sync with the
+// configuration.
+func (p *PostgresCDC) setup(ctx context.Context, run *Run, conn store.Connection, cfg PostgresCDCConfig) error {
+	db, err := p.open(conn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tables := make([]string, len(cfg.Tables))
+	for i, table := range cfg.Tables {
+		tables[i] = tableIdentifier(table).Sanitize()
+	}
+	tableList := strings.Join(tables, ", ")
+
+	var exists bool
+	err = db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $1)`, cfg.Publication).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER PUBLICATION %s SET TABLE %s", cfg.Publication, tableList)); err != nil {
+			return fmt.Errorf("failed to update publication %s: %w", cfg.Publication, err)
+		}
+	} else {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE %s", cfg.Publication, tableList)); err != nil {
+			return fmt.Errorf("failed to create publication %s: %w", cfg.Publication, err)
+		}
+		run.Log.Printf("created publication %s for %s", cfg.Publication, tableList)
+	}
+
+	err = db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_replication_slots WHERE slot_name = $1)`, cfg.Slot).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if _, err := db.ExecContext(ctx, `SELECT pg_create_logical_replication_slot($1, 'pgoutput')`, cfg.Slot); err != nil {
+			return fmt.Errorf("failed to create replication slot %s: %w", cfg.Slot, err)
+		}
+		run.Log.Printf("created replication slot %s", cfg.Slot)
+	}
+
+	return nil
+}
@@ -0,0 +1,377 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStream replays pgoutput messages, then blocks until the receive
+// context is done like an idle server.
+type fakeStream struct {
+	messages []walData
+	acked    []LSN
+}
+
+func (s *fakeStream) Receive(ctx context.Context) (walData, error) {
+	if len(s.messages) == 0 {
+		<-ctx.Done()
+		return walData{}, ctx.Err()
+	}
+	msg := s.messages[0]
+	s.messages = s.messages[1:]
+	return msg, nil
+}
+
+func (s *fakeStream) Ack(ctx context.Context, lsn LSN) error {
+	s.acked = append(s.acked, lsn)
+	return nil
+}
+
+func (s *fakeStream) Close(ctx context.Context) error {
+	return nil
+}
+
+// pgoutput message builders.
+
+func pgBegin(xid uint32) []byte {
+	b := []byte{'B'}
+	b = binary.BigEndian.AppendUint64(b, 0)
+	b = binary.BigEndian.AppendUint64(b, 0)
+	return binary.BigEndian.AppendUint32(b, xid)
+}
+
+func pgCommit(end LSN) []byte {
+	b := []byte{'C', 0}
+	b = binary.BigEndian.AppendUint64(b, uint64(end)-8)
+	b = binary.BigEndian.AppendUint64(b, uint64(end))
+	return binary.BigEndian.AppendUint64(b, 0)
+}
+
+// pgRelationMessage describes public.users(id int4 key, name text).
+func pgRelationMessage() []byte {
+	b := []byte{'R'}
+	b = binary.BigEndian.AppendUint32(b, 16384)
+	b = append(b, "public\x00users\x00"...)
+	b = append(b, 'd')
+	b = binary.BigEndian.AppendUint16(b, 2)
+	b = append(b, 1)
+	b = append(b, "id\x00"...)
+	b = binary.BigEndian.AppendUint32(b, 23)
+	b = binary.BigEndian.AppendUint32(b, 0xFFFFFFFF)
+	b = append(b, 0)
+	b = append(b, "name\x00"...)
+	b = binary.BigEndian.AppendUint32(b, 25)
+	return binary.BigEndian.AppendUint32(b, 0xFFFFFFFF)
+}
+
+// pgTuple encodes text column values, nil for null and "\x00" for an
+// unchanged TOASTed value.
+func pgTuple(kind byte, values ...any) []byte {
+	b := []byte{kind}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(values)))
+	for _, v := range values {
+		switch v {
+		case nil:
+			b = append(b, 'n')
+		case "\x00":
+			b = append(b, 'u')
+		default:
+			s := v.(string)
+			b = append(b, 't')
+			b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+			b = append(b, s...)
+		}
+	}
+	return b
+}
+
+func pgChange(op byte, tuples ...[]byte) []byte {
+	b := []byte{op}
+	b = binary.BigEndian.AppendUint32(b, 16384)
+	for _, t := range tuples {
+		b = append(b, t...)
+	}
+	return b
+}
+
+func TestParseLSN(t *testing.T) {
+	lsn, err := ParseLSN("16/B374D848")
+	assert.NoError(t, err)
+	assert.Equal(t, LSN(0x16B374D848), lsn)
+	assert.Equal(t, "16/B374D848", lsn.String())
+
+	_, err = ParseLSN("B374D848")
+	assert.Error(t, err)
+}
+
+func TestPgoutputDecoder(t *testing.T) {
+	d := newPgoutputDecoder()
+
+	_, err := d.Decode(1, pgChange('I', pgTuple('N', "1", "Chihiro")))
+	assert.ErrorContains(t, err, "unknown relation")
+
+	for _, msg := range [][]byte{pgRelationMessage(), pgBegin(42)} {
+		_, err := d.Decode(1, msg)
+		assert.NoError(t, err)
+	}
+
+	t.Run("insert", func(t *testing.T) {
+		batch, err := d.Decode(LSN(0x100), pgChange('I', pgTuple('N', "1", "Chihiro")))
+		assert.NoError(t, err)
+		assert.Len(t, batch.events, 1)
+
+		event := batch.events[0]
+		assert.Equal(t, ChangeInsert, event["op"])
+		assert.Equal(t, "users", event["table"])
+		assert.Equal(t, "0/100", event["lsn"])
+		assert.Equal(t, uint32(42), event["xid"])
+		assert.Nil(t, event["before"])
+		assert.Equal(t, map[string]any{"id": int64(1), "name": "Chihiro"}, event["after"])
+	})
+
+	t.Run("update with old image", func(t *testing.T) {
+		batch, err := d.Decode(1, pgChange('U', pgTuple('O', "1", "Chihiro"), pgTuple('N', "1", "Sen")))
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{"id": int64(1), "name": "Chihiro"}, batch.events[0]["before"])
+		assert.Equal(t, map[string]any{"id": int64(1), "name": "Sen"}, batch.events[0]["after"])
+	})
+
+	t.Run("update of an unchanged TOASTed value", func(t *testing.T) {
+		batch, err := d.Decode(1, pgChange('U', pgTuple('N', "2", "\x00")))
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{"id": int64(2)}, batch.events[0]["after"])
+	})
+
+	t.Run("delete with key image", func(t *testing.T) {
+		batch, err := d.Decode(1, pgChange('D', pgTuple('K', "1", nil)))
+		assert.NoError(t, err)
+		assert.Equal(t, ChangeDelete, batch.events[0]["op"])
+		assert.Equal(t, map[string]any{"id": int64(1)}, batch.events[0]["before"])
+		assert.Nil(t, batch.events[0]["after"])
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		batch, err := d.Decode(1, pgCommit(LSN(0x200)))
+		assert.NoError(t, err)
+		assert.True(t, batch.commit)
+		assert.Equal(t, LSN(0x200), batch.endLSN)
+	})
+
+	t.Run("truncated message", func(t *testing.T) {
+		msg := pgChange('I', pgTuple('N', "1", "Chihiro"))
+		_, err := d.Decode(1, msg[:len(msg)-2])
+		assert.Error(t, err)
+	})
+}
+
+func newPostgresCDCTest(t *testing.T) (*PostgresCDC, *fakeStream) {
+	t.Helper()
+
+	ctx := context.Background()
+	storage := store.NewMockStore()
+	storage.Pipelines.Create(ctx, &store.Pipelines{ID: 1, OrganizationID: 1})
+	storage.Connections.Create(ctx, &store.Connection{OrganizationID: 1, Name: "source", Type: store.ConnectionPostgres})
+
+	stream := &fakeStream{}
+	cdc := NewPostgresCDC(storage)
+	cdc.replicate = func(ctx context.Context, conn store.Connection, slot, publication string, start LSN) (replicationStream, error) {
+		return stream, nil
+	}
+
+	return cdc, stream
+}
+
+func TestPostgresCDC_Validate(t *testing.T) {
+	cdc, _ := newPostgresCDCTest(t)
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{name: "valid", config: `{"connection": "source", "tables": ["public.users"], "target_path": "/data/users"}`},
+		{name: "no tables", config: `{"connection": "source", "tables": [], "target_path": "/data/users"}`, wantErr: true},
+		{name: "bad slot", config: `{"connection": "source", "tables": ["users"], "slot": "Users'", "target_path": "/data/users"}`, wantErr: true},
+		{name: "bad idle timeout", config: `{"connection": "source", "tables": ["users"], "idle_timeout": "soon", "target_path": "/data/users"}`, wantErr: true},
+		{name: "unknown connection", config: `{"connection": "lake", "tables": ["users"], "target_path": "/data/users"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := cdc.Validate(context.Background(), store.Task{ID: 3, PipelineID: 1, Config: json.RawMessage(tt.config)})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPostgresCDC_Run(t *testing.T) {
+	ctx := context.Background()
+	cdc, stream := newPostgresCDCTest(t)
+
+	target := filepath.Join(t.TempDir(), "users")
+	config, _ := json.Marshal(PostgresCDCConfig{
+		Connection:  "source",
+		Tables:      []string{"public.users"},
+		TargetPath:  target,
+		IdleTimeout: "50ms",
+	})
+	task := store.Task{ID: 3, PipelineID: 1, Type: PostgresCDCType, Config: config}
+
+	// The publication and the slot are set up on a new database handle
+	// every run.
+	expectSetup := func(t *testing.T, publication, slot bool) {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatalf("Failed to create mock database: %v", err)
+		}
+		cdc.open = func(store.Connection) (*sql.DB, error) {
+			return db, nil
+		}
+		t.Cleanup(func() {
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+
+		mock.ExpectQuery(`SELECT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $1)`).
+			WithArgs("haku_task_3").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(publication))
+		if publication {
+			mock.ExpectExec(`ALTER PUBLICATION haku_task_3 SET TABLE "public"."users"`).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+		} else {
+			mock.ExpectExec(`CREATE PUBLICATION haku_task_3 FOR TABLE "public"."users"`).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mock.ExpectQuery(`SELECT EXISTS (SELECT 1 FROM pg_replication_slots WHERE slot_name = $1)`).
+			WithArgs("haku_task_3").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(slot))
+		if !slot {
+			mock.ExpectExec(`SELECT pg_create_logical_replication_slot($1, 'pgoutput')`).
+				WithArgs("haku_task_3").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+	}
+
+	t.Run("first run creates the slot and checkpoints", func(t *testing.T) {
+		expectSetup(t, false, false)
+		stream.messages = []walData{
+			{WALStart: 0x10, Data: pgRelationMessage()},
+			{WALStart: 0x10, Data: pgBegin(7)},
+			{WALStart: 0x20, Data: pgChange('I', pgTuple('N', "1", "Chihiro"))},
+			{WALStart: 0x30, Data: pgChange('I', pgTuple('N', "2", "Haku"))},
+			{WALStart: 0x40, Data: pgCommit(0x50)},
+		}
+
+		run := NewRun(task, &store.TaskRun{ID: 1})
+		assert.NoError(t, cdc.Run(ctx, run))
+		assert.Equal(t, int64(2), *run.Record.RowsAffected)
+		assert.Empty(t, stream.acked)
+
+		// Nothing is published or checkpointed before the run succeeds.
+		assert.NoFileExists(t, filepath.Join(target, "run-1.jsonl"))
+		_, err := cdc.store.TaskState.Get(ctx, 3, CDCPositionKey)
+		assert.ErrorIs(t, err, store.ErrNotFound)
+
+		assert.NoError(t, run.complete(ctx, nil))
+		lines := readLines(t, filepath.Join(target, "run-1.jsonl"))
+		assert.Len(t, lines, 2)
+		assert.JSONEq(t, `{"id": 2, "name": "Haku"}`, string(mustMarshal(lines[1]["after"])))
+		state, _ := cdc.store.TaskState.Get(ctx, 3, CDCPositionKey)
+		assert.Equal(t, "0/50", state.Value)
+	})
+
+	t.Run("next run resumes from the checkpoint", func(t *testing.T) {
+		expectSetup(t, true, true)
+		stream.messages = []walData{
+			{WALStart: 0x60, Data: pgBegin(8)},
+			{WALStart: 0x60, Data: pgRelationMessage()},
+			{WALStart: 0x70, Data: pgChange('D', pgTuple('K', "1", nil))},
+			{WALStart: 0x80, Data: pgCommit(0x90)},
+		}
+
+		run := NewRun(task, &store.TaskRun{ID: 2})
+		assert.NoError(t, cdc.Run(ctx, run))
+		assert.Equal(t, []LSN{0x50}, stream.acked)
+		assert.Equal(t, int64(1), *run.Record.RowsAffected)
+		assert.Len(t, run.onSuccess, 1)
+
+		// The changes of the first run stay until they are read.
+		assert.NoError(t, run.complete(ctx, nil))
+		assert.Len(t, readLines(t, filepath.Join(target, "run-1.jsonl")), 2)
+		assert.Len(t, readLines(t, filepath.Join(target, "run-2.jsonl")), 1)
+	})
+
+	t.Run("idle run writes nothing", func(t *testing.T) {
+		expectSetup(t, true, true)
+		stream.messages = nil
+
+		run := NewRun(task, &store.TaskRun{ID: 3})
+		assert.NoError(t, cdc.Run(ctx, run))
+		assert.Empty(t, run.onSuccess)
+		assert.NoError(t, run.complete(ctx, nil))
+
+		entries, err := os.ReadDir(target)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 2)
+		state, _ := cdc.store.TaskState.Get(ctx, 3, CDCPositionKey)
+		assert.Equal(t, "0/90", state.Value)
+	})
+
+	t.Run("stops at a transaction boundary", func(t *testing.T) {
+		expectSetup(t, true, true)
+		stream.messages = []walData{
+			{WALStart: 0x60, Data: pgRelationMessage()},
+			{WALStart: 0x60, Data: pgBegin(8)},
+			{WALStart: 0x70, Data: pgChange('I', pgTuple('N', "3", "Lin"))},
+		}
+
+		run := NewRun(task, &store.TaskRun{ID: 4})
+		ctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+
+		err := cdc.Run(ctx, run)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Empty(t, run.onSuccess)
+	})
+
+}
+
+func readLines(t *testing.T, path string) []map[string]any {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var lines []map[string]any
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line map[string]any
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func mustMarshal(v any) []byte {
+	b, _ := json.Marshal(v)
+	return b
+}
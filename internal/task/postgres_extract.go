@@ -0,0 +1,250 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/jackc/pgx/v5"
+)
+
+const PostgresExtractType = "postgres.extract"
+
+const defaultExtractTimeout = time.Hour
+
+type PostgresExtractConfig struct {
+	Connection string `json:"connection" validate:"required"`
+	// Either Table or Query selects the rows to extract.
+	Table      string `json:"table"`
+	Query      string `json:"query"`
+	TargetPath string `json:"target_path" validate:"required"`
+	// Incremental reads the rows in cursor order, which a checkpoint
+	// requires.
+	Incremental *IncrementalConfig `json:"incremental"`
+	Timeout     string             `json:"timeout"`
+	OutputConfig
+}
+
+func (PostgresExtractConfig) resumable() {}
+
+// PostgresExtract extracts the rows of a table or query into a JSON lines
+// file.
+type PostgresExtract struct {
+	store store.Storage
+	open  func(store.Connection) (*sql.DB, error)
+}
+
+func NewPostgresExtract(storage store.Storage) *PostgresExtract {
+	return &PostgresExtract{
+		store: storage,
+		open:  openPostgres,
+	}
+}
+
+func (p *PostgresExtract) Validate(ctx context.Context, task store.Task) error {
+	cfg, err := p.config(task)
+	if err != nil {
+		return err
+	}
+
+	_, err = taskConnection(ctx, p.store, task, cfg.Connection)
+	return err
+}
+
+func (p *PostgresExtract) config(task store.Task) (PostgresExtractConfig, error) {
+	var cfg PostgresExtractConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if (cfg.Table == "") == (cfg.Query == "") {
+		return cfg, errors.New("exactly one of table or query is required")
+	}
+
+	if err := validateOutputPath(cfg.TargetPath); err != nil {
+		return cfg, err
+	}
+
+	if cfg.Incremental != nil {
+		if err := cfg.Incremental.validate(); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.Checkpoint != nil && cfg.Incremental == nil {
+		return cfg, errors.New("checkpoint requires incremental")
+	}
+
+	if _, err := parseTimeout(cfg.Timeout, defaultExtractTimeout); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// query builds the extraction query and its arguments. Incremental runs
+// only select rows past the high-water mark, in cursor order. A resumed
+// run starts again at the cursor value of its checkpoint, the rows of that
+// value already written being skipped as they are read, which is exact as
+// long as rows sharing a cursor value come back in the same order.
+func (c PostgresExtractConfig) query(mark *watermark, resume *SourcePosition) (string, []any) {
+	source := c.Query
+	if c.Table != "" {
+		source = "SELECT * FROM " + tableIdentifier(c.Table).Sanitize()
+	}
+
+	if c.Incremental == nil {
+		return source, nil
+	}
+
+	cursor := pgx.Identifier{c.Incremental.Cursor}.Sanitize()
+	query := "SELECT * FROM (" + source + ") AS src"
+	var args []any
+	switch {
+	case resume != nil && resume.Cursor != "":
+		query += " WHERE " + cursor + " >= $1"
+		args = append(args, resume.Cursor)
+	case mark.from != "":
+		query += " WHERE " + cursor + " > $1"
+		args = append(args, mark.from)
+	}
+	query += " ORDER BY " + cursor
+
+	return query, args
+}
+
+func (p *PostgresExtract) Run(ctx context.Context, run *Run) error {
+	cfg, err := p.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	timeout, _ := parseTimeout(cfg.Timeout, defaultExtractTimeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := taskConnection(ctx, p.store, run.Task, cfg.Connection)
+	if err != nil {
+		return err
+	}
+
+	var mark *watermark
+	resume := run.resumeFrom()
+	if cfg.Incremental != nil {
+		mark, err = loadWatermark(ctx, p.store, run.Task.ID, cfg.Incremental)
+		if err != nil {
+			return err
+		}
+		switch {
+		case resume != nil && resume.Cursor != "":
+			// The rows written before the checkpoint count towards the
+			// high-water mark.
+			if err := mark.Observe(resume.Cursor); err != nil {
+				return err
+			}
+			run.Log.Printf("extracting rows with %s >= %s", cfg.Incremental.Cursor, resume.Cursor)
+		case mark.from == "":
+			run.Log.Printf("no high-water mark, running a full load")
+		default:
+			run.Log.Printf("extracting rows with %s > %s", cfg.Incremental.Cursor, mark.from)
+		}
+	}
+
+	db, err := p.open(conn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	query, args := cfg.query(mark, resume)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	// The tables of a query are not known.
+	if cfg.Table != "" {
+		run.Reads(cfg.Connection, cfg.Table)
+	}
+
+	sink, err := newJSONLOutput(run, cfg.TargetPath, cfg.Partition)
+	if err != nil {
+		return err
+	}
+
+	// The position of an incremental extraction is the cursor value of the
+	// last row written, rows being read in cursor order.
+	source := &readerSource{name: PostgresExtractType, seeks: true}
+	var skip int64
+	if resume != nil {
+		skip = resume.Ties
+	}
+	source.read = func(ctx context.Context, w record.Writer) error {
+		// The rows of the cursor value of the checkpoint are counted again
+		// as they are read.
+		source.pos.Ties = 0
+		for rows.Next() {
+			r, err := scanRecord(rows, columns)
+			if err != nil {
+				return err
+			}
+
+			if mark != nil {
+				if err := mark.Observe(r[cfg.Incremental.Cursor]); err != nil {
+					return err
+				}
+				pos := &source.pos
+				if cursor := mark.Value(); cursor == pos.Cursor {
+					pos.Ties++
+				} else {
+					pos.Cursor, pos.Ties = cursor, 1
+				}
+				if skip > 0 && pos.Cursor == resume.Cursor && pos.Ties <= skip {
+					continue
+				}
+			}
+
+			if err := w.Write(r); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	}
+	stats, err := runPipeline(ctx, run, nil, source, sink)
+	if err != nil {
+		return err
+	}
+
+	run.Log.Printf("extracted %d rows into %s", stats.Written(), cfg.TargetPath)
+
+	if mark != nil {
+		mark.CommitOnSuccess(run, p.store)
+	}
+	return nil
+}
+
+// scanRecord scans the current row into a record keyed by column name.
+func scanRecord(rows *sql.Rows, columns []string) (map[string]any, error) {
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+
+	r := make(map[string]any, len(columns))
+	for i, column := range columns {
+		r[column] = values[i]
+	}
+	return r, nil
+}
@@ -0,0 +1,299 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/jackc/pgx/v5"
+)
+
+const PostgresSCD2Type = "postgres.scd2"
+
+const (
+	DeletesIgnore string = "ignore"
+	DeletesClose  string = "close"
+)
+
+// scd2Source names the snapshot of the source rows a merge works from.
+const scd2Source = "haku_scd2_source"
+
+type PostgresSCD2Config struct {
+	// Connection is the name of a postgres connection of the organization.
+	Connection string `json:"connection" validate:"required"`
+	// Either SourceTable or SourceQuery selects the current state of the
+	// dimension, one row per business key.
+	SourceTable string `json:"source_table"`
+	SourceQuery string `json:"source_query"`
+	// TargetTable holds the history. It may be schema qualified.
+	TargetTable string `json:"target_table" validate:"required"`
+	// Keys are the business key columns. A source row with a null key
+	// fails the run, as a null never matches the key of a version.
+	Keys []string `json:"keys" validate:"required,min=1"`
+	// Tracked columns start a new version when they change.
+	Tracked []string `json:"tracked" validate:"required,min=1"`
+	// ValidFrom, ValidTo and Current name the history columns of the target
+	// table, valid_from, valid_to and is_current by default. The current
+	// version of a key has a null valid_to.
+	ValidFrom string `json:"valid_from"`
+	ValidTo   string `json:"valid_to"`
+	Current   string `json:"current"`
+	// Deletes is what happens to keys missing from the source. They are
+	// ignored by default, close ends their current version.
+	Deletes string `json:"deletes" validate:"omitempty,oneof=ignore close"`
+	Timeout string `json:"timeout"`
+}
+
+// PostgresSCD2 merges the current state of a dimension into a type 2
+// slowly changing dimension table, in a single transaction.
+type PostgresSCD2 struct {
+	store store.Storage
+	open  func(store.Connection) (*sql.DB, error)
+}
+
+func NewPostgresSCD2(storage store.Storage) *PostgresSCD2 {
+	return &PostgresSCD2{
+		store: storage,
+		open:  openPostgres,
+	}
+}
+
+func (p *PostgresSCD2) Validate(ctx context.Context, task store.Task) error {
+	cfg, err := p.config(task)
+	if err != nil {
+		return err
+	}
+
+	_, err = taskConnection(ctx, p.store, task, cfg.Connection)
+	return err
+}
+
+func (p *PostgresSCD2) config(task store.Task) (PostgresSCD2Config, error) {
+	var cfg PostgresSCD2Config
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if cfg.ValidFrom == "" {
+		cfg.ValidFrom = "valid_from"
+	}
+	if cfg.ValidTo == "" {
+		cfg.ValidTo = "valid_to"
+	}
+	if cfg.Current == "" {
+		cfg.Current = "is_current"
+	}
+	if cfg.Deletes == "" {
+		cfg.Deletes = DeletesIgnore
+	}
+
+	if (cfg.SourceTable == "") == (cfg.SourceQuery == "") {
+		return cfg, errors.New("exactly one of source_table or source_query is required")
+	}
+	if cfg.SourceTable != "" && !validTableName(cfg.SourceTable) {
+		return cfg, fmt.Errorf("invalid source_table %q", cfg.SourceTable)
+	}
+	if !validTableName(cfg.TargetTable) {
+		return cfg, fmt.Errorf("invalid target_table %q", cfg.TargetTable)
+	}
+
+	columns := slices.Concat(cfg.Keys, cfg.Tracked, []string{cfg.ValidFrom, cfg.ValidTo, cfg.Current})
+	if err := uniqueColumns(columns); err != nil {
+		return cfg, fmt.Errorf("keys, tracked and history columns: %w", err)
+	}
+
+	if _, err := parseTimeout(cfg.Timeout, defaultSQLTimeout); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func (p *PostgresSCD2) Run(ctx context.Context, run *Run) error {
+	cfg, err := p.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	timeout, _ := parseTimeout(cfg.Timeout, defaultSQLTimeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := taskConnection(ctx, p.store, run.Task, cfg.Connection)
+	if err != nil {
+		return err
+	}
+	run.Reads(cfg.Connection, cfg.SourceTable)
+	run.Writes(cfg.Connection, cfg.TargetTable)
+
+	db, err := p.open(conn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	m := cfg.merge()
+
+	// The source is read once, so every statement sees the same rows.
+	if _, err := tx.ExecContext(ctx, m.snapshot()); err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+
+	var nullKey bool
+	if err := tx.QueryRowContext(ctx, m.nullKey()).Scan(&nullKey); err != nil {
+		return err
+	}
+	if nullKey {
+		return errors.New("source has a row with a null key")
+	}
+
+	var duplicate string
+	err = tx.QueryRowContext(ctx, m.duplicateKey()).Scan(&duplicate)
+	switch {
+	case err == nil:
+		return fmt.Errorf("source has more than one row for key %s", duplicate)
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	changed, err := execRows(ctx, tx, m.closeChanged())
+	if err != nil {
+		return fmt.Errorf("closing changed rows: %w", err)
+	}
+
+	var deleted int64
+	if cfg.Deletes == DeletesClose {
+		deleted, err = execRows(ctx, tx, m.closeDeleted())
+		if err != nil {
+			return fmt.Errorf("closing deleted rows: %w", err)
+		}
+	}
+
+	inserted, err := execRows(ctx, tx, m.insertVersions())
+	if err != nil {
+		return fmt.Errorf("inserting versions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	run.Log.Printf("merged into %s: %d new keys, %d changed, %d deleted",
+		cfg.TargetTable, inserted-changed, changed, deleted)
+	run.SetRowsAffected(changed + deleted + inserted)
+	return nil
+}
+
+// scd2Merge builds the statements of a merge.
+type scd2Merge struct {
+	cfg    PostgresSCD2Config
+	target string
+	source string
+}
+
+func (c PostgresSCD2Config) merge() scd2Merge {
+	source := c.SourceQuery
+	if c.SourceTable != "" {
+		source = "SELECT * FROM " + tableIdentifier(c.SourceTable).Sanitize()
+	}
+	return scd2Merge{
+		cfg:    c,
+		target: tableIdentifier(c.TargetTable).Sanitize(),
+		source: source,
+	}
+}
+
+func (m scd2Merge) snapshot() string {
+	return "CREATE TEMPORARY TABLE " + scd2Source + " ON COMMIT DROP AS " + m.source
+}
+
+func (m scd2Merge) nullKey() string {
+	conds := make([]string, len(m.cfg.Keys))
+	for i, k := range m.cfg.Keys {
+		conds[i] = pgx.Identifier{k}.Sanitize() + " IS NULL"
+	}
+	return "SELECT EXISTS (SELECT 1 FROM " + scd2Source + " WHERE " + strings.Join(conds, " OR ") + ")"
+}
+
+func (m scd2Merge) duplicateKey() string {
+	keys := identifiers("", m.cfg.Keys)
+	return "SELECT concat_ws(', ', " + keys + ") FROM " + scd2Source +
+		" GROUP BY " + keys + " HAVING count(*) > 1 LIMIT 1"
+}
+
+// closeChanged ends the current version of keys whose tracked columns
+// changed.
+func (m scd2Merge) closeChanged() string {
+	changes := make([]string, len(m.cfg.Tracked))
+	for i, c := range m.cfg.Tracked {
+		column := pgx.Identifier{c}.Sanitize()
+		changes[i] = "t." + column + " IS DISTINCT FROM s." + column
+	}
+	return m.close() + " FROM " + scd2Source + " AS s" +
+		" WHERE " + m.current() + " AND " + m.sameKey() +
+		" AND (" + strings.Join(changes, " OR ") + ")"
+}
+
+// closeDeleted ends the current version of keys missing from the source.
+func (m scd2Merge) closeDeleted() string {
+	return m.close() +
+		" WHERE " + m.current() +
+		" AND NOT EXISTS (SELECT 1 FROM " + scd2Source + " AS s WHERE " + m.sameKey() + ")"
+}
+
+// insertVersions starts a version for the keys without a current one, the
+// new keys and the ones just closed.
+func (m scd2Merge) insertVersions() string {
+	columns := slices.Concat(m.cfg.Keys, m.cfg.Tracked)
+	return "INSERT INTO " + m.target + " (" + identifiers("", columns) + ", " +
+		identifiers("", []string{m.cfg.ValidFrom, m.cfg.ValidTo, m.cfg.Current}) + ")" +
+		" SELECT " + identifiers("s.", columns) + ", now(), NULL, true" +
+		" FROM " + scd2Source + " AS s" +
+		" WHERE NOT EXISTS (SELECT 1 FROM " + m.target + " AS t WHERE " + m.current() + " AND " + m.sameKey() + ")"
+}
+
+func (m scd2Merge) close() string {
+	return "UPDATE " + m.target + " AS t SET " +
+		pgx.Identifier{m.cfg.ValidTo}.Sanitize() + " = now(), " +
+		pgx.Identifier{m.cfg.Current}.Sanitize() + " = false"
+}
+
+func (m scd2Merge) current() string {
+	return "t." + pgx.Identifier{m.cfg.Current}.Sanitize()
+}
+
+func (m scd2Merge) sameKey() string {
+	conds := make([]string, len(m.cfg.Keys))
+	for i, k := range m.cfg.Keys {
+		column := pgx.Identifier{k}.Sanitize()
+		conds[i] = "t." + column + " = s." + column
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// identifiers quotes and joins columns, each with an optional table alias
+// prefix.
+func identifiers(prefix string, columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = prefix + pgx.Identifier{c}.Sanitize()
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// validTableName reports whether table is a table name, optionally schema
+// qualified.
+func validTableName(table string) bool {
+	parts := strings.Split(table, ".")
+	return len(parts) <= 2 && !slices.Contains(parts, "")
+}
@@ -0,0 +1,159 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPostgresSCD2Test(t *testing.T) (*PostgresSCD2, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+
+	ctx := context.Background()
+	storage := store.NewMockStore()
+	storage.Pipelines.Create(ctx, &store.Pipelines{ID: 1, OrganizationID: 1})
+	storage.Connections.Create(ctx, &store.Connection{OrganizationID: 1, Name: "warehouse", Type: store.ConnectionPostgres})
+
+	scd2 := NewPostgresSCD2(storage)
+	scd2.open = func(store.Connection) (*sql.DB, error) {
+		return db, nil
+	}
+
+	return scd2, mock
+}
+
+func TestPostgresSCD2_Validate(t *testing.T) {
+	scd2, _ := newPostgresSCD2Test(t)
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{name: "valid", config: `{"connection": "warehouse", "source_table": "staging.customers", "target_table": "dim.customers", "keys": ["id"], "tracked": ["name"], "deletes": "close"}`},
+		{name: "unknown connection", config: `{"connection": "lake", "source_table": "s", "target_table": "t", "keys": ["id"], "tracked": ["name"]}`, wantErr: `connection "lake" not found`},
+		{name: "no source", config: `{"connection": "warehouse", "target_table": "t", "keys": ["id"], "tracked": ["name"]}`, wantErr: "exactly one of source_table or source_query is required"},
+		{name: "bad target", config: `{"connection": "warehouse", "source_table": "s", "target_table": "a.b.c", "keys": ["id"], "tracked": ["name"]}`, wantErr: `invalid target_table "a.b.c"`},
+		{name: "key tracked", config: `{"connection": "warehouse", "source_table": "s", "target_table": "t", "keys": ["id"], "tracked": ["id"]}`, wantErr: `keys, tracked and history columns: duplicate column "id"`},
+		{name: "history tracked", config: `{"connection": "warehouse", "source_table": "s", "target_table": "t", "keys": ["id"], "tracked": ["valid_to"]}`, wantErr: `keys, tracked and history columns: duplicate column "valid_to"`},
+		{name: "bad deletes", config: `{"connection": "warehouse", "source_table": "s", "target_table": "t", "keys": ["id"], "tracked": ["name"], "deletes": "purge"}`, wantErr: "Deletes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := scd2.Validate(context.Background(), store.Task{PipelineID: 1, Config: json.RawMessage(tt.config)})
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPostgresSCD2_Run(t *testing.T) {
+	scd2, mock := newPostgresSCD2Test(t)
+
+	config := `{
+		"connection": "warehouse",
+		"source_query": "SELECT id, region, name, tier FROM staging.customers",
+		"target_table": "dim.customers",
+		"keys": ["id", "region"],
+		"tracked": ["name", "tier"],
+		"current": "active",
+		"deletes": "close"
+	}`
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TEMPORARY TABLE haku_scd2_source ON COMMIT DROP AS SELECT id, region, name, tier FROM staging.customers`).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectQuery(`SELECT EXISTS (SELECT 1 FROM haku_scd2_source WHERE "id" IS NULL OR "region" IS NULL)`).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(`SELECT concat_ws(', ', "id", "region") FROM haku_scd2_source GROUP BY "id", "region" HAVING count(*) > 1 LIMIT 1`).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(`UPDATE "dim"."customers" AS t SET "valid_to" = now(), "active" = false FROM haku_scd2_source AS s` +
+		` WHERE t."active" AND t."id" = s."id" AND t."region" = s."region"` +
+		` AND (t."name" IS DISTINCT FROM s."name" OR t."tier" IS DISTINCT FROM s."tier")`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE "dim"."customers" AS t SET "valid_to" = now(), "active" = false` +
+		` WHERE t."active" AND NOT EXISTS (SELECT 1 FROM haku_scd2_source AS s WHERE t."id" = s."id" AND t."region" = s."region")`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO "dim"."customers" ("id", "region", "name", "tier", "valid_from", "valid_to", "active")` +
+		` SELECT s."id", s."region", s."name", s."tier", now(), NULL, true FROM haku_scd2_source AS s` +
+		` WHERE NOT EXISTS (SELECT 1 FROM "dim"."customers" AS t WHERE t."active" AND t."id" = s."id" AND t."region" = s."region")`).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+	mock.ExpectClose()
+
+	run := NewRun(store.Task{ID: 1, PipelineID: 1, Config: json.RawMessage(config)}, &store.TaskRun{ID: 7})
+	err := scd2.Run(context.Background(), run)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), *run.Record.RowsAffected)
+	assert.Contains(t, run.Log.String(), "merged into dim.customers: 1 new keys, 2 changed, 1 deleted")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresSCD2_RunDuplicateKey(t *testing.T) {
+	scd2, mock := newPostgresSCD2Test(t)
+
+	config := `{"connection": "warehouse", "source_table": "staging.customers", "target_table": "customers", "keys": ["id"], "tracked": ["name"]}`
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TEMPORARY TABLE haku_scd2_source ON COMMIT DROP AS SELECT * FROM "staging"."customers"`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(`SELECT EXISTS (SELECT 1 FROM haku_scd2_source WHERE "id" IS NULL)`).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(`SELECT concat_ws(', ', "id") FROM haku_scd2_source GROUP BY "id" HAVING count(*) > 1 LIMIT 1`).
+		WillReturnRows(sqlmock.NewRows([]string{"concat_ws"}).AddRow("42"))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	run := NewRun(store.Task{ID: 1, PipelineID: 1, Config: json.RawMessage(config)}, &store.TaskRun{ID: 7})
+	err := scd2.Run(context.Background(), run)
+
+	assert.EqualError(t, err, "source has more than one row for key 42")
+	assert.Nil(t, run.Record.RowsAffected)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgresSCD2_RunNullKey(t *testing.T) {
+	config := `{"connection": "warehouse", "source_table": "staging.customers", "target_table": "customers", "keys": ["id"], "tracked": ["name"]}`
+	task := store.Task{ID: 1, PipelineID: 1, Config: json.RawMessage(config)}
+
+	scd2, mock := newPostgresSCD2Test(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TEMPORARY TABLE haku_scd2_source ON COMMIT DROP AS SELECT * FROM "staging"."customers"`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(`SELECT EXISTS (SELECT 1 FROM haku_scd2_source WHERE "id" IS NULL)`).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	run := NewRun(task, &store.TaskRun{ID: 7})
+	err := scd2.Run(context.Background(), run)
+
+	assert.EqualError(t, err, "source has a row with a null key")
+	assert.Nil(t, run.Record.RowsAffected)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+var ErrNotPreviewable = errors.New("task type cannot be previewed")
+
+const (
+	DefaultPreviewLimit   = 100
+	DefaultPreviewTimeout = 30 * time.Second
+)
+
+// previewTypes are the task types whose runs only have side effects
+// through their sink and the functions they register with OnSuccess,
+// which a preview replaces and skips.
+var previewTypes = map[string]bool{
+	PostgresExtractType:    true,
+	HTTPExtractType:        true,
+	FileIngestType:         true,
+	AvroReadType:           true,
+	AvroWriteType:          true,
+	FixedWidthReadType:     true,
+	XLSXReadType:           true,
+	XMLReadType:            true,
+	TransformMapType:       true,
+	TransformJoinType:      true,
+	TransformAggregateType: true,
+	TransformDedupeType:    true,
+	TransformMaskType:      true,
+}
+
+// Preview is a sample of the records a task writes.
+type Preview struct {
+	Schema  record.Schema   `json:"schema"`
+	Records []record.Record `json:"records"`
+	Logs    string          `json:"logs"`
+}
+
+// previewSink keeps the first records a preview run writes, in place of
+// the sink of its task.
+type previewSink struct {
+	limit   int
+	records []record.Record
+}
+
+func (s *previewSink) Name() string {
+	return "preview"
+}
+
+func (s *previewSink) Write(ctx context.Context, batch record.Batch) error {
+	for _, r := range batch {
+		if len(s.records) < s.limit {
+			s.records = append(s.records, r)
+		}
+	}
+	return nil
+}
+
+func (s *previewSink) Commit(ctx context.Context) error {
+	return nil
+}
+
+func (s *previewSink) Abort() {}
+
+// PreviewTask runs a task on the first limit records of its source and
+// returns what it writes. Its outputs go to a temporary directory and its
+// OnSuccess functions never run, so the preview leaves no trace. The
+// upstream tasks of the pipeline writing its source are previewed first,
+// and their sample is read instead of the file.
+func PreviewTask(ctx context.Context, storage store.Storage, registry *Registry, task store.Task, limit int, timeout time.Duration) (*Preview, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "haku-preview-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	p := &previewer{
+		storage:  storage,
+		registry: registry,
+		limit:    limit,
+		dir:      dir,
+		visited:  make(map[int64]bool),
+	}
+	return p.preview(ctx, task)
+}
+
+type previewer struct {
+	storage  store.Storage
+	registry *Registry
+	limit    int
+	dir      string
+	visited  map[int64]bool
+}
+
+func (p *previewer) preview(ctx context.Context, task store.Task) (*Preview, error) {
+	if !previewTypes[task.Type] {
+		return nil, fmt.Errorf("%w: %q", ErrNotPreviewable, task.Type)
+	}
+	if p.visited[task.ID] {
+		return nil, errors.New("the pipeline reads its own output in a loop")
+	}
+	p.visited[task.ID] = true
+
+	handler, err := p.registry.Get(task.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	log := NewLog()
+	task.Config, err = p.sandbox(ctx, task, log)
+	if err != nil {
+		return nil, err
+	}
+
+	run := NewRun(task, &store.TaskRun{})
+	run.Log = log
+	sink := &previewSink{limit: p.limit}
+	run.preview = sink
+
+	err = handler.Run(ctx, run)
+	run.discard()
+	if err != nil {
+		return nil, fmt.Errorf("task %q: %w", task.Name, err)
+	}
+
+	return &Preview{
+		Schema:  record.Infer(sink.records),
+		Records: sink.records,
+		Logs:    log.String(),
+	}, nil
+}
+
+// sandbox rewrites the paths of a task configuration into the preview
+// directory. A source written by an upstream task is replaced with the
+// preview of that task.
+func (p *previewer) sandbox(ctx context.Context, task store.Task, log *Log) (json.RawMessage, error) {
+	var cfg map[string]json.RawMessage
+	if err := json.Unmarshal(task.Config, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	name := fmt.Sprintf("task-%d", task.ID)
+	if _, ok := cfg["target_path"]; ok {
+		cfg["target_path"], _ = json.Marshal(filepath.Join(p.dir, name+".jsonl"))
+	}
+
+	if raw, ok := cfg["dead_letter"]; ok && string(raw) != "null" {
+		var dl map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &dl); err != nil {
+			return nil, fmt.Errorf("invalid dead_letter: %w", err)
+		}
+		dl["path"], _ = json.Marshal(filepath.Join(p.dir, name+".rejects"))
+		cfg["dead_letter"], _ = json.Marshal(dl)
+	}
+
+	var source string
+	if raw, ok := cfg["source_path"]; ok {
+		json.Unmarshal(raw, &source)
+	}
+	upstream, err := p.upstream(ctx, task, source)
+	if err != nil {
+		return nil, err
+	}
+	if upstream != nil {
+		if !previewTypes[upstream.Type] {
+			log.Printf("upstream task %q cannot be previewed, reading %s", upstream.Name, source)
+		} else {
+			sample, err := p.preview(ctx, *upstream)
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("reading %d records previewed from upstream task %q", len(sample.Records), upstream.Name)
+
+			path := filepath.Join(p.dir, name+".source.jsonl")
+			if err := writePreview(path, sample.Records); err != nil {
+				return nil, err
+			}
+			cfg["source_path"], _ = json.Marshal(path)
+		}
+	}
+
+	return json.Marshal(cfg)
+}
+
+// upstream returns the task of the same pipeline writing to path, if any.
+func (p *previewer) upstream(ctx context.Context, task store.Task, path string) (*store.Task, error) {
+	if path == "" || task.PipelineID == 0 {
+		return nil, nil
+	}
+
+	tasks, err := p.storage.Tasks.GetByPipeline(ctx, task.PipelineID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tasks {
+		if t.ID != task.ID && targetPath(t) == path {
+			return &t, nil
+		}
+	}
+	return nil, nil
+}
+
+func writePreview(path string, records []record.Record) error {
+	out, err := createJSONL(nil, path)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := out.Write(r); err != nil {
+			out.Abort()
+			return err
+		}
+	}
+	return out.Commit()
+}
@@ -0,0 +1,74 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreviewTask(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "orders.jsonl")
+	mapped := filepath.Join(dir, "mapped.jsonl")
+	unique := filepath.Join(dir, "unique.jsonl")
+	data := `{"id": 1, "customer": "chihiro", "note": "x"}` + "\n" +
+		`{"id": 1, "customer": "chihiro", "note": "y"}` + "\n" +
+		`{"id": 2, "customer": "haku", "note": "z"}` + "\n" +
+		`{"id": 3, "customer": "lin", "note": "w"}` + "\n"
+	assert.NoError(t, os.WriteFile(source, []byte(data), 0o644))
+
+	ctx := context.Background()
+	storage := store.NewMockStore()
+	registry := NewRegistry()
+	registry.Register(TransformMapType, NewTransformMap(storage, registry))
+	registry.Register(TransformDedupeType, NewTransformDedupe(storage, registry))
+	registry.Register(ShellExecType, NewShellExec())
+
+	mapTask := &store.Task{PipelineID: 1, Name: "map", Type: TransformMapType, Config: mustMarshal(TransformMapConfig{
+		SourcePath: source,
+		TargetPath: mapped,
+		Steps:      []MapStep{{Op: MapDrop, Columns: []string{"note"}}},
+		DeadLetter: &DeadLetterConfig{Path: filepath.Join(dir, "rejects")},
+	})}
+	dedupeTask := &store.Task{PipelineID: 1, Name: "dedupe", Type: TransformDedupeType, Config: mustMarshal(TransformDedupeConfig{
+		SourcePath: mapped,
+		TargetPath: unique,
+		Keys:       []string{"id"},
+	})}
+	assert.NoError(t, storage.Tasks.Create(ctx, mapTask))
+	assert.NoError(t, storage.Tasks.Create(ctx, dedupeTask))
+
+	preview, err := PreviewTask(ctx, storage, registry, *dedupeTask, 3, time.Minute)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []record.Record{
+		{"id": json.Number("1"), "customer": "chihiro"},
+		{"id": json.Number("2"), "customer": "haku"},
+	}, preview.Records)
+	assert.Equal(t, []record.Field{
+		{Name: "customer", Type: record.TypeString},
+		{Name: "id", Type: record.TypeInteger},
+	}, preview.Schema.Fields)
+	assert.Contains(t, preview.Logs, `reading 3 records previewed from upstream task "map"`)
+
+	for _, path := range []string{mapped, unique, filepath.Join(dir, "rejects")} {
+		assert.NoFileExists(t, path)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, ".*"))
+	assert.Empty(t, matches)
+
+	t.Run("tasks with other side effects", func(t *testing.T) {
+		shell := store.Task{Type: ShellExecType, Config: []byte(`{"command": "touch", "args": ["x"]}`)}
+		_, err := PreviewTask(ctx, storage, registry, shell, 3, time.Minute)
+		assert.ErrorIs(t, err, ErrNotPreviewable)
+	})
+}
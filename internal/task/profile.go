@@ -0,0 +1,465 @@
+package task
+
+import (
+	"cmp"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+const ProfileType = "profile"
+
+const (
+	defaultProfileTopK = 10
+	// profileCounters is the number of distinct values counted per column
+	// for the top values. Beyond it, the least frequent value counted is
+	// replaced and the counts become upper bounds.
+	profileCounters = 1000
+	// hllPrecision sets the 2^p registers of the distinct estimates, for a
+	// standard error of about 1.6%.
+	hllPrecision = 12
+)
+
+type ProfileConfig struct {
+	SourcePath string `json:"source_path" validate:"required"`
+	// Columns limits the profile to some columns, every column of the
+	// source by default.
+	Columns []string `json:"columns"`
+	// TopK is the number of most frequent values kept per column.
+	TopK int `json:"top_k" validate:"omitempty,min=1,max=100"`
+}
+
+// Profile computes statistics for every column of a JSON lines file: the
+// share of nulls, an estimate of the distinct values, the range, mean and
+// standard deviation of numbers, the most frequent values and a histogram
+// of string lengths. The statistics are stored with the run, one profile
+// per column, to follow the health of a dataset across runs.
+type Profile struct {
+	store    store.Storage
+	registry *Registry
+}
+
+func NewProfile(storage store.Storage, registry *Registry) *Profile {
+	return &Profile{store: storage, registry: registry}
+}
+
+// Validate checks the configuration and, when the schema of the upstream
+// records is known, that the columns exist.
+func (p *Profile) Validate(ctx context.Context, task store.Task) error {
+	cfg, err := p.config(task)
+	if err != nil {
+		return err
+	}
+
+	schema, err := upstreamSchema(ctx, p.store, p.registry, task, cfg.SourcePath)
+	if err != nil || schema == nil {
+		return err
+	}
+	return requireColumns(*schema, cfg.Columns...)
+}
+
+func (p *Profile) config(task store.Task) (ProfileConfig, error) {
+	var cfg ProfileConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if err := validateSourcePath(cfg.SourcePath); err != nil {
+		return cfg, err
+	}
+	if err := uniqueColumns(cfg.Columns); err != nil {
+		return cfg, err
+	}
+	if cfg.TopK == 0 {
+		cfg.TopK = defaultProfileTopK
+	}
+	return cfg, nil
+}
+
+func (p *Profile) Run(ctx context.Context, run *Run) error {
+	cfg, err := p.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	sink := newProfileSink(cfg.Columns)
+	stats, err := runPipeline(ctx, run, nil, jsonlSource(ProfileType, cfg.SourcePath), sink)
+	if err != nil {
+		return err
+	}
+
+	columns := sink.columns()
+	profiles := make([]store.ColumnProfile, len(columns))
+	for i, c := range columns {
+		profiles[i] = store.ColumnProfile{
+			RunID:  run.Record.ID,
+			TaskID: run.Task.ID,
+			Column: c.name,
+		}
+		profiles[i].Stats, err = json.Marshal(c.stats(sink.rows, cfg.TopK))
+		if err != nil {
+			return fmt.Errorf("column %s: %w", c.name, err)
+		}
+	}
+
+	if err := p.store.ColumnProfiles.Create(context.WithoutCancel(ctx), profiles); err != nil {
+		return fmt.Errorf("failed to store profiles: %w", err)
+	}
+	run.Log.Printf("profiled %d columns of %d records", len(profiles), stats.Written())
+	return nil
+}
+
+// ColumnStats are the statistics of a profiled column. Min and max are
+// the range of the numbers of the column, or of its strings when it holds
+// no numbers. Mean and stddev, the sample standard deviation, only cover
+// numbers.
+type ColumnStats struct {
+	Type             record.Type    `json:"type"`
+	Rows             int64          `json:"rows"`
+	Nulls            int64          `json:"nulls"`
+	NullPercent      float64        `json:"null_percent"`
+	DistinctEstimate int64          `json:"distinct_estimate"`
+	Min              any            `json:"min,omitempty"`
+	Max              any            `json:"max,omitempty"`
+	Mean             *float64       `json:"mean,omitempty"`
+	Stddev           *float64       `json:"stddev,omitempty"`
+	TopValues        []ValueCount   `json:"top_values"`
+	Lengths          []LengthBucket `json:"length_histogram,omitempty"`
+}
+
+// ValueCount is a value and the number of records holding it.
+type ValueCount struct {
+	Value any   `json:"value"`
+	Count int64 `json:"count"`
+}
+
+// LengthBucket counts the strings whose length in characters is between
+// min and max, inclusive.
+type LengthBucket struct {
+	Min   int   `json:"min"`
+	Max   int   `json:"max"`
+	Count int64 `json:"count"`
+}
+
+// profileSink feeds every record to the profiles of its columns.
+type profileSink struct {
+	only     []string
+	schema   record.Schema
+	profiles map[string]*columnProfile
+	rows     int64
+}
+
+func newProfileSink(columns []string) *profileSink {
+	s := &profileSink{only: columns, profiles: make(map[string]*columnProfile)}
+	for _, c := range columns {
+		s.profiles[c] = newColumnProfile(c)
+	}
+	return s
+}
+
+func (s *profileSink) Name() string {
+	return "profile"
+}
+
+func (s *profileSink) Write(ctx context.Context, batch record.Batch) error {
+	for _, r := range batch {
+		s.rows++
+		s.schema.Observe(r)
+		for name, v := range r {
+			if v == nil {
+				continue
+			}
+			p, ok := s.profiles[name]
+			if !ok {
+				if len(s.only) > 0 {
+					continue
+				}
+				p = newColumnProfile(name)
+				s.profiles[name] = p
+			}
+			p.observe(v)
+		}
+	}
+	return nil
+}
+
+func (s *profileSink) Commit(ctx context.Context) error {
+	return nil
+}
+
+func (s *profileSink) Abort() {}
+
+// columns returns the profiles in the order of the configured columns, or
+// else of the source schema.
+func (s *profileSink) columns() []*columnProfile {
+	names := s.only
+	if len(names) == 0 {
+		names = s.schema.Names()
+	}
+
+	columns := make([]*columnProfile, 0, len(names))
+	for _, name := range names {
+		p, ok := s.profiles[name]
+		if !ok {
+			p = newColumnProfile(name)
+		}
+		if f, ok := s.schema.Field(name); ok {
+			p.typ = f.Type
+		}
+		columns = append(columns, p)
+	}
+	return columns
+}
+
+// columnProfile holds the running statistics of a column. Nulls are not
+// observed; they are the records count misses.
+type columnProfile struct {
+	name  string
+	typ   record.Type
+	count int64
+
+	distinct hyperLogLog
+	top      *topValues
+
+	min, max       any
+	minStr, maxStr *string
+
+	// Running mean and sum of squared deviations, after Welford.
+	numbers int64
+	mean    float64
+	m2      float64
+
+	lengths map[int]int64
+}
+
+func newColumnProfile(name string) *columnProfile {
+	return &columnProfile{
+		name:    name,
+		typ:     record.TypeAny,
+		top:     newTopValues(profileCounters),
+		lengths: make(map[int]int64),
+	}
+}
+
+func (p *columnProfile) observe(v any) {
+	p.count++
+	key := valueKey(v)
+	p.distinct.add(key)
+	p.top.add(key, v)
+
+	if _, f, _, ok := toNumber(v); ok {
+		if p.min == nil || less(v, p.min) {
+			p.min = v
+		}
+		if p.max == nil || less(p.max, v) {
+			p.max = v
+		}
+
+		p.numbers++
+		delta := f - p.mean
+		p.mean += delta / float64(p.numbers)
+		p.m2 += delta * (f - p.mean)
+		return
+	}
+
+	if s, ok := v.(string); ok {
+		if p.minStr == nil || s < *p.minStr {
+			p.minStr = &s
+		}
+		if p.maxStr == nil || s > *p.maxStr {
+			p.maxStr = &s
+		}
+		p.lengths[lengthBucket(utf8.RuneCountInString(s))]++
+	}
+}
+
+// less orders two numbers.
+func less(a, b any) bool {
+	c, err := compareValues(a, b)
+	return err == nil && c < 0
+}
+
+func (p *columnProfile) stats(rows int64, k int) ColumnStats {
+	stats := ColumnStats{
+		Type:             p.typ,
+		Rows:             rows,
+		Nulls:            rows - p.count,
+		DistinctEstimate: p.distinct.estimate(),
+		TopValues:        p.top.top(k),
+	}
+	if rows > 0 {
+		stats.NullPercent = math.Round(float64(stats.Nulls)/float64(rows)*1e4) / 100
+	}
+
+	switch {
+	case p.numbers > 0:
+		stats.Min, stats.Max = p.min, p.max
+		mean := p.mean
+		stats.Mean = &mean
+		if p.numbers > 1 {
+			stddev := math.Sqrt(p.m2 / float64(p.numbers-1))
+			stats.Stddev = &stddev
+		}
+	case p.minStr != nil:
+		stats.Min, stats.Max = *p.minStr, *p.maxStr
+	}
+
+	for lo, count := range p.lengths {
+		stats.Lengths = append(stats.Lengths, LengthBucket{Min: lo, Max: max(lo*2-1, lo), Count: count})
+	}
+	slices.SortFunc(stats.Lengths, func(a, b LengthBucket) int {
+		return a.Min - b.Min
+	})
+	return stats
+}
+
+// lengthBucket returns the lower bound of the bucket of a length. Buckets
+// double in size: 0, 1, 2-3, 4-7, 8-15 and so on.
+func lengthBucket(n int) int {
+	if n == 0 {
+		return 0
+	}
+	return 1 << (bits.Len(uint(n)) - 1)
+}
+
+// hyperLogLog estimates the number of distinct keys added to it.
+type hyperLogLog struct {
+	registers [1 << hllPrecision]uint8
+}
+
+func (h *hyperLogLog) add(key string) {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	x := mix64(hash.Sum64())
+
+	i := x >> (64 - hllPrecision)
+	// The low bit set bounds the rank when the remaining bits are zeros.
+	w := x<<hllPrecision | 1<<(hllPrecision-1)
+	rank := uint8(bits.LeadingZeros64(w)) + 1
+	if rank > h.registers[i] {
+		h.registers[i] = rank
+	}
+}
+
+func (h *hyperLogLog) estimate() int64 {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// Small cardinalities are estimated from the empty registers.
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(e))
+}
+
+// mix64 spreads the bits of a hash, FNV leaving its high bits poorly
+// mixed for short keys.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// topValues counts the most frequent values with a bounded number of
+// counters, after the space-saving algorithm.
+type topValues struct {
+	capacity int
+	counters counterHeap
+	index    map[string]*counter
+}
+
+type counter struct {
+	key   string
+	value any
+	count int64
+	pos   int
+}
+
+func newTopValues(capacity int) *topValues {
+	return &topValues{capacity: capacity, index: make(map[string]*counter)}
+}
+
+func (t *topValues) add(key string, v any) {
+	if c, ok := t.index[key]; ok {
+		c.count++
+		heap.Fix(&t.counters, c.pos)
+		return
+	}
+
+	if len(t.counters) < t.capacity {
+		c := &counter{key: key, value: v, count: 1}
+		t.index[key] = c
+		heap.Push(&t.counters, c)
+		return
+	}
+
+	// The least frequent value gives its counter to the new one.
+	c := t.counters[0]
+	delete(t.index, c.key)
+	c.key, c.value = key, v
+	c.count++
+	t.index[key] = c
+	heap.Fix(&t.counters, 0)
+}
+
+// top returns the k most frequent values, ties ordered by value.
+func (t *topValues) top(k int) []ValueCount {
+	counters := slices.Clone(t.counters)
+	slices.SortFunc(counters, func(a, b *counter) int {
+		if c := cmp.Compare(b.count, a.count); c != 0 {
+			return c
+		}
+		return strings.Compare(a.key, b.key)
+	})
+
+	values := make([]ValueCount, 0, min(k, len(counters)))
+	for _, c := range counters[:min(k, len(counters))] {
+		values = append(values, ValueCount{Value: c.value, Count: c.count})
+	}
+	return values
+}
+
+// counterHeap is a min-heap of counters by count.
+type counterHeap []*counter
+
+func (h counterHeap) Len() int           { return len(h) }
+func (h counterHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+
+func (h counterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos = i
+	h[j].pos = j
+}
+
+func (h *counterHeap) Push(x any) {
+	c := x.(*counter)
+	c.pos = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *counterHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,103 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfile_Run(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "orders.jsonl")
+	data := `{"id": 1, "status": "paid", "amount": 10}` + "\n" +
+		`{"id": 2, "status": "paid", "amount": 20.5}` + "\n" +
+		`{"id": 3, "status": "open", "amount": null}` + "\n" +
+		`{"id": 4, "status": "cancelled"}` + "\n"
+	assert.NoError(t, os.WriteFile(source, []byte(data), 0o644))
+
+	storage := store.NewMockStore()
+	run, err := runTask(t, NewProfile(storage, NewRegistry()), ProfileType, ProfileConfig{SourcePath: source, TopK: 2})
+	assert.NoError(t, err)
+	assert.Contains(t, run.Log.String(), "profiled 3 columns of 4 records")
+
+	profiles, err := storage.ColumnProfiles.GetByRun(context.Background(), 1)
+	assert.NoError(t, err)
+	if !assert.Len(t, profiles, 3) {
+		return
+	}
+
+	stats := make(map[string]ColumnStats)
+	for _, p := range profiles {
+		var s ColumnStats
+		assert.NoError(t, json.Unmarshal(p.Stats, &s))
+		stats[p.Column] = s
+	}
+
+	amount := stats["amount"]
+	assert.Equal(t, record.TypeDecimal, amount.Type)
+	assert.Equal(t, int64(2), amount.Nulls)
+	assert.Equal(t, 50.0, amount.NullPercent)
+	assert.Equal(t, int64(2), amount.DistinctEstimate)
+	assert.Equal(t, 10.0, amount.Min)
+	assert.Equal(t, 20.5, amount.Max)
+	assert.InDelta(t, 15.25, *amount.Mean, 1e-9)
+	assert.InDelta(t, 7.4246, *amount.Stddev, 1e-4)
+	assert.Empty(t, amount.Lengths)
+
+	status := stats["status"]
+	assert.Equal(t, int64(0), status.Nulls)
+	assert.Equal(t, int64(3), status.DistinctEstimate)
+	assert.Equal(t, "cancelled", status.Min)
+	assert.Equal(t, "paid", status.Max)
+	assert.Nil(t, status.Mean)
+	assert.Equal(t, []ValueCount{{Value: "paid", Count: 2}, {Value: "cancelled", Count: 1}}, status.TopValues)
+	assert.Equal(t, []LengthBucket{{Min: 4, Max: 7, Count: 3}, {Min: 8, Max: 15, Count: 1}}, status.Lengths)
+
+	t.Run("columns", func(t *testing.T) {
+		storage := store.NewMockStore()
+		_, err := runTask(t, NewProfile(storage, NewRegistry()), ProfileType, ProfileConfig{SourcePath: source, Columns: []string{"status"}})
+		assert.NoError(t, err)
+
+		profiles, _ := storage.ColumnProfiles.GetByRun(context.Background(), 1)
+		if assert.Len(t, profiles, 1) {
+			assert.Equal(t, "status", profiles[0].Column)
+		}
+
+		_, err = runTask(t, NewProfile(storage, NewRegistry()), ProfileType, ProfileConfig{SourcePath: source, Columns: []string{"missing"}})
+		assert.EqualError(t, err, `unknown column "missing"`)
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		_, err := runTask(t, NewProfile(store.NewMockStore(), NewRegistry()), ProfileType, ProfileConfig{SourcePath: source, Columns: []string{"id", "id"}})
+		assert.Error(t, err)
+	})
+}
+
+func TestHyperLogLog(t *testing.T) {
+	var h hyperLogLog
+	for i := range 50000 {
+		h.add(fmt.Sprintf("n:%d", i))
+		h.add(fmt.Sprintf("n:%d", i))
+	}
+	assert.InEpsilon(t, 50000, h.estimate(), 0.05)
+}
+
+func TestTopValues(t *testing.T) {
+	top := newTopValues(3)
+	for _, v := range strings.Split("a a a b b c d e a b", " ") {
+		top.add(v, v)
+	}
+
+	values := top.top(2)
+	assert.Equal(t, "a", values[0].Value)
+	assert.Equal(t, int64(4), values[0].Count)
+	assert.Equal(t, "b", values[1].Value)
+}
@@ -0,0 +1,635 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+const QualityCheckType = "quality.check"
+
+const (
+	CheckNotNull        string = "not_null"
+	CheckUnique         string = "unique"
+	CheckAcceptedValues string = "accepted_values"
+	CheckRegex          string = "regex"
+	CheckRange          string = "range"
+	CheckRowCount       string = "row_count"
+	CheckFreshness      string = "freshness"
+	CheckRelationship   string = "relationship"
+)
+
+const (
+	// SeverityWarn checks are reported but leave the run successful.
+	SeverityWarn string = "warn"
+	// SeverityFail checks fail the run.
+	SeverityFail string = "fail"
+)
+
+// defaultQualitySamples is the number of failing records kept per check.
+const defaultQualitySamples = 5
+
+// QualityAssertion is one check of a quality.check task. Which fields
+// apply depends on the type:
+//
+//	not_null, unique: columns, unique checks their combination
+//	accepted_values:  column and values
+//	regex:            column and pattern, which values must match
+//	range:            column and min, max or both, inclusive
+//	row_count:        min, max or both, inclusive
+//	freshness:        column and max_age, such as "24h", the age of the
+//	                  most recent value must not exceed
+//	relationship:     column, reference_path and reference_column, the
+//	                  values must appear in the reference column
+//
+// Nulls only fail not_null checks. The name defaults to the type and the
+// columns, and severity to fail.
+type QualityAssertion struct {
+	Name            string   `json:"name"`
+	Type            string   `json:"type" validate:"required,oneof=not_null unique accepted_values regex range row_count freshness relationship"`
+	Severity        string   `json:"severity" validate:"omitempty,oneof=warn fail"`
+	Columns         []string `json:"columns"`
+	Column          string   `json:"column"`
+	Values          []any    `json:"values"`
+	Pattern         string   `json:"pattern"`
+	Min             *float64 `json:"min"`
+	Max             *float64 `json:"max"`
+	MaxAge          string   `json:"max_age"`
+	ReferencePath   string   `json:"reference_path"`
+	ReferenceColumn string   `json:"reference_column"`
+}
+
+type QualityCheckConfig struct {
+	SourcePath string `json:"source_path" validate:"required"`
+	// Samples caps the failing records kept per check.
+	Samples int                `json:"samples" validate:"omitempty,min=1,max=100"`
+	Checks  []QualityAssertion `json:"checks" validate:"required,min=1,dive"`
+}
+
+// QualityCheck asserts expectations about the records of a JSON lines
+// file. The results of every check are stored with the run, along with
+// samples of the failing records.
+type QualityCheck struct {
+	store    store.Storage
+	registry *Registry
+}
+
+func NewQualityCheck(storage store.Storage, registry *Registry) *QualityCheck {
+	return &QualityCheck{store: storage, registry: registry}
+}
+
+// Validate compiles the checks and, when the schema of the upstream
+// records is known, checks that their columns exist.
+func (q *QualityCheck) Validate(ctx context.Context, task store.Task) error {
+	cfg, _, err := q.config(task)
+	if err != nil {
+		return err
+	}
+
+	schema, err := upstreamSchema(ctx, q.store, q.registry, task, cfg.SourcePath)
+	if err != nil || schema == nil {
+		return err
+	}
+	for _, c := range cfg.Checks {
+		columns := c.Columns
+		if c.Column != "" {
+			columns = append(slices.Clone(columns), c.Column)
+		}
+		if err := requireColumns(*schema, columns...); err != nil {
+			return fmt.Errorf("check %q: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+func (q *QualityCheck) config(task store.Task) (QualityCheckConfig, []*assertion, error) {
+	var cfg QualityCheckConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, nil, err
+	}
+
+	if err := validateSourcePath(cfg.SourcePath); err != nil {
+		return cfg, nil, err
+	}
+	if cfg.Samples == 0 {
+		cfg.Samples = defaultQualitySamples
+	}
+
+	names := make(map[string]bool, len(cfg.Checks))
+	assertions := make([]*assertion, len(cfg.Checks))
+	for i := range cfg.Checks {
+		c := &cfg.Checks[i]
+		if c.Name == "" {
+			c.Name = defaultCheckName(*c)
+		}
+		if c.Severity == "" {
+			c.Severity = SeverityFail
+		}
+		if names[c.Name] {
+			return cfg, nil, fmt.Errorf("check %d: duplicate name %q", i+1, c.Name)
+		}
+		names[c.Name] = true
+
+		checker, err := compileAssertion(*c)
+		if err != nil {
+			return cfg, nil, fmt.Errorf("check %q: %w", c.Name, err)
+		}
+		assertions[i] = &assertion{QualityAssertion: *c, checker: checker, limit: cfg.Samples}
+	}
+
+	return cfg, assertions, nil
+}
+
+func defaultCheckName(c QualityAssertion) string {
+	columns := c.Columns
+	if c.Column != "" {
+		columns = []string{c.Column}
+	}
+	if len(columns) == 0 {
+		return c.Type
+	}
+	return fmt.Sprintf("%s(%s)", c.Type, strings.Join(columns, ", "))
+}
+
+func (q *QualityCheck) Run(ctx context.Context, run *Run) error {
+	cfg, assertions, err := q.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range assertions {
+		run.Reads("", a.ReferencePath)
+		if l, ok := a.checker.(interface{ load() error }); ok {
+			if err := l.load(); err != nil {
+				return fmt.Errorf("check %q: %w", a.Name, err)
+			}
+		}
+	}
+
+	sink := &qualitySink{assertions: assertions}
+	stats, err := runPipeline(ctx, run, nil, jsonlSource(QualityCheckType, cfg.SourcePath), sink)
+	if err != nil {
+		return err
+	}
+
+	results := make([]store.QualityResult, len(assertions))
+	var failed []string
+	warnings := 0
+	for i, a := range assertions {
+		results[i] = a.result(run.Record.ID, stats.Written())
+		switch {
+		case results[i].Passed:
+			run.Log.Printf("check %s passed", a.Name)
+		case a.Severity == SeverityWarn:
+			warnings++
+			run.Log.Printf("warning: check %s failed: %s", a.Name, results[i].Message)
+		default:
+			failed = append(failed, a.Name)
+			run.Log.Printf("check %s failed: %s", a.Name, results[i].Message)
+		}
+	}
+
+	// Results are kept for failed runs too, that is when they matter most.
+	if err := q.store.QualityResults.Create(context.WithoutCancel(ctx), results); err != nil {
+		return fmt.Errorf("failed to store check results: %w", err)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d checks failed: %s", len(failed), len(assertions), strings.Join(failed, ", "))
+	}
+	run.Log.Printf("%d records passed %d checks with %d warnings", stats.Written(), len(assertions), warnings)
+	return nil
+}
+
+// qualitySink hands every record to the checks.
+type qualitySink struct {
+	assertions []*assertion
+	rows       int64
+}
+
+func (s *qualitySink) Name() string {
+	return "quality"
+}
+
+func (s *qualitySink) Write(ctx context.Context, batch record.Batch) error {
+	for _, r := range batch {
+		s.rows++
+		for _, a := range s.assertions {
+			a.observe(s.rows, r)
+		}
+	}
+	return nil
+}
+
+func (s *qualitySink) Commit(ctx context.Context) error {
+	return nil
+}
+
+func (s *qualitySink) Abort() {}
+
+// qualitySample is a failing record and its 1-based position in the file.
+type qualitySample struct {
+	Record int64         `json:"record"`
+	Row    record.Record `json:"row"`
+}
+
+// assertion is a compiled QualityAssertion with its running counts.
+type assertion struct {
+	QualityAssertion
+	checker  checker
+	limit    int
+	failures int64
+	samples  []qualitySample
+}
+
+func (a *assertion) observe(n int64, r record.Record) {
+	if !a.checker.check(r) {
+		return
+	}
+	a.failures++
+	if len(a.samples) < a.limit {
+		a.samples = append(a.samples, qualitySample{Record: n, Row: r})
+	}
+}
+
+func (a *assertion) result(runID, rows int64) store.QualityResult {
+	failures, message := a.checker.finish(rows, a.failures)
+	result := store.QualityResult{
+		RunID:    runID,
+		Name:     a.Name,
+		Type:     a.Type,
+		Severity: a.Severity,
+		Passed:   failures == 0,
+		Failures: failures,
+		Message:  message,
+	}
+	if len(a.samples) > 0 {
+		result.Samples, _ = json.Marshal(a.samples)
+	}
+	return result
+}
+
+type checker interface {
+	// check reports whether a record fails the check.
+	check(r record.Record) bool
+	// finish returns the failures of the check once every record has been
+	// checked, and a message describing them. failures is the number of
+	// records check failed.
+	finish(rows, failures int64) (int64, string)
+}
+
+func compileAssertion(c QualityAssertion) (checker, error) {
+	// Reject the fields the type does not use, they are most likely meant
+	// for another type.
+	used := map[string]bool{
+		"columns":          c.Columns != nil,
+		"column":           c.Column != "",
+		"values":           c.Values != nil,
+		"pattern":          c.Pattern != "",
+		"min":              c.Min != nil,
+		"max":              c.Max != nil,
+		"max_age":          c.MaxAge != "",
+		"reference_path":   c.ReferencePath != "",
+		"reference_column": c.ReferenceColumn != "",
+	}
+	allowed := map[string][]string{
+		CheckNotNull:        {"columns"},
+		CheckUnique:         {"columns"},
+		CheckAcceptedValues: {"column", "values"},
+		CheckRegex:          {"column", "pattern"},
+		CheckRange:          {"column", "min", "max"},
+		CheckRowCount:       {"min", "max"},
+		CheckFreshness:      {"column", "max_age"},
+		CheckRelationship:   {"column", "reference_path", "reference_column"},
+	}
+	for _, field := range []string{"columns", "column", "values", "pattern", "min", "max", "max_age", "reference_path", "reference_column"} {
+		if used[field] && !slices.Contains(allowed[c.Type], field) {
+			return nil, fmt.Errorf("%s does not apply to %s", field, c.Type)
+		}
+	}
+
+	if slices.Contains(allowed[c.Type], "columns") {
+		if len(c.Columns) == 0 {
+			return nil, fmt.Errorf("columns is required")
+		}
+		if err := uniqueColumns(c.Columns); err != nil {
+			return nil, err
+		}
+	}
+	if slices.Contains(allowed[c.Type], "column") && c.Column == "" {
+		return nil, fmt.Errorf("column is required")
+	}
+	if slices.Contains(allowed[c.Type], "min") {
+		if c.Min == nil && c.Max == nil {
+			return nil, fmt.Errorf("min or max is required")
+		}
+		if c.Min != nil && c.Max != nil && *c.Min > *c.Max {
+			return nil, fmt.Errorf("min must not exceed max")
+		}
+	}
+
+	switch c.Type {
+	case CheckNotNull:
+		return notNullCheck{columns: c.Columns}, nil
+	case CheckUnique:
+		return &uniqueCheck{columns: c.Columns, seen: make(map[string]struct{})}, nil
+	case CheckAcceptedValues:
+		if len(c.Values) == 0 {
+			return nil, fmt.Errorf("values is required")
+		}
+		accepted := make(map[string]bool, len(c.Values))
+		for _, v := range c.Values {
+			accepted[valueKey(v)] = true
+		}
+		return acceptedValuesCheck{column: c.Column, accepted: accepted}, nil
+	case CheckRegex:
+		if c.Pattern == "" {
+			return nil, fmt.Errorf("pattern is required")
+		}
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		return regexCheck{column: c.Column, re: re}, nil
+	case CheckRange:
+		return rangeCheck{column: c.Column, min: c.Min, max: c.Max}, nil
+	case CheckRowCount:
+		return rowCountCheck{min: c.Min, max: c.Max}, nil
+	case CheckFreshness:
+		if c.MaxAge == "" {
+			return nil, fmt.Errorf("max_age is required")
+		}
+		maxAge, err := time.ParseDuration(c.MaxAge)
+		if err != nil || maxAge <= 0 {
+			return nil, fmt.Errorf("max_age must be a positive duration such as 24h")
+		}
+		return &freshnessCheck{column: c.Column, maxAge: maxAge}, nil
+	case CheckRelationship:
+		if c.ReferencePath == "" || c.ReferenceColumn == "" {
+			return nil, fmt.Errorf("reference_path and reference_column are required")
+		}
+		if !filepath.IsAbs(c.ReferencePath) {
+			return nil, fmt.Errorf("reference_path must be an absolute path")
+		}
+		return &relationshipCheck{column: c.Column, path: c.ReferencePath, reference: c.ReferenceColumn}, nil
+	}
+	return nil, fmt.Errorf("unsupported check %q", c.Type)
+}
+
+// valueKey returns a key equal for equal values. Numbers are equal by
+// value, so 1, 1.0 and "1" as a JSON number share a key, but not the
+// string "1".
+func valueKey(v any) string {
+	if r, ok := ratOf(v); ok {
+		return "n:" + r.RatString()
+	}
+	if s, ok := v.(string); ok {
+		return "s:" + s
+	}
+	data, _ := json.Marshal(v)
+	return "j:" + string(data)
+}
+
+func ratOf(v any) (*big.Rat, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		return new(big.Rat).SetString(string(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(v), true
+	case int64:
+		return new(big.Rat).SetInt64(v), true
+	case int:
+		return new(big.Rat).SetInt64(int64(v)), true
+	}
+	return nil, false
+}
+
+func formatBound(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// describeRange describes inclusive bounds, either of which may be unset.
+func describeRange(min, max *float64) string {
+	switch {
+	case min != nil && max != nil:
+		return fmt.Sprintf("between %s and %s", formatBound(*min), formatBound(*max))
+	case min != nil:
+		return "at least " + formatBound(*min)
+	}
+	return "at most " + formatBound(*max)
+}
+
+func countFailures(failures int64, format string, args ...any) (int64, string) {
+	if failures == 0 {
+		return 0, ""
+	}
+	return failures, fmt.Sprintf("%d records "+format, append([]any{failures}, args...)...)
+}
+
+type notNullCheck struct {
+	columns []string
+}
+
+func (c notNullCheck) check(r record.Record) bool {
+	for _, column := range c.columns {
+		if r[column] == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (c notNullCheck) finish(rows, failures int64) (int64, string) {
+	return countFailures(failures, "have nulls in %s", strings.Join(c.columns, ", "))
+}
+
+// uniqueCheck remembers the key of every record it has seen, so it needs
+// memory in proportion to the distinct keys of the file.
+type uniqueCheck struct {
+	columns []string
+	seen    map[string]struct{}
+}
+
+func (c *uniqueCheck) check(r record.Record) bool {
+	keys := make([]string, len(c.columns))
+	for i, column := range c.columns {
+		v := r[column]
+		if v == nil {
+			return false
+		}
+		keys[i] = valueKey(v)
+	}
+	key := strings.Join(keys, "\x00")
+
+	if _, ok := c.seen[key]; ok {
+		return true
+	}
+	c.seen[key] = struct{}{}
+	return false
+}
+
+func (c *uniqueCheck) finish(rows, failures int64) (int64, string) {
+	return countFailures(failures, "repeat a value of %s seen before", strings.Join(c.columns, ", "))
+}
+
+type acceptedValuesCheck struct {
+	column   string
+	accepted map[string]bool
+}
+
+func (c acceptedValuesCheck) check(r record.Record) bool {
+	v := r[c.column]
+	return v != nil && !c.accepted[valueKey(v)]
+}
+
+func (c acceptedValuesCheck) finish(rows, failures int64) (int64, string) {
+	return countFailures(failures, "have a value of %s that is not accepted", c.column)
+}
+
+type regexCheck struct {
+	column string
+	re     *regexp.Regexp
+}
+
+func (c regexCheck) check(r record.Record) bool {
+	v := r[c.column]
+	if v == nil {
+		return false
+	}
+	s, ok := v.(string)
+	if !ok {
+		s = fmt.Sprint(v)
+	}
+	return !c.re.MatchString(s)
+}
+
+func (c regexCheck) finish(rows, failures int64) (int64, string) {
+	return countFailures(failures, "have a value of %s not matching %s", c.column, c.re)
+}
+
+// rangeCheck fails values outside the bounds and values that are not
+// numbers.
+type rangeCheck struct {
+	column   string
+	min, max *float64
+}
+
+func (c rangeCheck) check(r record.Record) bool {
+	v := r[c.column]
+	if v == nil {
+		return false
+	}
+	n, ok := ratOf(v)
+	if !ok {
+		return true
+	}
+	if c.min != nil && n.Cmp(new(big.Rat).SetFloat64(*c.min)) < 0 {
+		return true
+	}
+	return c.max != nil && n.Cmp(new(big.Rat).SetFloat64(*c.max)) > 0
+}
+
+func (c rangeCheck) finish(rows, failures int64) (int64, string) {
+	return countFailures(failures, "have a value of %s that is not a number %s", c.column, describeRange(c.min, c.max))
+}
+
+type rowCountCheck struct {
+	min, max *float64
+}
+
+func (c rowCountCheck) check(r record.Record) bool {
+	return false
+}
+
+func (c rowCountCheck) finish(rows, failures int64) (int64, string) {
+	if (c.min != nil && float64(rows) < *c.min) || (c.max != nil && float64(rows) > *c.max) {
+		return 1, fmt.Sprintf("found %d records, expected %s", rows, describeRange(c.min, c.max))
+	}
+	return 0, ""
+}
+
+// freshnessCheck fails when the most recent value is older than maxAge.
+// Values that are not times fail as records.
+type freshnessCheck struct {
+	column string
+	maxAge time.Duration
+	latest time.Time
+}
+
+func (c *freshnessCheck) check(r record.Record) bool {
+	v := r[c.column]
+	if v == nil {
+		return false
+	}
+	t, err := castTime(v, "", "timestamp")
+	if err != nil {
+		return true
+	}
+	if t.After(c.latest) {
+		c.latest = t
+	}
+	return false
+}
+
+func (c *freshnessCheck) finish(rows, failures int64) (int64, string) {
+	if failures > 0 {
+		return countFailures(failures, "have a value of %s that is not a time", c.column)
+	}
+	if c.latest.IsZero() {
+		return 1, fmt.Sprintf("no values in %s", c.column)
+	}
+	if age := time.Since(c.latest); age > c.maxAge {
+		return 1, fmt.Sprintf("latest %s is %s old, more than %s", c.column, age.Truncate(time.Second), c.maxAge)
+	}
+	return 0, ""
+}
+
+// relationshipCheck fails values missing from a column of another JSON
+// lines file, typically written by another task of the pipeline.
+type relationshipCheck struct {
+	column    string
+	path      string
+	reference string
+	keys      map[string]bool
+}
+
+// load reads the values of the reference column before the run.
+func (c *relationshipCheck) load() error {
+	file, err := os.Open(c.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	c.keys = make(map[string]bool)
+	return readJSONL(file, func(r map[string]any) error {
+		if v := r[c.reference]; v != nil {
+			c.keys[valueKey(v)] = true
+		}
+		return nil
+	})
+}
+
+func (c *relationshipCheck) check(r record.Record) bool {
+	v := r[c.column]
+	return v != nil && !c.keys[valueKey(v)]
+}
+
+func (c *relationshipCheck) finish(rows, failures int64) (int64, string) {
+	return countFailures(failures, "have a value of %s missing from %s in %s", c.column, c.reference, c.path)
+}
@@ -0,0 +1,143 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func float(f float64) *float64 {
+	return &f
+}
+
+func TestQualityCheck_Run(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "orders.jsonl")
+	customers := filepath.Join(dir, "customers.jsonl")
+	recent := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	data := `{"id": 1, "customer": 10, "status": "paid", "email": "a@example.com", "amount": 12.5, "updated": "2024-01-01T00:00:00Z"}` + "\n" +
+		`{"id": 2, "customer": 11, "status": "lost", "email": "nope", "amount": 0, "updated": "` + recent + `"}` + "\n" +
+		`{"id": 2, "customer": 12, "status": null, "email": null, "amount": "n/a", "updated": null}` + "\n" +
+		`{"id": null, "customer": 10, "status": "open", "email": "b@example.com", "amount": 1000}` + "\n"
+	assert.NoError(t, os.WriteFile(source, []byte(data), 0o644))
+	assert.NoError(t, os.WriteFile(customers, []byte(`{"id": 10}`+"\n"+`{"id": 11.0}`+"\n"), 0o644))
+
+	config := QualityCheckConfig{
+		SourcePath: source,
+		Samples:    1,
+		Checks: []QualityAssertion{
+			{Type: CheckNotNull, Columns: []string{"id"}, Severity: SeverityWarn},
+			{Type: CheckUnique, Columns: []string{"id"}, Severity: SeverityWarn},
+			{Type: CheckAcceptedValues, Column: "status", Values: []any{"paid", "open"}, Severity: SeverityWarn},
+			{Type: CheckRegex, Column: "email", Pattern: `^[^@]+@[^@]+$`, Severity: SeverityWarn},
+			{Name: "amount", Type: CheckRange, Column: "amount", Min: float(0), Max: float(100), Severity: SeverityWarn},
+			{Type: CheckRowCount, Min: float(1)},
+			{Type: CheckFreshness, Column: "updated", MaxAge: "24h"},
+			{Type: CheckRelationship, Column: "customer", ReferencePath: customers, ReferenceColumn: "id", Severity: SeverityWarn},
+		},
+	}
+
+	storage := store.NewMockStore()
+	run, err := runTask(t, NewQualityCheck(storage, NewRegistry()), QualityCheckType, config)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), *run.Record.RowsAffected)
+
+	results, err := storage.QualityResults.GetByRun(context.Background(), 1)
+	assert.NoError(t, err)
+	if !assert.Len(t, results, 8) {
+		return
+	}
+
+	type outcome struct {
+		name     string
+		passed   bool
+		failures int64
+		message  string
+	}
+	var got []outcome
+	for _, r := range results {
+		got = append(got, outcome{r.Name, r.Passed, r.Failures, r.Message})
+	}
+	assert.Equal(t, []outcome{
+		{"not_null(id)", false, 1, "1 records have nulls in id"},
+		{"unique(id)", false, 1, "1 records repeat a value of id seen before"},
+		{"accepted_values(status)", false, 1, "1 records have a value of status that is not accepted"},
+		{"regex(email)", false, 1, "1 records have a value of email not matching ^[^@]+@[^@]+$"},
+		{"amount", false, 2, "2 records have a value of amount that is not a number between 0 and 100"},
+		{"row_count", true, 0, ""},
+		{"freshness(updated)", true, 0, ""},
+		{"relationship(customer)", false, 1, "1 records have a value of customer missing from id in " + customers},
+	}, got)
+
+	var samples []map[string]any
+	assert.NoError(t, json.Unmarshal(results[4].Samples, &samples))
+	assert.Len(t, samples, 1)
+	assert.Equal(t, 3.0, samples[0]["record"])
+	assert.Equal(t, "n/a", samples[0]["row"].(map[string]any)["amount"])
+	assert.Nil(t, results[5].Samples)
+
+	t.Run("failing checks fail the run", func(t *testing.T) {
+		failing := config
+		failing.Checks = []QualityAssertion{
+			{Type: CheckNotNull, Columns: []string{"id", "status"}},
+			{Type: CheckRowCount, Min: float(10), Severity: SeverityWarn},
+			{Name: "stale", Type: CheckFreshness, Column: "updated", MaxAge: "1m"},
+		}
+
+		storage := store.NewMockStore()
+		_, err := runTask(t, NewQualityCheck(storage, NewRegistry()), QualityCheckType, failing)
+		assert.EqualError(t, err, "2 of 3 checks failed: not_null(id, status), stale")
+
+		results, _ := storage.QualityResults.GetByRun(context.Background(), 1)
+		if assert.Len(t, results, 3) {
+			assert.Equal(t, "found 4 records, expected at least 10", results[1].Message)
+			assert.Contains(t, results[2].Message, "latest updated is ")
+		}
+	})
+}
+
+func TestQualityCheck_Validate(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "orders.jsonl")
+	assert.NoError(t, os.WriteFile(source, []byte(`{"id": 1, "status": "paid"}`+"\n"), 0o644))
+
+	q := NewQualityCheck(store.NewMockStore(), NewRegistry())
+	validate := func(checks ...QualityAssertion) error {
+		return q.Validate(context.Background(), store.Task{
+			Type:   QualityCheckType,
+			Config: mustMarshal(QualityCheckConfig{SourcePath: source, Checks: checks}),
+		})
+	}
+
+	assert.NoError(t, validate(QualityAssertion{Type: CheckUnique, Columns: []string{"id", "status"}}))
+
+	tests := []struct {
+		check QualityAssertion
+		err   string
+	}{
+		{QualityAssertion{Type: CheckNotNull, Columns: []string{"missing"}}, `check "not_null(missing)": unknown column "missing"`},
+		{QualityAssertion{Type: CheckNotNull}, `check "not_null": columns is required`},
+		{QualityAssertion{Type: CheckNotNull, Columns: []string{"id"}, Pattern: "x"}, `check "not_null(id)": pattern does not apply to not_null`},
+		{QualityAssertion{Type: CheckAcceptedValues, Column: "status"}, `check "accepted_values(status)": values is required`},
+		{QualityAssertion{Type: CheckRegex, Column: "status", Pattern: "("}, "check \"regex(status)\": invalid pattern: error parsing regexp: missing closing ): `(`"},
+		{QualityAssertion{Type: CheckRange, Column: "id"}, `check "range(id)": min or max is required`},
+		{QualityAssertion{Type: CheckRowCount, Min: float(5), Max: float(1)}, `check "row_count": min must not exceed max`},
+		{QualityAssertion{Type: CheckFreshness, Column: "id", MaxAge: "a day"}, `check "freshness(id)": max_age must be a positive duration such as 24h`},
+		{QualityAssertion{Type: CheckRelationship, Column: "id", ReferencePath: "customers.jsonl", ReferenceColumn: "id"}, `check "relationship(id)": reference_path must be an absolute path`},
+	}
+	for _, tt := range tests {
+		assert.EqualError(t, validate(tt.check), tt.err)
+	}
+
+	err := validate(
+		QualityAssertion{Type: CheckRowCount, Min: float(1)},
+		QualityAssertion{Type: CheckRowCount, Max: float(10)},
+	)
+	assert.EqualError(t, err, `check 2: duplicate name "row_count"`)
+}
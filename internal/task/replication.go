@@ -0,0 +1,159 @@
+package task
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// walData is a message of a logical replication stream.
+type walData struct {
+	WALStart LSN
+	Data     []byte
+}
+
+// replicationStream is a started logical replication stream.
+type replicationStream interface {
+	// Receive returns the next message of the stream. It returns the error
+	// of ctx when ctx is done first, leaving the stream usable.
+	Receive(ctx context.Context) (walData, error)
+	// Ack confirms to the server that changes up to lsn are processed, so
+	// the slot no longer retains the WAL before it.
+	Ack(ctx context.Context, lsn LSN) error
+	Close(ctx context.Context) error
+}
+
+// pgReplicationStream speaks the streaming replication protocol over a
+// replication connection.
+type pgReplicationStream struct {
+	conn  *pgconn.PgConn
+	acked LSN
+}
+
+// startReplication starts streaming the changes of a slot from start, or
+// from the confirmed position of the slot when start is zero. Slot and
+// publication names are validated by the caller.
+func startReplication(ctx context.Context, conn store.Connection, slot, publication string, start LSN) (replicationStream, error) {
+	if conn.Type != store.ConnectionPostgres {
+		return nil, fmt.Errorf("connection %q is of type %q, expected %q", conn.Name, conn.Type, store.ConnectionPostgres)
+	}
+
+	cfg, err := pgconn.ParseConfig(conn.DSN)
+	if err != nil {
+		return nil, err
+	}
+	cfg.RuntimeParams["replication"] = "database"
+
+	pg, err := pgconn.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(
+		"START_REPLICATION SLOT %s LOGICAL %s (proto_version '1', publication_names '%s')",
+		slot, start, publication,
+	)
+	pg.Frontend().SendQuery(&pgproto3.Query{String: query})
+	if err := pg.Frontend().Flush(); err != nil {
+		pg.Close(ctx)
+		return nil, err
+	}
+
+	for {
+		msg, err := pg.ReceiveMessage(ctx)
+		if err != nil {
+			pg.Close(ctx)
+			return nil, err
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.CopyBothResponse:
+			return &pgReplicationStream{conn: pg, acked: start}, nil
+		case *pgproto3.ErrorResponse:
+			pg.Close(ctx)
+			return nil, pgconn.ErrorResponseToPgError(msg)
+		case *pgproto3.NoticeResponse:
+		default:
+			pg.Close(ctx)
+			return nil, fmt.Errorf("unexpected message %T starting replication", msg)
+		}
+	}
+}
+
+func (s *pgReplicationStream) Receive(ctx context.Context) (walData, error) {
+	for {
+		msg, err := s.conn.ReceiveMessage(ctx)
+		if err != nil {
+			if pgconn.Timeout(err) && ctx.Err() != nil {
+				return walData{}, ctx.Err()
+			}
+			return walData{}, err
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.CopyData:
+			if len(msg.Data) == 0 {
+				return walData{}, errShortMessage
+			}
+
+			switch msg.Data[0] {
+			case 'w':
+				// XLogData: WAL start, WAL end and server clock, then the
+				// pgoutput message.
+				if len(msg.Data) < 25 {
+					return walData{}, errShortMessage
+				}
+				return walData{
+					WALStart: LSN(binary.BigEndian.Uint64(msg.Data[1:])),
+					Data:     msg.Data[25:],
+				}, nil
+			case 'k':
+				// Primary keepalive: WAL end, server clock and whether a
+				// reply is requested.
+				if len(msg.Data) < 18 {
+					return walData{}, errShortMessage
+				}
+				if msg.Data[17] == 1 {
+					if err := s.sendStatus(); err != nil {
+						return walData{}, err
+					}
+				}
+			}
+		case *pgproto3.ErrorResponse:
+			return walData{}, pgconn.ErrorResponseToPgError(msg)
+		case *pgproto3.CopyDone:
+			return walData{}, errors.New("replication stream ended by the server")
+		}
+	}
+}
+
+func (s *pgReplicationStream) Ack(ctx context.Context, lsn LSN) error {
+	s.acked = lsn
+	return s.sendStatus()
+}
+
+// sendStatus sends a standby status update reporting the acknowledged
+// position as written, flushed and applied.
+func (s *pgReplicationStream) sendStatus() error {
+	data := make([]byte, 0, 34)
+	data = append(data, 'r')
+	for range 3 {
+		data = binary.BigEndian.AppendUint64(data, uint64(s.acked))
+	}
+	clock := time.Since(postgresEpoch).Microseconds()
+	data = binary.BigEndian.AppendUint64(data, uint64(clock))
+	data = append(data, 0)
+
+	s.conn.Frontend().Send(&pgproto3.CopyData{Data: data})
+	return s.conn.Frontend().Flush()
+}
+
+func (s *pgReplicationStream) Close(ctx context.Context) error {
+	return s.conn.Close(ctx)
+}
@@ -0,0 +1,127 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+// SchemaProvider is implemented by handlers that can tell the schema of
+// the records a task writes from its configuration, before it has run.
+type SchemaProvider interface {
+	// OutputSchema returns nil when the schema cannot be known in advance.
+	OutputSchema(ctx context.Context, task store.Task) (*record.Schema, error)
+}
+
+// OutputSchema returns the schema of the records a task writes, or nil
+// when its handler cannot tell.
+func (r *Registry) OutputSchema(ctx context.Context, task store.Task) (*record.Schema, error) {
+	handler, err := r.Get(task.Type)
+	if err != nil {
+		return nil, err
+	}
+	provider, ok := handler.(SchemaProvider)
+	if !ok {
+		return nil, nil
+	}
+	return provider.OutputSchema(ctx, task)
+}
+
+// schemaSampleSize is the number of records read from an existing file to
+// infer its schema.
+const schemaSampleSize = 1000
+
+type visitedKey struct{}
+
+// upstreamSchema resolves the schema of the records at path, the input of
+// task. The upstream task is the one of the same pipeline writing to path.
+// Its handler is asked first, then the schema is inferred from the file if
+// an earlier run left one. It returns nil when neither is available.
+func upstreamSchema(ctx context.Context, storage store.Storage, registry *Registry, task store.Task, path string) (*record.Schema, error) {
+	// Tasks resolve their own upstream in turn, so a loop in the pipeline
+	// would never end.
+	visited, _ := ctx.Value(visitedKey{}).(map[int64]bool)
+	if visited[task.ID] && task.ID != 0 {
+		return nil, errors.New("the pipeline reads its own output in a loop")
+	}
+	next := map[int64]bool{task.ID: true}
+	for id := range visited {
+		next[id] = true
+	}
+	ctx = context.WithValue(ctx, visitedKey{}, next)
+
+	if task.PipelineID != 0 {
+		tasks, err := storage.Tasks.GetByPipeline(ctx, task.PipelineID)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tasks {
+			if t.ID == task.ID || targetPath(t) != path {
+				continue
+			}
+			schema, err := registry.OutputSchema(ctx, t)
+			if err != nil {
+				return nil, fmt.Errorf("upstream task %q: %w", t.Name, err)
+			}
+			if schema != nil {
+				return schema, nil
+			}
+		}
+	}
+
+	return sampleSchema(path)
+}
+
+// targetPath returns the file a task writes its records to, if any.
+func targetPath(task store.Task) string {
+	var cfg struct {
+		TargetPath string `json:"target_path"`
+	}
+	if err := json.Unmarshal(task.Config, &cfg); err != nil {
+		return ""
+	}
+	return cfg.TargetPath
+}
+
+// sampleSchema infers the schema of a JSON lines file from its first
+// records. It returns nil if the file does not exist yet, or is the
+// directory of a partitioned output. Lines that do not parse are skipped,
+// it is up to the run to reject or fail on them.
+func sampleSchema(path string) (*record.Schema, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil && info.IsDir() {
+		return nil, nil
+	}
+
+	var sample []record.Record
+	errSampled := errors.New("sampled")
+	err = scanJSONL(file, func(r map[string]any) error {
+		sample = append(sample, r)
+		if len(sample) == schemaSampleSize {
+			return errSampled
+		}
+		return nil
+	}, func(int, any, error) error { return nil })
+	if err != nil && !errors.Is(err, errSampled) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(sample) == 0 {
+		return nil, nil
+	}
+
+	schema := record.Infer(sample)
+	return &schema, nil
+}
@@ -0,0 +1,28 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+// taskSecret looks up a secret by name in the organization that owns the
+// pipeline of the task.
+func taskSecret(ctx context.Context, storage store.Storage, task store.Task, name string) (store.Secret, error) {
+	pipeline, err := storage.Pipelines.GetByID(ctx, task.PipelineID)
+	if err != nil {
+		return store.Secret{}, fmt.Errorf("failed to get pipeline %d: %w", task.PipelineID, err)
+	}
+
+	secret, err := storage.Secrets.GetByName(ctx, pipeline.OrganizationID, name)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return store.Secret{}, fmt.Errorf("secret %q not found", name)
+		}
+		return store.Secret{}, err
+	}
+
+	return secret, nil
+}
@@ -0,0 +1,170 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+const ShellExecType = "shell.exec"
+
+const defaultShellTimeout = time.Hour
+
+type ShellExecConfig struct {
+	Command    string            `json:"command" validate:"required"`
+	Args       []string          `json:"args"`
+	Env        map[string]string `json:"env"`
+	WorkingDir string            `json:"working_dir"`
+	// Timeout is a duration such as "90s" or "15m". It defaults to one hour.
+	Timeout string `json:"timeout"`
+	// SuccessCodes are the exit codes that finish the run successfully.
+	// It defaults to 0 only.
+	SuccessCodes []int `json:"success_codes"`
+	// SkipCodes are the exit codes that finish the run as skipped.
+	SkipCodes []int       `json:"skip_codes"`
+	Limits    ShellLimits `json:"limits"`
+}
+
+// ShellLimits are the resource limits applied to the command. A zero value
+// leaves the limit unset.
+type ShellLimits struct {
+	CPUSeconds  uint64 `json:"cpu_seconds"`
+	MemoryBytes uint64 `json:"memory_bytes"`
+	OpenFiles   uint64 `json:"open_files"`
+}
+
+func (l ShellLimits) isSet() bool {
+	return l.CPUSeconds > 0 || l.MemoryBytes > 0 || l.OpenFiles > 0
+}
+
+// ShellExec runs an external command.
+type ShellExec struct{}
+
+func NewShellExec() *ShellExec {
+	return &ShellExec{}
+}
+
+func (s *ShellExec) Validate(ctx context.Context, task store.Task) error {
+	_, err := s.config(task)
+	return err
+}
+
+func (s *ShellExec) config(task store.Task) (ShellExecConfig, error) {
+	var cfg ShellExecConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if cfg.WorkingDir != "" && !filepath.IsAbs(cfg.WorkingDir) {
+		return cfg, fmt.Errorf("working_dir must be an absolute path")
+	}
+
+	if _, err := cfg.timeout(); err != nil {
+		return cfg, err
+	}
+
+	for _, code := range cfg.SkipCodes {
+		if slices.Contains(cfg.successCodes(), code) {
+			return cfg, fmt.Errorf("exit code %d is both a success and a skip code", code)
+		}
+	}
+
+	return cfg, nil
+}
+
+func (c ShellExecConfig) timeout() (time.Duration, error) {
+	return parseTimeout(c.Timeout, defaultShellTimeout)
+}
+
+func (c ShellExecConfig) successCodes() []int {
+	if len(c.SuccessCodes) == 0 {
+		return []int{0}
+	}
+	return c.SuccessCodes
+}
+
+// environ builds the command environment. The worker environment is not
+// inherited, only its PATH, so the command never sees server secrets.
+func (c ShellExecConfig) environ() []string {
+	env := []string{"PATH=" + os.Getenv("PATH")}
+
+	keys := make([]string, 0, len(c.Env))
+	for k := range c.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		env = append(env, k+"="+c.Env[k])
+	}
+	return env
+}
+
+func (s *ShellExec) Run(ctx context.Context, run *Run) error {
+	cfg, err := s.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	timeout, _ := cfg.timeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stdout := run.Log.Writer("stdout")
+	stderr := run.Log.Writer("stderr")
+	defer stdout.Flush()
+	defer stderr.Flush()
+
+	cmd := exec.CommandContext(ctx, cfg.Command, cfg.Args...)
+	cmd.Env = cfg.environ()
+	cmd.Dir = cfg.WorkingDir
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Do not wait forever on pipes held open by orphaned children.
+	cmd.WaitDelay = 5 * time.Second
+	configureCommand(cmd)
+	if cfg.Limits.isSet() {
+		if err := limitCommand(cmd, cfg.Limits); err != nil {
+			return fmt.Errorf("failed to apply resource limits: %w", err)
+		}
+	}
+
+	run.Log.Printf("starting %s with timeout %s", cfg.Command, timeout)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return fmt.Errorf("command did not finish within %s: %w", timeout, ctx.Err())
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return err
+	}
+
+	code := cmd.ProcessState.ExitCode()
+	if code < 0 {
+		return fmt.Errorf("command terminated: %s", cmd.ProcessState.String())
+	}
+	run.SetExitCode(code)
+
+	switch {
+	case slices.Contains(cfg.successCodes(), code):
+		return nil
+	case slices.Contains(cfg.SkipCodes, code):
+		run.SetState(store.StateSkipped)
+		return nil
+	default:
+		return fmt.Errorf("command exited with code %d", code)
+	}
+}
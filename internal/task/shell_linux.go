@@ -0,0 +1,50 @@
+package task
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// configureCommand runs the command in its own process group so that a
+// timeout kills every process it spawned.
+func configureCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// limitCommand makes cmd start through a shell that sets the resource
+// limits and then execs the command in its place, so that the limits are in
+// effect before the first instruction of the command runs. The command and
+// its arguments are passed as positional parameters and never parsed by the
+// shell.
+func limitCommand(cmd *exec.Cmd, limits ShellLimits) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	sh, err := exec.LookPath("/bin/sh")
+	if err != nil {
+		return fmt.Errorf("resource limits require /bin/sh: %w", err)
+	}
+
+	var script strings.Builder
+	if limits.CPUSeconds > 0 {
+		fmt.Fprintf(&script, "ulimit -t %d && ", limits.CPUSeconds)
+	}
+	if limits.MemoryBytes > 0 {
+		// ulimit takes the address space size in KiB.
+		fmt.Fprintf(&script, "ulimit -v %d && ", max(limits.MemoryBytes/1024, 1))
+	}
+	if limits.OpenFiles > 0 {
+		fmt.Fprintf(&script, "ulimit -n %d && ", limits.OpenFiles)
+	}
+	script.WriteString(`exec "$0" "$@"`)
+
+	args := append([]string{sh, "-c", script.String(), cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = sh
+	cmd.Args = args
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package task
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func configureCommand(cmd *exec.Cmd) {}
+
+func limitCommand(cmd *exec.Cmd, limits ShellLimits) error {
+	return errors.New("resource limits are only supported on linux")
+}
@@ -0,0 +1,132 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func newShellRun(t *testing.T, cfg ShellExecConfig) *Run {
+	t.Helper()
+
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewRun(store.Task{ID: 1, Type: ShellExecType, Config: raw}, &store.TaskRun{ID: 1})
+}
+
+func TestShellExec_Validate(t *testing.T) {
+	shell := NewShellExec()
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{name: "valid", config: `{"command": "echo", "args": ["hi"], "timeout": "1m"}`},
+		{name: "missing command", config: `{"args": ["hi"]}`, wantErr: true},
+		{name: "unknown field", config: `{"command": "echo", "cmd": "x"}`, wantErr: true},
+		{name: "relative working dir", config: `{"command": "echo", "working_dir": "tmp"}`, wantErr: true},
+		{name: "invalid timeout", config: `{"command": "echo", "timeout": "soon"}`, wantErr: true},
+		{name: "overlapping codes", config: `{"command": "echo", "skip_codes": [0]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := shell.Validate(context.Background(), store.Task{Config: json.RawMessage(tt.config)})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestShellExec_Run(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	shell := NewShellExec()
+
+	t.Run("captures output", func(t *testing.T) {
+		run := newShellRun(t, ShellExecConfig{
+			Command: "sh",
+			Args:    []string{"-c", "echo out; echo err >&2; printf partial"},
+		})
+
+		err := shell.Run(context.Background(), run)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, *run.Record.ExitCode)
+
+		logs := run.Log.String()
+		assert.Contains(t, logs, "[stdout] out")
+		assert.Contains(t, logs, "[stderr] err")
+		assert.Contains(t, logs, "[stdout] partial")
+	})
+
+	t.Run("does not inherit the worker environment", func(t *testing.T) {
+		t.Setenv("AUTH_TOKEN_SECRET", "very-secret")
+		run := newShellRun(t, ShellExecConfig{
+			Command: "sh",
+			Args:    []string{"-c", "echo secret=$AUTH_TOKEN_SECRET custom=$CUSTOM"},
+			Env:     map[string]string{"CUSTOM": "value"},
+		})
+
+		assert.NoError(t, shell.Run(context.Background(), run))
+		assert.Contains(t, run.Log.String(), "secret= custom=value")
+	})
+
+	t.Run("maps exit codes", func(t *testing.T) {
+		run := newShellRun(t, ShellExecConfig{
+			Command:   "sh",
+			Args:      []string{"-c", "exit 3"},
+			SkipCodes: []int{3},
+		})
+		assert.NoError(t, shell.Run(context.Background(), run))
+		assert.Equal(t, store.StateSkipped, run.state)
+		assert.Equal(t, 3, *run.Record.ExitCode)
+
+		run = newShellRun(t, ShellExecConfig{
+			Command: "sh",
+			Args:    []string{"-c", "exit 2"},
+		})
+		err := shell.Run(context.Background(), run)
+		assert.ErrorContains(t, err, "exited with code 2")
+		assert.Equal(t, 2, *run.Record.ExitCode)
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		run := newShellRun(t, ShellExecConfig{
+			Command: "sh",
+			Args:    []string{"-c", "sleep 10"},
+			Timeout: "100ms",
+		})
+
+		err := shell.Run(context.Background(), run)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("applies resource limits", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("resource limits are only supported on linux")
+		}
+
+		run := newShellRun(t, ShellExecConfig{
+			Command: "sh",
+			Args:    []string{"-c", "ulimit -n"},
+			Limits:  ShellLimits{OpenFiles: 64},
+		})
+
+		assert.NoError(t, shell.Run(context.Background(), run))
+		assert.True(t, strings.Contains(run.Log.String(), "[stdout] 64"), run.Log.String())
+	})
+}
@@ -0,0 +1,151 @@
+package task
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// spillLine is a line of a spill file. The lines of a spill file are
+// sorted by key, so that spill files can be merged by reading them side by
+// side, which keeps memory bounded however large the input.
+type spillLine interface {
+	spillKey() string
+}
+
+// spills are the spill files written by a transform, in the order they
+// were written, next to its target.
+type spills struct {
+	dir   string
+	name  string
+	files []*os.File
+}
+
+func newSpills(dir, name string) *spills {
+	return &spills{dir: dir, name: name}
+}
+
+// write creates a spill file with the lines passed to encode, which the
+// caller passes in key order.
+func (s *spills) write(lines func(encode func(line any) error) error) error {
+	file, err := os.CreateTemp(s.dir, "."+s.name+".*.spill")
+	if err != nil {
+		return err
+	}
+	s.files = append(s.files, file)
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	if err := lines(encoder.Encode); err != nil {
+		return fmt.Errorf("spill file: %w", err)
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("spill file: %w", err)
+	}
+	return nil
+}
+
+// remove removes the spill files.
+func (s *spills) remove() {
+	for _, file := range s.files {
+		file.Close()
+		os.Remove(file.Name())
+	}
+	s.files = nil
+}
+
+// mergeSpills reads the spill files side by side and calls fn once per key
+// with its lines, in the order of the files.
+func mergeSpills[T spillLine](s *spills, fn func(lines []T) error) error {
+	var runs spillRuns[T]
+	for i, file := range s.files {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		decoder := json.NewDecoder(bufio.NewReader(file))
+		decoder.UseNumber()
+
+		run := &spillRun[T]{decoder: decoder, index: i}
+		ok, err := run.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			runs = append(runs, run)
+		}
+	}
+	heap.Init(&runs)
+
+	var lines []T
+	for len(runs) > 0 {
+		key := runs[0].head.spillKey()
+		lines = lines[:0]
+		for len(runs) > 0 && runs[0].head.spillKey() == key {
+			run := runs[0]
+			lines = append(lines, run.head)
+
+			ok, err := run.next()
+			if err != nil {
+				return err
+			}
+			if ok {
+				heap.Fix(&runs, 0)
+			} else {
+				heap.Pop(&runs)
+			}
+		}
+
+		if err := fn(lines); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spillRun reads the lines of a spill file in order.
+type spillRun[T spillLine] struct {
+	decoder *json.Decoder
+	index   int
+	head    T
+}
+
+func (r *spillRun[T]) next() (bool, error) {
+	var line T
+	err := r.decoder.Decode(&line)
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("spill file: %w", err)
+	}
+	r.head = line
+	return true, nil
+}
+
+// spillRuns is a heap of spill files by the key of their next line, then
+// by the order they were written in.
+type spillRuns[T spillLine] []*spillRun[T]
+
+func (h spillRuns[T]) Len() int { return len(h) }
+
+func (h spillRuns[T]) Less(i, j int) bool {
+	a, b := h[i].head.spillKey(), h[j].head.spillKey()
+	if a != b {
+		return a < b
+	}
+	return h[i].index < h[j].index
+}
+
+func (h spillRuns[T]) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *spillRuns[T]) Push(x any)   { *h = append(*h, x.(*spillRun[T])) }
+
+func (h *spillRuns[T]) Pop() any {
+	old := *h
+	run := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return run
+}
@@ -0,0 +1,258 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/jackc/pgx/v5"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+const SQLTransformType = "sql.transform"
+
+const defaultSQLTimeout = time.Hour
+
+// materializeSuffix names the table a materialization is built into
+// before it replaces the target table.
+const materializeSuffix = "__haku_tmp"
+
+type SQLTransformConfig struct {
+	// Connection is the name of a postgres connection of the organization.
+	Connection string `json:"connection" validate:"required"`
+	// Statements run in order, before the materialization.
+	Statements []string `json:"statements"`
+	// Params are available to statements and queries as {{ .name }}.
+	Params      map[string]string `json:"params"`
+	Materialize *Materialization  `json:"materialize"`
+	Timeout     string            `json:"timeout"`
+}
+
+// Materialization replaces Table with the result of Query.
+type Materialization struct {
+	// Table may be schema qualified, e.g. "analytics.daily_orders".
+	Table string `json:"table" validate:"required"`
+	Query string `json:"query" validate:"required"`
+}
+
+// SQLTransform runs SQL statements inside a target postgres database, in a
+// single transaction.
+type SQLTransform struct {
+	store store.Storage
+	open  func(store.Connection) (*sql.DB, error)
+}
+
+func NewSQLTransform(storage store.Storage) *SQLTransform {
+	return &SQLTransform{
+		store: storage,
+		open:  openPostgres,
+	}
+}
+
+func (s *SQLTransform) Validate(ctx context.Context, task store.Task) error {
+	cfg, err := s.config(task)
+	if err != nil {
+		return err
+	}
+
+	_, err = taskConnection(ctx, s.store, task, cfg.Connection)
+	return err
+}
+
+func (s *SQLTransform) config(task store.Task) (SQLTransformConfig, error) {
+	var cfg SQLTransformConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if len(cfg.Statements) == 0 && cfg.Materialize == nil {
+		return cfg, errors.New("at least one statement or a materialization is required")
+	}
+
+	for i, stmt := range cfg.Statements {
+		if _, err := parseSQLTemplate(stmt); err != nil {
+			return cfg, fmt.Errorf("statement %d: %w", i, err)
+		}
+	}
+
+	if cfg.Materialize != nil {
+		if err := validateMaterialization(cfg.Materialize); err != nil {
+			return cfg, err
+		}
+	}
+
+	if _, err := parseTimeout(cfg.Timeout, defaultSQLTimeout); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func validateMaterialization(m *Materialization) error {
+	if _, err := parseSQLTemplate(m.Query); err != nil {
+		return fmt.Errorf("materialize query: %w", err)
+	}
+	if !validTableName(m.Table) {
+		return fmt.Errorf("invalid materialize table %q", m.Table)
+	}
+	return nil
+}
+
+func (s *SQLTransform) Run(ctx context.Context, run *Run) error {
+	cfg, err := s.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	timeout, _ := parseTimeout(cfg.Timeout, defaultSQLTimeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := taskConnection(ctx, s.store, run.Task, cfg.Connection)
+	if err != nil {
+		return err
+	}
+
+	db, err := s.open(conn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	data := sqlTemplateData(run, cfg.Params)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var total int64
+	for i, stmt := range cfg.Statements {
+		query, err := renderSQL(stmt, data)
+		if err != nil {
+			return fmt.Errorf("statement %d: %w", i, err)
+		}
+
+		rows, err := execRows(ctx, tx, query)
+		if err != nil {
+			return fmt.Errorf("statement %d: %w", i, err)
+		}
+		run.Log.Printf("statement %d affected %d rows", i, rows)
+		total += rows
+	}
+
+	if cfg.Materialize != nil {
+		run.Writes(cfg.Connection, cfg.Materialize.Table)
+		rows, err := materialize(ctx, tx, cfg.Materialize, data)
+		if err != nil {
+			return err
+		}
+		run.Log.Printf("materialized %d rows into %s", rows, cfg.Materialize.Table)
+		total += rows
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	run.SetRowsAffected(total)
+	return nil
+}
+
+// materialize builds the query result into a temporary table and swaps it
+// with the target table. Postgres DDL is transactional, readers keep seeing
+// the previous table until the transaction commits.
+func materialize(ctx context.Context, tx *sql.Tx, m *Materialization, data map[string]any) (int64, error) {
+	query, err := renderSQL(m.Query, data)
+	if err != nil {
+		return 0, fmt.Errorf("materialize query: %w", err)
+	}
+
+	target := tableIdentifier(m.Table)
+	tmp := append(pgx.Identifier{}, target...)
+	tmp[len(tmp)-1] += materializeSuffix
+
+	if _, err := tx.ExecContext(ctx, "DROP TABLE IF EXISTS "+tmp.Sanitize()); err != nil {
+		return 0, err
+	}
+
+	rows, err := execRows(ctx, tx, "CREATE TABLE "+tmp.Sanitize()+" AS "+query)
+	if err != nil {
+		return 0, fmt.Errorf("materialize query: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DROP TABLE IF EXISTS "+target.Sanitize()); err != nil {
+		return 0, err
+	}
+
+	rename := pgx.Identifier{target[len(target)-1]}
+	if _, err := tx.ExecContext(ctx, "ALTER TABLE "+tmp.Sanitize()+" RENAME TO "+rename.Sanitize()); err != nil {
+		return 0, err
+	}
+
+	return rows, nil
+}
+
+func execRows(ctx context.Context, tx *sql.Tx, query string) (int64, error) {
+	res, err := tx.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// tableIdentifier splits an optionally schema qualified table name.
+func tableIdentifier(table string) pgx.Identifier {
+	return pgx.Identifier(strings.Split(table, "."))
+}
+
+func sqlTemplateData(run *Run, params map[string]string) map[string]any {
+	data := map[string]any{
+		"run_id":      run.Record.ID,
+		"task_id":     run.Task.ID,
+		"pipeline_id": run.Task.PipelineID,
+		"run_date":    time.Now().UTC().Format(time.DateOnly),
+	}
+	for k, v := range params {
+		data[k] = v
+	}
+	return data
+}
+
+var sqlTemplateFuncs = template.FuncMap{
+	// literal quotes a value as a SQL string literal.
+	"literal": func(v any) string {
+		return "'" + strings.ReplaceAll(fmt.Sprint(v), "'", "''") + "'"
+	},
+	// ident quotes a value as a SQL identifier.
+	"ident": func(v any) string {
+		return pgx.Identifier{fmt.Sprint(v)}.Sanitize()
+	},
+}
+
+func parseSQLTemplate(text string) (*template.Template, error) {
+	return template.New("sql").
+		Funcs(sqlTemplateFuncs).
+		Option("missingkey=error").
+		Parse(text)
+}
+
+func renderSQL(text string, data map[string]any) (string, error) {
+	tmpl, err := parseSQLTemplate(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
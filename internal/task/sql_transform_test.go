@@ -0,0 +1,130 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSQLTransformTest(t *testing.T) (*SQLTransform, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+
+	ctx := context.Background()
+	storage := store.NewMockStore()
+	storage.Pipelines.Create(ctx, &store.Pipelines{ID: 1, OrganizationID: 1})
+	storage.Connections.Create(ctx, &store.Connection{OrganizationID: 1, Name: "warehouse", Type: store.ConnectionPostgres})
+
+	transform := NewSQLTransform(storage)
+	transform.open = func(store.Connection) (*sql.DB, error) {
+		return db, nil
+	}
+
+	return transform, mock
+}
+
+func TestSQLTransform_Validate(t *testing.T) {
+	transform, _ := newSQLTransformTest(t)
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{name: "valid", config: `{"connection": "warehouse", "statements": ["DELETE FROM t WHERE dt = {{ literal .dt }}"]}`},
+		{name: "unknown connection", config: `{"connection": "lake", "statements": ["SELECT 1"]}`, wantErr: true},
+		{name: "nothing to run", config: `{"connection": "warehouse"}`, wantErr: true},
+		{name: "bad template", config: `{"connection": "warehouse", "statements": ["SELECT {{ .dt"]}`, wantErr: true},
+		{name: "bad table", config: `{"connection": "warehouse", "materialize": {"table": "a.b.c", "query": "SELECT 1"}}`, wantErr: true},
+		{name: "missing query", config: `{"connection": "warehouse", "materialize": {"table": "a.b"}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := transform.Validate(context.Background(), store.Task{PipelineID: 1, Config: json.RawMessage(tt.config)})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSQLTransform_Run(t *testing.T) {
+	transform, mock := newSQLTransformTest(t)
+
+	config := `{
+		"connection": "warehouse",
+		"params": {"dt": "2025-01-01"},
+		"statements": ["DELETE FROM staging.orders WHERE dt = {{ literal .dt }}"],
+		"materialize": {"table": "analytics.daily", "query": "SELECT * FROM staging.orders WHERE dt <> {{ literal .dt }}"}
+	}`
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM staging.orders WHERE dt = '2025-01-01'").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`DROP TABLE IF EXISTS "analytics"."daily__haku_tmp"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE "analytics"."daily__haku_tmp" AS SELECT * FROM staging.orders WHERE dt <> '2025-01-01'`).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec(`DROP TABLE IF EXISTS "analytics"."daily"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "analytics"."daily__haku_tmp" RENAME TO "daily"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectClose()
+
+	run := NewRun(store.Task{ID: 1, PipelineID: 1, Config: json.RawMessage(config)}, &store.TaskRun{ID: 7})
+	err := transform.Run(context.Background(), run)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(13), *run.Record.RowsAffected)
+	assert.Contains(t, run.Log.String(), "materialized 10 rows into analytics.daily")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestSQLTransform_RunRollsBack(t *testing.T) {
+	transform, mock := newSQLTransformTest(t)
+
+	config := `{"connection": "warehouse", "statements": ["UPDATE a SET x = 1", "UPDATE b SET y = 1"]}`
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE a SET x = 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE b SET y = 1").WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	run := NewRun(store.Task{ID: 1, PipelineID: 1, Config: json.RawMessage(config)}, &store.TaskRun{ID: 7})
+	err := transform.Run(context.Background(), run)
+
+	assert.ErrorContains(t, err, "statement 1")
+	assert.Nil(t, run.Record.RowsAffected)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRenderSQL(t *testing.T) {
+	data := map[string]any{"name": "O'Brien", "table": `we"ird`}
+
+	query, err := renderSQL("SELECT * FROM {{ ident .table }} WHERE name = {{ literal .name }}", data)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM "we""ird" WHERE name = 'O''Brien'`, query)
+
+	_, err = renderSQL("SELECT {{ .missing }}", data)
+	assert.Error(t, err)
+}
@@ -0,0 +1,244 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/LincolnG4/Haku/internal/utils"
+)
+
+var (
+	ErrUnknownType = errors.New("unknown task type")
+)
+
+// Handler implements a task type.
+type Handler interface {
+	// Validate checks the task configuration before the task is saved.
+	Validate(ctx context.Context, task store.Task) error
+	// Run executes the task. A returned error fails the run.
+	Run(ctx context.Context, run *Run) error
+}
+
+// Registry maps task types to their handlers.
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers: make(map[string]Handler),
+	}
+}
+
+func (r *Registry) Register(taskType string, handler Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.handlers[taskType] = handler
+}
+
+func (r *Registry) Get(taskType string) (Handler, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	handler, ok := r.handlers[taskType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownType, taskType)
+	}
+	return handler, nil
+}
+
+// Validate looks up the handler of the task type and validates the task
+// configuration with it.
+func (r *Registry) Validate(ctx context.Context, task store.Task) error {
+	handler, err := r.Get(task.Type)
+	if err != nil {
+		return err
+	}
+	return handler.Validate(ctx, task)
+}
+
+// Run is the execution of a task handed to its handler.
+type Run struct {
+	Task   store.Task
+	Record *store.TaskRun
+	Log    *Log
+
+	state     string
+	staged    []stagedOutput
+	onSuccess []func(context.Context) error
+	datasets  []store.RunDataset
+	// baseline is the source schema of the last successful run.
+	baseline *record.Schema
+	// preview replaces the sink of a preview run.
+	preview *previewSink
+	// checkpoint saves the progress of the run when the task checkpoints.
+	checkpoint *checkpointer
+}
+
+// stagedOutput is an output written to a staging location.
+type stagedOutput struct {
+	publish func() error
+	discard func()
+}
+
+func NewRun(task store.Task, record *store.TaskRun) *Run {
+	return &Run{
+		Task:   task,
+		Record: record,
+		Log:    NewLog(),
+	}
+}
+
+// SetState overrides the state the run finishes with when the handler
+// returns without error. By default a run succeeds.
+func (r *Run) SetState(state string) {
+	r.state = state
+}
+
+// OnSuccess registers fn to run once the handler has returned without
+// error. A failing fn fails the run. Handlers use it to commit state, such
+// as a high-water mark, only for successful runs.
+func (r *Run) OnSuccess(fn func(context.Context) error) {
+	r.onSuccess = append(r.onSuccess, fn)
+}
+
+// Stage registers an output written to a staging location. Staged outputs
+// are published once the handler has returned without error, before the
+// OnSuccess functions run, and discarded otherwise.
+func (r *Run) Stage(publish func() error, discard func()) {
+	r.staged = append(r.staged, stagedOutput{publish: publish, discard: discard})
+}
+
+// complete finishes a run whose handler returned err. The staged outputs
+// of a failed run are discarded. Otherwise they are published and the
+// OnSuccess functions run, the first error failing the run.
+func (r *Run) complete(ctx context.Context, err error) error {
+	if err != nil {
+		r.discard()
+		return err
+	}
+
+	for len(r.staged) > 0 {
+		output := r.staged[0]
+		r.staged = r.staged[1:]
+		if err := output.publish(); err != nil {
+			output.discard()
+			r.discard()
+			return fmt.Errorf("failed to publish output: %w", err)
+		}
+	}
+
+	for _, fn := range r.onSuccess {
+		if err := fn(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discard discards the outputs staged and not yet published.
+func (r *Run) discard() {
+	for _, output := range r.staged {
+		output.discard()
+	}
+	r.staged = nil
+}
+
+// Reads records that the run reads a dataset, for lineage. Files are
+// named by their path, with no connection.
+func (r *Run) Reads(connection, name string) {
+	r.access(store.DatasetRead, connection, name)
+}
+
+// Writes records that the run writes a dataset, for lineage.
+func (r *Run) Writes(connection, name string) {
+	r.access(store.DatasetWrite, connection, name)
+}
+
+func (r *Run) access(access, connection, name string) {
+	if name == "" {
+		return
+	}
+	if connection == "" && filepath.IsAbs(name) {
+		name = filepath.Clean(name)
+	}
+
+	d := store.RunDataset{
+		RunID:   r.Record.ID,
+		TaskID:  r.Task.ID,
+		Access:  access,
+		Dataset: store.Dataset{Connection: connection, Name: name},
+	}
+	for _, e := range r.datasets {
+		if e.Access == d.Access && e.Dataset == d.Dataset {
+			return
+		}
+	}
+	r.datasets = append(r.datasets, d)
+}
+
+func (r *Run) SetExitCode(code int) {
+	r.Record.ExitCode = &code
+}
+
+func (r *Run) SetRowsAffected(rows int64) {
+	r.Record.RowsAffected = &rows
+}
+
+// SetStats records the stage counters of a record pipeline. The rows
+// written by its sink become the row count of the run.
+func (r *Run) SetStats(stats record.Stats) {
+	if data, err := json.Marshal(stats); err == nil {
+		r.Record.Stats = data
+	}
+	r.SetRowsAffected(stats.Written())
+}
+
+// decodeConfig strictly decodes a task configuration and validates it
+// with the struct tags of v, along with the output options it embeds.
+func decodeConfig(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		return errors.New("config is required")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := utils.Validate.Struct(v); err != nil {
+		return err
+	}
+	if o, ok := v.(interface{ validateOutput(cfg any) error }); ok {
+		return o.validateOutput(v)
+	}
+	return nil
+}
+
+// parseTimeout parses a duration such as "90s" or "15m", falling back to
+// def when it is empty.
+func parseTimeout(timeout string, def time.Duration) (time.Duration, error) {
+	if timeout == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout: %w", err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("timeout must be positive")
+	}
+	return d, nil
+}
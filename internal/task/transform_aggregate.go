@@ -0,0 +1,700 @@
+package task
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+const TransformAggregateType = "transform.aggregate"
+
+const (
+	AggCount         string = "count"
+	AggCountDistinct string = "count_distinct"
+	AggSum           string = "sum"
+	AggAvg           string = "avg"
+	AggMin           string = "min"
+	AggMax           string = "max"
+	AggFirst         string = "first"
+	AggLast          string = "last"
+)
+
+const defaultAggregateMemoryGroups = 100000
+
+// Aggregation computes a value over the records of each group. Nulls are
+// ignored, so count with a column counts its values that are not null
+// while count without one counts records. Min and max compare numbers or
+// strings, and first and last are the first and last values in the order
+// the records were read.
+type Aggregation struct {
+	Op     string `json:"op" validate:"required,oneof=count count_distinct sum avg min max first last"`
+	Column string `json:"column"`
+	// As names the result, op_column by default, or count for a count of
+	// records.
+	As string `json:"as"`
+}
+
+type TransformAggregateConfig struct {
+	SourcePath string `json:"source_path" validate:"required"`
+	TargetPath string `json:"target_path" validate:"required"`
+	// GroupBy are the columns records are grouped by. Without them all
+	// records form a single group.
+	GroupBy      []string      `json:"group_by"`
+	Aggregations []Aggregation `json:"aggregations" validate:"required,min=1,dive"`
+	// MaxMemoryGroups is how many groups, together with the distinct
+	// values count_distinct keeps for them, are held in memory. Once there
+	// are more, they are written to a file next to the target and merged
+	// at the end.
+	MaxMemoryGroups int `json:"max_memory_groups" validate:"min=0"`
+	OutputConfig
+}
+
+// TransformAggregate groups the records of a JSON lines file and writes a
+// record per group with the results of the aggregations. Groups are
+// written in the order they first appear, unless they spilled to disk, in
+// which case their order is not defined.
+type TransformAggregate struct {
+	store    store.Storage
+	registry *Registry
+}
+
+func NewTransformAggregate(storage store.Storage, registry *Registry) *TransformAggregate {
+	return &TransformAggregate{store: storage, registry: registry}
+}
+
+// Validate checks the columns against the schema of the upstream records
+// when it is known.
+func (a *TransformAggregate) Validate(ctx context.Context, task store.Task) error {
+	_, err := a.OutputSchema(ctx, task)
+	return err
+}
+
+// OutputSchema returns the group columns followed by the aggregations.
+func (a *TransformAggregate) OutputSchema(ctx context.Context, task store.Task) (*record.Schema, error) {
+	cfg, err := a.config(task)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := upstreamSchema(ctx, a.store, a.registry, task, cfg.SourcePath)
+	if err != nil || source == nil {
+		return nil, err
+	}
+
+	out := &record.Schema{}
+	for _, c := range cfg.GroupBy {
+		field, ok := source.Field(c)
+		if !ok {
+			return nil, fmt.Errorf("group_by: unknown column %q", c)
+		}
+		out.Fields = append(out.Fields, field)
+	}
+
+	for i, agg := range cfg.Aggregations {
+		field := record.Field{Name: agg.As, Type: record.TypeInteger}
+		if agg.Column != "" {
+			column, ok := source.Field(agg.Column)
+			if !ok {
+				return nil, fmt.Errorf("aggregation %d (%s): unknown column %q", i+1, agg.Op, agg.Column)
+			}
+
+			switch agg.Op {
+			case AggSum, AggAvg:
+				if !slices.Contains([]record.Type{record.TypeInteger, record.TypeFloat, record.TypeDecimal, record.TypeAny}, column.Type) {
+					return nil, fmt.Errorf("aggregation %d (%s): column %s is %s, not a number", i+1, agg.Op, agg.Column, column.Type)
+				}
+				field.Type, field.Nullable = record.TypeFloat, true
+				if agg.Op == AggSum && column.Type == record.TypeInteger {
+					field.Type = record.TypeInteger
+				}
+			case AggMin, AggMax, AggFirst, AggLast:
+				field.Type, field.Nullable = column.Type, true
+			}
+		}
+		out.Fields = append(out.Fields, field)
+	}
+	return out, nil
+}
+
+func (a *TransformAggregate) config(task store.Task) (TransformAggregateConfig, error) {
+	var cfg TransformAggregateConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if err := validateSourcePath(cfg.SourcePath); err != nil {
+		return cfg, err
+	}
+	if err := validateOutputPath(cfg.TargetPath); err != nil {
+		return cfg, err
+	}
+	if cfg.SourcePath == cfg.TargetPath {
+		return cfg, fmt.Errorf("target_path must differ from source_path")
+	}
+	if cfg.MaxMemoryGroups == 0 {
+		cfg.MaxMemoryGroups = defaultAggregateMemoryGroups
+	}
+
+	names := slices.Clone(cfg.GroupBy)
+	for i := range cfg.Aggregations {
+		agg := &cfg.Aggregations[i]
+		if agg.Column == "" && agg.Op != AggCount {
+			return cfg, fmt.Errorf("aggregation %d (%s): column is required", i+1, agg.Op)
+		}
+		if agg.As == "" {
+			agg.As = agg.Op
+			if agg.Column != "" {
+				agg.As += "_" + agg.Column
+			}
+		}
+		names = append(names, agg.As)
+	}
+	if err := uniqueColumns(names); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func (a *TransformAggregate) Run(ctx context.Context, run *Run) error {
+	cfg, err := a.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	sink, err := newJSONLOutput(run, cfg.TargetPath, cfg.Partition)
+	if err != nil {
+		return err
+	}
+
+	transform := &aggregateTransform{
+		cfg:    cfg,
+		groups: make(map[string]*aggGroup),
+		spills: newSpills(filepath.Dir(cfg.TargetPath), "aggregate"),
+	}
+	defer transform.spills.remove()
+
+	stats, err := runPipeline(ctx, run, nil, jsonlSource(TransformAggregateType, cfg.SourcePath), sink, transform)
+	if err != nil {
+		return err
+	}
+
+	if n := len(transform.spills.files); n > 0 {
+		run.Log.Printf("spilled groups to disk %d times", n)
+	}
+	run.Log.Printf("aggregated %d records into %d groups in %s", stats.Read(), stats.Written(), cfg.TargetPath)
+	return nil
+}
+
+// aggGroup holds the values of the group columns and the state of each
+// aggregation for a group.
+type aggGroup struct {
+	values []any
+	states []aggState
+}
+
+// aggregateTransform groups records in memory. When there are too many
+// groups, they are written to a spill file and dropped from memory; Flush
+// then merges the spill files.
+type aggregateTransform struct {
+	cfg    TransformAggregateConfig
+	groups map[string]*aggGroup
+	order  []string
+	seq    int64
+	spills *spills
+	// values counts the distinct values held by the groups in memory.
+	values int
+}
+
+func (t *aggregateTransform) Name() string {
+	return "aggregate"
+}
+
+func (t *aggregateTransform) Apply(ctx context.Context, batch record.Batch) (record.Batch, error) {
+	for _, r := range batch {
+		t.seq++
+		key := groupKey(r, t.cfg.GroupBy)
+
+		group, ok := t.groups[key]
+		if len(t.groups)+t.values >= t.cfg.MaxMemoryGroups && (!ok || t.values > 0) {
+			if err := t.spill(); err != nil {
+				return nil, err
+			}
+			ok = false
+		}
+		if !ok {
+			group = t.newGroup()
+			for _, c := range t.cfg.GroupBy {
+				group.values = append(group.values, r[c])
+			}
+			t.groups[key] = group
+			t.order = append(t.order, key)
+		}
+
+		for i, agg := range t.cfg.Aggregations {
+			v := r[agg.Column]
+			if agg.Column == "" {
+				v = true // a count of records
+			}
+			if d, ok := group.states[i].(*distinctState); ok {
+				if d.insert(v) {
+					t.values++
+				}
+				continue
+			}
+			if err := group.states[i].add(v, t.seq); err != nil {
+				return nil, fmt.Errorf("record %d: aggregation %s: column %s: %w", t.seq, agg.As, agg.Column, err)
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (t *aggregateTransform) newGroup() *aggGroup {
+	group := &aggGroup{states: make([]aggState, len(t.cfg.Aggregations))}
+	for i, agg := range t.cfg.Aggregations {
+		group.states[i] = newAggState(agg.Op)
+	}
+	return group
+}
+
+func (t *aggregateTransform) Flush(ctx context.Context, w record.Writer) error {
+	// Without group columns there is always a group, as in SQL.
+	if len(t.cfg.GroupBy) == 0 && t.seq == 0 {
+		return w.Write(t.output(t.newGroup()))
+	}
+
+	if len(t.spills.files) == 0 {
+		for _, key := range t.order {
+			if err := w.Write(t.output(t.groups[key])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := t.spill(); err != nil {
+		return err
+	}
+	return t.merge(w)
+}
+
+func (t *aggregateTransform) output(group *aggGroup) record.Record {
+	r := make(record.Record, len(t.cfg.GroupBy)+len(t.cfg.Aggregations))
+	for i, c := range t.cfg.GroupBy {
+		r[c] = group.values[i]
+	}
+	for i, agg := range t.cfg.Aggregations {
+		r[agg.As] = group.states[i].result()
+	}
+	return r
+}
+
+// spilledGroup is a line of a spill file: a group, or a distinct value
+// of a count_distinct aggregation of the group before it. Keys are hex
+// encoded, which keeps their order, so that the key of a group followed
+// by a space and the aggregation and value sorts after the group and
+// before the next one.
+type spilledGroup struct {
+	Key    string            `json:"key"`
+	Values []any             `json:"values,omitempty"`
+	States []json.RawMessage `json:"states,omitempty"`
+	// Agg is the aggregation of a distinct value.
+	Agg int `json:"agg,omitempty"`
+}
+
+func (g spilledGroup) spillKey() string {
+	return g.Key
+}
+
+// spill writes the groups in memory to a new spill file, each followed by
+// its distinct values in order.
+func (t *aggregateTransform) spill() error {
+	err := t.spills.write(func(encode func(any) error) error {
+		for _, key := range slices.Sorted(maps.Keys(t.groups)) {
+			group := t.groups[key]
+			prefix := hex.EncodeToString([]byte(key))
+			line := spilledGroup{Key: prefix, Values: group.values, States: make([]json.RawMessage, len(group.states))}
+			for i, state := range group.states {
+				var err error
+				if line.States[i], err = json.Marshal(state); err != nil {
+					return err
+				}
+			}
+			if err := encode(line); err != nil {
+				return err
+			}
+
+			for i, state := range group.states {
+				d, ok := state.(*distinctState)
+				if !ok {
+					continue
+				}
+				for _, v := range slices.Sorted(maps.Keys(d.values)) {
+					key := fmt.Sprintf("%s %08d %s", prefix, i, hex.EncodeToString([]byte(v)))
+					if err := encode(spilledGroup{Key: key, Agg: i}); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	clear(t.groups)
+	t.order = t.order[:0]
+	t.values = 0
+	return nil
+}
+
+// merge writes each group of the spill files once, with the states of all
+// files merged. The distinct values of a group follow it, each once
+// whatever the number of files holding it, and are counted as they come.
+func (t *aggregateTransform) merge(w record.Writer) error {
+	var group *aggGroup
+	err := mergeSpills(t.spills, func(lines []spilledGroup) error {
+		if lines[0].States == nil {
+			group.states[lines[0].Agg].(*distinctState).n++
+			return nil
+		}
+
+		if group != nil {
+			if err := w.Write(t.output(group)); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		group, err = t.decodeGroup(lines[0])
+		if err != nil {
+			return err
+		}
+		for _, line := range lines[1:] {
+			next, err := t.decodeGroup(line)
+			if err != nil {
+				return err
+			}
+			for i, state := range group.states {
+				if err := state.merge(next.states[i]); err != nil {
+					return fmt.Errorf("aggregation %s: %w", t.cfg.Aggregations[i].As, err)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil || group == nil {
+		return err
+	}
+	return w.Write(t.output(group))
+}
+
+func (t *aggregateTransform) decodeGroup(line spilledGroup) (*aggGroup, error) {
+	group := t.newGroup()
+	group.values = line.Values
+	for i, state := range group.states {
+		decoder := json.NewDecoder(bytes.NewReader(line.States[i]))
+		decoder.UseNumber()
+		if err := decoder.Decode(state); err != nil {
+			return nil, fmt.Errorf("spill file: %w", err)
+		}
+	}
+	return group, nil
+}
+
+// groupKey returns a key equal for records with equal values in the
+// columns. Unlike joinKey, nulls form a group of their own.
+func groupKey(r map[string]any, columns []string) string {
+	var b strings.Builder
+	for _, c := range columns {
+		b.WriteString(valueKey(r[c]))
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// aggState is the running result of an aggregation over a group. States
+// are written to spill files as JSON and merged when read back.
+type aggState interface {
+	// add adds a value of the column read in position seq.
+	add(v any, seq int64) error
+	merge(other aggState) error
+	result() any
+}
+
+func newAggState(op string) aggState {
+	switch op {
+	case AggCount:
+		return &countState{}
+	case AggCountDistinct:
+		return &distinctState{values: make(map[string]bool)}
+	case AggSum:
+		return &sumState{}
+	case AggAvg:
+		return &avgState{}
+	case AggMin:
+		return &extremeState{}
+	case AggMax:
+		return &extremeState{max: true}
+	case AggFirst:
+		return &edgeState{}
+	case AggLast:
+		return &edgeState{last: true}
+	}
+	panic("unknown aggregation " + op)
+}
+
+type countState struct {
+	N int64 `json:"n"`
+}
+
+func (s *countState) add(v any, seq int64) error {
+	if v != nil {
+		s.N++
+	}
+	return nil
+}
+
+func (s *countState) merge(other aggState) error {
+	s.N += other.(*countState).N
+	return nil
+}
+
+func (s *countState) result() any {
+	return s.N
+}
+
+// distinctState keeps the distinct values of a group by key. They are not
+// part of its JSON: a spill file holds them on lines of their own, which
+// merge counts in n.
+type distinctState struct {
+	values map[string]bool
+	n      int64
+}
+
+// insert adds a value and reports whether it is new.
+func (s *distinctState) insert(v any) bool {
+	if v == nil {
+		return false
+	}
+	key := valueKey(v)
+	if s.values[key] {
+		return false
+	}
+	s.values[key] = true
+	return true
+}
+
+func (s *distinctState) add(v any, seq int64) error {
+	s.insert(v)
+	return nil
+}
+
+func (s *distinctState) merge(other aggState) error {
+	for key := range other.(*distinctState).values {
+		s.values[key] = true
+	}
+	return nil
+}
+
+func (s *distinctState) result() any {
+	return int64(len(s.values)) + s.n
+}
+
+// sumState sums integers exactly until a float is added or the sum
+// overflows.
+type sumState struct {
+	Int     int64   `json:"int"`
+	Float   float64 `json:"float"`
+	IsFloat bool    `json:"is_float"`
+	N       int64   `json:"n"`
+}
+
+func (s *sumState) add(v any, seq int64) error {
+	if v == nil {
+		return nil
+	}
+	i, f, isInt, ok := toNumber(v)
+	if !ok {
+		return fmt.Errorf("%v is not a number", v)
+	}
+	s.addNumber(i, f, isInt)
+	s.N++
+	return nil
+}
+
+func (s *sumState) addNumber(i int64, f float64, isInt bool) {
+	if isInt && !s.IsFloat {
+		if sum := s.Int + i; (sum > s.Int) == (i > 0) {
+			s.Int = sum
+			return
+		}
+	}
+	if !s.IsFloat {
+		s.IsFloat = true
+		s.Float = float64(s.Int)
+	}
+	s.Float += f
+}
+
+func (s *sumState) merge(other aggState) error {
+	s.mergeSum(other.(*sumState))
+	return nil
+}
+
+func (s *sumState) mergeSum(o *sumState) {
+	if o.N == 0 {
+		return
+	}
+	if o.IsFloat {
+		s.addNumber(0, o.Float, false)
+	} else {
+		s.addNumber(o.Int, float64(o.Int), true)
+	}
+	s.N += o.N
+}
+
+func (s *sumState) result() any {
+	switch {
+	case s.N == 0:
+		return nil
+	case s.IsFloat:
+		return s.Float
+	}
+	return s.Int
+}
+
+type avgState struct {
+	sumState
+}
+
+func (s *avgState) merge(other aggState) error {
+	s.mergeSum(&other.(*avgState).sumState)
+	return nil
+}
+
+func (s *avgState) result() any {
+	if s.N == 0 {
+		return nil
+	}
+	if s.IsFloat {
+		return s.Float / float64(s.N)
+	}
+	return float64(s.Int) / float64(s.N)
+}
+
+type extremeState struct {
+	Value any  `json:"value"`
+	Set   bool `json:"set"`
+	max   bool
+}
+
+func (s *extremeState) add(v any, seq int64) error {
+	if v == nil {
+		return nil
+	}
+	if !s.Set {
+		s.Value, s.Set = v, true
+		return nil
+	}
+
+	c, err := compareValues(v, s.Value)
+	if err != nil {
+		return err
+	}
+	if (s.max && c > 0) || (!s.max && c < 0) {
+		s.Value = v
+	}
+	return nil
+}
+
+func (s *extremeState) merge(other aggState) error {
+	if o := other.(*extremeState); o.Set {
+		return s.add(o.Value, 0)
+	}
+	return nil
+}
+
+func (s *extremeState) result() any {
+	return s.Value
+}
+
+// edgeState keeps the first or last value by position.
+type edgeState struct {
+	Value any   `json:"value"`
+	Seq   int64 `json:"seq"`
+	Set   bool  `json:"set"`
+	last  bool
+}
+
+func (s *edgeState) add(v any, seq int64) error {
+	if v == nil {
+		return nil
+	}
+	if !s.Set || (s.last && seq > s.Seq) || (!s.last && seq < s.Seq) {
+		s.Value, s.Seq, s.Set = v, seq, true
+	}
+	return nil
+}
+
+func (s *edgeState) merge(other aggState) error {
+	if o := other.(*edgeState); o.Set {
+		return s.add(o.Value, o.Seq)
+	}
+	return nil
+}
+
+func (s *edgeState) result() any {
+	return s.Value
+}
+
+// toNumber returns a number as an integer, when it is one, and as a float.
+func toNumber(v any) (i int64, f float64, isInt, ok bool) {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, float64(n), true, true
+		}
+		if x, err := v.Float64(); err == nil {
+			return 0, x, false, true
+		}
+	case int64:
+		return v, float64(v), true, true
+	case int:
+		return int64(v), float64(v), true, true
+	case float64:
+		return 0, v, false, true
+	}
+	return 0, 0, false, false
+}
+
+// compareValues orders two numbers or two strings.
+func compareValues(a, b any) (int, error) {
+	ai, af, aInt, aNum := toNumber(a)
+	bi, bf, bInt, bNum := toNumber(b)
+	if aNum && bNum {
+		if aInt && bInt {
+			return cmp.Compare(ai, bi), nil
+		}
+		return cmp.Compare(af, bf), nil
+	}
+
+	as, aStr := a.(string)
+	bs, bStr := b.(string)
+	if aStr && bStr {
+		return strings.Compare(as, bs), nil
+	}
+	return 0, fmt.Errorf("cannot compare %v with %v", a, b)
+}
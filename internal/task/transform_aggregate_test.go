@@ -0,0 +1,165 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransformAggregate_Run(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "orders.jsonl")
+	target := filepath.Join(dir, "totals.jsonl")
+	data := `{"country": "JP", "city": "Tokyo", "customer": 1, "amount": 10, "at": "2024-01-02"}` + "\n" +
+		`{"country": "FR", "city": "Paris", "customer": 2, "amount": 2.5, "at": "2024-01-01"}` + "\n" +
+		`{"country": "JP", "city": "Osaka", "customer": 1, "amount": 5, "at": "2024-01-01"}` + "\n" +
+		`{"country": "JP", "city": null, "customer": 3, "amount": null, "at": "2024-01-03"}` + "\n" +
+		`{"country": null, "city": "Nowhere", "customer": 4, "amount": 1, "at": "2024-01-04"}` + "\n"
+	assert.NoError(t, os.WriteFile(source, []byte(data), 0o644))
+
+	config := TransformAggregateConfig{
+		SourcePath: source,
+		TargetPath: target,
+		GroupBy:    []string{"country"},
+		Aggregations: []Aggregation{
+			{Op: AggCount},
+			{Op: AggCount, Column: "amount"},
+			{Op: AggCountDistinct, Column: "customer", As: "customers"},
+			{Op: AggSum, Column: "amount"},
+			{Op: AggAvg, Column: "amount"},
+			{Op: AggMin, Column: "at"},
+			{Op: AggMax, Column: "amount"},
+			{Op: AggFirst, Column: "city"},
+			{Op: AggLast, Column: "city"},
+		},
+	}
+	want := []map[string]any{
+		{
+			"country": "JP", "count": 3.0, "count_amount": 2.0, "customers": 2.0, "sum_amount": 15.0,
+			"avg_amount": 7.5, "min_at": "2024-01-01", "max_amount": 10.0, "first_city": "Tokyo", "last_city": "Osaka",
+		},
+		{
+			"country": "FR", "count": 1.0, "count_amount": 1.0, "customers": 1.0, "sum_amount": 2.5,
+			"avg_amount": 2.5, "min_at": "2024-01-01", "max_amount": 2.5, "first_city": "Paris", "last_city": "Paris",
+		},
+		{
+			"country": nil, "count": 1.0, "count_amount": 1.0, "customers": 1.0, "sum_amount": 1.0,
+			"avg_amount": 1.0, "min_at": "2024-01-04", "max_amount": 1.0, "first_city": "Nowhere", "last_city": "Nowhere",
+		},
+	}
+
+	run, err := runTask(t, NewTransformAggregate(store.NewMockStore(), NewRegistry()), TransformAggregateType, config)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), *run.Record.RowsAffected)
+	assert.Equal(t, want, readLines(t, target))
+
+	t.Run("spill to disk", func(t *testing.T) {
+		spilled := config
+		spilled.MaxMemoryGroups = 1
+
+		run, err := runTask(t, NewTransformAggregate(store.NewMockStore(), NewRegistry()), TransformAggregateType, spilled)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), *run.Record.RowsAffected)
+
+		byCountry := func(lines []map[string]any) []map[string]any {
+			slices.SortFunc(lines, func(a, b map[string]any) int {
+				return strings.Compare(fmt.Sprint(a["country"]), fmt.Sprint(b["country"]))
+			})
+			return lines
+		}
+		assert.Equal(t, byCountry(slices.Clone(want)), byCountry(readLines(t, target)))
+
+		matches, _ := filepath.Glob(filepath.Join(dir, ".aggregate.*"))
+		assert.Empty(t, matches, "spill files are removed")
+	})
+
+	t.Run("count distinct of a group larger than memory", func(t *testing.T) {
+		many := filepath.Join(dir, "many.jsonl")
+		var b strings.Builder
+		for i := range 50 {
+			fmt.Fprintf(&b, `{"customer": %d}`+"\n", i%20)
+		}
+		assert.NoError(t, os.WriteFile(many, []byte(b.String()), 0o644))
+
+		cfg := config
+		cfg.SourcePath = many
+		cfg.GroupBy = nil
+		cfg.MaxMemoryGroups = 4
+		cfg.Aggregations = []Aggregation{{Op: AggCount}, {Op: AggCountDistinct, Column: "customer"}}
+		_, err := runTask(t, NewTransformAggregate(store.NewMockStore(), NewRegistry()), TransformAggregateType, cfg)
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]any{{"count": 50.0, "count_distinct_customer": 20.0}}, readLines(t, target))
+	})
+
+	t.Run("no records and no groups", func(t *testing.T) {
+		empty := filepath.Join(dir, "empty.jsonl")
+		assert.NoError(t, os.WriteFile(empty, nil, 0o644))
+
+		cfg := config
+		cfg.SourcePath = empty
+		cfg.GroupBy = nil
+		cfg.Aggregations = []Aggregation{{Op: AggCount}, {Op: AggSum, Column: "amount"}}
+		_, err := runTask(t, NewTransformAggregate(store.NewMockStore(), NewRegistry()), TransformAggregateType, cfg)
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]any{{"count": 0.0, "sum_amount": nil}}, readLines(t, target))
+	})
+
+	t.Run("sum of strings", func(t *testing.T) {
+		cfg := config
+		cfg.Aggregations = []Aggregation{{Op: AggSum, Column: "city"}}
+		_, err := runTask(t, NewTransformAggregate(store.NewMockStore(), NewRegistry()), TransformAggregateType, cfg)
+		assert.EqualError(t, err, "aggregation 1 (sum): column city is string, not a number")
+	})
+}
+
+func TestTransformAggregate_Validate(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "orders.jsonl")
+	assert.NoError(t, os.WriteFile(source, []byte(`{"country": "JP", "amount": 1}`+"\n"), 0o644))
+
+	a := NewTransformAggregate(store.NewMockStore(), NewRegistry())
+	validate := func(groupBy []string, aggs ...Aggregation) error {
+		return a.Validate(context.Background(), store.Task{
+			Type: TransformAggregateType,
+			Config: mustMarshal(TransformAggregateConfig{
+				SourcePath:   source,
+				TargetPath:   filepath.Join(dir, "totals.jsonl"),
+				GroupBy:      groupBy,
+				Aggregations: aggs,
+			}),
+		})
+	}
+
+	schema, err := a.OutputSchema(context.Background(), store.Task{
+		Type: TransformAggregateType,
+		Config: mustMarshal(TransformAggregateConfig{
+			SourcePath:   source,
+			TargetPath:   filepath.Join(dir, "totals.jsonl"),
+			GroupBy:      []string{"country"},
+			Aggregations: []Aggregation{{Op: AggSum, Column: "amount"}, {Op: AggAvg, Column: "amount"}},
+		}),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"country", "sum_amount", "avg_amount"}, schema.Names())
+
+	tests := []struct {
+		groupBy []string
+		agg     Aggregation
+		err     string
+	}{
+		{nil, Aggregation{Op: AggSum}, "aggregation 1 (sum): column is required"},
+		{nil, Aggregation{Op: AggMax, Column: "missing"}, `aggregation 1 (max): unknown column "missing"`},
+		{[]string{"missing"}, Aggregation{Op: AggCount}, `group_by: unknown column "missing"`},
+		{[]string{"country"}, Aggregation{Op: AggCount, As: "country"}, `duplicate column "country"`},
+	}
+	for _, tt := range tests {
+		assert.EqualError(t, validate(tt.groupBy, tt.agg), tt.err)
+	}
+}
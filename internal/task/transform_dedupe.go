@@ -0,0 +1,281 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+const TransformDedupeType = "transform.dedupe"
+
+const (
+	KeepFirst string = "first"
+	KeepLast  string = "last"
+	KeepMax   string = "max"
+)
+
+// DuplicatesCounter is the counter of a dedupe run holding the number of
+// records it dropped.
+const DuplicatesCounter = "duplicates"
+
+const defaultDedupeMemoryRecords = 100000
+
+type TransformDedupeConfig struct {
+	SourcePath string `json:"source_path" validate:"required"`
+	TargetPath string `json:"target_path" validate:"required"`
+	// Keys are the columns identifying a record. Nulls are equal to each
+	// other.
+	Keys []string `json:"keys" validate:"required,min=1,dive,required"`
+	// Keep chooses the record kept for each key: the first or last one
+	// read, or the one with the largest value of OrderBy. Records where it
+	// is null lose, and ties go to the first one read.
+	Keep    string `json:"keep" validate:"omitempty,oneof=first last max"`
+	OrderBy string `json:"order_by"`
+	// MaxMemoryRecords is how many records are held in memory. Once there
+	// are more, they are sorted into files next to the target and merged at
+	// the end.
+	MaxMemoryRecords int `json:"max_memory_records" validate:"min=0"`
+	OutputConfig
+}
+
+// TransformDedupe drops the records of a JSON lines file that share a key
+// with another one. Records are written in the order their key first
+// appears, unless they spilled to disk, in which case their order is not
+// defined. The number of duplicates is kept in the counters of the run.
+type TransformDedupe struct {
+	store    store.Storage
+	registry *Registry
+}
+
+func NewTransformDedupe(storage store.Storage, registry *Registry) *TransformDedupe {
+	return &TransformDedupe{store: storage, registry: registry}
+}
+
+// Validate checks the columns against the schema of the upstream records
+// when it is known.
+func (d *TransformDedupe) Validate(ctx context.Context, task store.Task) error {
+	_, err := d.OutputSchema(ctx, task)
+	return err
+}
+
+// OutputSchema returns the upstream schema, which deduplication keeps.
+func (d *TransformDedupe) OutputSchema(ctx context.Context, task store.Task) (*record.Schema, error) {
+	cfg, err := d.config(task)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := upstreamSchema(ctx, d.store, d.registry, task, cfg.SourcePath)
+	if err != nil || schema == nil {
+		return nil, err
+	}
+	if err := requireColumns(*schema, cfg.Keys...); err != nil {
+		return nil, fmt.Errorf("keys: %w", err)
+	}
+	if cfg.OrderBy != "" {
+		if err := requireColumns(*schema, cfg.OrderBy); err != nil {
+			return nil, fmt.Errorf("order_by: %w", err)
+		}
+	}
+	return schema, nil
+}
+
+func (d *TransformDedupe) config(task store.Task) (TransformDedupeConfig, error) {
+	var cfg TransformDedupeConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if err := validateSourcePath(cfg.SourcePath); err != nil {
+		return cfg, err
+	}
+	if err := validateOutputPath(cfg.TargetPath); err != nil {
+		return cfg, err
+	}
+	if cfg.SourcePath == cfg.TargetPath {
+		return cfg, fmt.Errorf("target_path must differ from source_path")
+	}
+	if err := uniqueColumns(cfg.Keys); err != nil {
+		return cfg, fmt.Errorf("keys: %w", err)
+	}
+
+	if cfg.Keep == "" {
+		cfg.Keep = KeepFirst
+	}
+	if (cfg.Keep == KeepMax) != (cfg.OrderBy != "") {
+		return cfg, fmt.Errorf("order_by is required with keep max, and only applies to it")
+	}
+	if cfg.MaxMemoryRecords == 0 {
+		cfg.MaxMemoryRecords = defaultDedupeMemoryRecords
+	}
+
+	return cfg, nil
+}
+
+func (d *TransformDedupe) Run(ctx context.Context, run *Run) error {
+	cfg, err := d.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	sink, err := newJSONLOutput(run, cfg.TargetPath, cfg.Partition)
+	if err != nil {
+		return err
+	}
+
+	transform := &dedupeTransform{
+		cfg:    cfg,
+		kept:   make(map[string]*dedupeEntry),
+		spills: newSpills(filepath.Dir(cfg.TargetPath), "dedupe"),
+	}
+	defer transform.spills.remove()
+
+	stats, err := runPipeline(ctx, run, nil, jsonlSource(TransformDedupeType, cfg.SourcePath), sink, transform)
+	if err != nil {
+		return err
+	}
+
+	duplicates := stats.Read() - stats.Written()
+	if stats.Counters == nil {
+		stats.Counters = make(map[string]int64)
+	}
+	stats.Counters[DuplicatesCounter] = duplicates
+	run.SetStats(stats)
+
+	if n := len(transform.spills.files); n > 0 {
+		run.Log.Printf("sorted records into %d files on disk", n)
+	}
+	run.Log.Printf("dropped %d duplicates, wrote %d records into %s", duplicates, stats.Written(), cfg.TargetPath)
+	return nil
+}
+
+// dedupeEntry is the record kept for a key so far, and a line of a spill
+// file.
+type dedupeEntry struct {
+	Key    string        `json:"key"`
+	Seq    int64         `json:"seq"`
+	Record record.Record `json:"record"`
+}
+
+func (e dedupeEntry) spillKey() string {
+	return e.Key
+}
+
+// dedupeTransform keeps a record per key in memory. When there are too
+// many, they are written to a spill file and dropped from memory; Flush
+// then merges the spill files, choosing among the records kept for a key
+// in each.
+type dedupeTransform struct {
+	cfg    TransformDedupeConfig
+	kept   map[string]*dedupeEntry
+	order  []string
+	seq    int64
+	spills *spills
+}
+
+func (t *dedupeTransform) Name() string {
+	return "dedupe"
+}
+
+func (t *dedupeTransform) Apply(ctx context.Context, batch record.Batch) (record.Batch, error) {
+	for _, r := range batch {
+		t.seq++
+		entry := &dedupeEntry{Key: groupKey(r, t.cfg.Keys), Seq: t.seq, Record: r}
+
+		kept, ok := t.kept[entry.Key]
+		if !ok {
+			if len(t.kept) >= t.cfg.MaxMemoryRecords {
+				if err := t.spill(); err != nil {
+					return nil, err
+				}
+			}
+			t.kept[entry.Key] = entry
+			t.order = append(t.order, entry.Key)
+			continue
+		}
+
+		replace, err := t.replaces(entry, kept)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", t.seq, err)
+		}
+		if replace {
+			t.kept[entry.Key] = entry
+		}
+	}
+	return nil, nil
+}
+
+// replaces tells whether entry should be kept instead of kept, which was
+// read before it.
+func (t *dedupeTransform) replaces(entry, kept *dedupeEntry) (bool, error) {
+	switch t.cfg.Keep {
+	case KeepLast:
+		return true, nil
+	case KeepMax:
+		v, current := entry.Record[t.cfg.OrderBy], kept.Record[t.cfg.OrderBy]
+		if v == nil || current == nil {
+			return current == nil && v != nil, nil
+		}
+		c, err := compareValues(v, current)
+		if err != nil {
+			return false, fmt.Errorf("order_by %s: %w", t.cfg.OrderBy, err)
+		}
+		return c > 0, nil
+	}
+	return false, nil
+}
+
+func (t *dedupeTransform) Flush(ctx context.Context, w record.Writer) error {
+	if len(t.spills.files) == 0 {
+		for _, key := range t.order {
+			if err := w.Write(t.kept[key].Record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := t.spill(); err != nil {
+		return err
+	}
+	return mergeSpills(t.spills, func(entries []dedupeEntry) error {
+		// The entries are in the order of the spill files, which is the
+		// order they were read in.
+		kept := &entries[0]
+		for i := range entries[1:] {
+			entry := &entries[i+1]
+			replace, err := t.replaces(entry, kept)
+			if err != nil {
+				return fmt.Errorf("record %d: %w", entry.Seq, err)
+			}
+			if replace {
+				kept = entry
+			}
+		}
+		return w.Write(kept.Record)
+	})
+}
+
+// spill writes the records kept in memory to a new spill file.
+func (t *dedupeTransform) spill() error {
+	err := t.spills.write(func(encode func(any) error) error {
+		for _, key := range slices.Sorted(maps.Keys(t.kept)) {
+			if err := encode(t.kept[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	clear(t.kept)
+	t.order = t.order[:0]
+	return nil
+}
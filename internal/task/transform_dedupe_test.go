@@ -0,0 +1,109 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransformDedupe_Run(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "customers.jsonl")
+	target := filepath.Join(dir, "unique.jsonl")
+	data := `{"id": 1, "name": "Chihiro", "version": 1}` + "\n" +
+		`{"id": 2, "name": "Haku", "version": 3}` + "\n" +
+		`{"id": 1.0, "name": "Chihiro Ogino", "version": 3}` + "\n" +
+		`{"id": 2, "name": "Kohaku", "version": null}` + "\n" +
+		`{"id": 1, "name": "Sen", "version": 2}` + "\n" +
+		`{"id": 3, "name": "Lin", "version": 1}` + "\n"
+	assert.NoError(t, os.WriteFile(source, []byte(data), 0o644))
+
+	config := TransformDedupeConfig{
+		SourcePath: source,
+		TargetPath: target,
+		Keys:       []string{"id"},
+	}
+
+	tests := []struct {
+		name   string
+		change func(cfg *TransformDedupeConfig)
+		want   []string
+	}{
+		{"first", func(cfg *TransformDedupeConfig) {}, []string{"Chihiro", "Haku", "Lin"}},
+		{"last", func(cfg *TransformDedupeConfig) { cfg.Keep = KeepLast }, []string{"Sen", "Kohaku", "Lin"}},
+		{"max", func(cfg *TransformDedupeConfig) {
+			cfg.Keep = KeepMax
+			cfg.OrderBy = "version"
+		}, []string{"Chihiro Ogino", "Haku", "Lin"}},
+	}
+	for _, tt := range tests {
+		for _, memory := range []int{0, 1} {
+			cfg := config
+			cfg.MaxMemoryRecords = memory
+			tt.change(&cfg)
+
+			name := tt.name
+			if memory > 0 {
+				name += " spilled to disk"
+			}
+			t.Run(name, func(t *testing.T) {
+				run, err := runTask(t, NewTransformDedupe(store.NewMockStore(), NewRegistry()), TransformDedupeType, cfg)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(3), *run.Record.RowsAffected)
+
+				var stats record.Stats
+				assert.NoError(t, json.Unmarshal(run.Record.Stats, &stats))
+				assert.Equal(t, map[string]int64{DuplicatesCounter: 3}, stats.Counters)
+
+				var names []string
+				for _, line := range readLines(t, target) {
+					names = append(names, line["name"].(string))
+				}
+				want := tt.want
+				if memory > 0 {
+					// Spilled records are written by key.
+					slices.Sort(names)
+					want = slices.Sorted(slices.Values(want))
+				}
+				assert.Equal(t, want, names)
+			})
+		}
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(dir, ".dedupe.*"))
+	assert.Empty(t, matches, "spill files are removed")
+}
+
+func TestTransformDedupe_Validate(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "customers.jsonl")
+	assert.NoError(t, os.WriteFile(source, []byte(`{"id": 1, "version": 1}`+"\n"), 0o644))
+
+	d := NewTransformDedupe(store.NewMockStore(), NewRegistry())
+	validate := func(keys []string, keep, orderBy string) error {
+		return d.Validate(context.Background(), store.Task{
+			Type: TransformDedupeType,
+			Config: mustMarshal(TransformDedupeConfig{
+				SourcePath: source,
+				TargetPath: filepath.Join(dir, "unique.jsonl"),
+				Keys:       keys,
+				Keep:       keep,
+				OrderBy:    orderBy,
+			}),
+		})
+	}
+
+	assert.NoError(t, validate([]string{"id"}, KeepMax, "version"))
+	assert.EqualError(t, validate([]string{"id"}, KeepMax, ""), "order_by is required with keep max, and only applies to it")
+	assert.EqualError(t, validate([]string{"id"}, KeepLast, "version"), "order_by is required with keep max, and only applies to it")
+	assert.EqualError(t, validate([]string{"id", "id"}, "", ""), `keys: duplicate column "id"`)
+	assert.EqualError(t, validate([]string{"missing"}, "", ""), `keys: unknown column "missing"`)
+	assert.EqualError(t, validate([]string{"id"}, KeepMax, "missing"), `order_by: unknown column "missing"`)
+}
@@ -0,0 +1,544 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+const TransformJoinType = "transform.join"
+
+const (
+	JoinInner string = "inner"
+	JoinLeft  string = "left"
+	JoinAnti  string = "anti"
+)
+
+const (
+	DuplicatesError string = "error"
+	DuplicatesFirst string = "first"
+	DuplicatesLast  string = "last"
+	DuplicatesAll   string = "all"
+)
+
+const defaultJoinMemoryRecords = 100000
+
+// JoinReference is the dataset records are joined with, either a JSON
+// lines file or the rows of a query on a postgres connection.
+type JoinReference struct {
+	Path       string `json:"path"`
+	Connection string `json:"connection"`
+	Query      string `json:"query"`
+}
+
+// JoinKey pairs a column of the source with a column of the reference,
+// which has the same name unless set.
+type JoinKey struct {
+	Source    string `json:"source" validate:"required"`
+	Reference string `json:"reference"`
+}
+
+type TransformJoinConfig struct {
+	SourcePath string        `json:"source_path" validate:"required"`
+	TargetPath string        `json:"target_path" validate:"required"`
+	Reference  JoinReference `json:"reference"`
+	// Type is inner by default. Inner joins keep the records with a match
+	// and left joins all of them, with nulls for the reference columns when
+	// there is no match. Anti joins keep the records without a match.
+	Type string    `json:"type" validate:"omitempty,oneof=inner left anti"`
+	Keys []JoinKey `json:"keys" validate:"required,min=1,dive"`
+	// Columns of the reference added to the records, all but the keys by
+	// default, named with Prefix in front.
+	Columns []string `json:"columns"`
+	Prefix  string   `json:"prefix"`
+	// Duplicates tells what to do with reference records sharing a key:
+	// fail the run (error, the default), keep the first or last one, or
+	// keep all of them and write a record for each match.
+	Duplicates string `json:"duplicates" validate:"omitempty,oneof=error first last all"`
+	// MaxMemoryRecords is how many reference records are held in memory.
+	// The others are written to a file next to the target and read back
+	// on each match.
+	MaxMemoryRecords int `json:"max_memory_records" validate:"min=0"`
+	OutputConfig
+}
+
+// TransformJoin enriches the records of a JSON lines file with the
+// matching records of a reference dataset, such as a dimension table.
+// Null keys never match.
+type TransformJoin struct {
+	store    store.Storage
+	registry *Registry
+	open     func(store.Connection) (*sql.DB, error)
+}
+
+func NewTransformJoin(storage store.Storage, registry *Registry) *TransformJoin {
+	return &TransformJoin{store: storage, registry: registry, open: openPostgres}
+}
+
+// Validate checks the keys and columns against the schemas of the source
+// and reference when they are known, and that the connection exists.
+func (j *TransformJoin) Validate(ctx context.Context, task store.Task) error {
+	if _, err := j.OutputSchema(ctx, task); err != nil {
+		return err
+	}
+
+	cfg, _ := j.config(task)
+	if cfg.Reference.Connection != "" {
+		if _, err := taskConnection(ctx, j.store, task, cfg.Reference.Connection); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OutputSchema returns the source schema with the reference columns added.
+// It is nil unless the source schema is known, and the reference one too
+// when columns is not set.
+func (j *TransformJoin) OutputSchema(ctx context.Context, task store.Task) (*record.Schema, error) {
+	cfg, err := j.config(task)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := upstreamSchema(ctx, j.store, j.registry, task, cfg.SourcePath)
+	if err != nil || source == nil {
+		return nil, err
+	}
+	for _, key := range cfg.Keys {
+		if err := requireColumns(*source, key.Source); err != nil {
+			return nil, fmt.Errorf("keys: %w", err)
+		}
+	}
+
+	var reference *record.Schema
+	if cfg.Reference.Path != "" {
+		reference, err = upstreamSchema(ctx, j.store, j.registry, task, cfg.Reference.Path)
+		if err != nil {
+			return nil, fmt.Errorf("reference: %w", err)
+		}
+	}
+	if reference != nil {
+		for _, key := range cfg.Keys {
+			if err := requireColumns(*reference, key.Reference); err != nil {
+				return nil, fmt.Errorf("reference: %w", err)
+			}
+		}
+		if err := requireColumns(*reference, cfg.Columns...); err != nil {
+			return nil, fmt.Errorf("reference: %w", err)
+		}
+	}
+
+	if cfg.Type == JoinAnti {
+		return source, nil
+	}
+
+	columns := cfg.Columns
+	if len(columns) == 0 {
+		if reference == nil {
+			return nil, nil
+		}
+		columns = cfg.referenceColumns(reference.Names())
+	}
+
+	out := record.Schema{Fields: slices.Clone(source.Fields)}
+	for _, c := range columns {
+		name := cfg.Prefix + c
+		if _, ok := source.Field(name); ok {
+			return nil, fmt.Errorf("column %q is already in the source, set a prefix", name)
+		}
+
+		field := record.Field{Name: name, Type: record.TypeAny, Nullable: true}
+		if reference != nil {
+			field, _ = reference.Field(c)
+			field.Name = name
+			field.Nullable = field.Nullable || cfg.Type == JoinLeft
+		}
+		out.Fields = append(out.Fields, field)
+	}
+	return &out, nil
+}
+
+func (j *TransformJoin) config(task store.Task) (TransformJoinConfig, error) {
+	var cfg TransformJoinConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if err := validateSourcePath(cfg.SourcePath); err != nil {
+		return cfg, err
+	}
+	if err := validateOutputPath(cfg.TargetPath); err != nil {
+		return cfg, err
+	}
+	if cfg.SourcePath == cfg.TargetPath {
+		return cfg, fmt.Errorf("target_path must differ from source_path")
+	}
+
+	ref := cfg.Reference
+	switch {
+	case (ref.Path == "") == (ref.Query == ""):
+		return cfg, errors.New("reference: exactly one of path or query is required")
+	case ref.Path != "" && !filepath.IsAbs(ref.Path):
+		return cfg, errors.New("reference: path must be an absolute path")
+	case ref.Path != "" && ref.Connection != "":
+		return cfg, errors.New("reference: connection only applies to queries")
+	case ref.Query != "" && ref.Connection == "":
+		return cfg, errors.New("reference: connection is required with a query")
+	}
+
+	if cfg.Type == "" {
+		cfg.Type = JoinInner
+	}
+	if cfg.Type == JoinAnti && (cfg.Columns != nil || cfg.Prefix != "") {
+		return cfg, errors.New("columns and prefix do not apply to anti joins")
+	}
+	if cfg.Duplicates == "" {
+		cfg.Duplicates = DuplicatesError
+	}
+	if cfg.MaxMemoryRecords == 0 {
+		cfg.MaxMemoryRecords = defaultJoinMemoryRecords
+	}
+
+	for i := range cfg.Keys {
+		if cfg.Keys[i].Reference == "" {
+			cfg.Keys[i].Reference = cfg.Keys[i].Source
+		}
+	}
+	if err := uniqueColumns(cfg.Columns); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// referenceColumns returns the given reference columns but the keys.
+func (c TransformJoinConfig) referenceColumns(names []string) []string {
+	var columns []string
+	for _, name := range names {
+		if !slices.ContainsFunc(c.Keys, func(k JoinKey) bool { return k.Reference == name }) {
+			columns = append(columns, name)
+		}
+	}
+	return columns
+}
+
+func (j *TransformJoin) Run(ctx context.Context, run *Run) error {
+	cfg, err := j.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	index, err := j.load(ctx, run, cfg)
+	if err != nil {
+		return fmt.Errorf("reference: %w", err)
+	}
+	defer index.close()
+	run.Log.Printf("loaded %d reference records, %d of them spilled to disk", index.records, index.spilled)
+
+	sink, err := newJSONLOutput(run, cfg.TargetPath, cfg.Partition)
+	if err != nil {
+		return err
+	}
+
+	transform := &joinTransform{cfg: cfg, index: index, columns: cfg.Columns}
+	if transform.columns == nil {
+		transform.columns = cfg.referenceColumns(slices.Sorted(maps.Keys(index.names)))
+	}
+
+	stats, err := runPipeline(ctx, run, nil, jsonlSource(TransformJoinType, cfg.SourcePath), sink, transform)
+	if err != nil {
+		return err
+	}
+
+	run.Log.Printf("joined %d records into %s", stats.Written(), cfg.TargetPath)
+	return nil
+}
+
+// load reads the reference into an index by key.
+func (j *TransformJoin) load(ctx context.Context, run *Run, cfg TransformJoinConfig) (*joinIndex, error) {
+	index := &joinIndex{
+		duplicates: cfg.Duplicates,
+		maxMemory:  cfg.MaxMemoryRecords,
+		entries:    make(map[string][]joinEntry),
+		names:      make(map[string]bool),
+		spillDir:   filepath.Dir(cfg.TargetPath),
+	}
+
+	references := make([]string, len(cfg.Keys))
+	for i, key := range cfg.Keys {
+		references[i] = key.Reference
+	}
+	add := func(r map[string]any) error {
+		key, ok := joinKey(r, references)
+		if !ok {
+			return nil // a null key never matches
+		}
+		return index.add(key, r)
+	}
+
+	var err error
+	if cfg.Reference.Path != "" {
+		run.Reads("", cfg.Reference.Path)
+		err = readJSONLFile(cfg.Reference.Path, add)
+	} else {
+		err = j.query(ctx, run, cfg.Reference, add)
+	}
+	if err != nil {
+		index.close()
+		return nil, err
+	}
+	return index, nil
+}
+
+func (j *TransformJoin) query(ctx context.Context, run *Run, ref JoinReference, fn func(map[string]any) error) error {
+	conn, err := taskConnection(ctx, j.store, run.Task, ref.Connection)
+	if err != nil {
+		return err
+	}
+
+	db, err := j.open(conn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, ref.Query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		r, err := scanRecord(rows, columns)
+		if err != nil {
+			return err
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// readJSONLFile reads the JSON lines file at path.
+func readJSONLFile(path string, fn func(map[string]any) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return readJSONL(file, fn)
+}
+
+// joinKey returns the key of a record, which is false when a column of the
+// key is null.
+func joinKey(r map[string]any, columns []string) (string, bool) {
+	var b strings.Builder
+	for _, c := range columns {
+		v := r[c]
+		if v == nil {
+			return "", false
+		}
+		b.WriteString(valueKey(v))
+		b.WriteByte(0)
+	}
+	return b.String(), true
+}
+
+// joinIndex holds the reference records by key. Once maxMemory records are
+// held, the others are appended to a spill file and only their location is
+// kept in memory.
+type joinIndex struct {
+	duplicates string
+	maxMemory  int
+	entries    map[string][]joinEntry
+	// names are the columns seen in the reference.
+	names    map[string]bool
+	records  int
+	inMemory int
+	spilled  int
+
+	spillDir string
+	spill    *os.File
+	size     int64
+}
+
+// joinEntry is a reference record, or where to find it in the spill file.
+type joinEntry struct {
+	record record.Record
+	offset int64
+	length int
+}
+
+func (x *joinIndex) add(key string, r record.Record) error {
+	existing := x.entries[key]
+	if len(existing) > 0 {
+		switch x.duplicates {
+		case DuplicatesFirst:
+			return nil
+		case DuplicatesError:
+			return fmt.Errorf("more than one record has the key %s, set duplicates", describeKey(key))
+		}
+	}
+
+	for name := range r {
+		x.names[name] = true
+	}
+	x.records++
+
+	entry, err := x.store(r)
+	if err != nil {
+		return err
+	}
+	if x.duplicates == DuplicatesLast {
+		for _, e := range existing {
+			if e.record != nil {
+				x.inMemory--
+			}
+		}
+		existing = nil
+	}
+	x.entries[key] = append(existing, entry)
+	return nil
+}
+
+func (x *joinIndex) store(r record.Record) (joinEntry, error) {
+	if x.inMemory < x.maxMemory {
+		x.inMemory++
+		return joinEntry{record: r}, nil
+	}
+
+	if x.spill == nil {
+		file, err := os.CreateTemp(x.spillDir, ".join.*.spill")
+		if err != nil {
+			return joinEntry{}, err
+		}
+		x.spill = file
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return joinEntry{}, err
+	}
+	if _, err := x.spill.Write(data); err != nil {
+		return joinEntry{}, err
+	}
+
+	entry := joinEntry{offset: x.size, length: len(data)}
+	x.size += int64(len(data))
+	x.spilled++
+	return entry, nil
+}
+
+// lookup returns the reference records with the given key, in the order
+// they were read.
+func (x *joinIndex) lookup(key string) ([]record.Record, error) {
+	entries := x.entries[key]
+	matches := make([]record.Record, len(entries))
+	for i, e := range entries {
+		if e.record != nil {
+			matches[i] = e.record
+			continue
+		}
+
+		data := make([]byte, e.length)
+		if _, err := x.spill.ReadAt(data, e.offset); err != nil {
+			return nil, fmt.Errorf("spill file: %w", err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&matches[i]); err != nil {
+			return nil, fmt.Errorf("spill file: %w", err)
+		}
+	}
+	return matches, nil
+}
+
+func (x *joinIndex) close() {
+	if x.spill != nil {
+		x.spill.Close()
+		os.Remove(x.spill.Name())
+	}
+}
+
+// describeKey formats a key for error messages.
+func describeKey(key string) string {
+	parts := strings.Split(strings.TrimSuffix(key, "\x00"), "\x00")
+	for i, p := range parts {
+		parts[i] = p[2:] // drop the kind of the value
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// joinTransform looks up the reference records matching each record.
+type joinTransform struct {
+	cfg     TransformJoinConfig
+	index   *joinIndex
+	columns []string
+}
+
+func (t *joinTransform) Name() string {
+	return "join"
+}
+
+func (t *joinTransform) Apply(ctx context.Context, batch record.Batch) (record.Batch, error) {
+	sources := make([]string, len(t.cfg.Keys))
+	for i, key := range t.cfg.Keys {
+		sources[i] = key.Source
+	}
+
+	out := make(record.Batch, 0, len(batch))
+	for _, r := range batch {
+		var matches []record.Record
+		if key, ok := joinKey(r, sources); ok {
+			var err error
+			if matches, err = t.index.lookup(key); err != nil {
+				return nil, err
+			}
+		}
+
+		switch {
+		case t.cfg.Type == JoinAnti:
+			if len(matches) == 0 {
+				out = append(out, r)
+			}
+		case len(matches) == 0:
+			if t.cfg.Type == JoinLeft {
+				out = append(out, t.merge(r, nil))
+			}
+		default:
+			for i, m := range matches {
+				joined := r
+				if i < len(matches)-1 {
+					joined = maps.Clone(r)
+				}
+				out = append(out, t.merge(joined, m))
+			}
+		}
+	}
+	return out, nil
+}
+
+// merge adds the columns of the reference record to r, nulls without one.
+func (t *joinTransform) merge(r, reference record.Record) record.Record {
+	for _, c := range t.columns {
+		r[t.cfg.Prefix+c] = reference[c]
+	}
+	return r
+}
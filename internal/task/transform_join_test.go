@@ -0,0 +1,214 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransformJoin_Run(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "orders.jsonl")
+	customers := filepath.Join(dir, "customers.jsonl")
+	target := filepath.Join(dir, "joined.jsonl")
+	data := `{"id": 1, "customer": 10}` + "\n" +
+		`{"id": 2, "customer": 11}` + "\n" +
+		`{"id": 3, "customer": 12}` + "\n" +
+		`{"id": 4, "customer": null}` + "\n"
+	assert.NoError(t, os.WriteFile(source, []byte(data), 0o644))
+	reference := `{"id": 10, "name": "Chihiro", "country": "JP"}` + "\n" +
+		`{"id": 11.0, "name": "Haku", "country": "JP"}` + "\n" +
+		`{"id": 11, "name": "Kohaku", "country": "JP"}` + "\n" +
+		`{"id": null, "name": "Nobody"}` + "\n"
+	assert.NoError(t, os.WriteFile(customers, []byte(reference), 0o644))
+
+	config := TransformJoinConfig{
+		SourcePath: source,
+		TargetPath: target,
+		Reference:  JoinReference{Path: customers},
+		Keys:       []JoinKey{{Source: "customer", Reference: "id"}},
+		Duplicates: DuplicatesFirst,
+	}
+
+	tests := []struct {
+		name   string
+		change func(cfg *TransformJoinConfig)
+		want   []map[string]any
+	}{
+		{
+			name:   "inner",
+			change: func(cfg *TransformJoinConfig) {},
+			want: []map[string]any{
+				{"id": 1.0, "customer": 10.0, "name": "Chihiro", "country": "JP"},
+				{"id": 2.0, "customer": 11.0, "name": "Haku", "country": "JP"},
+			},
+		},
+		{
+			name: "left with columns and prefix",
+			change: func(cfg *TransformJoinConfig) {
+				cfg.Type = JoinLeft
+				cfg.Columns = []string{"name"}
+				cfg.Prefix = "customer_"
+			},
+			want: []map[string]any{
+				{"id": 1.0, "customer": 10.0, "customer_name": "Chihiro"},
+				{"id": 2.0, "customer": 11.0, "customer_name": "Haku"},
+				{"id": 3.0, "customer": 12.0, "customer_name": nil},
+				{"id": 4.0, "customer": nil, "customer_name": nil},
+			},
+		},
+		{
+			name:   "anti",
+			change: func(cfg *TransformJoinConfig) { cfg.Type = JoinAnti },
+			want: []map[string]any{
+				{"id": 3.0, "customer": 12.0},
+				{"id": 4.0, "customer": nil},
+			},
+		},
+		{
+			name:   "last duplicate",
+			change: func(cfg *TransformJoinConfig) { cfg.Duplicates = DuplicatesLast },
+			want: []map[string]any{
+				{"id": 1.0, "customer": 10.0, "name": "Chihiro", "country": "JP"},
+				{"id": 2.0, "customer": 11.0, "name": "Kohaku", "country": "JP"},
+			},
+		},
+		{
+			name: "all duplicates spilled to disk",
+			change: func(cfg *TransformJoinConfig) {
+				cfg.Duplicates = DuplicatesAll
+				cfg.MaxMemoryRecords = 1
+			},
+			want: []map[string]any{
+				{"id": 1.0, "customer": 10.0, "name": "Chihiro", "country": "JP"},
+				{"id": 2.0, "customer": 11.0, "name": "Haku", "country": "JP"},
+				{"id": 2.0, "customer": 11.0, "name": "Kohaku", "country": "JP"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config
+			tt.change(&cfg)
+
+			run, err := runTask(t, NewTransformJoin(store.NewMockStore(), NewRegistry()), TransformJoinType, cfg)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(tt.want)), *run.Record.RowsAffected)
+			assert.Equal(t, tt.want, readLines(t, target))
+		})
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(dir, ".join.*"))
+	assert.Empty(t, matches, "spill files are removed")
+
+	t.Run("duplicate keys fail by default", func(t *testing.T) {
+		cfg := config
+		cfg.Duplicates = ""
+		_, err := runTask(t, NewTransformJoin(store.NewMockStore(), NewRegistry()), TransformJoinType, cfg)
+		assert.EqualError(t, err, "reference: more than one record has the key (11), set duplicates")
+	})
+}
+
+func TestTransformJoin_Query(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+
+	ctx := context.Background()
+	storage := store.NewMockStore()
+	storage.Pipelines.Create(ctx, &store.Pipelines{ID: 1, OrganizationID: 1})
+	storage.Connections.Create(ctx, &store.Connection{OrganizationID: 1, Name: "app", Type: store.ConnectionPostgres})
+
+	join := NewTransformJoin(storage, NewRegistry())
+	join.open = func(store.Connection) (*sql.DB, error) {
+		return db, nil
+	}
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "orders.jsonl")
+	target := filepath.Join(dir, "joined.jsonl")
+	assert.NoError(t, os.WriteFile(source, []byte(`{"id": 1, "region": "eu", "code": 7}`+"\n"), 0o644))
+
+	mock.ExpectQuery("SELECT region, code, rate FROM rates").
+		WillReturnRows(sqlmock.NewRows([]string{"region", "code", "rate"}).
+			AddRow("eu", int64(7), "0.2").
+			AddRow("eu", int64(8), "0.1"))
+	mock.ExpectClose()
+
+	config := mustMarshal(TransformJoinConfig{
+		SourcePath: source,
+		TargetPath: target,
+		Reference:  JoinReference{Connection: "app", Query: "SELECT region, code, rate FROM rates"},
+		Keys:       []JoinKey{{Source: "region"}, {Source: "code"}},
+	})
+	task := store.Task{ID: 1, PipelineID: 1, Type: TransformJoinType, Config: config}
+	assert.NoError(t, join.Validate(ctx, task))
+
+	run := NewRun(task, &store.TaskRun{ID: 1})
+	assert.NoError(t, run.complete(ctx, join.Run(ctx, run)))
+	assert.Equal(t, []map[string]any{{"id": 1.0, "region": "eu", "code": 7.0, "rate": "0.2"}}, readLines(t, target))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransformJoin_Validate(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "orders.jsonl")
+	customers := filepath.Join(dir, "customers.jsonl")
+	assert.NoError(t, os.WriteFile(source, []byte(`{"id": 1, "customer": 10, "name": "x"}`+"\n"), 0o644))
+	assert.NoError(t, os.WriteFile(customers, []byte(`{"id": 10, "name": "Chihiro"}`+"\n"), 0o644))
+
+	join := NewTransformJoin(store.NewMockStore(), NewRegistry())
+	validate := func(change func(cfg *TransformJoinConfig)) error {
+		cfg := TransformJoinConfig{
+			SourcePath: source,
+			TargetPath: filepath.Join(dir, "joined.jsonl"),
+			Reference:  JoinReference{Path: customers},
+			Keys:       []JoinKey{{Source: "customer", Reference: "id"}},
+			Prefix:     "customer_",
+		}
+		change(&cfg)
+		return join.Validate(context.Background(), store.Task{Type: TransformJoinType, Config: mustMarshal(cfg)})
+	}
+
+	assert.NoError(t, validate(func(cfg *TransformJoinConfig) {}))
+
+	schema, err := join.OutputSchema(context.Background(), store.Task{Type: TransformJoinType, Config: mustMarshal(TransformJoinConfig{
+		SourcePath: source,
+		TargetPath: filepath.Join(dir, "joined.jsonl"),
+		Reference:  JoinReference{Path: customers},
+		Type:       JoinLeft,
+		Keys:       []JoinKey{{Source: "customer", Reference: "id"}},
+		Prefix:     "customer_",
+	})})
+	assert.NoError(t, err)
+	if field, ok := schema.Field("customer_name"); assert.True(t, ok) {
+		assert.True(t, field.Nullable)
+	}
+
+	tests := []struct {
+		change func(cfg *TransformJoinConfig)
+		err    string
+	}{
+		{func(cfg *TransformJoinConfig) { cfg.Reference = JoinReference{} }, "reference: exactly one of path or query is required"},
+		{func(cfg *TransformJoinConfig) { cfg.Reference.Path = "customers.jsonl" }, "reference: path must be an absolute path"},
+		{func(cfg *TransformJoinConfig) { cfg.Reference = JoinReference{Query: "SELECT 1"} }, "reference: connection is required with a query"},
+		{func(cfg *TransformJoinConfig) { cfg.Keys[0].Source = "missing" }, `keys: unknown column "missing"`},
+		{func(cfg *TransformJoinConfig) { cfg.Keys[0].Reference = "missing" }, `reference: unknown column "missing"`},
+		{func(cfg *TransformJoinConfig) { cfg.Columns = []string{"missing"} }, `reference: unknown column "missing"`},
+		{func(cfg *TransformJoinConfig) { cfg.Prefix = "" }, `column "name" is already in the source, set a prefix`},
+		{func(cfg *TransformJoinConfig) { cfg.Type = JoinAnti }, "columns and prefix do not apply to anti joins"},
+	}
+	for _, tt := range tests {
+		assert.EqualError(t, validate(tt.change), tt.err)
+	}
+}
@@ -0,0 +1,890 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/LincolnG4/Haku/internal/expr"
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+const TransformMapType = "transform.map"
+
+const (
+	MapSelect  string = "select"
+	MapDrop    string = "drop"
+	MapRename  string = "rename"
+	MapCast    string = "cast"
+	MapDerive  string = "derive"
+	MapDefault string = "default"
+	MapTrim    string = "trim"
+	MapCase    string = "case"
+	MapFilter  string = "filter"
+)
+
+// MapStep is one operation of a transform.map task. Which fields apply
+// depends on the operation:
+//
+//	select, drop, trim: columns
+//	rename:             mapping, from the old name to the new one
+//	cast:               columns, type and, for dates and timestamps, format
+//	derive:             column and expression
+//	default:            columns and value, which replaces nulls
+//	case:               columns and to, one of upper, lower or title
+//	filter:             expression, records it is not true for are dropped
+type MapStep struct {
+	Op         string            `json:"op" validate:"required,oneof=select drop rename cast derive default trim case filter"`
+	Columns    []string          `json:"columns"`
+	Mapping    map[string]string `json:"mapping"`
+	Column     string            `json:"column"`
+	Type       string            `json:"type"`
+	Format     string            `json:"format"`
+	Expression string            `json:"expression"`
+	Value      json.RawMessage   `json:"value,omitempty"`
+	To         string            `json:"to"`
+}
+
+type TransformMapConfig struct {
+	SourcePath string    `json:"source_path" validate:"required"`
+	TargetPath string    `json:"target_path" validate:"required"`
+	Steps      []MapStep `json:"steps" validate:"required,min=1,dive"`
+	// DeadLetter, when set, sets aside the records a step fails on, as
+	// they were when it did, instead of failing the run.
+	DeadLetter *DeadLetterConfig `json:"dead_letter"`
+	OutputConfig
+}
+
+func (TransformMapConfig) resumable() {}
+
+// TransformMap applies an ordered list of column operations to every
+// record of a JSON lines file.
+type TransformMap struct {
+	store    store.Storage
+	registry *Registry
+}
+
+func NewTransformMap(storage store.Storage, registry *Registry) *TransformMap {
+	return &TransformMap{store: storage, registry: registry}
+}
+
+// Validate compiles the steps and, when the schema of the upstream records
+// is known, checks every step against it.
+func (m *TransformMap) Validate(ctx context.Context, task store.Task) error {
+	_, err := m.OutputSchema(ctx, task)
+	return err
+}
+
+// OutputSchema returns the upstream schema as changed by the steps.
+func (m *TransformMap) OutputSchema(ctx context.Context, task store.Task) (*record.Schema, error) {
+	cfg, steps, err := m.config(task)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := upstreamSchema(ctx, m.store, m.registry, task, cfg.SourcePath)
+	if err != nil || schema == nil {
+		return nil, err
+	}
+
+	out := *schema
+	out.Fields = slices.Clone(schema.Fields)
+	for i, step := range steps {
+		if out, err = step.schema(out); err != nil {
+			return nil, fmt.Errorf("step %d (%s): %w", i+1, cfg.Steps[i].Op, err)
+		}
+	}
+	return &out, nil
+}
+
+func (m *TransformMap) config(task store.Task) (TransformMapConfig, []mapStep, error) {
+	var cfg TransformMapConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, nil, err
+	}
+
+	if err := validateSourcePath(cfg.SourcePath); err != nil {
+		return cfg, nil, err
+	}
+	if err := validateOutputPath(cfg.TargetPath); err != nil {
+		return cfg, nil, err
+	}
+	if cfg.SourcePath == cfg.TargetPath {
+		return cfg, nil, fmt.Errorf("target_path must differ from source_path")
+	}
+	if err := validateDeadLetter(cfg.DeadLetter); err != nil {
+		return cfg, nil, err
+	}
+
+	steps := make([]mapStep, len(cfg.Steps))
+	for i, s := range cfg.Steps {
+		step, err := compileMapStep(s)
+		if err != nil {
+			return cfg, nil, fmt.Errorf("step %d (%s): %w", i+1, s.Op, err)
+		}
+		steps[i] = step
+	}
+
+	return cfg, steps, nil
+}
+
+func (m *TransformMap) Run(ctx context.Context, run *Run) error {
+	cfg, steps, err := m.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	sink, err := newJSONLOutput(run, cfg.TargetPath, cfg.Partition)
+	if err != nil {
+		return err
+	}
+
+	transform := &mapTransform{ops: cfg.Steps, steps: steps}
+	stats, err := runPipeline(ctx, run, cfg.DeadLetter, jsonlSource(TransformMapType, cfg.SourcePath), sink, transform)
+	if err != nil {
+		return err
+	}
+
+	run.Log.Printf("mapped %d records into %s", stats.Written(), cfg.TargetPath)
+	return nil
+}
+
+// mapTransform applies the steps to each record in turn.
+type mapTransform struct {
+	ops   []MapStep
+	steps []mapStep
+	rows  int64
+}
+
+func (t *mapTransform) Name() string {
+	return "map"
+}
+
+func (t *mapTransform) Apply(ctx context.Context, batch record.Batch) (record.Batch, error) {
+	out := batch[:0]
+	for _, r := range batch {
+		t.rows++
+		for j, step := range t.steps {
+			mapped, err := step.apply(r)
+			if err != nil {
+				err = record.Reject(ctx, record.Rejection{
+					Position: fmt.Sprintf("record %d", t.rows),
+					Reason:   fmt.Sprintf("step %d (%s): %v", j+1, t.ops[j].Op, err),
+					Record:   r,
+				})
+				if err != nil {
+					return nil, err
+				}
+			}
+			if r = mapped; r == nil {
+				break
+			}
+		}
+		if r != nil {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+// mapStep is a compiled MapStep.
+type mapStep interface {
+	// apply returns nil to drop the record.
+	apply(r record.Record) (record.Record, error)
+	// schema returns the schema of the records after the step, or an
+	// error if the step does not fit the schema of its input.
+	schema(in record.Schema) (record.Schema, error)
+}
+
+func compileMapStep(s MapStep) (mapStep, error) {
+	if string(s.Value) == "null" {
+		s.Value = nil
+	}
+
+	// Reject the fields the operation does not use, they are most likely
+	// meant for another operation.
+	used := map[string]bool{
+		"columns":    s.Columns != nil,
+		"mapping":    s.Mapping != nil,
+		"column":     s.Column != "",
+		"type":       s.Type != "",
+		"format":     s.Format != "",
+		"expression": s.Expression != "",
+		"value":      s.Value != nil,
+		"to":         s.To != "",
+	}
+	allowed := map[string][]string{
+		MapSelect:  {"columns"},
+		MapDrop:    {"columns"},
+		MapTrim:    {"columns"},
+		MapRename:  {"mapping"},
+		MapCast:    {"columns", "type", "format"},
+		MapDerive:  {"column", "expression"},
+		MapDefault: {"columns", "value"},
+		MapCase:    {"columns", "to"},
+		MapFilter:  {"expression"},
+	}
+	for _, field := range []string{"columns", "mapping", "column", "type", "format", "expression", "value", "to"} {
+		if used[field] && !slices.Contains(allowed[s.Op], field) {
+			return nil, fmt.Errorf("%s does not apply to %s", field, s.Op)
+		}
+	}
+
+	if slices.Contains(allowed[s.Op], "columns") {
+		if len(s.Columns) == 0 {
+			return nil, fmt.Errorf("columns is required")
+		}
+		if err := uniqueColumns(s.Columns); err != nil {
+			return nil, err
+		}
+	}
+
+	switch s.Op {
+	case MapSelect:
+		return selectStep{columns: s.Columns}, nil
+	case MapDrop:
+		return dropStep{columns: s.Columns}, nil
+	case MapRename:
+		return compileRename(s.Mapping)
+	case MapCast:
+		return compileCast(s.Columns, s.Type, s.Format)
+	case MapDerive:
+		if s.Column == "" || s.Expression == "" {
+			return nil, fmt.Errorf("column and expression are required")
+		}
+		program, err := expr.Compile(s.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("expression: %w", err)
+		}
+		return deriveStep{column: s.Column, program: program}, nil
+	case MapFilter:
+		if s.Expression == "" {
+			return nil, fmt.Errorf("expression is required")
+		}
+		program, err := expr.Compile(s.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("expression: %w", err)
+		}
+		return filterStep{program: program}, nil
+	case MapDefault:
+		return compileDefault(s.Columns, s.Value)
+	case MapTrim:
+		return stringStep{columns: s.Columns, fn: strings.TrimSpace}, nil
+	case MapCase:
+		fn, ok := caseFuncs[s.To]
+		if !ok {
+			return nil, fmt.Errorf("to must be one of upper, lower or title")
+		}
+		return stringStep{columns: s.Columns, fn: fn}, nil
+	}
+	return nil, fmt.Errorf("unsupported operation %q", s.Op)
+}
+
+func uniqueColumns(columns []string) error {
+	seen := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		if c == "" {
+			return fmt.Errorf("empty column name")
+		}
+		if seen[c] {
+			return fmt.Errorf("duplicate column %q", c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+// requireColumns checks that the columns are part of the schema.
+func requireColumns(schema record.Schema, columns ...string) error {
+	for _, c := range columns {
+		if _, ok := schema.Field(c); !ok {
+			return fmt.Errorf("unknown column %q", c)
+		}
+	}
+	return nil
+}
+
+func updateField(schema record.Schema, name string, fn func(f *record.Field)) record.Schema {
+	for i := range schema.Fields {
+		if schema.Fields[i].Name == name {
+			fn(&schema.Fields[i])
+		}
+	}
+	return schema
+}
+
+// selectStep keeps only the listed columns. Columns missing from a record
+// are null.
+type selectStep struct {
+	columns []string
+}
+
+func (s selectStep) apply(r record.Record) (record.Record, error) {
+	out := make(record.Record, len(s.columns))
+	for _, c := range s.columns {
+		out[c] = r[c]
+	}
+	return out, nil
+}
+
+func (s selectStep) schema(in record.Schema) (record.Schema, error) {
+	var out record.Schema
+	for _, c := range s.columns {
+		f, ok := in.Field(c)
+		if !ok {
+			return in, fmt.Errorf("unknown column %q", c)
+		}
+		out.Fields = append(out.Fields, f)
+	}
+	return out, nil
+}
+
+type dropStep struct {
+	columns []string
+}
+
+func (s dropStep) apply(r record.Record) (record.Record, error) {
+	for _, c := range s.columns {
+		delete(r, c)
+	}
+	return r, nil
+}
+
+func (s dropStep) schema(in record.Schema) (record.Schema, error) {
+	if err := requireColumns(in, s.columns...); err != nil {
+		return in, err
+	}
+	in.Fields = slices.DeleteFunc(in.Fields, func(f record.Field) bool {
+		return slices.Contains(s.columns, f.Name)
+	})
+	return in, nil
+}
+
+type renameStep struct {
+	mapping map[string]string
+}
+
+func compileRename(mapping map[string]string) (mapStep, error) {
+	if len(mapping) == 0 {
+		return nil, fmt.Errorf("mapping is required")
+	}
+	targets := make(map[string]bool, len(mapping))
+	for from, to := range mapping {
+		if from == "" || to == "" {
+			return nil, fmt.Errorf("empty column name")
+		}
+		if targets[to] {
+			return nil, fmt.Errorf("several columns renamed to %q", to)
+		}
+		targets[to] = true
+	}
+	return renameStep{mapping: mapping}, nil
+}
+
+func (s renameStep) apply(r record.Record) (record.Record, error) {
+	values := make(map[string]any, len(s.mapping))
+	for from := range s.mapping {
+		if v, ok := r[from]; ok {
+			values[from] = v
+			delete(r, from)
+		}
+	}
+	for from, v := range values {
+		r[s.mapping[from]] = v
+	}
+	return r, nil
+}
+
+func (s renameStep) schema(in record.Schema) (record.Schema, error) {
+	for _, from := range slices.Sorted(maps.Keys(s.mapping)) {
+		if err := requireColumns(in, from); err != nil {
+			return in, err
+		}
+		to := s.mapping[from]
+		if _, renamed := s.mapping[to]; !renamed {
+			if _, exists := in.Field(to); exists {
+				return in, fmt.Errorf("column %q already exists", to)
+			}
+		}
+	}
+	for i, f := range in.Fields {
+		if to, ok := s.mapping[f.Name]; ok {
+			in.Fields[i].Name = to
+		}
+	}
+	return in, nil
+}
+
+// castTypes maps the target types of casts to the record types.
+var castTypes = map[string]record.Type{
+	"string":    record.TypeString,
+	"integer":   record.TypeInteger,
+	"float":     record.TypeFloat,
+	"decimal":   record.TypeDecimal,
+	"boolean":   record.TypeBoolean,
+	"date":      record.TypeDate,
+	"timestamp": record.TypeTimestamp,
+}
+
+// castStep converts columns to another type. Format is the Go layout used
+// to parse dates and timestamps from strings and to format them as
+// strings; "unix" and "unix_ms" read numbers as epoch timestamps.
+type castStep struct {
+	columns []string
+	to      record.Type
+	format  string
+}
+
+func compileCast(columns []string, to, format string) (mapStep, error) {
+	t, ok := castTypes[to]
+	if !ok {
+		return nil, fmt.Errorf("type must be one of string, integer, float, decimal, boolean, date or timestamp")
+	}
+	if format != "" && t != record.TypeString && t != record.TypeDate && t != record.TypeTimestamp {
+		return nil, fmt.Errorf("format only applies to casts to string, date or timestamp")
+	}
+	if (format == "unix" || format == "unix_ms") && t != record.TypeTimestamp {
+		return nil, fmt.Errorf("format %s only applies to timestamps", format)
+	}
+	return castStep{columns: columns, to: t, format: format}, nil
+}
+
+func (s castStep) apply(r record.Record) (record.Record, error) {
+	for _, c := range s.columns {
+		v, err := castValue(r[c], s.to, s.format)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", c, err)
+		}
+		if _, ok := r[c]; ok || v != nil {
+			r[c] = v
+		}
+	}
+	return r, nil
+}
+
+func (s castStep) schema(in record.Schema) (record.Schema, error) {
+	if err := requireColumns(in, s.columns...); err != nil {
+		return in, err
+	}
+	for _, c := range s.columns {
+		field, _ := in.Field(c)
+		if field.Type == record.TypeObject || field.Type == record.TypeArray {
+			if s.to != record.TypeString {
+				return in, fmt.Errorf("cannot cast %s column %q to %s", field.Type, c, s.to)
+			}
+		}
+		in = updateField(in, c, func(f *record.Field) {
+			f.Type = s.to
+			// Blank strings become null when cast to other types.
+			if field.Type != s.to && s.to != record.TypeString {
+				f.Nullable = f.Nullable || field.Type == record.TypeString || field.Type == record.TypeAny
+			}
+		})
+	}
+	return in, nil
+}
+
+// castValue converts a value to the given type. Null stays null, and blank
+// strings become null unless cast to a string.
+func castValue(v any, to record.Type, format string) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if s, ok := v.(string); ok && to != record.TypeString {
+		v = strings.TrimSpace(s)
+		if v == "" {
+			return nil, nil
+		}
+	}
+
+	switch to {
+	case record.TypeString:
+		return castString(v, format)
+	case record.TypeInteger:
+		return castInteger(v)
+	case record.TypeFloat:
+		return castFloat(v)
+	case record.TypeDecimal:
+		return castDecimal(v)
+	case record.TypeBoolean:
+		return castBoolean(v)
+	case record.TypeDate:
+		t, err := castTime(v, format, time.DateOnly)
+		if err != nil {
+			return nil, err
+		}
+		return t.Format(time.DateOnly), nil
+	case record.TypeTimestamp:
+		return castTime(v, format, time.RFC3339)
+	}
+	return nil, fmt.Errorf("unsupported type %s", to)
+}
+
+func castString(v any, format string) (any, error) {
+	switch v := v.(type) {
+	case string:
+		if format != "" {
+			// A date or timestamp written as a string by an earlier step.
+			t, err := parseTime(v, "")
+			if err != nil {
+				return nil, err
+			}
+			return t.Format(format), nil
+		}
+		return v, nil
+	case time.Time:
+		if format == "" {
+			format = time.RFC3339Nano
+		}
+		return v.Format(format), nil
+	case json.Number:
+		return string(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []byte:
+		return string(v), nil
+	case map[string]any, []any:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+func castInteger(v any) (any, error) {
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case float64:
+		if v != math.Trunc(v) || math.Abs(v) >= 1<<63 {
+			return nil, fmt.Errorf("%v is not an integer", v)
+		}
+		return int64(v), nil
+	case json.Number, string:
+		s := fmt.Sprint(v)
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+		// Whole decimals, such as 12.00, are accepted.
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return nil, fmt.Errorf("invalid integer %q", s)
+		}
+		if !r.IsInt() || !r.Num().IsInt64() {
+			return nil, fmt.Errorf("%s is not an integer", s)
+		}
+		return r.Num().Int64(), nil
+	}
+	return nil, fmt.Errorf("cannot cast %s to integer", record.TypeOf(v))
+}
+
+func castFloat(v any) (any, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case json.Number, string:
+		f, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float %q", fmt.Sprint(v))
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("cannot cast %s to float", record.TypeOf(v))
+}
+
+// castDecimal returns an exact json.Number, keeping the scale of decimal
+// strings.
+func castDecimal(v any) (any, error) {
+	switch v := v.(type) {
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10)), nil
+	case int:
+		return json.Number(strconv.Itoa(v)), nil
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'f', -1, 64)), nil
+	case json.Number, string:
+		s := fmt.Sprint(v)
+		r, ok := new(big.Rat).SetString(s)
+		if !ok || strings.Contains(s, "/") {
+			return nil, fmt.Errorf("invalid decimal %q", s)
+		}
+		scale := 0
+		if i := strings.IndexByte(s, '.'); i >= 0 && !strings.ContainsAny(s, "eE") {
+			scale = len(s) - i - 1
+		}
+		return json.Number(r.FloatString(scale)), nil
+	}
+	return nil, fmt.Errorf("cannot cast %s to decimal", record.TypeOf(v))
+}
+
+func castBoolean(v any) (any, error) {
+	switch v := v.(type) {
+	case bool:
+		return v, nil
+	case int64, int, float64, json.Number:
+		switch fmt.Sprint(v) {
+		case "0":
+			return false, nil
+		case "1":
+			return true, nil
+		}
+		return nil, fmt.Errorf("invalid boolean %v", v)
+	case string:
+		switch strings.ToLower(v) {
+		case "true", "t", "yes", "y", "1":
+			return true, nil
+		case "false", "f", "no", "n", "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid boolean %q", v)
+	}
+	return nil, fmt.Errorf("cannot cast %s to boolean", record.TypeOf(v))
+}
+
+func castTime(v any, format, def string) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		if format == "unix" || format == "unix_ms" {
+			return castTime(json.Number(v), format, def)
+		}
+		return parseTime(v, format)
+	case int64, int, float64, json.Number:
+		f, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		switch format {
+		case "unix":
+			sec, frac := math.Modf(f)
+			return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+		case "unix_ms":
+			return time.UnixMilli(int64(f)).UTC(), nil
+		}
+		return time.Time{}, fmt.Errorf("numbers need the format unix or unix_ms")
+	}
+	return time.Time{}, fmt.Errorf("cannot cast %s to %s", record.TypeOf(v), def)
+}
+
+// timeLayouts are tried in turn when a cast has no format.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	time.DateOnly,
+}
+
+func parseTime(s, format string) (time.Time, error) {
+	if format != "" {
+		t, err := time.Parse(format, s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q, expected the format %s", s, format)
+		}
+		return t, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// deriveStep sets a column, new or existing, to the value of an
+// expression.
+type deriveStep struct {
+	column  string
+	program *expr.Program
+}
+
+func (s deriveStep) apply(r record.Record) (record.Record, error) {
+	v, err := s.program.Eval(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.column, err)
+	}
+	r[s.column] = v
+	return r, nil
+}
+
+func (s deriveStep) schema(in record.Schema) (record.Schema, error) {
+	t, err := s.program.Check(in)
+	if err != nil {
+		return in, fmt.Errorf("expression: %w", err)
+	}
+
+	field := record.Field{Name: s.column, Type: t, Nullable: true}
+	if _, ok := in.Field(s.column); ok {
+		return updateField(in, s.column, func(f *record.Field) { *f = field }), nil
+	}
+	in.Fields = append(in.Fields, field)
+	return in, nil
+}
+
+// filterStep keeps the records its expression is true for. Records it is
+// false or null for are dropped.
+type filterStep struct {
+	program *expr.Program
+}
+
+func (s filterStep) apply(r record.Record) (record.Record, error) {
+	v, err := s.program.Eval(r)
+	if err != nil {
+		return nil, err
+	}
+	switch v {
+	case true:
+		return r, nil
+	case false, nil:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("expression is a %s, not a boolean", record.TypeOf(v))
+}
+
+func (s filterStep) schema(in record.Schema) (record.Schema, error) {
+	t, err := s.program.Check(in)
+	if err != nil {
+		return in, fmt.Errorf("expression: %w", err)
+	}
+	if t != record.TypeBoolean && t != record.TypeAny {
+		return in, fmt.Errorf("expression is a %s, not a boolean", t)
+	}
+	return in, nil
+}
+
+// defaultStep replaces nulls and missing values.
+type defaultStep struct {
+	columns []string
+	value   any
+}
+
+func compileDefault(columns []string, raw json.RawMessage) (mapStep, error) {
+	if raw == nil {
+		return nil, fmt.Errorf("value is required and must not be null")
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(raw)))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("value: %w", err)
+	}
+	return defaultStep{columns: columns, value: value}, nil
+}
+
+func (s defaultStep) apply(r record.Record) (record.Record, error) {
+	for _, c := range s.columns {
+		if r[c] == nil {
+			r[c] = s.value
+		}
+	}
+	return r, nil
+}
+
+func (s defaultStep) schema(in record.Schema) (record.Schema, error) {
+	if err := requireColumns(in, s.columns...); err != nil {
+		return in, err
+	}
+
+	valueType := record.TypeOf(s.value)
+	for _, c := range s.columns {
+		field, _ := in.Field(c)
+		if !defaultFits(field.Type, valueType) {
+			return in, fmt.Errorf("value is a %s, column %q is a %s", valueType, c, field.Type)
+		}
+		in = updateField(in, c, func(f *record.Field) { f.Nullable = false })
+	}
+	return in, nil
+}
+
+func defaultFits(column, value record.Type) bool {
+	switch {
+	case column == value, column == record.TypeAny:
+		return true
+	case column == record.TypeFloat || column == record.TypeDecimal:
+		return value == record.TypeInteger || value == record.TypeFloat || value == record.TypeDecimal
+	case column == record.TypeDate || column == record.TypeTimestamp:
+		return value == record.TypeString
+	}
+	return false
+}
+
+// stringStep applies fn to the string values of the columns. Other
+// values are left alone.
+type stringStep struct {
+	columns []string
+	fn      func(string) string
+}
+
+func (s stringStep) apply(r record.Record) (record.Record, error) {
+	for _, c := range s.columns {
+		if v, ok := r[c].(string); ok {
+			r[c] = s.fn(v)
+		}
+	}
+	return r, nil
+}
+
+func (s stringStep) schema(in record.Schema) (record.Schema, error) {
+	if err := requireColumns(in, s.columns...); err != nil {
+		return in, err
+	}
+	for _, c := range s.columns {
+		field, _ := in.Field(c)
+		if field.Type != record.TypeString && field.Type != record.TypeAny {
+			return in, fmt.Errorf("column %q is a %s, not a string", c, field.Type)
+		}
+	}
+	return in, nil
+}
+
+var caseFuncs = map[string]func(string) string{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"title": titleCase,
+}
+
+// titleCase upper cases the first letter of every word and lower cases
+// the others.
+func titleCase(s string) string {
+	start := true
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' {
+			start = true
+			return r
+		}
+		if start {
+			start = false
+			return unicode.ToTitle(r)
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
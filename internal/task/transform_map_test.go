@@ -0,0 +1,275 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTransformMap(storage store.Storage) *TransformMap {
+	registry := NewRegistry()
+	registry.Register(FixedWidthReadType, NewFixedWidthRead())
+	m := NewTransformMap(storage, registry)
+	registry.Register(TransformMapType, m)
+	return m
+}
+
+func TestTransformMap_Run(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "orders.jsonl")
+	target := filepath.Join(dir, "mapped.jsonl")
+	data := `{"id": "1", "customer": "  chihiro ogino ", "price": "12.50", "qty": 3, "ordered": "31/01/2024", "note": "x"}` + "\n" +
+		`{"id": "2", "customer": "HAKU", "price": "3", "qty": null, "ordered": "", "note": "y"}` + "\n"
+	assert.NoError(t, os.WriteFile(source, []byte(data), 0o644))
+
+	config := TransformMapConfig{
+		SourcePath: source,
+		TargetPath: target,
+		Steps: []MapStep{
+			{Op: MapDrop, Columns: []string{"note"}},
+			{Op: MapRename, Mapping: map[string]string{"customer": "name", "qty": "quantity"}},
+			{Op: MapTrim, Columns: []string{"name"}},
+			{Op: MapCase, Columns: []string{"name"}, To: "title"},
+			{Op: MapCast, Columns: []string{"id"}, Type: "integer"},
+			{Op: MapCast, Columns: []string{"price"}, Type: "decimal"},
+			{Op: MapCast, Columns: []string{"ordered"}, Type: "date", Format: "02/01/2006"},
+			{Op: MapDefault, Columns: []string{"quantity"}, Value: json.RawMessage(`1`)},
+			{Op: MapDerive, Column: "total", Expression: "price * quantity"},
+			{Op: MapSelect, Columns: []string{"id", "name", "ordered", "total"}},
+		},
+	}
+
+	run, err := runTask(t, newTransformMap(store.NewMockStore()), TransformMapType, config)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), *run.Record.RowsAffected)
+
+	lines := readLines(t, target)
+	assert.Equal(t, []map[string]any{
+		{"id": 1.0, "name": "Chihiro Ogino", "ordered": "2024-01-31", "total": 37.5},
+		{"id": 2.0, "name": "Haku", "ordered": nil, "total": 3.0},
+	}, lines)
+
+	t.Run("filter drops records", func(t *testing.T) {
+		filtered := config
+		filtered.Steps = append(slices.Clone(config.Steps[:len(config.Steps)-1]),
+			MapStep{Op: MapFilter, Expression: "total > 5 and name matches '^C'"},
+			MapStep{Op: MapSelect, Columns: []string{"id", "total"}},
+		)
+		run, err := runTask(t, newTransformMap(store.NewMockStore()), TransformMapType, filtered)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), *run.Record.RowsAffected)
+		assert.Equal(t, []map[string]any{{"id": 1.0, "total": 37.5}}, readLines(t, target))
+	})
+
+	t.Run("runtime errors name the record and step", func(t *testing.T) {
+		bad := config
+		bad.Steps = []MapStep{{Op: MapCast, Columns: []string{"price"}, Type: "integer"}}
+		_, err := runTask(t, newTransformMap(store.NewMockStore()), TransformMapType, bad)
+		assert.EqualError(t, err, `record 1: step 1 (cast): column price: 12.50 is not an integer`)
+	})
+}
+
+func TestTransformMap_Validate(t *testing.T) {
+	dir := t.TempDir()
+	extract := filepath.Join(dir, "accounts.jsonl")
+	storage := store.NewMockStore()
+	ctx := context.Background()
+
+	upstream := &store.Task{
+		PipelineID: 1,
+		Name:       "accounts",
+		Type:       FixedWidthReadType,
+		Config: mustMarshal(FixedWidthReadConfig{
+			SourcePath: "/data/accounts.txt",
+			TargetPath: extract,
+			Columns: []FixedWidthColumn{
+				{Name: "id", Start: 1, Length: 5, Type: FieldInteger},
+				{Name: "name", Start: 6, Length: 10},
+				{Name: "balance", Start: 16, Length: 9, Type: FieldDecimal},
+			},
+		}),
+	}
+	assert.NoError(t, storage.Tasks.Create(ctx, upstream))
+
+	m := newTransformMap(storage)
+	validate := func(steps ...MapStep) error {
+		return m.Validate(ctx, store.Task{
+			PipelineID: 1,
+			Type:       TransformMapType,
+			Config: mustMarshal(TransformMapConfig{
+				SourcePath: extract,
+				TargetPath: filepath.Join(dir, "mapped.jsonl"),
+				Steps:      steps,
+			}),
+		})
+	}
+
+	assert.NoError(t, validate(
+		MapStep{Op: MapRename, Mapping: map[string]string{"balance": "amount"}},
+		MapStep{Op: MapDerive, Column: "doubled", Expression: "amount * 2"},
+		MapStep{Op: MapCase, Columns: []string{"name"}, To: "upper"},
+	))
+
+	tests := []struct {
+		steps []MapStep
+		err   string
+	}{
+		{
+			[]MapStep{{Op: MapDrop, Columns: []string{"missing"}}},
+			`step 1 (drop): unknown column "missing"`,
+		},
+		{
+			[]MapStep{
+				{Op: MapRename, Mapping: map[string]string{"balance": "amount"}},
+				{Op: MapDerive, Column: "doubled", Expression: "balance * 2"},
+			},
+			`step 2 (derive): expression: position 1: unknown column "balance"`,
+		},
+		{
+			[]MapStep{{Op: MapRename, Mapping: map[string]string{"balance": "name"}}},
+			`step 1 (rename): column "name" already exists`,
+		},
+		{
+			[]MapStep{{Op: MapTrim, Columns: []string{"id"}}},
+			`step 1 (trim): column "id" is a integer, not a string`,
+		},
+		{
+			[]MapStep{{Op: MapDefault, Columns: []string{"id"}, Value: json.RawMessage(`"none"`)}},
+			`step 1 (default): value is a string, column "id" is a integer`,
+		},
+		{
+			[]MapStep{{Op: MapDerive, Column: "x", Expression: "name - 1"}},
+			`step 1 (derive): expression: position 6: cannot apply - to string and integer`,
+		},
+		{
+			[]MapStep{{Op: MapDerive, Column: "x", Expression: "id +"}},
+			`step 1 (derive): expression: position 5: unexpected end of expression`,
+		},
+		{
+			[]MapStep{{Op: MapCast, Columns: []string{"id"}, Type: "money"}},
+			`step 1 (cast): type must be one of string, integer, float, decimal, boolean, date or timestamp`,
+		},
+		{
+			[]MapStep{{Op: MapDrop, Columns: []string{"id"}, To: "upper"}},
+			`step 1 (drop): to does not apply to drop`,
+		},
+		{
+			[]MapStep{{Op: MapFilter, Expression: "balance * 2"}},
+			`step 1 (filter): expression is a decimal, not a boolean`,
+		},
+		{
+			[]MapStep{{Op: MapFilter, Expression: "lower(id) == 'x'"}},
+			`step 1 (filter): expression: position 7: lower: argument 1 must be a string, found integer`,
+		},
+		{
+			[]MapStep{{Op: MapFilter, Expression: "name matches '['"}},
+			"step 1 (filter): expression: position 14: invalid pattern: error parsing regexp: missing closing ]: `[`",
+		},
+	}
+	for _, tt := range tests {
+		assert.EqualError(t, validate(tt.steps...), tt.err)
+	}
+
+	t.Run("chained transforms", func(t *testing.T) {
+		mapped := filepath.Join(dir, "mapped.jsonl")
+		first := &store.Task{
+			PipelineID: 1,
+			Name:       "rename",
+			Type:       TransformMapType,
+			Config: mustMarshal(TransformMapConfig{
+				SourcePath: extract,
+				TargetPath: mapped,
+				Steps:      []MapStep{{Op: MapRename, Mapping: map[string]string{"balance": "amount"}}},
+			}),
+		}
+		assert.NoError(t, storage.Tasks.Create(ctx, first))
+
+		second := store.Task{
+			PipelineID: 1,
+			Type:       TransformMapType,
+			Config: mustMarshal(TransformMapConfig{
+				SourcePath: mapped,
+				TargetPath: filepath.Join(dir, "final.jsonl"),
+				Steps:      []MapStep{{Op: MapDrop, Columns: []string{"balance"}}},
+			}),
+		}
+		assert.EqualError(t, m.Validate(ctx, second), `step 1 (drop): unknown column "balance"`)
+
+		schema, err := m.OutputSchema(ctx, *first)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"id", "name", "amount"}, schema.Names())
+		field, _ := schema.Field("amount")
+		assert.Equal(t, record.TypeDecimal, field.Type)
+	})
+
+	t.Run("unknown upstream skips the schema checks", func(t *testing.T) {
+		err := m.Validate(ctx, store.Task{
+			PipelineID: 2,
+			Type:       TransformMapType,
+			Config: mustMarshal(TransformMapConfig{
+				SourcePath: filepath.Join(dir, "elsewhere.jsonl"),
+				TargetPath: filepath.Join(dir, "out.jsonl"),
+				Steps:      []MapStep{{Op: MapDrop, Columns: []string{"anything"}}},
+			}),
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("schema sampled from an existing file", func(t *testing.T) {
+		existing := filepath.Join(dir, "existing.jsonl")
+		assert.NoError(t, os.WriteFile(existing, []byte(`{"a": 1}`+"\n"), 0o644))
+
+		err := m.Validate(ctx, store.Task{
+			PipelineID: 2,
+			Type:       TransformMapType,
+			Config: mustMarshal(TransformMapConfig{
+				SourcePath: existing,
+				TargetPath: filepath.Join(dir, "out.jsonl"),
+				Steps:      []MapStep{{Op: MapDrop, Columns: []string{"b"}}},
+			}),
+		})
+		assert.EqualError(t, err, `step 1 (drop): unknown column "b"`)
+	})
+}
+
+func TestCastValue(t *testing.T) {
+	tests := []struct {
+		value  any
+		to     record.Type
+		format string
+		want   any
+	}{
+		{json.Number("12"), record.TypeInteger, "", int64(12)},
+		{"12.00", record.TypeInteger, "", int64(12)},
+		{"  ", record.TypeInteger, "", nil},
+		{"1.5", record.TypeFloat, "", 1.5},
+		{"0012.50", record.TypeDecimal, "", json.Number("12.50")},
+		{"yes", record.TypeBoolean, "", true},
+		{json.Number("0"), record.TypeBoolean, "", false},
+		{"2024-01-31T10:00:00Z", record.TypeDate, "", "2024-01-31"},
+		{json.Number("1700000000"), record.TypeTimestamp, "unix", "2023-11-14T22:13:20Z"},
+		{"2024-01-31", record.TypeString, "02.01.2006", "31.01.2024"},
+		{map[string]any{"a": true}, record.TypeString, "", `{"a":true}`},
+		{1.5, record.TypeString, "", "1.5"},
+	}
+	for _, tt := range tests {
+		got, err := castValue(tt.value, tt.to, tt.format)
+		assert.NoError(t, err, "%v to %s", tt.value, tt.to)
+		if ts, ok := got.(interface{ Format(string) string }); ok {
+			got = ts.Format("2006-01-02T15:04:05Z07:00")
+		}
+		assert.Equal(t, tt.want, got, "%v to %s", tt.value, tt.to)
+	}
+
+	_, err := castValue("abc", record.TypeInteger, "")
+	assert.EqualError(t, err, `invalid integer "abc"`)
+	_, err = castValue("2024-13-01", record.TypeDate, "2006-01-02")
+	assert.EqualError(t, err, `invalid time "2024-13-01", expected the format 2006-01-02`)
+}
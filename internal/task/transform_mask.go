@@ -0,0 +1,424 @@
+package task
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+	"golang.org/x/crypto/hkdf"
+)
+
+const TransformMaskType = "transform.mask"
+
+const (
+	MaskRedact     string = "redact"
+	MaskPartial    string = "partial"
+	MaskHash       string = "hash"
+	MaskEmail      string = "email"
+	MaskTokenize   string = "tokenize"
+	MaskDetokenize string = "detokenize"
+)
+
+// tokenPrefix starts every token, so they are told apart from the values
+// they replace.
+const tokenPrefix = "tok_"
+
+// MaskRule masks the values of columns. Nulls are left as they are. Which
+// fields apply depends on the method:
+//
+//	redact:     replacement, which replaces the values, null by default
+//	partial:    keep_first and keep_last characters, the others replaced
+//	            by char, "*" by default; values too short are fully masked
+//	hash:       secret, the key of the HMAC-SHA256 of the values
+//	email:      char, which replaces the local part but its first
+//	            character, keeping the domain
+//	tokenize:   secret, the key the values are encrypted with into tokens,
+//	            the same for equal values
+//	detokenize: secret, the key tokenize used, to get the values back
+type MaskRule struct {
+	Columns     []string `json:"columns" validate:"required,min=1,dive,required"`
+	Method      string   `json:"method" validate:"required,oneof=redact partial hash email tokenize detokenize"`
+	Replacement *string  `json:"replacement"`
+	KeepFirst   int      `json:"keep_first" validate:"min=0"`
+	KeepLast    int      `json:"keep_last" validate:"min=0"`
+	Char        string   `json:"char" validate:"omitempty,len=1"`
+	// Secret names a secret of the organization, which keeps keys and
+	// salts out of the configuration.
+	Secret string `json:"secret"`
+}
+
+type TransformMaskConfig struct {
+	SourcePath string     `json:"source_path" validate:"required"`
+	TargetPath string     `json:"target_path" validate:"required"`
+	Rules      []MaskRule `json:"rules" validate:"required,min=1,dive"`
+	OutputConfig
+}
+
+func (TransformMaskConfig) resumable() {}
+
+// TransformMask masks personal data in the records of a JSON lines file.
+// Each run logs the rules it applied, with the secrets they used, and
+// counts the values masked in each column as counters named
+// masked.<column>.
+type TransformMask struct {
+	store    store.Storage
+	registry *Registry
+}
+
+func NewTransformMask(storage store.Storage, registry *Registry) *TransformMask {
+	return &TransformMask{store: storage, registry: registry}
+}
+
+// Validate checks the rules, that their secrets exist and, when the schema
+// of the upstream records is known, that their columns do.
+func (m *TransformMask) Validate(ctx context.Context, task store.Task) error {
+	cfg, err := m.config(task)
+	if err != nil {
+		return err
+	}
+	for i, rule := range cfg.Rules {
+		if rule.Secret == "" {
+			continue
+		}
+		if _, err := taskSecret(ctx, m.store, task, rule.Secret); err != nil {
+			return fmt.Errorf("rule %d (%s): %w", i+1, rule.Method, err)
+		}
+	}
+
+	_, err = m.OutputSchema(ctx, task)
+	return err
+}
+
+// OutputSchema returns the upstream schema with the masked columns turned
+// into strings, or into nulls when redacted without a replacement.
+func (m *TransformMask) OutputSchema(ctx context.Context, task store.Task) (*record.Schema, error) {
+	cfg, err := m.config(task)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := upstreamSchema(ctx, m.store, m.registry, task, cfg.SourcePath)
+	if err != nil || schema == nil {
+		return nil, err
+	}
+
+	out := record.Schema{Fields: slices.Clone(schema.Fields)}
+	for i, rule := range cfg.Rules {
+		if err := requireColumns(out, rule.Columns...); err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i+1, rule.Method, err)
+		}
+		for _, c := range rule.Columns {
+			out = updateField(out, c, func(f *record.Field) {
+				if rule.Method == MaskRedact && rule.Replacement == nil {
+					f.Nullable = true
+					return
+				}
+				f.Type = record.TypeString
+			})
+		}
+	}
+	return &out, nil
+}
+
+func (m *TransformMask) config(task store.Task) (TransformMaskConfig, error) {
+	var cfg TransformMaskConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if err := validateSourcePath(cfg.SourcePath); err != nil {
+		return cfg, err
+	}
+	if err := validateOutputPath(cfg.TargetPath); err != nil {
+		return cfg, err
+	}
+	if cfg.SourcePath == cfg.TargetPath {
+		return cfg, fmt.Errorf("target_path must differ from source_path")
+	}
+
+	var columns []string
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		if err := validateMaskRule(rule); err != nil {
+			return cfg, fmt.Errorf("rule %d (%s): %w", i+1, rule.Method, err)
+		}
+		columns = append(columns, rule.Columns...)
+	}
+	// A column masked twice would have its masked value masked again.
+	if err := uniqueColumns(columns); err != nil {
+		return cfg, fmt.Errorf("rules: %w", err)
+	}
+
+	return cfg, nil
+}
+
+func validateMaskRule(rule *MaskRule) error {
+	// Reject the fields the method does not use, they are most likely
+	// meant for another method.
+	used := map[string]bool{
+		"replacement": rule.Replacement != nil,
+		"keep_first":  rule.KeepFirst != 0,
+		"keep_last":   rule.KeepLast != 0,
+		"char":        rule.Char != "",
+		"secret":      rule.Secret != "",
+	}
+	allowed := map[string][]string{
+		MaskRedact:     {"replacement"},
+		MaskPartial:    {"keep_first", "keep_last", "char"},
+		MaskHash:       {"secret"},
+		MaskEmail:      {"char"},
+		MaskTokenize:   {"secret"},
+		MaskDetokenize: {"secret"},
+	}
+	for _, field := range []string{"replacement", "keep_first", "keep_last", "char", "secret"} {
+		if used[field] && !slices.Contains(allowed[rule.Method], field) {
+			return fmt.Errorf("%s does not apply to %s", field, rule.Method)
+		}
+	}
+
+	if slices.Contains(allowed[rule.Method], "secret") && rule.Secret == "" {
+		return errors.New("secret is required")
+	}
+	if rule.Char == "" {
+		rule.Char = "*"
+	}
+	return nil
+}
+
+func (m *TransformMask) Run(ctx context.Context, run *Run) error {
+	cfg, err := m.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	transform := &maskTransform{counts: make(map[string]int64)}
+	for i, rule := range cfg.Rules {
+		audit := fmt.Sprintf("rule %d: %s %s", i+1, rule.Method, strings.Join(rule.Columns, ", "))
+
+		var secret string
+		if rule.Secret != "" {
+			s, err := taskSecret(ctx, m.store, run.Task, rule.Secret)
+			if err != nil {
+				return fmt.Errorf("rule %d (%s): %w", i+1, rule.Method, err)
+			}
+			secret = s.Value
+			audit += fmt.Sprintf(" with secret %s (id %d, updated at %s)", s.Name, s.ID, s.UpdatedAt)
+		}
+		run.Log.Printf("%s", audit)
+
+		mask, err := compileMask(rule, secret)
+		if err != nil {
+			return fmt.Errorf("rule %d (%s): %w", i+1, rule.Method, err)
+		}
+		for _, c := range rule.Columns {
+			transform.columns = append(transform.columns, maskColumn{name: c, mask: mask})
+		}
+	}
+
+	sink, err := newJSONLOutput(run, cfg.TargetPath, cfg.Partition)
+	if err != nil {
+		return err
+	}
+
+	stats, err := runPipeline(ctx, run, nil, jsonlSource(TransformMaskType, cfg.SourcePath), sink, transform)
+	if err != nil {
+		return err
+	}
+
+	if stats.Counters == nil {
+		stats.Counters = make(map[string]int64, len(transform.columns))
+	}
+	for _, c := range transform.columns {
+		stats.Counters["masked."+c.name] = transform.counts[c.name]
+	}
+	run.SetStats(stats)
+
+	run.Log.Printf("masked %d records into %s", stats.Written(), cfg.TargetPath)
+	return nil
+}
+
+// masker masks a value that is not null.
+type masker func(v any) (any, error)
+
+type maskColumn struct {
+	name string
+	mask masker
+}
+
+// maskTransform masks the columns of each record and counts the values it
+// masked.
+type maskTransform struct {
+	columns []maskColumn
+	counts  map[string]int64
+	rows    int64
+}
+
+func (t *maskTransform) Name() string {
+	return "mask"
+}
+
+func (t *maskTransform) Apply(ctx context.Context, batch record.Batch) (record.Batch, error) {
+	for _, r := range batch {
+		t.rows++
+		for _, c := range t.columns {
+			v := r[c.name]
+			if v == nil {
+				continue
+			}
+			masked, err := c.mask(v)
+			if err != nil {
+				return nil, fmt.Errorf("record %d: column %s: %w", t.rows, c.name, err)
+			}
+			r[c.name] = masked
+			t.counts[c.name]++
+		}
+	}
+	return batch, nil
+}
+
+func compileMask(rule MaskRule, secret string) (masker, error) {
+	switch rule.Method {
+	case MaskRedact:
+		return func(any) (any, error) {
+			if rule.Replacement == nil {
+				return nil, nil
+			}
+			return *rule.Replacement, nil
+		}, nil
+	case MaskPartial:
+		return textMasker(func(s string) (string, error) {
+			return maskPartial(s, rule.KeepFirst, rule.KeepLast, rule.Char), nil
+		}), nil
+	case MaskEmail:
+		return textMasker(func(s string) (string, error) {
+			return maskEmail(s, rule.Char), nil
+		}), nil
+	case MaskHash:
+		return textMasker(func(s string) (string, error) {
+			h := hmac.New(sha256.New, []byte(secret))
+			h.Write([]byte(s))
+			return hex.EncodeToString(h.Sum(nil)), nil
+		}), nil
+	case MaskTokenize, MaskDetokenize:
+		t, err := newTokenizer(secret)
+		if err != nil {
+			return nil, err
+		}
+		if rule.Method == MaskTokenize {
+			return textMasker(func(s string) (string, error) { return t.tokenize(s), nil }), nil
+		}
+		return textMasker(t.detokenize), nil
+	}
+	return nil, fmt.Errorf("unknown method %q", rule.Method)
+}
+
+// textMasker masks the text of scalar values.
+func textMasker(fn func(s string) (string, error)) masker {
+	return func(v any) (any, error) {
+		var s string
+		switch v := v.(type) {
+		case string:
+			s = v
+		case json.Number:
+			s = v.String()
+		case bool:
+			s = strconv.FormatBool(v)
+		default:
+			return nil, errors.New("only scalar values can be masked")
+		}
+		return fn(s)
+	}
+}
+
+// maskPartial masks all characters of s but the first and last ones.
+func maskPartial(s string, first, last int, char string) string {
+	runes := []rune(s)
+	if len(runes) <= first+last {
+		return strings.Repeat(char, len(runes))
+	}
+	return string(runes[:first]) + strings.Repeat(char, len(runes)-first-last) + string(runes[len(runes)-last:])
+}
+
+// maskEmail masks the local part of an address but its first character.
+// Text that is not an address is fully masked.
+func maskEmail(s, char string) string {
+	at := strings.LastIndex(s, "@")
+	if at <= 0 {
+		return maskPartial(s, 0, 0, char)
+	}
+	return maskPartial(s[:at], 1, 0, char) + s[at:]
+}
+
+// tokenizer encrypts values into tokens with AES-GCM. The nonce is derived
+// from the value, so equal values get equal tokens and can still be joined
+// on.
+type tokenizer struct {
+	aead cipher.AEAD
+	mac  []byte
+}
+
+func newTokenizer(secret string) (*tokenizer, error) {
+	key, err := deriveKey(secret, "transform.mask encryption")
+	if err != nil {
+		return nil, err
+	}
+	mac, err := deriveKey(secret, "transform.mask nonce")
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenizer{aead: aead, mac: mac}, nil
+}
+
+// deriveKey derives a 256 bit key for a purpose from a secret with HKDF.
+func deriveKey(secret, purpose string) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), nil, []byte(purpose)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (t *tokenizer) tokenize(s string) string {
+	h := hmac.New(sha256.New, t.mac)
+	h.Write([]byte(s))
+	nonce := h.Sum(nil)[:t.aead.NonceSize()]
+
+	sealed := t.aead.Seal(nonce, nonce, []byte(s), nil)
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+func (t *tokenizer) detokenize(token string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, tokenPrefix))
+	if err != nil || !strings.HasPrefix(token, tokenPrefix) || len(data) < t.aead.NonceSize() {
+		return "", errors.New("not a token")
+	}
+
+	nonce, sealed := data[:t.aead.NonceSize()], data[t.aead.NonceSize():]
+	plain, err := t.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", errors.New("token was not made with this secret")
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,148 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMaskStore(t *testing.T) store.Storage {
+	t.Helper()
+
+	ctx := context.Background()
+	storage := store.NewMockStore()
+	storage.Pipelines.Create(ctx, &store.Pipelines{ID: 1, OrganizationID: 1})
+	storage.Secrets.Create(ctx, &store.Secret{OrganizationID: 1, Name: "pii_salt", Value: "pepper"})
+	storage.Secrets.Create(ctx, &store.Secret{OrganizationID: 1, Name: "token_key", Value: "k3y"})
+	storage.Secrets.Create(ctx, &store.Secret{OrganizationID: 2, Name: "other_org", Value: "x"})
+	return storage
+}
+
+func runMask(t *testing.T, storage store.Storage, config TransformMaskConfig) (*Run, error) {
+	t.Helper()
+
+	task := store.Task{ID: 1, PipelineID: 1, Type: TransformMaskType, Config: mustMarshal(config)}
+	mask := NewTransformMask(storage, NewRegistry())
+	if err := mask.Validate(context.Background(), task); err != nil {
+		return nil, err
+	}
+
+	run := NewRun(task, &store.TaskRun{ID: 1})
+	return run, run.complete(context.Background(), mask.Run(context.Background(), run))
+}
+
+func TestTransformMask_Run(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "customers.jsonl")
+	target := filepath.Join(dir, "masked.jsonl")
+	data := `{"id": 1, "name": "Chihiro Ogino", "email": "chihiro@example.com", "card": "4111111111111111", "phone": 5550100, "ssn": "123-45-6789"}` + "\n" +
+		`{"id": 2, "name": "Haku", "email": "not an email", "card": "42", "phone": null, "ssn": null}` + "\n"
+	assert.NoError(t, os.WriteFile(source, []byte(data), 0o644))
+
+	redacted := "[redacted]"
+	config := TransformMaskConfig{
+		SourcePath: source,
+		TargetPath: target,
+		Rules: []MaskRule{
+			{Columns: []string{"name"}, Method: MaskRedact, Replacement: &redacted},
+			{Columns: []string{"card"}, Method: MaskPartial, KeepLast: 4, Char: "#"},
+			{Columns: []string{"email"}, Method: MaskEmail},
+			{Columns: []string{"phone"}, Method: MaskHash, Secret: "pii_salt"},
+			{Columns: []string{"ssn"}, Method: MaskTokenize, Secret: "token_key"},
+		},
+	}
+
+	storage := newMaskStore(t)
+	run, err := runMask(t, storage, config)
+	assert.NoError(t, err)
+
+	lines := readLines(t, target)
+	if !assert.Len(t, lines, 2) {
+		return
+	}
+	assert.Equal(t, "[redacted]", lines[0]["name"])
+	assert.Equal(t, "############1111", lines[0]["card"])
+	assert.Equal(t, "##", lines[1]["card"])
+	assert.Equal(t, "c******@example.com", lines[0]["email"])
+	assert.Equal(t, "************", lines[1]["email"])
+	assert.Equal(t, "c1e738653f9f35375e67104b3468b2aa6281d7d502023b329594330cc4a81ccc", lines[0]["phone"])
+	assert.Nil(t, lines[1]["phone"])
+	assert.True(t, strings.HasPrefix(lines[0]["ssn"].(string), tokenPrefix))
+	assert.NotContains(t, lines[0]["ssn"], "6789")
+
+	var stats record.Stats
+	assert.NoError(t, json.Unmarshal(run.Record.Stats, &stats))
+	assert.Equal(t, map[string]int64{
+		"masked.name": 2, "masked.card": 2, "masked.email": 2, "masked.phone": 1, "masked.ssn": 1,
+	}, stats.Counters)
+
+	logs := run.Log.String()
+	assert.Contains(t, logs, "rule 4: hash phone with secret pii_salt (id 1")
+	assert.NotContains(t, logs, "pepper")
+
+	t.Run("tokens are stable and reversible", func(t *testing.T) {
+		first := lines[0]["ssn"]
+		_, err := runMask(t, storage, config)
+		assert.NoError(t, err)
+		assert.Equal(t, first, readLines(t, target)[0]["ssn"])
+
+		restored := filepath.Join(dir, "restored.jsonl")
+		_, err = runMask(t, storage, TransformMaskConfig{
+			SourcePath: target,
+			TargetPath: restored,
+			Rules:      []MaskRule{{Columns: []string{"ssn"}, Method: MaskDetokenize, Secret: "token_key"}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "123-45-6789", readLines(t, restored)[0]["ssn"])
+
+		storage.Secrets.Create(context.Background(), &store.Secret{OrganizationID: 1, Name: "rotated", Value: "new"})
+		_, err = runMask(t, storage, TransformMaskConfig{
+			SourcePath: target,
+			TargetPath: restored,
+			Rules:      []MaskRule{{Columns: []string{"ssn"}, Method: MaskDetokenize, Secret: "rotated"}},
+		})
+		assert.EqualError(t, err, "record 1: column ssn: token was not made with this secret")
+	})
+}
+
+func TestTransformMask_Validate(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "customers.jsonl")
+	assert.NoError(t, os.WriteFile(source, []byte(`{"id": 1, "email": "a@example.com"}`+"\n"), 0o644))
+
+	storage := newMaskStore(t)
+	validate := func(rules ...MaskRule) error {
+		task := store.Task{PipelineID: 1, Type: TransformMaskType, Config: mustMarshal(TransformMaskConfig{
+			SourcePath: source,
+			TargetPath: filepath.Join(dir, "masked.jsonl"),
+			Rules:      rules,
+		})}
+		return NewTransformMask(storage, NewRegistry()).Validate(context.Background(), task)
+	}
+
+	assert.NoError(t, validate(MaskRule{Columns: []string{"email"}, Method: MaskHash, Secret: "pii_salt"}))
+
+	tests := []struct {
+		rules []MaskRule
+		err   string
+	}{
+		{[]MaskRule{{Columns: []string{"email"}, Method: MaskHash}}, "rule 1 (hash): secret is required"},
+		{[]MaskRule{{Columns: []string{"email"}, Method: MaskHash, Secret: "other_org"}}, `rule 1 (hash): secret "other_org" not found`},
+		{[]MaskRule{{Columns: []string{"email"}, Method: MaskEmail, KeepFirst: 2}}, "rule 1 (email): keep_first does not apply to email"},
+		{[]MaskRule{{Columns: []string{"missing"}, Method: MaskRedact}}, `rule 1 (redact): unknown column "missing"`},
+		{[]MaskRule{
+			{Columns: []string{"email"}, Method: MaskEmail},
+			{Columns: []string{"email"}, Method: MaskRedact},
+		}, `rules: duplicate column "email"`},
+	}
+	for _, tt := range tests {
+		assert.EqualError(t, validate(tt.rules...), tt.err)
+	}
+}
@@ -0,0 +1,716 @@
+package task
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+const XLSXReadType = "xlsx.read"
+
+type XLSXReadConfig struct {
+	SourcePath string `json:"source_path" validate:"required"`
+	TargetPath string `json:"target_path" validate:"required"`
+	// Sheet selects a sheet by name, SheetIndex by its 1-based position.
+	// The first sheet is read by default.
+	Sheet      string `json:"sheet"`
+	SheetIndex int    `json:"sheet_index" validate:"min=0"`
+	// Range limits the cells read, e.g. "B3:F200", or "B3:F" to read down
+	// to the last row. The whole sheet is read by default.
+	Range string `json:"range"`
+	// HeaderRow is the sheet row holding the column names, the first row of
+	// the range by default. HeaderRows spans the header over several rows,
+	// whose names are joined with a space.
+	HeaderRow  int `json:"header_row" validate:"min=0"`
+	HeaderRows int `json:"header_rows" validate:"min=0"`
+	// NoHeader names the columns by their letter instead.
+	NoHeader bool `json:"no_header"`
+	OutputConfig
+}
+
+func (XLSXReadConfig) resumable() {}
+
+// XLSXRead reads a sheet of an Excel workbook into a JSON lines file. The
+// sheet is streamed row by row, only the shared strings of the workbook
+// are held in memory.
+type XLSXRead struct{}
+
+func NewXLSXRead() *XLSXRead {
+	return &XLSXRead{}
+}
+
+func (x *XLSXRead) Validate(ctx context.Context, task store.Task) error {
+	_, err := x.config(task)
+	return err
+}
+
+func (x *XLSXRead) config(task store.Task) (XLSXReadConfig, error) {
+	var cfg XLSXReadConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if err := validateSourcePath(cfg.SourcePath); err != nil {
+		return cfg, err
+	}
+	if err := validateOutputPath(cfg.TargetPath); err != nil {
+		return cfg, err
+	}
+
+	if cfg.Sheet != "" && cfg.SheetIndex != 0 {
+		return cfg, errors.New("only one of sheet or sheet_index can be set")
+	}
+
+	if _, err := parseCellRange(cfg.Range); err != nil {
+		return cfg, err
+	}
+
+	if cfg.NoHeader && (cfg.HeaderRow != 0 || cfg.HeaderRows != 0) {
+		return cfg, errors.New("header_row and header_rows do not apply with no_header")
+	}
+	if cfg.HeaderRows == 0 {
+		cfg.HeaderRows = 1
+	}
+
+	return cfg, nil
+}
+
+func (x *XLSXRead) Run(ctx context.Context, run *Run) error {
+	cfg, err := x.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	book, err := openWorkbook(cfg.SourcePath)
+	if err != nil {
+		return err
+	}
+	defer book.Close()
+
+	sheet, err := book.sheet(cfg.Sheet, cfg.SheetIndex)
+	if err != nil {
+		return err
+	}
+
+	bounds, _ := parseCellRange(cfg.Range)
+	headerRow := cfg.HeaderRow
+	if headerRow == 0 {
+		headerRow = max(bounds.minRow, 1)
+	}
+	if headerRow < bounds.minRow || (bounds.maxRow > 0 && headerRow > bounds.maxRow) {
+		return fmt.Errorf("header_row %d is outside of the range %s", headerRow, cfg.Range)
+	}
+
+	var merges []cellRange
+	if !cfg.NoHeader {
+		merges, err = book.mergedCells(sheet.path)
+		if err != nil {
+			return err
+		}
+	}
+
+	sink, err := newJSONLOutput(run, cfg.TargetPath, cfg.Partition)
+	if err != nil {
+		return err
+	}
+
+	source := newSource(XLSXReadType, func(ctx context.Context, w record.Writer) error {
+		var header []string
+		var headerCells []map[int]any
+		lastHeaderRow := headerRow + cfg.HeaderRows - 1
+		if cfg.NoHeader {
+			lastHeaderRow = 0
+		}
+
+		err := book.rows(sheet.path, func(row int, cells map[int]any) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if !bounds.containsRow(row) {
+				return nil
+			}
+			for col := range cells {
+				if !bounds.containsCol(col) {
+					delete(cells, col)
+				}
+			}
+
+			if row <= lastHeaderRow {
+				if row >= headerRow {
+					headerCells = append(headerCells, fillMerged(row, cells, merges))
+				}
+				if row == lastHeaderRow {
+					header = headerNames(headerCells)
+					run.Log.Printf("header: %s", strings.Join(slices.DeleteFunc(slices.Clone(header), func(name string) bool {
+						return name == ""
+					}), ", "))
+				}
+				return nil
+			}
+			if len(cells) == 0 {
+				return nil
+			}
+
+			r := make(map[string]any)
+			if cfg.NoHeader {
+				for col, value := range cells {
+					r[columnName(col)] = value
+				}
+			} else {
+				for col, name := range header {
+					if name != "" {
+						r[name] = cells[col]
+					}
+				}
+			}
+			return w.Write(r)
+		})
+		if err != nil {
+			return err
+		}
+		if !cfg.NoHeader && header == nil {
+			return fmt.Errorf("header row %d not found in sheet %s", headerRow, sheet.name)
+		}
+		return nil
+	})
+	source.path = cfg.SourcePath
+	stats, err := runPipeline(ctx, run, nil, source, sink)
+	if err != nil {
+		return err
+	}
+
+	run.Log.Printf("read %d rows of sheet %s into %s", stats.Written(), sheet.name, cfg.TargetPath)
+	return nil
+}
+
+// fillMerged copies the value of merged cells, held by their top left
+// cell, over the columns they span. Rows below the top of a merged cell
+// stay empty, so multi-row headers only name such a column once.
+func fillMerged(row int, cells map[int]any, merges []cellRange) map[int]any {
+	for _, m := range merges {
+		if row != m.minRow {
+			continue
+		}
+		value, ok := cells[m.minCol]
+		if !ok {
+			continue
+		}
+		for col := m.minCol + 1; col <= m.maxCol; col++ {
+			cells[col] = value
+		}
+	}
+	return cells
+}
+
+// headerNames builds the column names from the header rows. Columns
+// without a name are dropped and duplicate names get a numeric suffix.
+func headerNames(rows []map[int]any) []string {
+	width := 0
+	for _, cells := range rows {
+		for col := range cells {
+			width = max(width, col+1)
+		}
+	}
+
+	names := make([]string, width)
+	seen := make(map[string]int)
+	for col := range names {
+		var parts []string
+		for _, cells := range rows {
+			if v, ok := cells[col]; ok && v != nil {
+				part := strings.TrimSpace(fmt.Sprint(v))
+				if part != "" && (len(parts) == 0 || parts[len(parts)-1] != part) {
+					parts = append(parts, part)
+				}
+			}
+		}
+		name := strings.Join(parts, " ")
+		if name == "" {
+			continue
+		}
+
+		seen[name]++
+		if n := seen[name]; n > 1 {
+			name = fmt.Sprintf("%s_%d", name, n)
+		}
+		names[col] = name
+	}
+	return names
+}
+
+// cellRange is an inclusive range of cells with 0-based columns and
+// 1-based rows. A zero maxRow leaves the range open downwards and a -1
+// maxCol open to the right.
+type cellRange struct {
+	minCol, maxCol int
+	minRow, maxRow int
+}
+
+var cellRefPattern = regexp.MustCompile(`^([A-Z]{1,3})([0-9]*)$`)
+
+func parseCellRange(text string) (cellRange, error) {
+	if text == "" {
+		return cellRange{minCol: 0, maxCol: -1, minRow: 1}, nil
+	}
+
+	from, to, found := strings.Cut(strings.ToUpper(text), ":")
+	if !found {
+		to = from
+	}
+
+	minCol, minRow, err := parseCellRef(from)
+	if err != nil || minRow == 0 {
+		return cellRange{}, fmt.Errorf("invalid range %q", text)
+	}
+	maxCol, maxRow, err := parseCellRef(to)
+	if err != nil || maxCol < minCol || (maxRow != 0 && maxRow < minRow) {
+		return cellRange{}, fmt.Errorf("invalid range %q", text)
+	}
+
+	return cellRange{minCol: minCol, maxCol: maxCol, minRow: minRow, maxRow: maxRow}, nil
+}
+
+// parseCellRef parses a reference such as "AB12" into a 0-based column
+// and a 1-based row, zero when the reference has no row.
+func parseCellRef(ref string) (int, int, error) {
+	m := cellRefPattern.FindStringSubmatch(ref)
+	if m == nil {
+		return 0, 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+
+	col := 0
+	for _, c := range m[1] {
+		col = col*26 + int(c-'A'+1)
+	}
+
+	row := 0
+	if m[2] != "" {
+		row, _ = strconv.Atoi(m[2])
+	}
+	return col - 1, row, nil
+}
+
+func columnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+func (r cellRange) containsRow(row int) bool {
+	return row >= r.minRow && (r.maxRow == 0 || row <= r.maxRow)
+}
+
+func (r cellRange) containsCol(col int) bool {
+	return col >= r.minCol && (r.maxCol < 0 || col <= r.maxCol)
+}
+
+type workbookSheet struct {
+	name string
+	path string
+}
+
+type workbook struct {
+	zip     *zip.ReadCloser
+	sheets  []workbookSheet
+	strings []string
+	// dateStyles are the cell styles with a date number format.
+	dateStyles map[int]bool
+	date1904   bool
+}
+
+func openWorkbook(name string) (*workbook, error) {
+	z, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a workbook: %w", name, err)
+	}
+
+	book := &workbook{zip: z}
+	for _, load := range []func() error{book.loadSheets, book.loadStrings, book.loadStyles} {
+		if err := load(); err != nil {
+			z.Close()
+			return nil, err
+		}
+	}
+	return book, nil
+}
+
+func (b *workbook) Close() error {
+	return b.zip.Close()
+}
+
+// decodePart decodes a whole part of the workbook.
+func (b *workbook) decodePart(name string, v any) error {
+	f, err := b.zip.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return xml.NewDecoder(f).Decode(v)
+}
+
+func (b *workbook) loadSheets() error {
+	var wb struct {
+		Pr struct {
+			Date1904 bool `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := b.decodePart("xl/workbook.xml", &wb); err != nil {
+		return fmt.Errorf("failed to read workbook: %w", err)
+	}
+	b.date1904 = wb.Pr.Date1904
+
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := b.decodePart("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return fmt.Errorf("failed to read workbook relationships: %w", err)
+	}
+
+	targets := make(map[string]string)
+	for _, rel := range rels.Relationships {
+		target := rel.Target
+		if strings.HasPrefix(target, "/") {
+			target = strings.TrimPrefix(target, "/")
+		} else {
+			target = path.Join("xl", target)
+		}
+		targets[rel.ID] = target
+	}
+
+	for _, s := range wb.Sheets {
+		b.sheets = append(b.sheets, workbookSheet{name: s.Name, path: targets[s.RID]})
+	}
+	return nil
+}
+
+func (b *workbook) loadStrings() error {
+	f, err := b.zip.Open("xl/sharedStrings.xml")
+	if err != nil {
+		// Workbooks without text have no shared strings.
+		return nil
+	}
+	defer f.Close()
+
+	// Rich text strings are made of several runs, each with a <t>.
+	decoder := xml.NewDecoder(f)
+	var current *strings.Builder
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read shared strings: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				current = &strings.Builder{}
+			case "t":
+				var text string
+				if err := decoder.DecodeElement(&text, &t); err != nil {
+					return err
+				}
+				if current != nil {
+					current.WriteString(text)
+				}
+			case "rPh":
+				// Phonetic hints are not part of the text.
+				if err := decoder.Skip(); err != nil {
+					return err
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "si" && current != nil {
+				b.strings = append(b.strings, current.String())
+				current = nil
+			}
+		}
+	}
+}
+
+// builtinDateFormats are the ids of the built-in date and time number
+// formats.
+var builtinDateFormats = map[int]bool{
+	14: true, 15: true, 16: true, 17: true, 18: true, 19: true, 20: true, 21: true, 22: true,
+	27: true, 28: true, 29: true, 30: true, 31: true, 32: true, 33: true, 34: true, 35: true, 36: true,
+	45: true, 46: true, 47: true,
+	50: true, 51: true, 52: true, 53: true, 54: true, 55: true, 56: true, 57: true, 58: true,
+}
+
+func (b *workbook) loadStyles() error {
+	b.dateStyles = make(map[int]bool)
+
+	var styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err := b.decodePart("xl/styles.xml", &styles); err != nil {
+		// Workbooks without styles have no dates.
+		return nil
+	}
+
+	custom := make(map[int]bool)
+	for _, f := range styles.NumFmts {
+		custom[f.ID] = isDateFormat(f.Code)
+	}
+	for i, xf := range styles.CellXfs {
+		if date, ok := custom[xf.NumFmtID]; ok {
+			b.dateStyles[i] = date
+		} else {
+			b.dateStyles[i] = builtinDateFormats[xf.NumFmtID]
+		}
+	}
+	return nil
+}
+
+var nonDateFormatParts = regexp.MustCompile(`"[^"]*"|\\.|\[[^\]]*\]|_.|\*.`)
+
+// isDateFormat reports whether a number format code formats dates or
+// times, ignoring quoted text, escapes, colors and conditions.
+func isDateFormat(code string) bool {
+	if strings.Contains(strings.ToLower(code), "[h]") || strings.Contains(strings.ToLower(code), "[m]") {
+		return true
+	}
+	code = strings.ToLower(nonDateFormatParts.ReplaceAllString(code, ""))
+	return strings.ContainsAny(code, "ymdhs")
+}
+
+func (b *workbook) sheet(name string, index int) (workbookSheet, error) {
+	if len(b.sheets) == 0 {
+		return workbookSheet{}, errors.New("workbook has no sheets")
+	}
+
+	switch {
+	case name != "":
+		for _, s := range b.sheets {
+			if s.name == name {
+				return s, nil
+			}
+		}
+		return workbookSheet{}, fmt.Errorf("sheet %q not found", name)
+	case index > 0:
+		if index > len(b.sheets) {
+			return workbookSheet{}, fmt.Errorf("sheet_index %d is out of range, the workbook has %d sheets", index, len(b.sheets))
+		}
+		return b.sheets[index-1], nil
+	default:
+		return b.sheets[0], nil
+	}
+}
+
+// mergedCells lists the merged cells of a sheet. They follow the cells
+// in the sheet, which is scanned without holding its rows.
+func (b *workbook) mergedCells(name string) ([]cellRange, error) {
+	f, err := b.zip.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var merges []cellRange
+	decoder := xml.NewDecoder(f)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return merges, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "sheetData":
+			if err := decoder.Skip(); err != nil {
+				return nil, err
+			}
+		case "mergeCell":
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "ref" {
+					r, err := parseCellRange(attr.Value)
+					if err != nil {
+						return nil, err
+					}
+					merges = append(merges, r)
+				}
+			}
+		}
+	}
+}
+
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Style  int    `xml:"s,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline struct {
+		Text string   `xml:"t"`
+		Runs []string `xml:"r>t"`
+	} `xml:"is"`
+}
+
+// rows streams the non-empty cells of each row of a sheet to fn, keyed by
+// their 0-based column.
+func (b *workbook) rows(name string, fn func(row int, cells map[int]any) error) error {
+	f, err := b.zip.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := xml.NewDecoder(f)
+	row, col := 0, 0
+	var cells map[int]any
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				row++
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "r" {
+						if r, err := strconv.Atoi(attr.Value); err == nil {
+							row = r
+						}
+					}
+				}
+				cells = make(map[int]any)
+				col = 0
+			case "c":
+				var cell xlsxCell
+				if err := decoder.DecodeElement(&cell, &t); err != nil {
+					return err
+				}
+
+				// The reference of a cell is optional, it then follows the
+				// previous cell.
+				if cell.Ref != "" {
+					if col, _, err = parseCellRef(cell.Ref); err != nil {
+						return fmt.Errorf("row %d: %w", row, err)
+					}
+				}
+
+				value, err := b.cellValue(cell)
+				if err != nil {
+					return fmt.Errorf("cell %s%d: %w", columnName(col), row, err)
+				}
+				if value != nil {
+					cells[col] = value
+				}
+				col++
+			case "mergeCells":
+				return nil
+			}
+		case xml.EndElement:
+			if t.Name.Local == "row" {
+				if err := fn(row, cells); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func (b *workbook) cellValue(cell xlsxCell) (any, error) {
+	switch cell.Type {
+	case "s":
+		i, err := strconv.Atoi(cell.Value)
+		if err != nil || i < 0 || i >= len(b.strings) {
+			return nil, fmt.Errorf("invalid shared string %q", cell.Value)
+		}
+		return b.strings[i], nil
+	case "inlineStr":
+		if cell.Inline.Text != "" {
+			return cell.Inline.Text, nil
+		}
+		return strings.Join(cell.Inline.Runs, ""), nil
+	case "str", "e":
+		return cell.Value, nil
+	case "b":
+		return cell.Value == "1", nil
+	}
+
+	if cell.Value == "" {
+		return nil, nil
+	}
+	if b.dateStyles[cell.Style] {
+		serial, err := strconv.ParseFloat(cell.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date serial %q", cell.Value)
+		}
+		return excelDate(serial, b.date1904), nil
+	}
+	if _, err := strconv.ParseFloat(cell.Value, 64); err != nil {
+		return nil, fmt.Errorf("invalid number %q", cell.Value)
+	}
+	return json.Number(cell.Value), nil
+}
+
+// excelDate converts a date serial into a date, or a date and time when it
+// has a time part. Serials count days since 1900, where Excel wrongly has a
+// 29 February, or since 1904.
+func excelDate(serial float64, date1904 bool) string {
+	epoch := time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+	switch {
+	case date1904:
+		epoch = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+	case serial < 61:
+		epoch = time.Date(1899, time.December, 31, 0, 0, 0, 0, time.UTC)
+	}
+
+	days := math.Floor(serial)
+	millis := math.Round((serial - days) * 24 * 60 * 60 * 1000)
+	t := epoch.AddDate(0, 0, int(days)).Add(time.Duration(millis) * time.Millisecond)
+
+	if millis == 0 {
+		return t.Format(time.DateOnly)
+	}
+	if t.Nanosecond() == 0 {
+		return t.Format("2006-01-02T15:04:05")
+	}
+	return t.Format("2006-01-02T15:04:05.000")
+}
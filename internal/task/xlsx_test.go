@@ -0,0 +1,163 @@
+package task
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeWorkbook writes a minimal workbook with the given parts.
+func writeWorkbook(t *testing.T, name string, parts map[string]string) {
+	t.Helper()
+
+	file, err := os.Create(name)
+	if err != nil {
+		t.Fatalf("Failed to create workbook: %v", err)
+	}
+	defer file.Close()
+
+	w := zip.NewWriter(file)
+	for part, content := range parts {
+		f, _ := w.Create(part)
+		f.Write([]byte(content))
+	}
+	assert.NoError(t, w.Close())
+}
+
+const testWorkbook = `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+	<sheets>
+		<sheet name="Notes" sheetId="1" r:id="rId1"/>
+		<sheet name="Sales" sheetId="2" r:id="rId2"/>
+	</sheets>
+</workbook>`
+
+const testWorkbookRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+	<Relationship Id="rId1" Type="worksheet" Target="worksheets/sheet1.xml"/>
+	<Relationship Id="rId2" Type="worksheet" Target="/xl/worksheets/sheet2.xml"/>
+</Relationships>`
+
+const testSharedStrings = `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+	<si><t>Region</t></si>
+	<si><t>Q1</t></si>
+	<si><t>Jan</t></si>
+	<si><t>Feb</t></si>
+	<si><t>Date</t></si>
+	<si><r><t>No</t></r><r><t>rth</t></r></si>
+</sst>`
+
+// Style 1 is a built-in date format, style 2 a custom date and time
+// format and style 3 a custom number format.
+const testStyles = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+	<numFmts>
+		<numFmt numFmtId="164" formatCode="yyyy\-mm\-dd hh:mm"/>
+		<numFmt numFmtId="165" formatCode="&quot;USD&quot; #,##0.00"/>
+	</numFmts>
+	<cellXfs>
+		<xf numFmtId="0"/>
+		<xf numFmtId="14"/>
+		<xf numFmtId="164"/>
+		<xf numFmtId="165"/>
+	</cellXfs>
+</styleSheet>`
+
+// The sales sheet has a title row, a two row header where Q1 is merged
+// over Jan and Feb, and Region and Date are merged vertically.
+const testSalesSheet = `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+	<sheetData>
+		<row r="1"><c r="A1" t="inlineStr"><is><t>Sales report</t></is></c></row>
+		<row r="3"><c r="B3" t="s"><v>0</v></c><c r="C3" t="s"><v>1</v></c><c r="E3" t="s"><v>4</v></c></row>
+		<row r="4"><c r="C4" t="s"><v>2</v></c><c r="D4" t="s"><v>3</v></c></row>
+		<row r="5"><c r="B5" t="s"><v>5</v></c><c r="C5" s="3"><v>10.5</v></c><c r="D5"><v>20</v></c><c r="E5" s="1"><v>45658</v></c><c r="F5"><v>99</v></c></row>
+		<row r="6"></row>
+		<row r="7"><c r="B7" t="inlineStr"><is><t>South</t></is></c><c r="D7"><v>7</v></c><c r="E7" s="2"><v>45658.5</v></c></row>
+		<row r="8"><c r="B8" t="inlineStr"><is><t>Total</t></is></c><c r="C8" t="str"><f>SUM(C5:C7)</f><v>10.5</v></c></row>
+	</sheetData>
+	<mergeCells count="3">
+		<mergeCell ref="C3:D3"/>
+		<mergeCell ref="B3:B4"/>
+		<mergeCell ref="E3:E4"/>
+	</mergeCells>
+</worksheet>`
+
+func TestXLSXRead(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "sales.xlsx")
+	writeWorkbook(t, source, map[string]string{
+		"xl/workbook.xml":            testWorkbook,
+		"xl/_rels/workbook.xml.rels": testWorkbookRels,
+		"xl/sharedStrings.xml":       testSharedStrings,
+		"xl/styles.xml":              testStyles,
+		"xl/worksheets/sheet1.xml":   `<worksheet><sheetData/></worksheet>`,
+		"xl/worksheets/sheet2.xml":   testSalesSheet,
+	})
+	target := filepath.Join(dir, "sales.jsonl")
+
+	t.Run("merged header and dates", func(t *testing.T) {
+		run, err := runTask(t, NewXLSXRead(), XLSXReadType, XLSXReadConfig{
+			SourcePath: source,
+			TargetPath: target,
+			Sheet:      "Sales",
+			Range:      "B3:E7",
+			HeaderRows: 2,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), *run.Record.RowsAffected)
+		assert.Contains(t, run.Log.String(), "header: Region, Q1 Jan, Q1 Feb, Date")
+
+		lines := readLines(t, target)
+		assert.Equal(t, map[string]any{"Region": "North", "Q1 Jan": 10.5, "Q1 Feb": 20.0, "Date": "2025-01-01"}, lines[0])
+		assert.Equal(t, map[string]any{"Region": "South", "Q1 Jan": nil, "Q1 Feb": 7.0, "Date": "2025-01-01T12:00:00"}, lines[1])
+	})
+
+	t.Run("sheet by index without header", func(t *testing.T) {
+		run, err := runTask(t, NewXLSXRead(), XLSXReadType, XLSXReadConfig{
+			SourcePath: source,
+			TargetPath: target,
+			SheetIndex: 2,
+			Range:      "B7:C",
+			NoHeader:   true,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), *run.Record.RowsAffected)
+
+		lines := readLines(t, target)
+		assert.Equal(t, map[string]any{"B": "South"}, lines[0])
+		assert.Equal(t, map[string]any{"B": "Total", "C": "10.5"}, lines[1])
+	})
+
+	t.Run("unknown sheet", func(t *testing.T) {
+		_, err := runTask(t, NewXLSXRead(), XLSXReadType, XLSXReadConfig{SourcePath: source, TargetPath: target, Sheet: "Costs"})
+		assert.EqualError(t, err, `sheet "Costs" not found`)
+
+		_, err = runTask(t, NewXLSXRead(), XLSXReadType, XLSXReadConfig{SourcePath: source, TargetPath: target, SheetIndex: 3})
+		assert.ErrorContains(t, err, "out of range")
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		_, err := runTask(t, NewXLSXRead(), XLSXReadType, XLSXReadConfig{SourcePath: source, TargetPath: target, Range: "3B:C"})
+		assert.ErrorContains(t, err, "invalid range")
+
+		_, err = runTask(t, NewXLSXRead(), XLSXReadType, XLSXReadConfig{SourcePath: source, TargetPath: target, Sheet: "Sales", SheetIndex: 1})
+		assert.Error(t, err)
+	})
+}
+
+func TestExcelDate(t *testing.T) {
+	assert.Equal(t, "1900-01-01", excelDate(1, false))
+	assert.Equal(t, "1900-03-01", excelDate(61, false))
+	assert.Equal(t, "2025-01-01", excelDate(45658, false))
+	assert.Equal(t, "2025-01-01T06:00:00", excelDate(45658.25, false))
+	assert.Equal(t, "2029-01-02", excelDate(45658, true))
+}
+
+func TestIsDateFormat(t *testing.T) {
+	assert.True(t, isDateFormat("dd/mm/yyyy"))
+	assert.True(t, isDateFormat("[h]:mm:ss"))
+	assert.True(t, isDateFormat(`[$-409]mmmm\ d\,\ yyyy;@`))
+	assert.False(t, isDateFormat("General"))
+	assert.False(t, isDateFormat(`"Days" 0.00`))
+	assert.False(t, isDateFormat("[Red]#,##0.00"))
+}
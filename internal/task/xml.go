@@ -0,0 +1,474 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/LincolnG4/Haku/internal/record"
+	"github.com/LincolnG4/Haku/internal/store"
+)
+
+const XMLReadType = "xml.read"
+
+type XMLReadConfig struct {
+	SourcePath string `json:"source_path" validate:"required"`
+	TargetPath string `json:"target_path" validate:"required"`
+	// RecordPath selects the repeating record elements with an XPath-like
+	// expression, e.g. "/feed/entry", "//entry" or
+	// "//atom:entry[@type='post']".
+	RecordPath string `json:"record_path" validate:"required"`
+	// Namespaces maps the prefixes used in paths to namespace URIs. Names
+	// without a prefix match elements of any namespace.
+	Namespaces map[string]string `json:"namespaces"`
+	// Fields maps field names to paths relative to the record, e.g.
+	// "title", "author/name", "@id", "link/@href" or "." for the text of
+	// the record. Without fields, attributes map to "@name" fields and
+	// child elements to fields, nested for elements with children and
+	// lists for repeated elements.
+	Fields map[string]string `json:"fields"`
+	OutputConfig
+}
+
+func (XMLReadConfig) resumable() {}
+
+// XMLRead streams the records of an XML document into a JSON lines file.
+// Only the record being read is held in memory.
+type XMLRead struct{}
+
+func NewXMLRead() *XMLRead {
+	return &XMLRead{}
+}
+
+func (x *XMLRead) Validate(ctx context.Context, task store.Task) error {
+	_, _, _, err := x.config(task)
+	return err
+}
+
+func (x *XMLRead) config(task store.Task) (XMLReadConfig, xmlPath, map[string]xmlPath, error) {
+	var cfg XMLReadConfig
+	if err := decodeConfig(task.Config, &cfg); err != nil {
+		return cfg, xmlPath{}, nil, err
+	}
+
+	if err := validateSourcePath(cfg.SourcePath); err != nil {
+		return cfg, xmlPath{}, nil, err
+	}
+	if err := validateOutputPath(cfg.TargetPath); err != nil {
+		return cfg, xmlPath{}, nil, err
+	}
+
+	records, err := parseXMLPath(cfg.RecordPath, cfg.Namespaces, false)
+	if err != nil {
+		return cfg, xmlPath{}, nil, fmt.Errorf("record_path: %w", err)
+	}
+	if records.attr != nil || records.self {
+		return cfg, xmlPath{}, nil, errors.New("record_path must select elements")
+	}
+
+	fields := make(map[string]xmlPath, len(cfg.Fields))
+	for name, text := range cfg.Fields {
+		path, err := parseXMLPath(text, cfg.Namespaces, true)
+		if err != nil {
+			return cfg, xmlPath{}, nil, fmt.Errorf("field %s: %w", name, err)
+		}
+		fields[name] = path
+	}
+
+	return cfg, records, fields, nil
+}
+
+func (x *XMLRead) Run(ctx context.Context, run *Run) error {
+	cfg, records, fields, err := x.config(run.Task)
+	if err != nil {
+		return err
+	}
+
+	sink, err := newJSONLOutput(run, cfg.TargetPath, cfg.Partition)
+	if err != nil {
+		return err
+	}
+
+	source := newSource(XMLReadType, func(ctx context.Context, w record.Writer) error {
+		return readXML(ctx, cfg.SourcePath, records, fields, w)
+	})
+	source.path = cfg.SourcePath
+	stats, err := runPipeline(ctx, run, nil, source, sink)
+	if err != nil {
+		return err
+	}
+
+	run.Log.Printf("read %d records into %s", stats.Written(), cfg.TargetPath)
+	return nil
+}
+
+func readXML(ctx context.Context, path string, records xmlPath, fields map[string]xmlPath, w record.Writer) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := xml.NewDecoder(bufio.NewReader(file))
+	decoder.CharsetReader = xmlCharsetReader
+
+	// stack holds the open elements down to the current one.
+	var stack []xml.StartElement
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", xmlLine(decoder), err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Copy())
+			if !records.matchStack(stack) {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			node, err := decodeXMLNode(decoder, t)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", xmlLine(decoder), err)
+			}
+			stack = stack[:len(stack)-1]
+
+			var r map[string]any
+			if len(fields) > 0 {
+				r = node.selectFields(fields)
+			} else {
+				r = node.toRecord()
+			}
+			if err := w.Write(r); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return nil
+}
+
+func xmlLine(decoder *xml.Decoder) int {
+	line, _ := decoder.InputPos()
+	return line
+}
+
+// xmlCharsetReader decodes the Latin-1 documents still common in older
+// feeds. encoding/xml handles UTF-8 itself.
+func xmlCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "latin-1", "us-ascii":
+		return &latin1Reader{r: bufio.NewReader(input)}, nil
+	}
+	return nil, fmt.Errorf("unsupported charset %q", charset)
+}
+
+type latin1Reader struct {
+	r       *bufio.Reader
+	pending []byte
+}
+
+func (l *latin1Reader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(l.pending) > 0 {
+			c := copy(p[n:], l.pending)
+			l.pending = l.pending[c:]
+			n += c
+			continue
+		}
+
+		b, err := l.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		if b < utf8.RuneSelf {
+			p[n] = b
+			n++
+			continue
+		}
+		l.pending = utf8.AppendRune(nil, rune(b))
+	}
+	return n, nil
+}
+
+// xmlStep is a step of a path. An empty space matches any namespace and a
+// "*" local name any element.
+type xmlStep struct {
+	space, local string
+	// pred is an attribute the element must have, with value unless nil.
+	pred  *xml.Name
+	value *string
+}
+
+// xmlPath is a parsed XPath-like expression.
+type xmlPath struct {
+	steps []xmlStep
+	// descendant is set by a leading "//", the steps then match at any
+	// depth.
+	descendant bool
+	// attr selects an attribute of the elements the steps match.
+	attr *xml.Name
+	// self selects the text of the context element, "." in a field path.
+	self bool
+}
+
+var xmlStepPattern = regexp.MustCompile(`^([A-Za-z_][\w.-]*:)?([A-Za-z_][\w.-]*|\*)(?:\[@([A-Za-z_][\w.-]*:)?([A-Za-z_][\w.-]*)(?:=(?:'([^']*)'|"([^"]*)"))?\])?$`)
+
+var xmlAttrPattern = regexp.MustCompile(`^@([A-Za-z_][\w.-]*:)?([A-Za-z_][\w.-]*)$`)
+
+func parseXMLPath(text string, namespaces map[string]string, relative bool) (xmlPath, error) {
+	var p xmlPath
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return p, errors.New("path is empty")
+	}
+	if relative && text == "." {
+		p.self = true
+		return p, nil
+	}
+
+	switch {
+	case relative && strings.HasPrefix(text, "/"):
+		return p, fmt.Errorf("path %q must be relative to the record", text)
+	case !relative && strings.HasPrefix(text, "//"):
+		p.descendant = true
+		text = text[2:]
+	case !relative && strings.HasPrefix(text, "/"):
+		text = text[1:]
+	case !relative:
+		p.descendant = true
+	}
+
+	resolve := func(prefix string) (string, error) {
+		if prefix == "" {
+			return "", nil
+		}
+		prefix = strings.TrimSuffix(prefix, ":")
+		space, ok := namespaces[prefix]
+		if !ok {
+			return "", fmt.Errorf("unknown namespace prefix %q", prefix)
+		}
+		return space, nil
+	}
+
+	parts := strings.Split(text, "/")
+	for i, part := range parts {
+		if i == len(parts)-1 {
+			if m := xmlAttrPattern.FindStringSubmatch(part); m != nil {
+				space, err := resolve(m[1])
+				if err != nil {
+					return p, err
+				}
+				p.attr = &xml.Name{Space: space, Local: m[2]}
+				break
+			}
+		}
+
+		m := xmlStepPattern.FindStringSubmatch(part)
+		if m == nil {
+			return p, fmt.Errorf("invalid step %q in %q", part, text)
+		}
+
+		space, err := resolve(m[1])
+		if err != nil {
+			return p, err
+		}
+		step := xmlStep{space: space, local: m[2]}
+
+		if m[4] != "" {
+			predSpace, err := resolve(m[3])
+			if err != nil {
+				return p, err
+			}
+			step.pred = &xml.Name{Space: predSpace, Local: m[4]}
+			if strings.Contains(part, "=") {
+				value := m[5] + m[6]
+				step.value = &value
+			}
+		}
+		p.steps = append(p.steps, step)
+	}
+
+	if len(p.steps) == 0 && !relative {
+		return p, fmt.Errorf("path %q selects no element", text)
+	}
+	return p, nil
+}
+
+func (s xmlStep) match(e xml.StartElement) bool {
+	if s.local != "*" && s.local != e.Name.Local {
+		return false
+	}
+	if s.space != "" && s.space != e.Name.Space {
+		return false
+	}
+	if s.pred == nil {
+		return true
+	}
+
+	value, ok := xmlAttr(e.Attr, *s.pred)
+	return ok && (s.value == nil || *s.value == value)
+}
+
+func xmlAttr(attrs []xml.Attr, name xml.Name) (string, bool) {
+	for _, a := range attrs {
+		if a.Name.Local == name.Local && (name.Space == "" || a.Name.Space == name.Space) {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// matchStack reports whether the innermost open element is selected.
+func (p xmlPath) matchStack(stack []xml.StartElement) bool {
+	if len(stack) < len(p.steps) || (!p.descendant && len(stack) != len(p.steps)) {
+		return false
+	}
+
+	offset := len(stack) - len(p.steps)
+	for i, step := range p.steps {
+		if !step.match(stack[offset+i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// xmlNode is an element of a record.
+type xmlNode struct {
+	start    xml.StartElement
+	children []*xmlNode
+	text     strings.Builder
+}
+
+// decodeXMLNode reads the element opened by start up to its end.
+func decodeXMLNode(decoder *xml.Decoder, start xml.StartElement) (*xmlNode, error) {
+	node := &xmlNode{start: start.Copy()}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			child, err := decodeXMLNode(decoder, t)
+			if err != nil {
+				return nil, err
+			}
+			node.children = append(node.children, child)
+		case xml.CharData:
+			node.text.Write(t)
+		case xml.EndElement:
+			return node, nil
+		}
+	}
+}
+
+func (n *xmlNode) textValue() string {
+	return strings.TrimSpace(n.text.String())
+}
+
+// find returns the descendants of n selected by steps.
+func (n *xmlNode) find(steps []xmlStep) []*xmlNode {
+	nodes := []*xmlNode{n}
+	for _, step := range steps {
+		var next []*xmlNode
+		for _, node := range nodes {
+			for _, child := range node.children {
+				if step.match(child.start) {
+					next = append(next, child)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// selectFields maps the record with explicit field paths. A field is the
+// first value its path selects, null when it selects nothing.
+func (n *xmlNode) selectFields(fields map[string]xmlPath) map[string]any {
+	record := make(map[string]any, len(fields))
+
+	for name, path := range fields {
+		record[name] = nil
+		if path.self {
+			record[name] = n.textValue()
+			continue
+		}
+
+		for _, node := range n.find(path.steps) {
+			if path.attr == nil {
+				record[name] = node.textValue()
+				break
+			}
+			if value, ok := xmlAttr(node.start.Attr, *path.attr); ok {
+				record[name] = value
+				break
+			}
+		}
+	}
+
+	return record
+}
+
+// toRecord maps an element to a record by convention.
+func (n *xmlNode) toRecord() map[string]any {
+	record := make(map[string]any)
+
+	for _, a := range n.start.Attr {
+		if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+			continue
+		}
+		record["@"+a.Name.Local] = a.Value
+	}
+
+	for _, child := range n.children {
+		name := child.start.Name.Local
+
+		var value any
+		if len(child.children) == 0 && len(child.start.Attr) == 0 {
+			value = child.textValue()
+		} else {
+			value = child.toRecord()
+		}
+
+		switch existing := record[name].(type) {
+		case nil:
+			record[name] = value
+		case []any:
+			record[name] = append(existing, value)
+		default:
+			record[name] = []any{existing, value}
+		}
+	}
+
+	if text := n.textValue(); text != "" {
+		record["#text"] = text
+	}
+	return record
+}
@@ -0,0 +1,149 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:bank="urn:example:bank">
+	<title>Transfers</title>
+	<entry type="post" bank:id="1">
+		<title>First</title>
+		<author><name>Chihiro</name><email>chihiro@example.com</email></author>
+		<link href="https://example.com/1"/>
+		<bank:amount currency="EUR">12.50</bank:amount>
+		<category>a</category>
+		<category>b</category>
+	</entry>
+	<entry type="draft" bank:id="2">
+		<title>Second</title>
+	</entry>
+	<archive>
+		<entry type="post" bank:id="3">
+			<title>Archived</title>
+		</entry>
+	</archive>
+</feed>`
+
+func TestXMLRead(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "feed.xml")
+	target := filepath.Join(dir, "feed.jsonl")
+	assert.NoError(t, os.WriteFile(source, []byte(testFeed), 0o644))
+
+	namespaces := map[string]string{
+		"atom": "http://www.w3.org/2005/Atom",
+		"bank": "urn:example:bank",
+	}
+
+	t.Run("explicit fields", func(t *testing.T) {
+		run, err := runTask(t, NewXMLRead(), XMLReadType, XMLReadConfig{
+			SourcePath: source,
+			TargetPath: target,
+			RecordPath: "/atom:feed/atom:entry",
+			Namespaces: namespaces,
+			Fields: map[string]string{
+				"id":       "@bank:id",
+				"title":    "atom:title",
+				"author":   "author/name",
+				"link":     "link/@href",
+				"amount":   "bank:amount",
+				"currency": "bank:amount/@currency",
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), *run.Record.RowsAffected)
+
+		lines := readLines(t, target)
+		assert.Equal(t, map[string]any{
+			"id":       "1",
+			"title":    "First",
+			"author":   "Chihiro",
+			"link":     "https://example.com/1",
+			"amount":   "12.50",
+			"currency": "EUR",
+		}, lines[0])
+		assert.Equal(t, "Second", lines[1]["title"])
+		assert.Nil(t, lines[1]["author"])
+	})
+
+	t.Run("descendants with a predicate", func(t *testing.T) {
+		run, err := runTask(t, NewXMLRead(), XMLReadType, XMLReadConfig{
+			SourcePath: source,
+			TargetPath: target,
+			RecordPath: "//entry[@type='post']",
+			Fields:     map[string]string{"title": "title"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), *run.Record.RowsAffected)
+
+		lines := readLines(t, target)
+		assert.Equal(t, "First", lines[0]["title"])
+		assert.Equal(t, "Archived", lines[1]["title"])
+	})
+
+	t.Run("fields by convention", func(t *testing.T) {
+		_, err := runTask(t, NewXMLRead(), XMLReadType, XMLReadConfig{
+			SourcePath: source,
+			TargetPath: target,
+			RecordPath: "/feed/entry[@bank:id='1']",
+			Namespaces: namespaces,
+		})
+		assert.NoError(t, err)
+
+		lines := readLines(t, target)
+		assert.Len(t, lines, 1)
+		assert.Equal(t, map[string]any{
+			"@type":    "post",
+			"@id":      "1",
+			"title":    "First",
+			"author":   map[string]any{"name": "Chihiro", "email": "chihiro@example.com"},
+			"link":     map[string]any{"@href": "https://example.com/1"},
+			"amount":   map[string]any{"@currency": "EUR", "#text": "12.50"},
+			"category": []any{"a", "b"},
+		}, lines[0])
+	})
+
+	t.Run("latin-1 documents", func(t *testing.T) {
+		latin1 := filepath.Join(dir, "latin1.xml")
+		data := append([]byte(`<?xml version="1.0" encoding="ISO-8859-1"?><rows><row>S`), 0xE3, 'o', ' ', 'P', 'a', 'u', 'l', 'o')
+		data = append(data, "</row></rows>"...)
+		assert.NoError(t, os.WriteFile(latin1, data, 0o644))
+
+		_, err := runTask(t, NewXMLRead(), XMLReadType, XMLReadConfig{
+			SourcePath: latin1,
+			TargetPath: target,
+			RecordPath: "/rows",
+			Fields:     map[string]string{"city": "row"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "São Paulo", readLines(t, target)[0]["city"])
+	})
+
+	t.Run("malformed documents report the line", func(t *testing.T) {
+		broken := filepath.Join(dir, "broken.xml")
+		assert.NoError(t, os.WriteFile(broken, []byte("<feed>\n<entry>\n<title>x</entry>\n</feed>"), 0o644))
+
+		_, err := runTask(t, NewXMLRead(), XMLReadType, XMLReadConfig{SourcePath: broken, TargetPath: target, RecordPath: "/feed/entry"})
+		assert.ErrorContains(t, err, "line 3")
+	})
+
+	t.Run("invalid paths", func(t *testing.T) {
+		for _, path := range []string{"/feed/@id", "/x:feed", "/feed/entry[type]", "/"} {
+			_, err := runTask(t, NewXMLRead(), XMLReadType, XMLReadConfig{SourcePath: source, TargetPath: target, RecordPath: path})
+			assert.Error(t, err, path)
+		}
+
+		_, err := runTask(t, NewXMLRead(), XMLReadType, XMLReadConfig{
+			SourcePath: source,
+			TargetPath: target,
+			RecordPath: "//entry",
+			Fields:     map[string]string{"title": "/feed/title"},
+		})
+		assert.ErrorContains(t, err, "must be relative")
+	})
+}
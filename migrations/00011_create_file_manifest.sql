@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS file_manifest (
+    id BIGSERIAL PRIMARY KEY,
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    run_id INTEGER REFERENCES task_runs(id) ON DELETE SET NULL,
+    path TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    mtime TIMESTAMP NOT NULL,
+    checksum VARCHAR(64) NOT NULL,
+    ingested_at TIMESTAMP DEFAULT now(),
+    UNIQUE(task_id, path)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE file_manifest;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS quality_results (
+    id BIGSERIAL PRIMARY KEY,
+    run_id INTEGER NOT NULL REFERENCES task_runs(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    check_type VARCHAR(32) NOT NULL,
+    severity VARCHAR(8) NOT NULL,
+    passed BOOLEAN NOT NULL,
+    failures BIGINT NOT NULL DEFAULT 0,
+    message TEXT NOT NULL DEFAULT '',
+    samples JSONB,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS quality_results_run_id_idx ON quality_results(run_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE quality_results;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tasks ADD COLUMN drift_policy VARCHAR(16) NOT NULL DEFAULT 'warn';
+ALTER TABLE task_runs ADD COLUMN schema JSONB;
+ALTER TABLE task_runs ADD COLUMN schema_drift JSONB;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE task_runs DROP COLUMN schema_drift;
+ALTER TABLE task_runs DROP COLUMN schema;
+ALTER TABLE tasks DROP COLUMN drift_policy;
+-- +goose StatementEnd
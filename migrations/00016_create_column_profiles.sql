@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS column_profiles (
+    id BIGSERIAL PRIMARY KEY,
+    run_id INTEGER NOT NULL REFERENCES task_runs(id) ON DELETE CASCADE,
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    column_name TEXT NOT NULL,
+    stats JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS column_profiles_run_id_idx ON column_profiles(run_id);
+CREATE INDEX IF NOT EXISTS column_profiles_task_id_column_idx ON column_profiles(task_id, column_name);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE column_profiles;
+-- +goose StatementEnd